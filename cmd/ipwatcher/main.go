@@ -1,385 +1,9 @@
+// Command ipwatcher keeps DNS records pointed at the current IP addresses of the host. The
+// daemon itself is the watcher package, which applications can embed.
 package main
 
-import (
-	"context"
-	"flag"
-	"fmt"
-	"log"
-	"os"
-	"os/signal"
-	"sync"
-	"sync/atomic"
-	"syscall"
-	"time"
-
-	"github.com/msyrus/ipwatcher/internal/config"
-	"github.com/msyrus/ipwatcher/internal/dnsmanager"
-	"github.com/msyrus/ipwatcher/internal/ipfetcher"
-)
-
-// version is set at build time via -ldflags "-X main.version=vX.Y.Z"
-var version = "dev"
-
-// IPWatcher manages the IP monitoring and DNS update process
-type IPWatcher struct {
-	config        *config.Config
-	ipFetcher     ipfetcher.Fetcher
-	providers     map[string]dnsmanager.DNSProvider
-	zoneCache     *sync.Map // zone name -> zone ID cache
-	currentIPv4   *atomic.Value
-	currentIPv6   *atomic.Value
-	refreshTicker *time.Ticker
-	syncTicker    *time.Ticker
-}
-
-// NewIPWatcher creates a new IP watcher instance
-func NewIPWatcher(ctx context.Context, cfg *config.Config, apiToken string) (*IPWatcher, error) {
-	return NewIPWatcherWithFetcher(ctx, cfg, apiToken, ipfetcher.NewIPFetcher())
-}
-
-// NewIPWatcherWithFetcher creates a new IP watcher instance with a custom IP fetcher
-func NewIPWatcherWithFetcher(ctx context.Context, cfg *config.Config, apiToken string, fetcher ipfetcher.Fetcher) (*IPWatcher, error) {
-	providers := make(map[string]dnsmanager.DNSProvider)
-
-	// Determine which providers are needed
-	cloudflareNeeded := false
-	route53Needed := false
-	for _, d := range cfg.Domains {
-		switch d.Provider {
-		case "cloudflare":
-			cloudflareNeeded = true
-		case "route53":
-			route53Needed = true
-		}
-	}
-
-	// Initialize Cloudflare provider if needed
-	if cloudflareNeeded {
-		if apiToken == "" {
-			return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN environment variable is required when using the cloudflare provider")
-		}
-		cfProvider, err := dnsmanager.NewCloudflareProvider(apiToken)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Cloudflare provider: %w", err)
-		}
-		providers["cloudflare"] = cfProvider
-	}
-
-	// Initialize Route53 provider if needed
-	if route53Needed {
-		r53Provider, err := dnsmanager.NewRoute53Provider(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Route53 provider: %w", err)
-		}
-		providers["route53"] = r53Provider
-	}
-
-	return &IPWatcher{
-		config:      cfg,
-		ipFetcher:   fetcher,
-		providers:   providers,
-		zoneCache:   &sync.Map{},
-		currentIPv4: &atomic.Value{},
-		currentIPv6: &atomic.Value{},
-	}, nil
-}
-
-// NewIPWatcherWithDeps creates a new IP watcher with fully injected dependencies for testing
-func NewIPWatcherWithDeps(cfg *config.Config, fetcher ipfetcher.Fetcher, providers map[string]dnsmanager.DNSProvider) *IPWatcher {
-	return &IPWatcher{
-		config:      cfg,
-		ipFetcher:   fetcher,
-		providers:   providers,
-		zoneCache:   &sync.Map{},
-		currentIPv4: &atomic.Value{},
-		currentIPv6: &atomic.Value{},
-	}
-}
-
-// Run starts the IP watcher daemon
-func (w *IPWatcher) Run(ctx context.Context) error {
-	log.Println("Starting IP Watcher daemon...")
-
-	// Initial IP fetch
-	if err := w.FetchAndUpdateIPs(ctx); err != nil {
-		log.Printf("Warning: Initial IP fetch failed: %v", err)
-	}
-
-	// Create tickers for refresh and sync
-	refreshInterval := time.Duration(float64(time.Second) / w.config.RefreshRate)
-	syncInterval := time.Duration(float64(time.Minute) / w.config.SyncRate)
-
-	w.refreshTicker = time.NewTicker(refreshInterval)
-	defer w.refreshTicker.Stop()
-
-	w.syncTicker = time.NewTicker(syncInterval)
-	defer w.syncTicker.Stop()
-
-	log.Printf("Refresh interval: %v (%.2f times per second)", refreshInterval, w.config.RefreshRate)
-	log.Printf("Sync interval: %v (%.2f times per minute)", syncInterval, w.config.SyncRate)
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Shutting down IP Watcher daemon...")
-			return ctx.Err()
-
-		case <-w.refreshTicker.C:
-			if err := w.CheckAndUpdateIP(ctx); err != nil {
-				log.Printf("Error checking IP: %v", err)
-			}
-
-		case <-w.syncTicker.C:
-			if err := w.VerifyDNSRecords(ctx); err != nil {
-				log.Printf("Error verifying DNS records: %v", err)
-			}
-		}
-	}
-}
-
-// FetchAndUpdateIPs fetches current IPs and updates DNS if needed
-func (w *IPWatcher) FetchAndUpdateIPs(ctx context.Context) error {
-	// Fetch IPv4
-	ipv4, err := w.ipFetcher.GetIPv4(ctx)
-	if err != nil {
-		log.Printf("Failed to fetch IPv4: %v", err)
-	} else {
-		w.currentIPv4.Store(ipv4)
-		log.Printf("Current IPv4: %s", ipv4)
-	}
-
-	// Fetch IPv6
-	if w.config.SupportsIPv6 {
-		ipv6, err := w.ipFetcher.GetIPv6(ctx)
-		if err != nil {
-			log.Printf("Failed to fetch IPv6: %v", err)
-		} else {
-			w.currentIPv6.Store(ipv6)
-			log.Printf("Current IPv6: %s", ipv6)
-		}
-	}
-
-	// Update DNS records
-	return w.UpdateAllDNSRecords(ctx)
-}
-
-// CheckAndUpdateIP checks if IP has changed and updates DNS if needed
-func (w *IPWatcher) CheckAndUpdateIP(ctx context.Context) error {
-	oldIPv4, _ := w.currentIPv4.Load().(string)
-	oldIPv6, _ := w.currentIPv6.Load().(string)
-
-	// Fetch current IPs
-	newIPv4, err := w.ipFetcher.GetIPv4(ctx)
-	if err != nil {
-		log.Printf("Failed to fetch IPv4: %v", err)
-	}
-
-	newIPv6 := ""
-	if w.config.SupportsIPv6 {
-		newIPv6, err = w.ipFetcher.GetIPv6(ctx)
-		if err != nil {
-			// IPv6 might not be available, just log it
-			log.Printf("Failed to fetch IPv6: %v", err)
-		}
-	}
-
-	// Check if IPs have changed
-	ipv4Changed := newIPv4 != oldIPv4 && newIPv4 != ""
-	ipv6Changed := newIPv6 != oldIPv6 && newIPv6 != ""
-
-	if ipv4Changed {
-		log.Printf("IPv4 changed: %s -> %s", oldIPv4, newIPv4)
-		w.currentIPv4.Store(newIPv4)
-	}
-	if ipv6Changed {
-		log.Printf("IPv6 changed: %s -> %s", oldIPv6, newIPv6)
-		w.currentIPv6.Store(newIPv6)
-	}
-	if ipv4Changed || ipv6Changed {
-		// Reset sync ticker if it's running (initialized in Run())
-		if w.syncTicker != nil {
-			w.syncTicker.Reset(time.Duration(float64(time.Minute) / w.config.SyncRate))
-		}
-
-		return w.UpdateAllDNSRecords(ctx)
-	}
-
-	return nil
-}
-
-// GetZoneID retrieves the zone ID for a domain, using cache if available
-func (w *IPWatcher) GetZoneID(ctx context.Context, zoneName, providerType string) (string, error) {
-	cacheKey := providerType + ":" + zoneName
-	zoneID, exists := w.zoneCache.Load(cacheKey)
-
-	if exists {
-		return zoneID.(string), nil
-	}
-
-	provider, ok := w.providers[providerType]
-	if !ok {
-		return "", fmt.Errorf("unsupported provider: %s", providerType)
-	}
-
-	// Fetch zone ID from provider
-	zID, err := provider.GetZoneIDByName(ctx, zoneName)
-	if err != nil {
-		return "", err
-	}
-
-	// Cache it
-	w.zoneCache.Store(cacheKey, zID)
-
-	return zID, nil
-}
-
-// UpdateAllDNSRecords updates DNS records for all configured domains
-func (w *IPWatcher) UpdateAllDNSRecords(ctx context.Context) error {
-	ipv4, _ := w.currentIPv4.Load().(string)
-	ipv6, _ := w.currentIPv6.Load().(string)
-
-	var lastErr error
-	for _, domain := range w.config.Domains {
-		provider, ok := w.providers[domain.Provider]
-		if !ok {
-			log.Printf("Unsupported provider %s for domain %s", domain.Provider, domain.ZoneName)
-			continue
-		}
-
-		// Get zone ID
-		zoneID, err := w.GetZoneID(ctx, domain.ZoneName, domain.Provider)
-		if err != nil {
-			log.Printf("Failed to get zone ID for %s (%s): %v", domain.ZoneName, domain.Provider, err)
-			lastErr = err
-			continue
-		}
-
-		// Convert config records to DNS manager records
-		var dnsRecords []dnsmanager.DNSRecord
-		for _, record := range domain.Records {
-			dnsRecords = append(dnsRecords, dnsmanager.DNSRecord{
-				Root:    domain.ZoneName,
-				Name:    record.Name,
-				Type:    dnsmanager.DNSRecordType(record.Type),
-				Proxied: record.Proxied,
-			})
-		}
-
-		// Use EnsureDNSRecords to batch create/update
-		if err := provider.EnsureDNSRecords(ctx, zoneID, dnsRecords, ipv4, ipv6); err != nil {
-			log.Printf("Failed to ensure DNS records for %s (%s): %v", domain.ZoneName, domain.Provider, err)
-			lastErr = err
-		} else {
-			log.Printf("DNS records for %s (%s) updated successfully", domain.ZoneName, domain.Provider)
-		}
-	}
-
-	return lastErr
-}
-
-// VerifyDNSRecords verifies that all DNS records are up-to-date
-func (w *IPWatcher) VerifyDNSRecords(ctx context.Context) error {
-	ipv4, _ := w.currentIPv4.Load().(string)
-	ipv6, _ := w.currentIPv6.Load().(string)
-
-	log.Println("Verifying DNS records...")
-
-	var lastErr error
-	for _, domain := range w.config.Domains {
-		provider, ok := w.providers[domain.Provider]
-		if !ok {
-			log.Printf("Unsupported provider %s for domain %s", domain.Provider, domain.ZoneName)
-			continue
-		}
-
-		// Get zone ID
-		zoneID, err := w.GetZoneID(ctx, domain.ZoneName, domain.Provider)
-		if err != nil {
-			log.Printf("Failed to get zone ID for %s (%s): %v", domain.ZoneName, domain.Provider, err)
-			lastErr = err
-			continue
-		}
-
-		// Convert config records to DNS manager records
-		var dnsRecords []dnsmanager.DNSRecord
-		for _, record := range domain.Records {
-			dnsRecords = append(dnsRecords, dnsmanager.DNSRecord{
-				Root:    domain.ZoneName,
-				Name:    record.Name,
-				Type:    dnsmanager.DNSRecordType(record.Type),
-				Proxied: record.Proxied,
-			})
-		}
-
-		// Use EnsureDNSRecords which will update only if needed
-		if err := provider.EnsureDNSRecords(ctx, zoneID, dnsRecords, ipv4, ipv6); err != nil {
-			log.Printf("Failed to verify/update DNS records for %s (%s): %v", domain.ZoneName, domain.Provider, err)
-			lastErr = err
-		} else {
-			log.Printf("DNS records for %s (%s) are up-to-date", domain.ZoneName, domain.Provider)
-		}
-	}
-
-	return lastErr
-}
-
-// Execute is the main entry point for running the IP watcher daemon
-// It loads configuration, creates the watcher, and runs it until interrupted
-func Execute(configFile, apiToken string) error {
-	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	// Create signal handling context
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Create IP watcher
-	watcher, err := NewIPWatcher(ctx, cfg, apiToken)
-	if err != nil {
-		return fmt.Errorf("failed to create IP watcher: %w", err)
-	}
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("Received shutdown signal")
-		cancel()
-	}()
-
-	// Run the watcher
-	if err := watcher.Run(ctx); err != nil && err != context.Canceled {
-		return fmt.Errorf("IP watcher error: %w", err)
-	}
-
-	log.Println("IP Watcher daemon stopped")
-	return nil
-}
+import "github.com/msyrus/ipwatcher/watcher"
 
 func main() {
-	showVersion := flag.Bool("version", false, "Print version and exit")
-	flag.Parse()
-
-	if *showVersion {
-		fmt.Println(version)
-		return
-	}
-
-	// Load configuration file path
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile == "" {
-		configFile = "config.yaml"
-	}
-
-	// Get Cloudflare API token
-	apiToken := os.Getenv("CLOUDFLARE_API_TOKEN")
-
-	// Execute the daemon
-	if err := Execute(configFile, apiToken); err != nil {
-		log.Fatalf("Error: %v", err)
-	}
+	watcher.Main()
 }
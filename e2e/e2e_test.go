@@ -0,0 +1,1092 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/jobs"
+)
+
+// End-to-end tests run the ipwatcher binary against local fakes only:
+// - IP sources are HTTP servers answering with a scripted address
+// - DNS is the exec provider, pointed at this test binary, which logs every record it is asked to push
+// - notifications go to a local webhook
+// Run with: go test -v -tags=e2e ./e2e/
+
+const (
+	providerLogEnv  = "IPWATCHER_E2E_PROVIDER_LOG"  // Makes this binary act as the exec provider command, appending to the file
+	providerFailEnv = "IPWATCHER_E2E_PROVIDER_FAIL" // The provider command fails while this file exists
+
+	waitTimeout = 15 * time.Second
+)
+
+var binary string
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(providerLogEnv); path != "" {
+		os.Exit(fakeProvider(path, os.Args[1:]))
+	}
+
+	dir, err := os.MkdirTemp("", "ipwatcher-e2e")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create build directory: %v\n", err)
+		os.Exit(1)
+	}
+	binary = filepath.Join(dir, "ipwatcher")
+	build := exec.Command("go", "build", "-o", binary, "../cmd/ipwatcher")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build ipwatcher: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeProvider records one push of <fqdn> <type> <ip> as a line of the log at path
+func fakeProvider(path string, args []string) int {
+	if fail := os.Getenv(providerFailEnv); fail != "" {
+		if _, err := os.Stat(fail); err == nil {
+			fmt.Fprintln(os.Stderr, "fake provider unavailable")
+			return 1
+		}
+	}
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "expected <fqdn> <type> <ip>, got %q\n", args)
+		return 2
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, strings.Join(args, " ")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// ipSource is an echo endpoint whose answer the test controls
+type ipSource struct {
+	*httptest.Server
+	ip       atomic.Value
+	requests atomic.Int64
+}
+
+func newIPSource(t *testing.T, ip string) *ipSource {
+	s := &ipSource{}
+	s.Set(ip)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		fmt.Fprintln(w, s.ip.Load().(string))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Set changes the address the source answers with
+func (s *ipSource) Set(ip string) {
+	s.ip.Store(ip)
+}
+
+// webhook collects the events of the notifications it receives
+type webhook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []string
+}
+
+func newWebhook(t *testing.T) *webhook {
+	h := &webhook{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n struct {
+			Event string `json:"event"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		h.events = append(h.events, n.Event)
+		h.mu.Unlock()
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *webhook) received(event string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// env is the working directory of one daemon: its config, provider log and state files
+type env struct {
+	t   *testing.T
+	dir string
+}
+
+func newEnv(t *testing.T) *env {
+	return &env{t: t, dir: t.TempDir()}
+}
+
+func (e *env) path(name string) string {
+	return filepath.Join(e.dir, name)
+}
+
+// config writes the config built from body plus the exec block pointing at the fake provider
+func (e *env) config(body string) {
+	e.t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		e.t.Fatalf("failed to locate test binary: %v", err)
+	}
+	cfg := fmt.Sprintf("refresh_rate: 20\nsync_rate: 600\nexec:\n  command: %q\n  timeout: 5s\n%s", self, body)
+	if err := os.WriteFile(e.path("config.yaml"), []byte(cfg), 0600); err != nil {
+		e.t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+// pushes returns the records the fake provider was asked to push, in order
+func (e *env) pushes() []string {
+	data, err := os.ReadFile(e.path("provider.log"))
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func (e *env) count(push string) int {
+	n := 0
+	for _, p := range e.pushes() {
+		if p == push {
+			n++
+		}
+	}
+	return n
+}
+
+// daemon is a running ipwatcher process
+type daemon struct {
+	t    *testing.T
+	cmd  *exec.Cmd
+	out  *syncBuffer
+	done chan error
+}
+
+// start runs the daemon in e with args until the test ends or stop is called
+func (e *env) start(args ...string) *daemon {
+	e.t.Helper()
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = e.dir
+	cmd.Env = append(os.Environ(),
+		"CONFIG_FILE="+e.path("config.yaml"),
+		providerLogEnv+"="+e.path("provider.log"),
+		providerFailEnv+"="+e.path("provider.fail"),
+	)
+	d := &daemon{t: e.t, cmd: cmd, out: &syncBuffer{}, done: make(chan error, 1)}
+	cmd.Stdout, cmd.Stderr = d.out, d.out
+	if err := cmd.Start(); err != nil {
+		e.t.Fatalf("failed to start ipwatcher: %v", err)
+	}
+	go func() { d.done <- cmd.Wait() }()
+
+	e.t.Cleanup(func() {
+		if d.cmd.ProcessState == nil {
+			d.cmd.Process.Kill()
+			<-d.done
+		}
+		if e.t.Failed() {
+			e.t.Logf("ipwatcher output:\n%s", d.out)
+		}
+	})
+	return d
+}
+
+// stop sends SIGTERM and waits for a clean exit
+func (d *daemon) stop() {
+	d.t.Helper()
+	if err := d.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		d.t.Fatalf("failed to signal ipwatcher: %v", err)
+	}
+	select {
+	case err := <-d.done:
+		if err != nil {
+			d.t.Fatalf("ipwatcher exited with %v", err)
+		}
+	case <-time.After(waitTimeout):
+		d.t.Fatal("ipwatcher did not stop after SIGTERM")
+	}
+}
+
+// logged reports whether the daemon printed a line containing s
+func (d *daemon) logged(s string) bool {
+	return strings.Contains(d.out.String(), s)
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond until it holds, failing the test with what after waitTimeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestE2E_ChangeDetection(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: "@"
+        type: A
+      - name: www
+        type: A
+`, source.URL))
+
+	d := e.start()
+	waitFor(t, "initial records", func() bool {
+		return e.count("example.com A 203.0.113.10") == 1 && e.count("www.example.com A 203.0.113.10") == 1
+	})
+
+	source.Set("203.0.113.20")
+	waitFor(t, "updated records", func() bool {
+		return e.count("example.com A 203.0.113.20") == 1 && e.count("www.example.com A 203.0.113.20") == 1
+	})
+
+	// Later refreshes see the same address and push nothing
+	seen := source.requests.Load()
+	waitFor(t, "further refreshes", func() bool { return source.requests.Load() >= seen+5 })
+	d.stop()
+
+	if got := len(e.pushes()); got != 4 {
+		t.Errorf("expected 4 pushes, got %d: %q", got, e.pushes())
+	}
+}
+
+func TestE2E_HoldWhileSourcesDisagree(t *testing.T) {
+	primary := newIPSource(t, "203.0.113.10")
+	secondary := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_source_policy: hold
+ip_sources:
+  - url: %s
+    family: ipv4
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, primary.URL, secondary.URL))
+
+	d := e.start()
+	waitFor(t, "initial record", func() bool { return e.count("home.example.com A 203.0.113.10") == 1 })
+
+	// A flapping source alone does not move the record
+	primary.Set("203.0.113.20")
+	seen := secondary.requests.Load()
+	waitFor(t, "refreshes while sources disagree", func() bool { return secondary.requests.Load() >= seen+5 })
+	if n := e.count("home.example.com A 203.0.113.20"); n != 0 {
+		t.Fatalf("expected the record to be held while sources disagree, got %d pushes of the new address", n)
+	}
+
+	secondary.Set("203.0.113.20")
+	waitFor(t, "record update once sources agree", func() bool { return e.count("home.example.com A 203.0.113.20") == 1 })
+	d.stop()
+}
+
+func TestE2E_JobJournal(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`job_queue_file: %s
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, e.path("jobs.json"), source.URL))
+
+	// A job of a zone that is no longer configured, left by an earlier run
+	journal := jobs.NewJournal(e.path("jobs.json"))
+	if err := journal.Begin(jobs.Job{Key: "stale", Zone: "gone.example.com", Provider: "exec"}, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to seed job file: %v", err)
+	}
+	if err := os.WriteFile(e.path("provider.fail"), nil, 0600); err != nil {
+		t.Fatalf("failed to break provider: %v", err)
+	}
+
+	d := e.start()
+	waitFor(t, "stale job pruned", func() bool {
+		return d.logged(`msg="Dropping pending DNS update not retried by the initial update" module=sync zone=gone.example.com`)
+	})
+	pending, err := journal.Pending()
+	if err != nil {
+		t.Fatalf("failed to read job file: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Zone != "example.com" || pending[0].LastError == "" {
+		t.Fatalf("expected the failed update of example.com to stay pending, got %+v", pending)
+	}
+	d.stop()
+
+	// The next run resumes the failed update and clears the journal
+	if err := os.Remove(e.path("provider.fail")); err != nil {
+		t.Fatalf("failed to repair provider: %v", err)
+	}
+	d = e.start()
+	waitFor(t, "pending update applied", func() bool { return e.count("home.example.com A 203.0.113.10") == 1 })
+	waitFor(t, "pending jobs finished", func() bool {
+		pending, err := journal.Pending()
+		return err == nil && len(pending) == 0
+	})
+	d.stop()
+
+	if !d.logged(`msg="Resuming DNS update" module=sync zone=example.com provider=exec`) {
+		t.Error("expected the interrupted update to be reported on restart")
+	}
+}
+
+func TestE2E_Notifications(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	hook := newWebhook(t)
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`notifications:
+  webhook_url: %s
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, hook.URL, source.URL))
+
+	d := e.start()
+	waitFor(t, "start notification", func() bool { return hook.received("start") })
+	d.stop()
+
+	if !hook.received("shutdown") {
+		t.Error("expected a shutdown notification")
+	}
+}
+
+func TestE2E_ValidateOnlineDeep(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: www
+        type: A
+`, source.URL))
+
+	cmd := exec.Command(binary, "validate", "--online", "--deep", e.path("config.yaml"))
+	cmd.Env = append(os.Environ(), providerLogEnv+"="+e.path("provider.log"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("validate failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"PASS zone example.com (exec)", "~ www.example.com A 203.0.113.10", "a sync would make 1 change in 1 zone", "is valid"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+	if pushes := e.pushes(); len(pushes) > 0 {
+		t.Errorf("expected validate to change nothing, got pushes %q", pushes)
+	}
+
+	// --deep only makes sense against the live providers
+	if out, err := exec.Command(binary, "validate", "--deep", e.path("config.yaml")).CombinedOutput(); err == nil {
+		t.Errorf("expected --deep without --online to fail:\n%s", out)
+	}
+}
+
+func TestE2E_ValidateOnlineReport(t *testing.T) {
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/user/tokens/verify":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"token-1","status":"active"}}`)
+		case "/zones":
+			// lab.example.com is delegated to a zone of its own
+			zones := map[string]string{"example.com": "zone-1", "lab.example.com": "zone-2"}
+			result, count := "[]", 0
+			if id, ok := zones[r.URL.Query().Get("name")]; ok {
+				result, count = fmt.Sprintf(`[{"id":%q,"name":%q}]`, id, r.URL.Query().Get("name")), 1
+			}
+			fmt.Fprintf(w, `{"success":true,"errors":[],"messages":[],"result":%s,"result_info":{"page":1,"per_page":20,"count":%d,"total_count":%d}}`, result, count, count)
+		case "/zones/zone-1/dns_records":
+			// The client pages until a page comes back empty
+			if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+				fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[],"result_info":{"page":1,"per_page":100,"count":0,"total_count":0}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cloudflare.Close()
+
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    records:
+      - name: www
+        type: A
+      - name: host.lab
+        type: A
+`, source.URL))
+
+	cmd := exec.Command(binary, "validate", "--online", e.path("config.yaml"))
+	cmd.Env = append(os.Environ(), "CLOUDFLARE_API_TOKEN=test-token", "CLOUDFLARE_BASE_URL="+cloudflare.URL)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected validate to fail for a record of a delegated zone:\n%s", out)
+	}
+	for _, want := range []string{
+		"PASS cloudflare credentials for example.com",
+		"PASS zone example.com (cloudflare)",
+		"PASS records of example.com (cloudflare)",
+		"PASS record www.example.com (cloudflare)",
+		"FAIL record host.lab.example.com (cloudflare): name is inside zone lab.example.com, not example.com",
+		"1 of 5 checks failed",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+}
+
+func TestE2E_Import(t *testing.T) {
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/zones":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[{"id":"zone-1","name":"example.com"}],"result_info":{"page":1,"per_page":20,"count":1,"total_count":1}}`)
+		case "/zones/zone-1/dns_records":
+			// The client pages until a page comes back empty
+			if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+				fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[
+				{"id":"r1","name":"example.com","type":"A","content":"203.0.113.10","proxied":true,"ttl":1},
+				{"id":"r2","name":"vpn.example.com","type":"AAAA","content":"2001:db8::10","proxied":false,"ttl":300},
+				{"id":"r3","name":"example.com","type":"MX","content":"mail.example.com","proxied":false,"ttl":1}
+			],"result_info":{"page":1,"per_page":100,"count":3,"total_count":3}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cloudflare.Close()
+
+	cmd := exec.Command(binary, "import", "--zone", "example.com")
+	cmd.Env = append(os.Environ(), "CLOUDFLARE_API_TOKEN=test-token", "CLOUDFLARE_BASE_URL="+cloudflare.URL)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("import failed: %v\n%s", err, out)
+	}
+	want := `domains:
+  - zone_name: example.com
+    provider: cloudflare
+    records:
+      - name: "@"
+        type: A # currently 203.0.113.10
+        proxied: true
+      - name: "vpn"
+        type: AAAA # currently 2001:db8::10
+        ttl: 300
+`
+	if string(out) != want {
+		t.Errorf("unexpected import:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestE2E_Commands(t *testing.T) {
+	out, err := exec.Command(binary, "help").CombinedOutput()
+	if err != nil {
+		t.Fatalf("help failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"run ", "validate ", "import ", "version ", "-config", "-log-level"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the usage:\n%s", want, out)
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if out, err := exec.Command(binary, "frobnicate").CombinedOutput(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Errorf("expected an unknown command to exit with 2, got %v:\n%s", err, out)
+	}
+
+	// The shared flags work before and after the command
+	e := newEnv(t)
+	e.config(`domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: www
+        type: A
+`)
+	for _, args := range [][]string{
+		{"validate", "--config", e.path("config.yaml")},
+		{"--config", e.path("config.yaml"), "--log-level", "warn", "validate"},
+	} {
+		out, err := exec.Command(binary, args...).CombinedOutput()
+		if err != nil || !strings.Contains(string(out), e.path("config.yaml")+" is valid") {
+			t.Errorf("ipwatcher %s: expected the config to be valid, got %v:\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if out, err := exec.Command(binary, "validate", "--log-level", "loud", "--config", e.path("config.yaml")).CombinedOutput(); err == nil {
+		t.Errorf("expected an unknown log level to fail:\n%s", out)
+	}
+}
+
+func TestE2E_Once(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+
+	once := func() (int, string) {
+		cmd := exec.Command(binary, "once", "--config", e.path("config.yaml"))
+		cmd.Env = append(os.Environ(), providerLogEnv+"="+e.path("provider.log"), providerFailEnv+"="+e.path("provider.fail"))
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			t.Fatalf("failed to run once: %v", err)
+		}
+		return cmd.ProcessState.ExitCode(), string(out)
+	}
+
+	if code, out := once(); code != 1 || e.count("home.example.com A 203.0.113.10") != 1 {
+		t.Errorf("expected the record to be pushed and exit code 1, got %d:\n%s", code, out)
+	}
+
+	if err := os.WriteFile(e.path("provider.fail"), nil, 0600); err != nil {
+		t.Fatalf("failed to break provider: %v", err)
+	}
+	if code, out := once(); code != 2 {
+		t.Errorf("expected a failing provider to exit with 2, got %d:\n%s", code, out)
+	}
+}
+
+func TestE2E_OutputJSON(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(`domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: TXT
+`)
+
+	var report struct {
+		Valid    bool `json:"valid"`
+		Problems []struct {
+			Path    string `json:"path"`
+			Message string `json:"message"`
+		} `json:"problems"`
+	}
+	out, err := exec.Command(binary, "validate", "--output", "json", "--config", e.path("config.yaml")).Output()
+	if err == nil {
+		t.Errorf("expected an invalid config to fail")
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatalf("expected a JSON report, got %v:\n%s", err, out)
+	}
+	if report.Valid || len(report.Problems) != 1 || report.Problems[0].Path != "domains[0].records[0].type" {
+		t.Errorf("expected one problem with the record type, got %+v", report)
+	}
+
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	cmd := exec.Command(binary, "once", "--output", "json", "--config", e.path("config.yaml"))
+	cmd.Env = append(os.Environ(), providerLogEnv+"="+e.path("provider.log"))
+	out, err = cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("expected once to exit with 1, got %v", err)
+	}
+	var once struct {
+		ExitCode int    `json:"exit_code"`
+		Changes  int    `json:"changes"`
+		IPv4     string `json:"ipv4"`
+	}
+	if err := json.Unmarshal(out, &once); err != nil {
+		t.Fatalf("expected a JSON report, got %v:\n%s", err, out)
+	}
+	if once.ExitCode != 1 || once.Changes != 1 || once.IPv4 != "203.0.113.10" {
+		t.Errorf("expected one change for 203.0.113.10, got %+v", once)
+	}
+}
+
+func TestE2E_Status(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`control_socket: %s
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, e.path("control.sock"), source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+	waitFor(t, "the control socket", func() bool { return d.logged("Control socket listening") })
+
+	out, err := exec.Command(binary, "status", "--config", e.path("config.yaml"), "--output", "json").Output()
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, out)
+	}
+	var status struct {
+		IPv4      string    `json:"ipv4"`
+		NextCheck time.Time `json:"next_check"`
+		Zones     []struct {
+			Zone string `json:"zone"`
+			OK   bool   `json:"ok"`
+		} `json:"zones"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		t.Fatalf("expected a JSON status, got %v:\n%s", err, out)
+	}
+	if status.IPv4 != "203.0.113.10" || status.NextCheck.IsZero() || len(status.Zones) != 1 || !status.Zones[0].OK {
+		t.Errorf("expected the IP, the next check and a synced zone, got %s", out)
+	}
+
+	out, err = exec.Command(binary, "status", "--socket", e.path("control.sock")).CombinedOutput()
+	for _, want := range []string{"IPv4:        203.0.113.10", "example.com (exec): ok"} {
+		if err != nil || !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the status, got %v:\n%s", want, err, out)
+		}
+	}
+	d.stop()
+}
+
+func TestE2E_JSONLogs(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	d := e.start("-log-format", "json", "-log-output", e.path("ipwatcher.log"))
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+	d.stop()
+
+	data, err := os.ReadFile(e.path("ipwatcher.log"))
+	if err != nil {
+		t.Fatalf("expected the log file to be written: %v", err)
+	}
+	var sawIP, sawZone bool
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected a JSON log line, got %v: %s", err, line)
+		}
+		if entry["level"] == nil || entry["msg"] == nil || entry["time"] == nil {
+			t.Errorf("expected time, level and msg in every line, got %s", line)
+		}
+		sawIP = sawIP || entry["msg"] == "Current IP" && entry["ip"] == "203.0.113.10" && entry["family"] == "ipv4"
+		sawZone = sawZone || entry["zone"] == "example.com" && entry["provider"] == "exec"
+	}
+	if !sawIP || !sawZone {
+		t.Errorf("expected the IP and zone as fields, got:\n%s", data)
+	}
+	if d.out.String() != "" {
+		t.Errorf("expected nothing on standard error with -log-output, got:\n%s", d.out)
+	}
+}
+
+func TestE2E_ModuleLogLevels(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`log_level: warn,ip=info
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+	waitFor(t, "the IP to be logged", func() bool { return d.logged("module=ip") })
+	d.stop()
+
+	out := d.out.String()
+	if !strings.Contains(out, `msg="Current IP" module=ip family=ipv4 ip=203.0.113.10`) {
+		t.Errorf("expected the IP at info with ip=info, got:\n%s", out)
+	}
+	for _, quiet := range []string{"Starting IP Watcher daemon", `msg="DNS records`} {
+		if strings.Contains(out, quiet) {
+			t.Errorf("expected %q to be left out at warn, got:\n%s", quiet, out)
+		}
+	}
+}
+
+func TestE2E_RepeatedErrors(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	if err := os.WriteFile(e.path("provider.fail"), nil, 0600); err != nil {
+		t.Fatalf("failed to break provider: %v", err)
+	}
+	d := e.start()
+	waitFor(t, "several failed syncs", func() bool { return strings.Count(d.out.String(), `msg="Verifying DNS records"`) >= 5 })
+	d.stop()
+
+	if n := strings.Count(d.out.String(), `msg="Failed to sync record"`); n != 1 {
+		t.Errorf("expected the repeated error to be logged once until its summary, got %d times:\n%s", n, d.out)
+	}
+}
+
+func TestE2E_API(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`http_listen: ["unix:%s"]
+api:
+  token: api-secret
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, e.path("http.sock"), source.URL))
+	d := e.start()
+	defer d.stop()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", e.path("http.sock"))
+	}}}
+	post := func(path string) (int, map[string]any) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer api-secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var answer map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+			t.Fatalf("failed to decode the answer of POST %s: %v", path, err)
+		}
+		return resp.StatusCode, answer
+	}
+
+	if code, answer := post("/pause"); code != http.StatusOK || answer["paused"] != true {
+		t.Errorf("expected the daemon to pause, got %d %v", code, answer)
+	}
+	if code, answer := post("/sync"); code != http.StatusConflict {
+		t.Errorf("expected a sync of a paused daemon to be refused, got %d %v", code, answer)
+	}
+	if code, answer := post("/resume"); code != http.StatusOK || answer["paused"] != false {
+		t.Errorf("expected the daemon to resume, got %d %v", code, answer)
+	}
+	if code, answer := post("/sync"); code != http.StatusOK || answer["message"] != "Every record is in sync" {
+		t.Errorf("expected a forced sync, got %d %v", code, answer)
+	}
+
+	resp, err := client.Get("http://localhost/history")
+	if err != nil {
+		t.Fatalf("GET /history failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var history struct {
+		Transactions []map[string]any `json:"transactions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil || resp.StatusCode != http.StatusOK || history.Transactions == nil {
+		t.Errorf("expected the history as JSON, got %s %+v, %v", resp.Status, history, err)
+	}
+}
+
+func TestE2E_Health(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`health:
+  listen: ["unix:%s"]
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, e.path("health.sock"), source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+
+	for _, args := range [][]string{{"health"}, {"health", "--ready"}} {
+		var out []byte
+		var err error
+		waitFor(t, strings.Join(args, " ")+" to pass", func() bool {
+			out, err = exec.Command(binary, append(args, "--config", e.path("config.yaml"))...).CombinedOutput()
+			return err == nil
+		})
+		if !strings.Contains(string(out), "PASS") || strings.Contains(string(out), "FAIL") {
+			t.Errorf("expected %s to pass every check, got:\n%s", strings.Join(args, " "), out)
+		}
+	}
+	d.stop()
+
+	out, err := exec.Command(binary, "health", "--config", e.path("config.yaml"), "--timeout", "2s").CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Errorf("expected health to exit with 1 once the daemon stopped, got %v:\n%s", err, out)
+	}
+}
+
+func TestE2E_ControlCommands(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	body := `control_socket: %s
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`
+	e.config(fmt.Sprintf(body, e.path("control.sock"), source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+	waitFor(t, "the control socket", func() bool { return d.logged("Control socket listening") })
+
+	ctl := func(command string) (string, error) {
+		out, err := exec.Command(binary, command, "--socket", e.path("control.sock")).CombinedOutput()
+		return string(out), err
+	}
+	if out, err := ctl("pause"); err != nil || !strings.Contains(out, "Paused") {
+		t.Errorf("expected pause to succeed, got %v:\n%s", err, out)
+	}
+	if out, err := ctl("sync"); err == nil || !strings.Contains(out, "paused") {
+		t.Errorf("expected sync of a paused daemon to fail, got %v:\n%s", err, out)
+	}
+	if out, err := ctl("resume"); err != nil || !strings.Contains(out, "Resumed") {
+		t.Errorf("expected resume to succeed, got %v:\n%s", err, out)
+	}
+	if out, err := ctl("sync"); err != nil || !strings.Contains(out, "in sync") || !d.logged("Forced sync") {
+		t.Errorf("expected sync to verify the records, got %v:\n%s", err, out)
+	}
+
+	// A reload picks up a record added to the config file
+	e.config(fmt.Sprintf(body+"      - name: vpn\n        type: A\n", e.path("control.sock"), source.URL))
+	if out, err := ctl("reload"); err != nil {
+		t.Errorf("expected reload to succeed, got %v:\n%s", err, out)
+	}
+	waitFor(t, "the added record to be pushed", func() bool { return e.count("vpn.example.com A 203.0.113.10") > 0 })
+	d.stop()
+}
+
+func TestE2E_SyncSignal(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+
+	if err := d.cmd.Process.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatalf("failed to signal ipwatcher: %v", err)
+	}
+	waitFor(t, "the forced sync", func() bool { return d.logged("Forced sync") })
+	d.stop()
+}
+
+func TestE2E_DumpSignal(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+
+	if err := d.cmd.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatalf("failed to signal ipwatcher: %v", err)
+	}
+	waitFor(t, "the state dump", func() bool { return d.logged("State dump end") })
+	for _, want := range []string{"  ipv4: 203.0.113.10", "  zone id exec::example.com: example.com", "  zone example.com (exec): ok"} {
+		if !d.logged(want) {
+			t.Errorf("expected %q in the state dump", want)
+		}
+	}
+	d.stop()
+}
+
+func TestE2E_SingleInstance(t *testing.T) {
+	source := newIPSource(t, "203.0.113.10")
+	e := newEnv(t)
+	e.config(fmt.Sprintf(`lock_file: %s
+ip_sources:
+  - url: %s
+    family: ipv4
+domains:
+  - zone_name: example.com
+    provider: exec
+    records:
+      - name: home
+        type: A
+`, e.path("ipwatcher.lock"), source.URL))
+	d := e.start()
+	waitFor(t, "the record to be pushed", func() bool { return e.count("home.example.com A 203.0.113.10") > 0 })
+
+	// A second daemon with the same config exits instead of racing the first
+	second := e.start()
+	select {
+	case err := <-second.done:
+		if err == nil || !second.logged("another ipwatcher instance is running with this config") {
+			t.Errorf("expected the second daemon to fail on the lock, got %v", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("the second daemon kept running")
+	}
+	d.stop()
+
+	// The lock is released on exit
+	third := e.start()
+	waitFor(t, "the next daemon to start", func() bool { return third.logged("Refresh interval") })
+	third.stop()
+}
@@ -0,0 +1,150 @@
+// Package events defines the typed events the watcher emits and a bus to subscribe to them,
+// so applications embedding the watcher can build their own UIs and automation on top of it.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event is one of IPChange, RecordChange or Error
+type Event interface {
+	// When returns the time the event happened
+	When() time.Time
+}
+
+// IPChange is published when a watched address changes
+type IPChange struct {
+	Time    time.Time
+	Family  string // ipv4 or ipv6
+	Channel string // Channel whose address changed; empty for the default addresses
+	Old     string // Empty on the first detection
+	New     string
+}
+
+// When implements Event
+func (e IPChange) When() time.Time { return e.Time }
+
+// RecordChange is published when records of a zone were pushed to a provider, or checked in read-only mode
+type RecordChange struct {
+	Time     time.Time
+	Zone     string
+	Provider string
+	Records  []string // Fully qualified record names
+	Message  string   // What happened, e.g. "DNS records updated successfully (created 1, ...)"
+	Err      error    // Set when the records could not be pushed
+}
+
+// When implements Event
+func (e RecordChange) When() time.Time { return e.Time }
+
+// Error is published when a refresh or sync of the watcher fails as a whole
+type Error struct {
+	Time  time.Time
+	Where string // e.g. "IP refresh" or "DNS sync"
+	Err   error
+}
+
+// When implements Event
+func (e Error) When() time.Time { return e.Time }
+
+// subscriber queues the events published to it, which its own goroutine delivers in order
+type subscriber struct {
+	ctx    context.Context
+	ch     chan Event
+	mu     sync.Mutex
+	queue  []Event
+	notify chan struct{} // Signalled when queue is no longer empty
+}
+
+// push queues e without waiting for the subscriber
+func (s *subscriber) push(e Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events to the channel of the subscriber until its context is done
+func (s *subscriber) deliver() {
+	for {
+		select {
+		case <-s.notify:
+		case <-s.ctx.Done():
+			return
+		}
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, e := range queue {
+			select {
+			case s.ch <- e:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Bus delivers published events to every subscriber, in order. It is safe for concurrent use.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now on, until ctx is done;
+// the channel is closed then. Events queue up for a subscriber that does not keep up rather
+// than hold up Publish or get lost, so keep receiving, or cancel ctx, as long as the watcher runs.
+func (b *Bus) Subscribe(ctx context.Context) <-chan Event {
+	sub := &subscriber{ctx: ctx, ch: make(chan Event), notify: make(chan struct{}, 1)}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		sub.deliver()
+		b.mu.Lock()
+		delete(b.subs, sub)
+		b.mu.Unlock()
+		close(sub.ch)
+	}()
+	return sub.ch
+}
+
+// Handle calls fn with every published event of type T until ctx is done, e.g.
+//
+//	go events.Handle(ctx, bus, func(e events.IPChange) { ... })
+//
+// It blocks, so run it in its own goroutine.
+func Handle[T Event](ctx context.Context, b *Bus, fn func(T)) {
+	for e := range b.Subscribe(ctx) {
+		if t, ok := e.(T); ok {
+			fn(t)
+		}
+	}
+}
+
+// Publish queues e for every subscriber and returns without waiting for any of them, so a
+// slow subscriber never holds up the watcher
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	subs := make([]*subscriber, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.push(e)
+	}
+}
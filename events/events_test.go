@@ -0,0 +1,89 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/events"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	bus := events.NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := bus.Subscribe(ctx)
+
+	change := events.IPChange{Time: time.Now(), Family: "ipv4", Old: "192.0.2.1", New: "198.51.100.1"}
+	bus.Publish(change)
+	if e := <-ch; e.(events.IPChange) != change {
+		t.Errorf("Expected %+v, got %+v", change, e)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Expected no further events after cancelling the subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the channel to be closed after cancelling the subscription")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	bus := events.NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	handled := make(chan events.RecordChange, 16)
+	done := make(chan struct{})
+	go func() {
+		events.Handle(ctx, bus, func(e events.RecordChange) { handled <- e })
+		close(done)
+	}()
+
+	// Handle subscribes in its goroutine, so publish until it has picked up an event
+	var e events.RecordChange
+	for received := false; !received; {
+		bus.Publish(events.Error{Where: "DNS sync", Err: errors.New("boom")})
+		bus.Publish(events.RecordChange{Zone: "example.com", Provider: "cloudflare"})
+		select {
+		case e = <-handled:
+			received = true
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if e.Zone != "example.com" {
+		t.Errorf("Expected the record change of example.com, got %+v", e)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestBus_PublishDoesNotWait(t *testing.T) {
+	bus := events.NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := bus.Subscribe(ctx) // Not received from until every event is published
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			bus.Publish(events.IPChange{Family: "ipv4", New: strconv.Itoa(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Publish to return without waiting for the subscriber")
+	}
+
+	for i := 0; i < 1000; i++ {
+		if e := (<-ch).(events.IPChange); e.New != strconv.Itoa(i) {
+			t.Fatalf("Expected event %d in order, got %+v", i, e)
+		}
+	}
+}
@@ -1,109 +1,1356 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/msyrus/ipwatcher/internal/httpserver"
+	"github.com/msyrus/ipwatcher/internal/schedule"
+	"github.com/msyrus/ipwatcher/internal/statsd"
+	"golang.org/x/net/idna"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	RefreshRate  float64  `yaml:"refresh_rate"` // Times per second to check IP
-	SyncRate     float64  `yaml:"sync_rate"`    // Times per minute to verify DNS
-	SupportsIPv6 bool     `yaml:"supports_ipv6"`
-	Domains      []Domain `yaml:"domains"`
+	RefreshRate       float64        `yaml:"refresh_rate"`    // Times per second to check IP
+	SyncRate          float64        `yaml:"sync_rate"`       // Times per minute to verify DNS
+	SyncSchedule      string         `yaml:"sync_schedule"`   // Cron expression for DNS verification, used instead of sync_rate
+	IntervalJitter    float64        `yaml:"interval_jitter"` // Fraction of every refresh and sync interval, 0 to 1, that is randomly left out
+	AuditRate         float64        `yaml:"audit_rate"`      // Times per hour to audit every record; 0 audits on every sync
+	SupportsIPv6      bool           `yaml:"supports_ipv6"`
+	RollbackOnFailure bool           `yaml:"rollback_on_failure"` // Revert updated zones when others fail during an IP change
+	ReadOnly          bool           `yaml:"read_only"`           // Detect IPs and report drift without changing DNS
+	DryRun            bool           `yaml:"dry_run"`             // Print planned record changes instead of applying them
+	Exec              *ExecConfig    `yaml:"exec"`                // Command used by the exec provider
+	Route53           *Route53Config `yaml:"route53"`             // Route53 authentication; the default AWS credential chain when unset
+	ControlSocket     string         `yaml:"control_socket"`      // Unix socket for `ipwatcher watch`; disabled when empty
+	Notifications     *Notifications `yaml:"notifications"`       // Daemon lifecycle notifications; disabled when unset
+	HTTPListen        []string       `yaml:"http_listen"`         // Addresses the status HTTP server listens on; disabled when empty
+	Debug             *Debug         `yaml:"debug"`               // Authenticated /debug/state endpoint on http_listen; disabled when unset
+	API               *API           `yaml:"api"`                 // Authenticated POST /sync, /pause and /resume on http_listen; disabled when unset
+	Health            *Health        `yaml:"health"`              // Thresholds and listener of the /healthz and /readyz endpoints; defaults when unset
+	MetricsTextfile   string         `yaml:"metrics_textfile"`    // *.prom file rewritten every cycle for the node_exporter textfile collector
+	StatsD            *StatsD        `yaml:"statsd"`              // StatsD or DogStatsD server the metrics are sent to every cycle; disabled when unset
+	JobQueueFile      string         `yaml:"job_queue_file"`      // Journal of DNS updates until they succeed, across restarts; disabled when empty
+	RecordCacheFile   string         `yaml:"record_cache_file"`   // File caching Cloudflare record IDs so IP changes skip listing the zone; disabled when empty
+	HistoryFile       string         `yaml:"history_file"`        // File keeping the IP change history and last published IPs across restarts; in memory only when empty
+	ConfigRefresh     time.Duration  `yaml:"config_refresh"`      // How often a config loaded from an https URL is fetched again; defaults to 5m
+	ShutdownTimeout   time.Duration  `yaml:"shutdown_timeout"`    // Limit of the last sync before the daemon exits; defaults to 5s
+	LockFile          string         `yaml:"lock_file"`           // File locked while the daemon runs; defaults to one per config file and profile in the temporary directory
+	CloudflareBaseURL string         `yaml:"cloudflare_base_url"` // Cloudflare API endpoint override, e.g. an API gateway or mock server
+	CloudflareTags    []string       `yaml:"cloudflare_tags"`     // name:value tags set on managed Cloudflare records (paid plans)
+	CloudflareRetry   *Retry         `yaml:"cloudflare_retry"`    // Retries of rate-limited and failed Cloudflare requests; defaults when unset
+	IPSources         []IPSource     `yaml:"ip_sources"`          // Echo endpoints tried in order; ipify is used for families without one
+	IPSourcePolicy    string         `yaml:"ip_source_policy"`    // first, prefer-first, majority or hold
+	Channels          []Channel      `yaml:"channels"`            // Named addresses with their own sources that records can publish instead of the default ones
+	OwnerID           string         `yaml:"owner_id"`            // Instance ID written to ownership TXT records, transactions and log lines; disabled when empty
+	LogLevel          string         `yaml:"log_level"`           // Least severe log lines printed, with module overrides like info,dnsmanager=debug; -log-level takes precedence
+	Adopt             *bool          `yaml:"adopt"`               // Take over existing unmanaged records with different content; defaults to true
+	Heartbeat         *Heartbeat     `yaml:"heartbeat"`           // TXT record in every zone with the last update time; disabled when unset
+	NTP               *NTP           `yaml:"ntp"`                 // Checks the system clock so change timestamps can be trusted; disabled when unset
+	Propagation       *Propagation   `yaml:"propagation"`         // Public resolvers queried after IP changes to warm caches and time propagation; disabled when unset
+	BindInterface     string         `yaml:"bind_interface"`      // Network interface outbound requests leave through (Linux only)
+	BindAddress       string         `yaml:"bind_address"`        // Local address outbound requests are sent from
+	Domains           []Domain       `yaml:"domains"`
+	Include           []string       `yaml:"include"` // Glob patterns of YAML files, relative to this one, merged into it
+
+	RecordSets map[string][]Record `yaml:"record_sets"` // Named record layouts that domains add with record_sets
+
+	CloudflareAccounts       []CloudflareAccount `yaml:"cloudflare_accounts"`        // Named Cloudflare credentials domains can refer to
+	CloudflareCircuitBreaker *CircuitBreaker     `yaml:"cloudflare_circuit_breaker"` // Pauses Cloudflare requests during an outage; defaults when unset
+	CloudflareBatch          *Batch              `yaml:"cloudflare_batch"`           // Splits the changes of a zone into Cloudflare batch requests; defaults when unset
+	Route53Batch             *Batch              `yaml:"route53_batch"`              // Splits the changes of a zone into Route53 change batches; defaults when unset
+	WorkersKV                *WorkersKV          `yaml:"workers_kv"`                 // Workers KV key the current IPs are written to; disabled when unset
+	LocalDNS                 *LocalDNS           `yaml:"local_dns"`                  // LAN DNS server given the internal address of the managed names; disabled when unset
+
+	Profile  string             `yaml:"profile"`  // Profile used unless another is selected; set to the profile in use after loading
+	Profiles map[string]Profile `yaml:"profiles"` // Per-environment overrides of domains, accounts and notifications
+}
+
+// AdoptRecords reports whether existing records ipwatcher does not manage may be overwritten
+func (c *Config) AdoptRecords() bool {
+	return c.Adopt == nil || *c.Adopt
+}
+
+// Profile overrides parts of the config for one environment, such as staging or production.
+// Sections a profile leaves out keep their top-level values.
+type Profile struct {
+	Domains            []Domain            `yaml:"domains"`
+	CloudflareAccounts []CloudflareAccount `yaml:"cloudflare_accounts"`
+	Notifications      *Notifications      `yaml:"notifications"`
+}
+
+// UseProfile applies the overrides of the named profile, or of the config's own profile when
+// name is empty. Without either, the top-level settings are used as they are.
+func (c *Config) UseProfile(name string) error {
+	if name == "" {
+		name = c.Profile
+	}
+	if name == "" {
+		return nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s is not defined", name)
+	}
+	if p.Domains != nil {
+		c.Domains = p.Domains
+	}
+	if p.CloudflareAccounts != nil {
+		c.CloudflareAccounts = p.CloudflareAccounts
+	}
+	if p.Notifications != nil {
+		c.Notifications = p.Notifications
+	}
+	c.Profile = name
+	return nil
+}
+
+// ProfileNames returns the names of the defined profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CloudflareAccount represents a named set of Cloudflare credentials
+type CloudflareAccount struct {
+	Name         string `yaml:"name"`
+	AccountID    string `yaml:"account_id"` // Restricts zone lookups to this Cloudflare account
+	APIToken     string `yaml:"api_token"`
+	APITokenFile string `yaml:"api_token_file"`
+}
+
+// Token returns the account's token, reading it from api_token_file if set
+func (a CloudflareAccount) Token() (string, error) {
+	return readToken(a.APIToken, a.APITokenFile, "cloudflare account "+a.Name)
+}
+
+// WorkersKV configures the Workers KV key the current IPs are published to
+type WorkersKV struct {
+	AccountID    string `yaml:"account_id"`
+	NamespaceID  string `yaml:"namespace_id"`
+	Key          string `yaml:"key"`       // Defaults to ipwatcher
+	APIToken     string `yaml:"api_token"` // Defaults to CLOUDFLARE_API_TOKEN
+	APITokenFile string `yaml:"api_token_file"`
+}
+
+// Token returns the Workers KV token, reading it from api_token_file if set; empty when neither is set
+func (k WorkersKV) Token() (string, error) {
+	return readToken(k.APIToken, k.APITokenFile, "workers_kv")
+}
+
+// Local DNS server types
+const (
+	LocalDNSPiHole  = "pihole"
+	LocalDNSAdGuard = "adguard"
+	LocalDNSDnsmasq = "dnsmasq"
+	LocalDNSHosts   = "hosts"
+)
+
+// LocalDNS configures a DNS server on the local network that answers the managed names with the
+// internal address, so hosts inside the network reach them without going through the router
+type LocalDNS struct {
+	Type          string   `yaml:"type"`           // pihole, adguard, dnsmasq or hosts
+	URL           string   `yaml:"url"`            // Web interface of pihole and adguard, e.g. http://pi.hole
+	Username      string   `yaml:"username"`       // adguard only
+	Password      string   `yaml:"password"`       // Web interface password of pihole and adguard
+	PasswordFile  string   `yaml:"password_file"`  // File holding the password, read on every sync
+	File          string   `yaml:"file"`           // File dnsmasq and hosts write; defaults to /etc/dnsmasq.d/ipwatcher.conf and /etc/hosts
+	ReloadCommand []string `yaml:"reload_command"` // Run after the file changed, e.g. [systemctl, restart, dnsmasq]
+	Interface     string   `yaml:"interface"`      // Interface the internal addresses are read from; defaults to the one of the default route
+	IPv4          string   `yaml:"ipv4"`           // Fixed internal IPv4 address instead of the interface's, e.g. of a reverse proxy
+	IPv6          string   `yaml:"ipv6"`           // Fixed internal IPv6 address instead of the interface's
+	Names         []string `yaml:"names"`          // Names to publish; defaults to those of every A and AAAA record without a channel
+}
+
+// ResolvePassword returns the password, reading password_file when set
+func (l LocalDNS) ResolvePassword() (string, error) {
+	if l.PasswordFile == "" {
+		return l.Password, nil
+	}
+	data, err := os.ReadFile(l.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local_dns.password_file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// IPSource is a way of detecting the public IP, by default an echo endpoint that returns it as plain text
+type IPSource struct {
+	Type    string            `yaml:"type"` // Registered source type; defaults to http
+	URL     string            `yaml:"url"`
+	Family  string            `yaml:"family"`  // ipv4 or ipv6
+	Headers []Header          `yaml:"headers"` // Sent with every request, e.g. an API key
+	Options map[string]string `yaml:"options"` // Settings specific to the source type
+	Network string            `yaml:"network"` // tcp4 or tcp6 pins echo requests to one family; any family when empty
+	Connect string            `yaml:"connect"` // Address dialed instead of the URL's host, as IP or host:port
+}
+
+// Channel is a named address detected by its own sources, decoupled from the default IPv4/IPv6 pair,
+// e.g. a second WAN link or a VPN address
+type Channel struct {
+	Name    string     `yaml:"name"`
+	Family  string     `yaml:"family"`  // ipv4 or ipv6
+	Sources []IPSource `yaml:"sources"` // Tried like ip_sources; their family defaults to the channel's
+	Policy  string     `yaml:"policy"`  // Like ip_source_policy, which it defaults to
+}
+
+// Channel returns the channel with the given name
+func (c *Config) Channel(name string) (Channel, bool) {
+	for _, ch := range c.Channels {
+		if ch.Name == name {
+			return ch, true
+		}
+	}
+	return Channel{}, false
+}
+
+// Header is an HTTP header whose value is set inline, or read from a file or an environment variable
+type Header struct {
+	Name      string `yaml:"name"`
+	Value     string `yaml:"value"`
+	ValueFile string `yaml:"value_file"`
+	ValueEnv  string `yaml:"value_env"`
+}
+
+// Resolve returns the header value, reading value_file or value_env when set
+func (h Header) Resolve() (string, error) {
+	switch {
+	case h.ValueFile != "":
+		data, err := os.ReadFile(h.ValueFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read value_file for header %s: %w", h.Name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case h.ValueEnv != "":
+		value, ok := os.LookupEnv(h.ValueEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s for header %s is not set", h.ValueEnv, h.Name)
+		}
+		return value, nil
+	}
+	return h.Value, nil
+}
+
+// Heartbeat configures the TXT record external monitoring can watch to detect a dead updater
+type Heartbeat struct {
+	Name     string        `yaml:"name"`     // Relative record name in every zone; defaults to _ipwatcher-heartbeat
+	Interval time.Duration `yaml:"interval"` // How often the timestamp is refreshed; defaults to 1h
+}
+
+// NTP configures the clock check against an NTP server
+type NTP struct {
+	Server   string        `yaml:"server"`   // host or host:port; defaults to pool.ntp.org
+	Interval time.Duration `yaml:"interval"` // How often the clock is checked; defaults to 1h
+	MaxSkew  time.Duration `yaml:"max_skew"` // Offset above which a warning is logged; defaults to 2s
+}
+
+// Propagation configures the public resolvers and external probes queried for changed records
+// after an IP change
+type Propagation struct {
+	Resolvers []string      `yaml:"resolvers"` // host or host:port of each resolver; port 53 when omitted
+	Probes    []Probe       `yaml:"probes"`    // External vantage points queried over HTTPS
+	Quorum    int           `yaml:"quorum"`    // Resolvers and probes that must answer the new values for global propagation; defaults to all
+	Timeout   time.Duration `yaml:"timeout"`   // How long a resolver is queried before it counts as not propagated; defaults to 10m
+	Interval  time.Duration `yaml:"interval"`  // Pause between queries while a resolver still answers old values; defaults to 10s
+}
+
+// Probe is an external vantage point that answers DNS queries over the DNS JSON API, such as a
+// public DoH resolver or a small probe service on a server in another region
+type Probe struct {
+	Name    string   `yaml:"name"`    // Reported in status and metrics; defaults to the URL
+	URL     string   `yaml:"url"`     // https endpoint taking name and type query parameters, e.g. https://dns.google/resolve
+	Headers []Header `yaml:"headers"` // Sent with every query, e.g. an API key of a probe service
+}
+
+// ProbeName returns the name a probe is reported under
+func (p Probe) ProbeName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.URL
+}
+
+// Debug configures the /debug/state endpoint, which dumps the internal state for bug reports
+type Debug struct {
+	Token     string        `yaml:"token"`      // Bearer token every request must send
+	TokenFile string        `yaml:"token_file"` // File holding the token, read on every request
+	Interval  time.Duration `yaml:"interval"`   // Minimum time between two dumps; defaults to 10s
+}
+
+// ResolveToken returns the token, reading token_file when set
+func (d Debug) ResolveToken() (string, error) {
+	return resolveToken("debug", d.Token, d.TokenFile)
+}
+
+// API configures the endpoints that control the daemon over HTTP, like the control socket does
+type API struct {
+	Token     string `yaml:"token"`      // Bearer token every request must send
+	TokenFile string `yaml:"token_file"` // File holding the token, read on every request
+}
+
+// ResolveToken returns the token, reading token_file when set
+func (a API) ResolveToken() (string, error) {
+	return resolveToken("api", a.Token, a.TokenFile)
+}
+
+// resolveToken returns token, or the contents of file when set; section names the settings
+// in errors
+func resolveToken(section, token, file string) (string, error) {
+	if file == "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s.token_file: %w", section, err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s.token_file is empty", section)
+	}
+	return token, nil
+}
+
+// Health configures the /healthz and /readyz endpoints, which are served on http_listen and,
+// when set, on a listener of their own
+type Health struct {
+	Listen []string      `yaml:"listen"`  // Addresses of a listener serving only the health endpoints
+	MaxAge time.Duration `yaml:"max_age"` // How long IP fetches and zone syncs may fail, and checks stop, before the endpoints fail
+}
+
+// StatsD configures sending the metrics of metrics_textfile to a StatsD or DogStatsD server,
+// for setups without a Prometheus scraper
+type StatsD struct {
+	Address   string   `yaml:"address"`   // host:port of the UDP server, or unix:/path of a DogStatsD socket
+	Prefix    string   `yaml:"prefix"`    // Prepended to every metric name with a dot; defaults to ipwatcher
+	DogStatsD bool     `yaml:"dogstatsd"` // Send labels as DogStatsD tags instead of appending their values to the names
+	Tags      []string `yaml:"tags"`      // key:value tags added to every metric; needs dogstatsd
+}
+
+// Retry configures how failed provider requests are retried with exponential backoff.
+// Zero values keep the provider defaults.
+type Retry struct {
+	Attempts  int           `yaml:"attempts"`   // Attempts of every request, including the first
+	BaseDelay time.Duration `yaml:"base_delay"` // Backoff before the first retry, doubled on every further retry
+	Jitter    *float64      `yaml:"jitter"`     // Fraction of every backoff, 0 to 1, that is randomly left out
+}
+
+// CircuitBreaker configures when a provider stops calling an API that keeps failing.
+// Unset values keep the provider defaults.
+type CircuitBreaker struct {
+	Failures *int          `yaml:"failures"` // Consecutive failed requests that pause the API; 0 disables the breaker
+	Cooldown time.Duration `yaml:"cooldown"` // How long requests are skipped once paused
+}
+
+// Batch configures how the record changes of a zone are split into provider API calls.
+// Unset values keep the provider defaults.
+type Batch struct {
+	MaxChanges int            `yaml:"max_changes"` // Most record changes sent in one call
+	Delay      *time.Duration `yaml:"delay"`       // Pause between the calls of one zone
+}
+
+// Notifications configures where daemon lifecycle notifications are sent
+type Notifications struct {
+	WebhookURL        string        `yaml:"webhook_url"`         // Receives every notification as a JSON POST
+	Headers           []Header      `yaml:"headers"`             // Sent with every webhook request
+	Events            []string      `yaml:"events"`              // start, shutdown, crash_loop, summary and conflict; all when empty
+	SummarySchedule   string        `yaml:"summary_schedule"`    // Cron expression, e.g. @daily or @weekly, for summary reports; disabled when empty
+	StateFile         string        `yaml:"state_file"`          // Enables crash-loop detection across restarts
+	CrashLoopRestarts int           `yaml:"crash_loop_restarts"` // Unclean restarts that make a crash loop; defaults to 3
+	CrashLoopWindow   time.Duration `yaml:"crash_loop_window"`   // Period the restarts are counted over; defaults to 10m
+	QueueFile         string        `yaml:"queue_file"`          // Keeps undelivered notifications for retry; they are lost when empty
+	QueueMaxAge       time.Duration `yaml:"queue_max_age"`       // Queued notifications older than this are dropped; defaults to 24h
+	Workers           int           `yaml:"workers"`             // Notifications delivered at the same time; defaults to 2
+	Timeout           time.Duration `yaml:"timeout"`             // Time allowed to deliver one notification; defaults to 10s
+}
+
+// Enabled reports whether notifications of the given event should be sent
+func (n *Notifications) Enabled(event string) bool {
+	if n == nil || n.WebhookURL == "" {
+		return false
+	}
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecConfig configures the exec provider, which hands record updates to an external command
+type ExecConfig struct {
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args"`    // Passed before the record name, type and IP
+	Timeout time.Duration `yaml:"timeout"` // Per-invocation timeout; defaults to 30s
+}
+
+// Route53Config configures workload identity federation for the Route53 provider
+type Route53Config struct {
+	RoleARN              string `yaml:"role_arn"`                // Role assumed with an OIDC token
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"` // OIDC token file, e.g. a projected Kubernetes service account token
+	GitHubActionsOIDC    bool   `yaml:"github_actions_oidc"`     // Request the OIDC token from the GitHub Actions token endpoint
+	SessionName          string `yaml:"session_name"`            // Role session name; defaults to ipwatcher
 }
 
 // Domain represents a domain configuration
 type Domain struct {
-	ZoneName string   `yaml:"zone_name"`
-	Provider string   `yaml:"provider"` // cloudflare or route53
-	Records  []Record `yaml:"records"`
+	ZoneName   string   `yaml:"zone_name"`
+	ZoneID     string   `yaml:"zone_id"`   // Skips the zone lookup when set
+	Provider   string   `yaml:"provider"`  // cloudflare, route53 or exec
+	Providers  []string `yaml:"providers"` // Fan out the same records to several providers
+	Records    []Record `yaml:"records"`
+	RecordSets []string `yaml:"record_sets"` // Names of shared record sets added to records
+	Verify     string   `yaml:"verify"`      // content (default), full or resolver
+	AliasWWW   bool     `yaml:"alias_www"`   // Also publish www, following the apex records
+
+	// Defaults of records that do not set proxied or ttl themselves
+	Proxied *bool `yaml:"proxied"`
+	TTL     int   `yaml:"ttl"` // Not inherited by proxied records, which always use automatic TTL
+
+	// Cloudflare credentials scoped to this zone; override CLOUDFLARE_API_TOKEN
+	Account      string `yaml:"account"`    // Name of an entry in cloudflare_accounts
+	AccountID    string `yaml:"account_id"` // Cloudflare account the zone belongs to, when names collide
+	APIToken     string `yaml:"api_token"`
+	APITokenFile string `yaml:"api_token_file"`
+}
+
+// Verify levels of a domain, from cheapest to most thorough at the provider
+const (
+	VerifyContent  = "content"  // Compare record content, proxied status and explicit TTLs
+	VerifyFull     = "full"     // Also compare automatic TTLs and the managed comment
+	VerifyResolver = "resolver" // Skip the provider when live DNS answers already match
+)
+
+// ProviderNames returns every provider the domain's records are pushed to
+func (d Domain) ProviderNames() []string {
+	if len(d.Providers) > 0 {
+		return d.Providers
+	}
+	return []string{d.Provider}
+}
+
+// wwwRecords returns the www records alias_www adds next to the apex records. www is a CNAME to
+// the apex when every provider supports CNAMEs; the exec provider gets copies of the apex's A and
+// AAAA records instead, since its command may only handle addresses.
+func (d Domain) wwwRecords() ([]Record, error) {
+	var apex []Record
+	for _, r := range d.Records {
+		if r.Name == "www" {
+			return nil, fmt.Errorf("www is managed by alias_www, remove its records")
+		}
+		if r.Name == "@" {
+			apex = append(apex, r)
+		}
+	}
+	if len(apex) == 0 {
+		return nil, fmt.Errorf("a record named @ is required")
+	}
+
+	if !slices.Contains(d.ProviderNames(), "exec") {
+		return []Record{{
+			Name:     "www",
+			Type:     "CNAME",
+			Proxied:  apex[0].Proxied,
+			Priority: apex[0].Priority,
+			TTL:      apex[0].TTL,
+			Target:   d.ZoneName,
+
+			PurgeCache: apex[0].PurgeCache,
+		}}, nil
+	}
+
+	var www []Record
+	for _, r := range apex {
+		if r.Type == "CNAME" {
+			return nil, fmt.Errorf("the exec provider cannot follow a CNAME at the apex")
+		}
+		r.Name = "www"
+		www = append(www, r)
+	}
+	return www, nil
+}
+
+// Priorities returns the distinct record priorities across all domains, highest first
+func (c *Config) Priorities() []int {
+	seen := make(map[int]bool)
+	var priorities []int
+	for _, d := range c.Domains {
+		for _, r := range d.Records {
+			if !seen[r.Priority] {
+				seen[r.Priority] = true
+				priorities = append(priorities, r.Priority)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	return priorities
+}
+
+// CloudflareAccountID returns the Cloudflare account ID used to look up the domain's zone:
+// the domain's own account_id, or the one of the account it is routed to
+func (c *Config) CloudflareAccountID(d Domain) string {
+	if d.AccountID != "" {
+		return d.AccountID
+	}
+	for _, a := range c.CloudflareAccounts {
+		if a.Name == d.Account {
+			return a.AccountID
+		}
+	}
+	return ""
+}
+
+// ProviderKey returns the key identifying the provider instance that manages the domain.
+// Domains bound to a Cloudflare account share that account's client, and domains with
+// their own Cloudflare token get a dedicated client instead of the default one.
+func (d Domain) ProviderKey(providerType string) string {
+	if providerType != "cloudflare" {
+		return providerType
+	}
+	if d.Account != "" {
+		return CloudflareAccountKey(d.Account)
+	}
+	if d.APIToken != "" || d.APITokenFile != "" {
+		return providerType + ":" + d.ZoneName
+	}
+	return providerType
+}
+
+// CloudflareAccountKey returns the provider key of a named Cloudflare account
+func CloudflareAccountKey(name string) string {
+	return "cloudflare@" + name
+}
+
+// CloudflareToken returns the zone-scoped Cloudflare token, reading it from api_token_file if set
+func (d Domain) CloudflareToken() (string, error) {
+	return readToken(d.APIToken, d.APITokenFile, d.ZoneName)
+}
+
+// readToken returns the inline token, or the trimmed contents of file when set
+func readToken(token, file, owner string) (string, error) {
+	if file == "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read api_token_file for %s: %w", owner, err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("api_token_file for %s is empty", owner)
+	}
+	return token, nil
 }
 
+// Limits for a custom record TTL, in seconds; both providers accept this range
+const (
+	minRecordTTL = 60
+	maxRecordTTL = 86400
+)
+
 // Record represents a DNS record configuration
 type Record struct {
-	Name    string `yaml:"name"`
-	Type    string `yaml:"type"` // A or AAAA
-	Proxied bool   `yaml:"proxied"`
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"` // A, AAAA or CNAME
+	Proxied  bool   `yaml:"proxied"`
+	Priority int    `yaml:"priority"` // Higher priorities are updated first
+	TTL      int    `yaml:"ttl"`      // Seconds; 0 uses the provider default
+	Channel  string `yaml:"channel"`  // Publishes this channel's address instead of the default IPv4/IPv6
+	Target   string `yaml:"target"`   // Host name a CNAME record points at
+
+	PurgeCache  bool          `yaml:"purge_cache"`  // Purge the Cloudflare cache of the host after changing a proxied record
+	CreateAfter time.Duration `yaml:"create_after"` // Only create the record once its address has been unchanged this long
+
+	// Whether proxied and ttl were left out of the config file, so the domain defaults apply.
+	// Records built in code set everything themselves.
+	inheritProxied bool
+	inheritTTL     bool
+}
+
+// UnmarshalYAML decodes a record and notes which of the settings with domain defaults it leaves out
+func (r *Record) UnmarshalYAML(value *yaml.Node) error {
+	type plain Record
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	var set struct {
+		Proxied *bool `yaml:"proxied"`
+		TTL     *int  `yaml:"ttl"`
+	}
+	if err := value.Decode(&set); err != nil {
+		return err
+	}
+	r.inheritProxied = set.Proxied == nil
+	r.inheritTTL = set.TTL == nil
+	return nil
+}
+
+// RelativeName returns name relative to zone: "@" for the zone apex and the labels in front of
+// the zone for names inside it. Names that are already relative are returned unchanged.
+func RelativeName(name, zone string) string {
+	name = strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return name
+	}
+	if strings.EqualFold(name, zone) {
+		return "@"
+	}
+	if prefix, ok := cutSuffixFold(name, "."+zone); ok && prefix != "" {
+		return prefix
+	}
+	return name
+}
+
+// idnaProfile maps internationalized names like providers expect them. Unlike idna.Lookup it
+// accepts underscores and wildcards, which are common in record names.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.BidiRule())
+
+// asciiName returns name in its ASCII form, with internationalized labels in punycode.
+// ASCII names are returned unchanged.
+func asciiName(name string) (string, error) {
+	for _, r := range name {
+		if r >= utf8.RuneSelf {
+			fqdn := strings.HasSuffix(name, ".")
+			ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(name, "."))
+			if err != nil {
+				return "", fmt.Errorf("invalid internationalized name %q: %w", name, err)
+			}
+			if fqdn {
+				ascii += "."
+			}
+			return ascii, nil
+		}
+	}
+	return name, nil
+}
+
+// cutSuffixFold is strings.CutSuffix ignoring case
+func cutSuffixFold(s, suffix string) (string, bool) {
+	if len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix) {
+		return s[:len(s)-len(suffix)], true
+	}
+	return s, false
 }
 
-// LoadConfig loads configuration from a YAML file
+// LoadConfig loads configuration from a YAML file, with the profile it selects itself
 func LoadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+	return LoadConfigProfile(filename, "")
+}
+
+// LoadConfigProfile loads configuration from a YAML file, a conf.d-style directory of YAML
+// files, or an https URL, with the named profile applied; an empty name selects the profile the
+// file sets itself
+func LoadConfigProfile(filename, profile string) (*Config, error) {
+	if IsRemote(filename) {
+		data, _, err := NewRemote(filename, nil).Fetch(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		return Parse(data, profile)
+	}
+	doc, files, err := loadDocument(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
+	return decode(doc, files, profile)
+}
 
+// Parse parses and validates a config file with the named profile applied. IPWATCHER_*
+// environment variables override values of the file, see applyEnv. The file cannot include
+// others, since there is no directory to resolve them in.
+func Parse(data []byte, profile string) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if patterns, err := includes(&doc); err != nil || len(patterns) > 0 {
+		return nil, fmt.Errorf("include is only supported in config files on disk")
+	}
+	return decode(&doc, nil, profile)
+}
+
+// decode applies the environment and the named profile to a config document and validates it.
+// Validation problems are reported at their position in the document, in the files named by files.
+func decode(doc *yaml.Node, files map[*yaml.Node]string, profile string) (*Config, error) {
+	if err := applyEnv(doc, os.Environ()); err != nil {
+		return nil, err
+	}
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := doc.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := config.UseProfile(profile); err != nil {
+		return nil, err
+	}
 
 	// Validate configuration
 	if err := config.Validate(); err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			verr.locate(doc, files, config.Profile)
+		}
 		return nil, err
 	}
 
 	return &config, nil
 }
 
-// Validate checks if the configuration is valid
+// expandRecordSets adds the records of every shared record set a domain refers to, after the
+// domain's own records. Each domain gets its own copy, so they are normalized for their zone.
+func (c *Config) expandRecordSets(ps *problems) {
+	for _, name := range slices.Sorted(maps.Keys(c.RecordSets)) {
+		records := c.RecordSets[name]
+		if name == "" {
+			ps.add("record_sets", "record_sets: names must not be empty")
+		} else if len(records) == 0 {
+			ps.add("record_sets."+name, "record_sets: %s has no records", name)
+		}
+	}
+
+	for i := range c.Domains {
+		domain := &c.Domains[i]
+		for j, name := range domain.RecordSets {
+			records, ok := c.RecordSets[name]
+			if !ok {
+				ps.add(fmt.Sprintf("domains[%d].record_sets[%d]", i, j), "domain %s: unknown record set %s", domain.ZoneName, name)
+				continue
+			}
+			domain.Records = append(slices.Clip(domain.Records), records...)
+		}
+		// Expanded once; validating the config again must not add the records twice
+		domain.RecordSets = nil
+	}
+}
+
+// applyDomainDefaults gives records that do not set proxied or ttl the defaults of their domain.
+// Proxied records keep the automatic TTL.
+func (c *Config) applyDomainDefaults() {
+	for i := range c.Domains {
+		domain := &c.Domains[i]
+		for j := range domain.Records {
+			record := &domain.Records[j]
+			if domain.Proxied != nil && record.inheritProxied {
+				record.Proxied = *domain.Proxied
+			}
+			if domain.TTL != 0 && record.inheritTTL && !record.Proxied {
+				record.TTL = domain.TTL
+			}
+		}
+	}
+}
+
+// Validate checks if the configuration is valid and reports every problem it finds, as a
+// *ValidationError. Internationalized zone, record and CNAME target names are converted to
+// punycode, and record names given as fully qualified names are rewritten relative to their zone.
 func (c *Config) Validate() error {
-	if math.IsNaN(c.RefreshRate) || math.IsInf(c.RefreshRate, 0) {
-		return fmt.Errorf("refresh_rate must be a finite number")
+	var ps problems
+	c.expandRecordSets(&ps)
+	c.expandNames(&ps)
+	c.applyDomainDefaults()
+
+	for i := range c.Domains {
+		domain := &c.Domains[i]
+		zone, err := asciiName(domain.ZoneName)
+		if err != nil {
+			ps.add(fmt.Sprintf("domains[%d].zone_name", i), "domain %s: zone_name: %w", domain.ZoneName, err)
+			continue
+		}
+		domain.ZoneName = zone
+		for j := range domain.Records {
+			record := &domain.Records[j]
+			path := fmt.Sprintf("domains[%d].records[%d]", i, j)
+			name, err := asciiName(record.Name)
+			if err != nil {
+				ps.add(path+".name", "domain %s, record %s: name: %w", zone, record.Name, err)
+				continue
+			}
+			record.Name = RelativeName(name, zone)
+			if record.Type == "CNAME" {
+				if record.Target, err = asciiName(record.Target); err != nil {
+					ps.add(path+".target", "domain %s, record %s: target: %w", zone, record.Name, err)
+				}
+			}
+		}
+	}
+
+	switch {
+	case math.IsNaN(c.RefreshRate) || math.IsInf(c.RefreshRate, 0):
+		ps.add("refresh_rate", "refresh_rate must be a finite number")
+	case c.RefreshRate <= 0:
+		ps.add("refresh_rate", "refresh_rate must be greater than 0")
+	case time.Duration(float64(time.Second)/c.RefreshRate) <= 0:
+		ps.add("refresh_rate", "refresh_rate is too high and results in an invalid interval")
+	}
+
+	if math.IsNaN(c.IntervalJitter) || c.IntervalJitter < 0 || c.IntervalJitter > 1 {
+		ps.add("interval_jitter", "interval_jitter must be between 0 and 1")
+	}
+
+	if c.SyncSchedule != "" {
+		if _, err := schedule.Parse(c.SyncSchedule); err != nil {
+			ps.add("sync_schedule", "sync_schedule: %w", err)
+		}
+	} else {
+		switch {
+		case math.IsNaN(c.SyncRate) || math.IsInf(c.SyncRate, 0):
+			ps.add("sync_rate", "sync_rate must be a finite number")
+		case c.SyncRate <= 0:
+			ps.add("sync_rate", "sync_rate must be greater than 0")
+		case time.Duration(float64(time.Minute)/c.SyncRate) <= 0:
+			ps.add("sync_rate", "sync_rate is too high and results in an invalid interval")
+		}
+	}
+
+	switch {
+	case math.IsNaN(c.AuditRate) || math.IsInf(c.AuditRate, 0):
+		ps.add("audit_rate", "audit_rate must be a finite number")
+	case c.AuditRate < 0:
+		ps.add("audit_rate", "audit_rate must not be negative")
+	case c.AuditRate > 0 && time.Duration(float64(time.Hour)/c.AuditRate) <= 0:
+		ps.add("audit_rate", "audit_rate is too high and results in an invalid interval")
+	}
+
+	if c.ConfigRefresh < 0 {
+		ps.add("config_refresh", "config_refresh must not be negative")
+	}
+	if c.ShutdownTimeout < 0 {
+		ps.add("shutdown_timeout", "shutdown_timeout must not be negative")
+	}
+
+	if c.Exec != nil && c.Exec.Timeout < 0 {
+		ps.add("exec.timeout", "exec.timeout must not be negative")
+	}
+
+	if r := c.Route53; r != nil {
+		if !strings.HasPrefix(r.RoleARN, "arn:") {
+			ps.add("route53.role_arn", "route53.role_arn must be an IAM role ARN")
+		}
+		if (r.WebIdentityTokenFile == "") == !r.GitHubActionsOIDC {
+			ps.add("route53", "route53: exactly one of web_identity_token_file or github_actions_oidc is required")
+		}
+	}
+
+	if n := c.Notifications; n != nil {
+		u, err := url.Parse(n.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ps.add("notifications.webhook_url", "notifications.webhook_url must be an absolute http or https URL")
+		}
+		for i, e := range n.Events {
+			if e != "start" && e != "shutdown" && e != "crash_loop" && e != "summary" && e != "conflict" {
+				ps.add(fmt.Sprintf("notifications.events[%d]", i), "notifications.events: unknown event %q", e)
+			}
+		}
+		if n.CrashLoopRestarts < 0 || n.CrashLoopWindow < 0 {
+			ps.add("notifications", "notifications.crash_loop_restarts and crash_loop_window must not be negative")
+		}
+		if n.QueueMaxAge < 0 {
+			ps.add("notifications.queue_max_age", "notifications.queue_max_age must not be negative")
+		}
+		if n.Workers < 0 || n.Timeout < 0 {
+			ps.add("notifications", "notifications.workers and timeout must not be negative")
+		}
+		if n.SummarySchedule != "" {
+			if _, err := schedule.Parse(n.SummarySchedule); err != nil {
+				ps.add("notifications.summary_schedule", "notifications.summary_schedule: %w", err)
+			}
+		}
+	}
+
+	if !validSourcePolicy(c.IPSourcePolicy) {
+		ps.add("ip_source_policy", "ip_source_policy must be first, prefer-first, majority or hold")
+	}
+
+	for i, src := range c.IPSources {
+		field := fmt.Sprintf("ip_sources[%d]", i)
+		switch err := src.validate(field); {
+		case err != nil:
+			ps.add(field, "%w", err)
+		case src.Family != "ipv4" && src.Family != "ipv6":
+			ps.add(field+".family", "%s: family must be ipv4 or ipv6", field)
+		case src.Family == "ipv6" && !c.SupportsIPv6:
+			ps.add(field+".family", "%s: ipv6 sources require supports_ipv6", field)
+		}
+	}
+
+	channels := make(map[string]bool)
+	for i, ch := range c.Channels {
+		path := fmt.Sprintf("channels[%d]", i)
+		if ch.Name == "" {
+			ps.add(path+".name", "channels[%d]: name is required", i)
+			continue
+		}
+		if channels[ch.Name] {
+			ps.add(path+".name", "channels[%d]: duplicate channel %s", i, ch.Name)
+			continue
+		}
+		channels[ch.Name] = true
+		if ch.Family != "ipv4" && ch.Family != "ipv6" {
+			ps.add(path+".family", "channel %s: family must be ipv4 or ipv6", ch.Name)
+			continue
+		}
+		if !validSourcePolicy(ch.Policy) {
+			ps.add(path+".policy", "channel %s: policy must be first, prefer-first, majority or hold", ch.Name)
+		}
+		if len(ch.Sources) == 0 {
+			ps.add(path, "channel %s: at least one source is required", ch.Name)
+		}
+		for j, src := range ch.Sources {
+			field := fmt.Sprintf("channel %s, sources[%d]", ch.Name, j)
+			srcPath := fmt.Sprintf("%s.sources[%d]", path, j)
+			if err := src.validate(field); err != nil {
+				ps.add(srcPath, "%w", err)
+			} else if src.Family != "" && src.Family != ch.Family {
+				ps.add(srcPath+".family", "%s: family must match the channel's %s", field, ch.Family)
+			}
+		}
+	}
+
+	if c.CloudflareBaseURL != "" {
+		u, err := url.Parse(c.CloudflareBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ps.add("cloudflare_base_url", "cloudflare_base_url must be an absolute http or https URL")
+		}
+	}
+
+	for i, tag := range c.CloudflareTags {
+		if name, _, ok := strings.Cut(tag, ":"); !ok || name == "" {
+			ps.add(fmt.Sprintf("cloudflare_tags[%d]", i), "cloudflare_tags: %q must have the form name:value", tag)
+		}
+	}
+
+	if r := c.CloudflareRetry; r != nil {
+		if r.Attempts < 0 {
+			ps.add("cloudflare_retry.attempts", "cloudflare_retry.attempts must not be negative")
+		}
+		if r.BaseDelay < 0 {
+			ps.add("cloudflare_retry.base_delay", "cloudflare_retry.base_delay must not be negative")
+		}
+		if r.Jitter != nil && (*r.Jitter < 0 || *r.Jitter > 1) {
+			ps.add("cloudflare_retry.jitter", "cloudflare_retry.jitter must be between 0 and 1")
+		}
+	}
+
+	if b := c.CloudflareCircuitBreaker; b != nil {
+		if b.Failures != nil && *b.Failures < 0 {
+			ps.add("cloudflare_circuit_breaker.failures", "cloudflare_circuit_breaker.failures must not be negative")
+		}
+		if b.Cooldown < 0 {
+			ps.add("cloudflare_circuit_breaker.cooldown", "cloudflare_circuit_breaker.cooldown must not be negative")
+		}
+	}
+
+	for _, batch := range []struct {
+		key string
+		b   *Batch
+	}{{"cloudflare_batch", c.CloudflareBatch}, {"route53_batch", c.Route53Batch}} {
+		key, b := batch.key, batch.b
+		if b == nil {
+			continue
+		}
+		if b.MaxChanges < 0 {
+			ps.add(key+".max_changes", "%s.max_changes must not be negative", key)
+		}
+		if b.Delay != nil && *b.Delay < 0 {
+			ps.add(key+".delay", "%s.delay must not be negative", key)
+		}
+	}
+
+	if kv := c.WorkersKV; kv != nil {
+		if kv.AccountID == "" {
+			ps.add("workers_kv", "workers_kv.account_id is required")
+		}
+		if kv.NamespaceID == "" {
+			ps.add("workers_kv", "workers_kv.namespace_id is required")
+		}
+		if kv.APIToken != "" && kv.APITokenFile != "" {
+			ps.add("workers_kv", "workers_kv: api_token and api_token_file are mutually exclusive")
+		}
+	}
+
+	if l := c.LocalDNS; l != nil {
+		switch l.Type {
+		case LocalDNSPiHole, LocalDNSAdGuard:
+			if u, err := url.Parse(l.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				ps.add("local_dns.url", "local_dns.url must be an http or https URL for %s", l.Type)
+			}
+			if l.File != "" || len(l.ReloadCommand) > 0 {
+				ps.add("local_dns", "local_dns.file and local_dns.reload_command only apply to dnsmasq and hosts")
+			}
+		case LocalDNSDnsmasq, LocalDNSHosts:
+			if l.URL != "" || l.Username != "" || l.Password != "" || l.PasswordFile != "" {
+				ps.add("local_dns", "local_dns.url, username and password only apply to pihole and adguard")
+			}
+		default:
+			ps.add("local_dns.type", "local_dns.type must be pihole, adguard, dnsmasq or hosts, not %q", l.Type)
+		}
+		if l.Password != "" && l.PasswordFile != "" {
+			ps.add("local_dns", "local_dns: password and password_file are mutually exclusive")
+		}
+		if l.Username != "" && l.Type != LocalDNSAdGuard {
+			ps.add("local_dns.username", "local_dns.username only applies to adguard")
+		}
+		if ip := net.ParseIP(l.IPv4); l.IPv4 != "" && (ip == nil || ip.To4() == nil) {
+			ps.add("local_dns.ipv4", "local_dns.ipv4 must be an IPv4 address, not %q", l.IPv4)
+		}
+		if ip := net.ParseIP(l.IPv6); l.IPv6 != "" && (ip == nil || ip.To4() != nil) {
+			ps.add("local_dns.ipv6", "local_dns.ipv6 must be an IPv6 address, not %q", l.IPv6)
+		}
+		for i, name := range l.Names {
+			if name == "" || strings.ContainsAny(name, " \t,/") {
+				ps.add(fmt.Sprintf("local_dns.names[%d]", i), "local_dns.names: %q is not a host name", name)
+			}
+		}
+	}
+
+	if strings.ContainsAny(c.OwnerID, "\",= \t") {
+		ps.add("owner_id", "owner_id: %q must not contain quotes, commas, equals signs or whitespace", c.OwnerID)
+	}
+
+	if c.LogLevel != "" {
+		if _, err := ParseLogLevel(c.LogLevel); err != nil {
+			ps.add("log_level", "log_level: %w", err)
+		}
+	}
+
+	if c.MetricsTextfile != "" && !strings.HasSuffix(c.MetricsTextfile, ".prom") {
+		ps.add("metrics_textfile", "metrics_textfile must end in .prom to be read by the textfile collector")
+	}
+
+	if sd := c.StatsD; sd != nil {
+		if _, err := statsd.New(sd.Address, statsd.Options{}); err != nil {
+			ps.add("statsd.address", "statsd.address: %w", err)
+		}
+		if strings.ContainsAny(sd.Prefix, ":|@# \t") {
+			ps.add("statsd.prefix", "statsd.prefix: %q must not contain colons, pipes, at signs, hashes or whitespace", sd.Prefix)
+		}
+		if len(sd.Tags) > 0 && !sd.DogStatsD {
+			ps.add("statsd.tags", "statsd.tags needs dogstatsd, since plain StatsD has no tags")
+		}
+	}
+
+	if hb := c.Heartbeat; hb != nil {
+		if hb.Interval < 0 {
+			ps.add("heartbeat.interval", "heartbeat.interval must not be negative")
+		}
+		for _, domain := range c.Domains {
+			if hb.Name != "" && slices.ContainsFunc(domain.Records, func(r Record) bool { return r.Name == hb.Name }) {
+				ps.add("heartbeat.name", "heartbeat.name: %s is also a record of domain %s", hb.Name, domain.ZoneName)
+			}
+		}
 	}
-	if c.RefreshRate <= 0 {
-		return fmt.Errorf("refresh_rate must be greater than 0")
+
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil {
+		ps.add("bind_address", "bind_address must be an IP address")
 	}
-	if time.Duration(float64(time.Second)/c.RefreshRate) <= 0 {
-		return fmt.Errorf("refresh_rate is too high and results in an invalid interval")
+
+	if n := c.NTP; n != nil && (n.Interval < 0 || n.MaxSkew < 0) {
+		ps.add("ntp", "ntp.interval and ntp.max_skew must not be negative")
 	}
 
-	if math.IsNaN(c.SyncRate) || math.IsInf(c.SyncRate, 0) {
-		return fmt.Errorf("sync_rate must be a finite number")
+	if p := c.Propagation; p != nil {
+		if len(p.Resolvers)+len(p.Probes) == 0 {
+			ps.add("propagation", "propagation needs at least one resolver or probe")
+		}
+		for i, r := range p.Resolvers {
+			path := fmt.Sprintf("propagation.resolvers[%d]", i)
+			host := r
+			if h, port, err := net.SplitHostPort(r); err == nil {
+				if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+					ps.add(path, "propagation.resolvers: invalid port in %q", r)
+					continue
+				}
+				host = h
+			}
+			if net.ParseIP(host) == nil && (host == "" || strings.ContainsAny(host, "/: ")) {
+				ps.add(path, "propagation.resolvers: invalid resolver %q", r)
+			}
+		}
+		names := make(map[string]bool)
+		for _, r := range p.Resolvers {
+			names[r] = true
+		}
+		for i, probe := range p.Probes {
+			field := fmt.Sprintf("propagation.probes[%d]", i)
+			u, err := url.Parse(probe.URL)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				ps.add(field+".url", "%s: url must be an https URL", field)
+			}
+			if names[probe.ProbeName()] {
+				ps.add(field+".name", "%s: name %s is used twice", field, probe.ProbeName())
+			}
+			names[probe.ProbeName()] = true
+			if err := validateHeaders(field, probe.Headers); err != nil {
+				ps.add(field+".headers", "%w", err)
+			}
+		}
+		if p.Quorum < 0 || p.Quorum > len(p.Resolvers)+len(p.Probes) {
+			ps.add("propagation.quorum", "propagation.quorum must be between 0 and the number of resolvers and probes")
+		}
+		if p.Timeout < 0 || p.Interval < 0 {
+			ps.add("propagation", "propagation.timeout and propagation.interval must not be negative")
+		}
+	}
+
+	if d := c.Debug; d != nil {
+		if (d.Token == "") == (d.TokenFile == "") {
+			ps.add("debug", "debug needs exactly one of token or token_file")
+		}
+		if d.Interval < 0 {
+			ps.add("debug.interval", "debug.interval must not be negative")
+		}
 	}
-	if c.SyncRate <= 0 {
-		return fmt.Errorf("sync_rate must be greater than 0")
+
+	if a := c.API; a != nil && (a.Token == "") == (a.TokenFile == "") {
+		ps.add("api", "api needs exactly one of token or token_file")
 	}
-	if time.Duration(float64(time.Minute)/c.SyncRate) <= 0 {
-		return fmt.Errorf("sync_rate is too high and results in an invalid interval")
+
+	for i, addr := range c.HTTPListen {
+		if _, _, err := httpserver.ParseAddress(addr); err != nil {
+			ps.add(fmt.Sprintf("http_listen[%d]", i), "http_listen: %w", err)
+		}
+	}
+	if h := c.Health; h != nil {
+		for i, addr := range h.Listen {
+			if _, _, err := httpserver.ParseAddress(addr); err != nil {
+				ps.add(fmt.Sprintf("health.listen[%d]", i), "health.listen: %w", err)
+			}
+		}
+		if h.MaxAge < 0 {
+			ps.add("health.max_age", "health.max_age must not be negative")
+		}
 	}
 
 	if len(c.Domains) == 0 {
-		return fmt.Errorf("at least one domain must be configured")
+		ps.add("domains", "at least one domain must be configured")
 	}
 
-	for i, domain := range c.Domains {
-		if domain.ZoneName == "" {
-			return fmt.Errorf("domain %d: zone_name is required", i)
+	accounts := make(map[string]bool)
+	for i, account := range c.CloudflareAccounts {
+		path := fmt.Sprintf("cloudflare_accounts[%d]", i)
+		if account.Name == "" {
+			ps.add(path+".name", "cloudflare account %d: name is required", i)
+			continue
+		}
+		if accounts[account.Name] {
+			ps.add(path+".name", "cloudflare account %s: defined more than once", account.Name)
+			continue
+		}
+		accounts[account.Name] = true
+		if (account.APIToken == "") == (account.APITokenFile == "") {
+			ps.add(path, "cloudflare account %s: exactly one of api_token or api_token_file is required", account.Name)
 		}
+	}
+
+	for i := range c.Domains {
+		c.validateDomain(i, accounts, &ps)
+	}
+
+	return ps.err()
+}
+
+// validateDomain checks the i-th domain and its records, filling in the defaults of provider
+// and verify
+func (c *Config) validateDomain(i int, accounts map[string]bool, ps *problems) {
+	domain := &c.Domains[i]
+	path := fmt.Sprintf("domains[%d]", i)
+	if domain.ZoneName == "" {
+		ps.add(path, "domain %d: zone_name is required", i)
+		return
+	}
+	if domain.Provider != "" && len(domain.Providers) > 0 {
+		ps.add(path, "domain %s: provider and providers are mutually exclusive", domain.ZoneName)
+		return
+	}
+	if domain.Provider == "" && len(domain.Providers) == 0 {
+		domain.Provider = "cloudflare" // Default to cloudflare
+	}
+	seen := make(map[string]bool)
+	for _, provider := range domain.ProviderNames() {
+		field := path + ".provider"
 		if domain.Provider == "" {
-			domain.Provider = "cloudflare"
-			c.Domains[i].Provider = "cloudflare" // Default to cloudflare
+			field = path + ".providers"
 		}
-		if domain.Provider != "cloudflare" && domain.Provider != "route53" {
-			return fmt.Errorf("domain %s: unsupported provider %s", domain.ZoneName, domain.Provider)
+		if provider != "cloudflare" && provider != "route53" && provider != "exec" {
+			ps.add(field, "domain %s: unsupported provider %s", domain.ZoneName, provider)
+			continue
 		}
-		if len(domain.Records) == 0 {
-			return fmt.Errorf("domain %s: at least one record must be configured", domain.ZoneName)
+		if provider == "exec" && (c.Exec == nil || c.Exec.Command == "") {
+			ps.add(field, "domain %s: exec provider requires exec.command to be set", domain.ZoneName)
+		}
+		if seen[provider] {
+			ps.add(field, "domain %s: provider %s listed more than once", domain.ZoneName, provider)
+		}
+		seen[provider] = true
+	}
+	switch domain.Verify {
+	case "":
+		domain.Verify = VerifyContent
+	case VerifyContent, VerifyFull, VerifyResolver:
+	default:
+		ps.add(path+".verify", "domain %s: verify must be content, full or resolver", domain.ZoneName)
+	}
+	if domain.ZoneID != "" && len(domain.ProviderNames()) > 1 {
+		ps.add(path+".zone_id", "domain %s: zone_id cannot be used with multiple providers", domain.ZoneName)
+	}
+	if domain.APIToken != "" && domain.APITokenFile != "" {
+		ps.add(path, "domain %s: api_token and api_token_file are mutually exclusive", domain.ZoneName)
+	}
+	if (domain.APIToken != "" || domain.APITokenFile != "") && !seen["cloudflare"] {
+		ps.add(path, "domain %s: api_token is only supported by the cloudflare provider", domain.ZoneName)
+	}
+	if domain.AccountID != "" && !seen["cloudflare"] {
+		ps.add(path+".account_id", "domain %s: account_id is only supported by the cloudflare provider", domain.ZoneName)
+	}
+	if domain.Account != "" {
+		switch {
+		case !seen["cloudflare"]:
+			ps.add(path+".account", "domain %s: account is only supported by the cloudflare provider", domain.ZoneName)
+		case domain.APIToken != "" || domain.APITokenFile != "":
+			ps.add(path+".account", "domain %s: account and api_token are mutually exclusive", domain.ZoneName)
+		case !accounts[domain.Account]:
+			ps.add(path+".account", "domain %s: unknown cloudflare account %s", domain.ZoneName, domain.Account)
+		}
+	}
+	if domain.TTL != 0 && (domain.TTL < minRecordTTL || domain.TTL > maxRecordTTL) {
+		ps.add(path+".ttl", "domain %s: ttl must be between %d and %d seconds", domain.ZoneName, minRecordTTL, maxRecordTTL)
+	}
+	if domain.AliasWWW {
+		// Cleared once expanded, so validating the config again does not add www a second time
+		domain.AliasWWW = false
+		www, err := domain.wwwRecords()
+		if err != nil {
+			ps.add(path+".alias_www", "domain %s: alias_www: %w", domain.ZoneName, err)
 		}
+		domain.Records = append(domain.Records, www...)
+	}
+	if len(domain.Records) == 0 {
+		ps.add(path, "domain %s: at least one record must be configured", domain.ZoneName)
+		return
+	}
 
-		for j, record := range domain.Records {
-			if record.Name == "" {
-				return fmt.Errorf("domain %s, record %d: name is required", domain.ZoneName, j)
-			}
-			if record.Type != "A" && record.Type != "AAAA" {
-				return fmt.Errorf("domain %s, record %s: type must be A or AAAA", domain.ZoneName, record.Name)
+	names := make(map[string]int) // record name -> number of records
+	for _, record := range domain.Records {
+		names[record.Name]++
+	}
+
+	for j, record := range domain.Records {
+		path := fmt.Sprintf("%s.records[%d]", path, j)
+		switch {
+		case record.Name == "":
+			ps.add(path, "domain %s, record %d: name is required", domain.ZoneName, j)
+		case record.Type != "A" && record.Type != "AAAA" && record.Type != "CNAME":
+			ps.add(path+".type", "domain %s, record %s: type must be A, AAAA or CNAME, not %q", domain.ZoneName, record.Name, record.Type)
+		case record.TTL != 0 && (record.TTL < minRecordTTL || record.TTL > maxRecordTTL):
+			ps.add(path+".ttl", "domain %s, record %s: ttl must be between %d and %d seconds", domain.ZoneName, record.Name, minRecordTTL, maxRecordTTL)
+		case record.TTL != 0 && record.Proxied:
+			ps.add(path+".ttl", "domain %s, record %s: proxied records always use automatic TTL, remove ttl", domain.ZoneName, record.Name)
+		case record.CreateAfter < 0:
+			ps.add(path+".create_after", "domain %s, record %s: create_after must not be negative", domain.ZoneName, record.Name)
+		case record.PurgeCache && !record.Proxied:
+			ps.add(path+".purge_cache", "domain %s, record %s: purge_cache requires a proxied record, since only proxied hosts are cached", domain.ZoneName, record.Name)
+		case record.Type == "CNAME":
+			switch {
+			case record.Target == "":
+				ps.add(path, "domain %s, record %s: CNAME record requires target", domain.ZoneName, record.Name)
+			case record.Channel != "":
+				ps.add(path+".channel", "domain %s, record %s: CNAME record cannot use a channel", domain.ZoneName, record.Name)
+			case record.CreateAfter != 0:
+				ps.add(path+".create_after", "domain %s, record %s: create_after is only supported by A and AAAA records", domain.ZoneName, record.Name)
+			case names[record.Name] > 1:
+				ps.add(path+".name", "domain %s, record %s: CNAME record cannot share its name with other records", domain.ZoneName, record.Name)
+			case record.Name == "@" && (len(seen) > 1 || !seen["cloudflare"]):
+				ps.add(path+".name", "domain %s, record %s: CNAME at the zone apex is only supported by the cloudflare provider", domain.ZoneName, record.Name)
 			}
-			if record.Type == "AAAA" && !c.SupportsIPv6 {
-				return fmt.Errorf("domain %s, record %s: AAAA record configured but supports_ipv6 is false", domain.ZoneName, record.Name)
+		case record.Target != "":
+			ps.add(path+".target", "domain %s, record %s: target is only supported by CNAME records", domain.ZoneName, record.Name)
+		case record.Channel != "":
+			ch, ok := c.Channel(record.Channel)
+			if !ok {
+				ps.add(path+".channel", "domain %s, record %s: unknown channel %s", domain.ZoneName, record.Name, record.Channel)
+			} else if (record.Type == "A") != (ch.Family == "ipv4") {
+				ps.add(path+".channel", "domain %s, record %s: %s record cannot use %s channel %s", domain.ZoneName, record.Name, record.Type, ch.Family, ch.Name)
 			}
+		case record.Type == "AAAA" && !c.SupportsIPv6:
+			ps.add(path+".type", "domain %s, record %s: AAAA record configured but supports_ipv6 is false", domain.ZoneName, record.Name)
 		}
 	}
+}
+
+// validSourcePolicy reports whether policy is a known IP source disagreement policy
+func validSourcePolicy(policy string) bool {
+	switch policy {
+	case "", "first", "prefer-first", "majority", "hold":
+		return true
+	}
+	return false
+}
 
+// validate checks the source's URL and headers; field names it in errors
+func (src IPSource) validate(field string) error {
+	// Other types are checked against the source registry when the fetcher is built
+	if src.Type == "" || src.Type == "http" || src.URL != "" {
+		u, err := url.Parse(src.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: url must be an absolute http or https URL", field)
+		}
+	}
+	switch src.Network {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("%s: network must be tcp, tcp4 or tcp6", field)
+	}
+	if src.Connect != "" {
+		host := src.Connect
+		if h, _, err := net.SplitHostPort(src.Connect); err == nil {
+			host = h
+		}
+		if host == "" {
+			return fmt.Errorf("%s: connect must be an address or host:port", field)
+		}
+	}
+	if (src.Network != "" || src.Connect != "") && src.Type != "" && src.Type != "http" {
+		return fmt.Errorf("%s: network and connect are only supported by http sources", field)
+	}
+	return validateHeaders(field, src.Headers)
+}
+
+// validateHeaders checks that every header has a name and exactly one source for its value
+func validateHeaders(field string, headers []Header) error {
+	for _, h := range headers {
+		if h.Name == "" {
+			return fmt.Errorf("%s: header name is required", field)
+		}
+		set := 0
+		for _, v := range []string{h.Value, h.ValueFile, h.ValueEnv} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("%s: header %s needs exactly one of value, value_file or value_env", field, h.Name)
+		}
+	}
 	return nil
 }
@@ -1,11 +1,21 @@
 package config_test
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/msyrus/ipwatcher/internal/config"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig_Success(t *testing.T) {
@@ -93,6 +103,609 @@ func TestLoadConfig_InvalidYAML(t *testing.T) {
 	}
 }
 
+func TestLoadConfigProfile(t *testing.T) {
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+profile: staging
+notifications:
+  webhook_url: "https://hooks.example.com/prod"
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+profiles:
+  staging:
+    domains:
+      - zone_name: "staging.example.com"
+        records:
+          - name: "@"
+            type: "A"
+  production: {}
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	tests := []struct {
+		profile     string
+		wantProfile string
+		wantZone    string
+		expectError bool
+	}{
+		{profile: "", wantProfile: "staging", wantZone: "staging.example.com"},
+		{profile: "production", wantProfile: "production", wantZone: "example.com"},
+		{profile: "dev", expectError: true},
+	}
+
+	for _, tt := range tests {
+		cfg, err := config.LoadConfigProfile(configPath, tt.profile)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("profile %q: expected error, got nil", tt.profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("profile %q: LoadConfigProfile failed: %v", tt.profile, err)
+		}
+		if cfg.Profile != tt.wantProfile || cfg.Domains[0].ZoneName != tt.wantZone {
+			t.Errorf("profile %q: expected profile %s with zone %s, got %s with %s", tt.profile, tt.wantProfile, tt.wantZone, cfg.Profile, cfg.Domains[0].ZoneName)
+		}
+		// Sections a profile leaves out keep their top-level values
+		if cfg.Notifications == nil || cfg.Notifications.WebhookURL != "https://hooks.example.com/prod" {
+			t.Errorf("profile %q: expected the top-level notifications, got %+v", tt.profile, cfg.Notifications)
+		}
+	}
+}
+
+func TestLoadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `refresh_rate: 0.5
+sync_rate: 2.0
+include: ["conf.d/*.yaml"]
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+`,
+		"conf.d/10-example.org.yaml": `sync_rate: 2.0
+domains:
+  - zone_name: "example.org"
+    records:
+      - name: "vpn"
+        type: "A"
+`,
+		"conf.d/20-example.net.yaml": `refresh_rate: 0.5
+http_listen: [":9180"]
+domains:
+  - zone_name: "example.net"
+    records:
+      - name: "@"
+        type: "A"
+`,
+		"conf.d/README.md": "not a config fragment",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create temp config: %v", err)
+		}
+	}
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	var zones []string
+	for _, d := range cfg.Domains {
+		zones = append(zones, d.ZoneName)
+	}
+	if !slices.Equal(zones, []string{"example.com", "example.org", "example.net"}) {
+		t.Errorf("expected domains of the main file and fragments in order, got %v", zones)
+	}
+	if cfg.RefreshRate != 0.5 || len(cfg.HTTPListen) != 1 {
+		t.Errorf("expected settings of fragments to be merged, got refresh_rate %v and http_listen %v", cfg.RefreshRate, cfg.HTTPListen)
+	}
+
+	// A directory is loaded as if its files were included
+	cfg, err = config.LoadConfig(filepath.Join(dir, "conf.d"))
+	if err != nil {
+		t.Fatalf("LoadConfig of a directory failed: %v", err)
+	}
+	if len(cfg.Domains) != 2 || cfg.Domains[0].ZoneName != "example.org" {
+		t.Errorf("expected the domains of the directory, got %+v", cfg.Domains)
+	}
+
+	// Fragments must not disagree on a value
+	conflict := filepath.Join(dir, "conf.d", "30-conflict.yaml")
+	if err := os.WriteFile(conflict, []byte("refresh_rate: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Error("expected an error for fragments setting refresh_rate differently")
+	}
+
+	// Includes cannot nest and are not available to configs loaded from data
+	if err := os.WriteFile(conflict, []byte("include: [\"other/*.yaml\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Error("expected an error for a fragment including others")
+	}
+	if _, err := config.Parse([]byte(files["config.yaml"]), ""); err == nil {
+		t.Error("expected Parse to reject include")
+	}
+}
+
+func TestLoadConfig_ValidationProblems(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `refresh_rate: -1
+sync_rate: 1.0
+include: ["zones/*.yaml"]
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+      - name: "www"
+        type: "CNAM"
+`
+	fragment := `domains:
+  - zone_name: "example.org"
+    records:
+      - name: "vpn"
+        type: "AAAA"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "zones"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fragmentPath := filepath.Join(dir, "zones", "example.org.yaml")
+	if err := os.WriteFile(fragmentPath, []byte(fragment), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := config.LoadConfig(configPath)
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	want := []struct {
+		file         string
+		line, column int
+		path         string
+	}{
+		{configPath, 1, 15, "refresh_rate"},
+		{configPath, 10, 15, "domains[0].records[1].type"},
+		{fragmentPath, 5, 15, "domains[1].records[0].type"},
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), err)
+	}
+	for i, w := range want {
+		p := verr.Problems[i]
+		if p.File != w.file || p.Line != w.line || p.Column != w.column || p.Path != w.path {
+			t.Errorf("problem %d: expected %s at %s:%d:%d, got %s at %s:%d:%d", i, w.path, w.file, w.line, w.column, p.Path, p.File, p.Line, p.Column)
+		}
+	}
+	if msg := verr.Problems[1].Error(); !strings.HasPrefix(msg, configPath+":10:15: ") || !strings.Contains(msg, `"CNAM"`) {
+		t.Errorf("expected the problem to start with its location, got %q", msg)
+	}
+
+	// Problems of a profile are located in the profile's section
+	content = `refresh_rate: 1.0
+sync_rate: 1.0
+profile: staging
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+profiles:
+  staging:
+    domains:
+      - zone_name: "staging.example.com"
+        records:
+          - name: "@"
+            type: "MX"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.LoadConfig(configPath)
+	if !errors.As(err, &verr) || len(verr.Problems) != 1 || verr.Problems[0].Line != 15 {
+		t.Errorf("expected one problem at line 15, got %v", err)
+	}
+}
+
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	t.Setenv("IPWATCHER_REFRESH_RATE", "0.25")
+	t.Setenv("IPWATCHER_DOMAINS_0_ZONE_NAME", "example.org")
+	t.Setenv("IPWATCHER_DOMAINS_0_RECORDS_1_NAME", "vpn")
+	t.Setenv("IPWATCHER_DOMAINS_0_RECORDS_1_TYPE", "A")
+	t.Setenv("IPWATCHER_HTTP_LISTEN", "[':9180', ':9181']")
+	t.Setenv("IPWATCHER_RECORD_CACHE_FILE", "/var/cache/ipwatcher/records.json")
+	t.Setenv("IPWATCHER_ZONE", "not a config value")
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.RefreshRate != 0.25 || cfg.SyncRate != 2.0 {
+		t.Errorf("expected refresh_rate 0.25 and sync_rate 2, got %v and %v", cfg.RefreshRate, cfg.SyncRate)
+	}
+	if d := cfg.Domains[0]; d.ZoneName != "example.org" || len(d.Records) != 2 || d.Records[1].Name != "vpn" {
+		t.Errorf("expected zone example.org with records @ and vpn, got %+v", d)
+	}
+	if len(cfg.HTTPListen) != 2 || cfg.HTTPListen[1] != ":9181" {
+		t.Errorf("expected two http_listen addresses, got %v", cfg.HTTPListen)
+	}
+	if cfg.RecordCacheFile != "/var/cache/ipwatcher/records.json" {
+		t.Errorf("expected record_cache_file from the environment, got %q", cfg.RecordCacheFile)
+	}
+
+	// Invalid values and list gaps fail like a bad config file
+	t.Setenv("IPWATCHER_DOMAINS_0_RECORDS_5_NAME", "api")
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Error("expected an error for a list index past the end")
+	}
+	t.Setenv("IPWATCHER_DOMAINS_0_RECORDS_5_NAME", "")
+	os.Unsetenv("IPWATCHER_DOMAINS_0_RECORDS_5_NAME")
+	t.Setenv("IPWATCHER_SYNC_RATE", "often")
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Error("expected an error for a non-numeric sync_rate")
+	}
+}
+
+func TestLoadConfig_RecordSets(t *testing.T) {
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+record_sets:
+  web:
+    - name: "@"
+      type: "A"
+      proxied: true
+    - name: "www"
+      type: "A"
+      proxied: true
+domains:
+  - zone_name: "example.com"
+    record_sets: [web]
+  - zone_name: "example.org"
+    records:
+      - name: "vpn"
+        type: "A"
+    record_sets: [web]
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := map[string][]string{
+		"example.com": {"@", "www"},
+		"example.org": {"vpn", "@", "www"},
+	}
+	for _, domain := range cfg.Domains {
+		var names []string
+		for _, r := range domain.Records {
+			names = append(names, r.Name)
+		}
+		if !slices.Equal(names, want[domain.ZoneName]) {
+			t.Errorf("domain %s: expected records %v, got %v", domain.ZoneName, want[domain.ZoneName], names)
+		}
+	}
+
+	// Validating again must not add the shared records twice
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if len(cfg.Domains[0].Records) != 2 {
+		t.Errorf("Expected 2 records after validating again, got %d", len(cfg.Domains[0].Records))
+	}
+}
+
+func TestValidate_RecordSets(t *testing.T) {
+	tests := []struct {
+		name        string
+		sets        map[string][]config.Record
+		use         []string
+		expectError bool
+	}{
+		{name: "known set", sets: map[string][]config.Record{"web": {{Name: "@", Type: "A"}}}, use: []string{"web"}},
+		{name: "unknown set", sets: map[string][]config.Record{"web": {{Name: "@", Type: "A"}}}, use: []string{"mail"}, expectError: true},
+		{name: "empty set", sets: map[string][]config.Record{"web": nil}, expectError: true},
+		{name: "invalid record in set", sets: map[string][]config.Record{"web": {{Name: "@", Type: "MX"}}}, use: []string{"web"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				RecordSets:  tt.sets,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "vpn", Type: "A"}}, RecordSets: tt.use},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParse_NameVariables(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no host name: %v", err)
+	}
+	host, _, _ := strings.Cut(strings.ToLower(hostname), ".")
+	t.Setenv("SITE", "berlin")
+
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+record_sets:
+  host:
+    - name: "{{hostname}}.hosts"
+      type: "A"
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "{{env \"SITE\"}}-{{hostname}}"
+        type: "A"
+      - name: "vpn"
+        type: "A"
+    record_sets: [host]
+`
+	cfg, err := config.Parse([]byte(content), "")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := []string{"berlin-" + host, "vpn", host + ".hosts"}
+	var names []string
+	for _, r := range cfg.Domains[0].Records {
+		names = append(names, r.Name)
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("expected records %v, got %v", want, names)
+	}
+
+	tests := []struct {
+		name   string
+		record string
+	}{
+		{name: "unset variable", record: `{{env "IPWATCHER_TEST_UNSET"}}`},
+		{name: "unknown function", record: `{{user}}`},
+		{name: "unterminated", record: `{{hostname`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: tt.record, Type: "A"}}},
+				},
+			}
+			var verr *config.ValidationError
+			if err := cfg.Validate(); !errors.As(err, &verr) || verr.Problems[0].Path != "domains[0].records[0].name" {
+				t.Errorf("expected a problem at the record name, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DomainDefaults(t *testing.T) {
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+domains:
+  - zone_name: "example.com"
+    proxied: true
+    ttl: 300
+    records:
+      - name: "@"
+        type: "A"
+      - name: "vpn"
+        type: "A"
+        proxied: false
+      - name: "mail"
+        type: "A"
+        proxied: false
+        ttl: 0
+      - name: "api"
+        type: "A"
+        proxied: false
+        ttl: 120
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := map[string]struct {
+		proxied bool
+		ttl     int
+	}{
+		"@":    {proxied: true},
+		"vpn":  {ttl: 300},
+		"mail": {},
+		"api":  {ttl: 120},
+	}
+	for _, r := range cfg.Domains[0].Records {
+		w := want[r.Name]
+		if r.Proxied != w.proxied || r.TTL != w.ttl {
+			t.Errorf("record %s: expected proxied %v and ttl %d, got %v and %d", r.Name, w.proxied, w.ttl, r.Proxied, r.TTL)
+		}
+	}
+}
+
+func TestValidate_DomainDefaultsKeepRecordsBuiltInCode(t *testing.T) {
+	proxied := true
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		RecordSets:  map[string][]config.Record{"web": {{Name: "www", Type: "A"}}},
+		Domains: []config.Domain{
+			{ZoneName: "example.com", Proxied: &proxied, TTL: 300, Records: []config.Record{{Name: "@", Type: "A"}}, RecordSets: []string{"web"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	for _, r := range cfg.Domains[0].Records {
+		if r.Proxied || r.TTL != 0 {
+			t.Errorf("record %s: expected its own proxied false and ttl 0, got %v and %d", r.Name, r.Proxied, r.TTL)
+		}
+	}
+}
+
+func TestValidate_BindAddress(t *testing.T) {
+	for _, tt := range []struct {
+		addr        string
+		expectError bool
+	}{
+		{addr: "192.0.2.10"},
+		{addr: "2001:db8::10"},
+		{addr: "wan0", expectError: true},
+	} {
+		cfg := &config.Config{
+			RefreshRate: 1.0,
+			SyncRate:    1.0,
+			BindAddress: tt.addr,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if tt.expectError && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.addr)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.addr, err)
+		}
+	}
+}
+
+func TestValidate_Propagation(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		propagation config.Propagation
+		expectError bool
+	}{
+		{name: "hosts and ports", propagation: config.Propagation{Resolvers: []string{"1.1.1.1", "[2606:4700:4700::1111]:53", "dns.google"}}},
+		{name: "IPv6 without port", propagation: config.Propagation{Resolvers: []string{"2606:4700:4700::1111"}}},
+		{name: "no resolvers", expectError: true},
+		{name: "URL", propagation: config.Propagation{Resolvers: []string{"https://dns.google/dns-query"}}, expectError: true},
+		{name: "negative timeout", propagation: config.Propagation{Resolvers: []string{"1.1.1.1"}, Timeout: -time.Second}, expectError: true},
+		{name: "probes", propagation: config.Propagation{Probes: []config.Probe{{URL: "https://dns.google/resolve"}, {Name: "fra", URL: "https://probe.example.net/dns"}}, Quorum: 2}},
+		{name: "plain HTTP probe", propagation: config.Propagation{Probes: []config.Probe{{URL: "http://probe.example.net/dns"}}}, expectError: true},
+		{name: "duplicate probe name", propagation: config.Propagation{Resolvers: []string{"1.1.1.1"}, Probes: []config.Probe{{Name: "1.1.1.1", URL: "https://cloudflare-dns.com/dns-query"}}}, expectError: true},
+		{name: "probe header without value", propagation: config.Propagation{Probes: []config.Probe{{URL: "https://probe.example.net/dns", Headers: []config.Header{{Name: "X-Api-Key"}}}}}, expectError: true},
+		{name: "quorum above vantage points", propagation: config.Propagation{Resolvers: []string{"1.1.1.1"}, Quorum: 2}, expectError: true},
+	} {
+		cfg := &config.Config{
+			RefreshRate: 1.0,
+			SyncRate:    1.0,
+			Propagation: &tt.propagation,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if tt.expectError && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidate_LocalDNS(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		localDNS    config.LocalDNS
+		expectError bool
+	}{
+		{name: "pihole", localDNS: config.LocalDNS{Type: "pihole", URL: "http://pi.hole", Password: "secret"}},
+		{name: "adguard", localDNS: config.LocalDNS{Type: "adguard", URL: "https://adguard.lan", Username: "admin", PasswordFile: "/run/secrets/adguard"}},
+		{name: "dnsmasq", localDNS: config.LocalDNS{Type: "dnsmasq", ReloadCommand: []string{"systemctl", "restart", "dnsmasq"}}},
+		{name: "hosts with fixed addresses", localDNS: config.LocalDNS{Type: "hosts", File: "/etc/hosts", IPv4: "192.168.1.10", IPv6: "fd00::10"}},
+		{name: "unknown type", localDNS: config.LocalDNS{Type: "bind"}, expectError: true},
+		{name: "pihole without URL", localDNS: config.LocalDNS{Type: "pihole"}, expectError: true},
+		{name: "hosts with URL", localDNS: config.LocalDNS{Type: "hosts", URL: "http://pi.hole"}, expectError: true},
+		{name: "pihole with username", localDNS: config.LocalDNS{Type: "pihole", URL: "http://pi.hole", Username: "admin"}, expectError: true},
+		{name: "password and password file", localDNS: config.LocalDNS{Type: "adguard", URL: "http://adguard.lan", Password: "a", PasswordFile: "b"}, expectError: true},
+		{name: "IPv6 as ipv4", localDNS: config.LocalDNS{Type: "hosts", IPv4: "fd00::10"}, expectError: true},
+		{name: "invalid name", localDNS: config.LocalDNS{Type: "hosts", Names: []string{"home lan"}}, expectError: true},
+	} {
+		cfg := &config.Config{
+			RefreshRate: 1.0,
+			SyncRate:    1.0,
+			LocalDNS:    &tt.localDNS,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if tt.expectError && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidate_DomainTTLOutOfRange(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{ZoneName: "example.com", TTL: 30, Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for domain ttl below the minimum, got nil")
+	}
+}
+
 func TestValidate_InvalidRefreshRate(t *testing.T) {
 	cfg := &config.Config{
 		RefreshRate: 0,
@@ -329,3 +942,1514 @@ func TestValidate_SyncRateTooHigh(t *testing.T) {
 		t.Fatal("Expected error for sync_rate that produces invalid interval, got nil")
 	}
 }
+
+func TestValidate_MultipleProviders(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				ZoneName:  "example.com",
+				Providers: []string{"cloudflare", "route53"},
+				Records:   []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected no error for multi-provider domain, got: %v", err)
+	}
+	if cfg.Domains[0].Provider != "" {
+		t.Errorf("Expected provider to stay empty when providers is set, got %q", cfg.Domains[0].Provider)
+	}
+	if got := cfg.Domains[0].ProviderNames(); len(got) != 2 {
+		t.Errorf("Expected 2 provider names, got %v", got)
+	}
+}
+
+func TestValidate_MultipleProvidersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain config.Domain
+	}{
+		{
+			name: "provider and providers both set",
+			domain: config.Domain{
+				ZoneName:  "example.com",
+				Provider:  "cloudflare",
+				Providers: []string{"route53"},
+			},
+		},
+		{
+			name: "unsupported provider in list",
+			domain: config.Domain{
+				ZoneName:  "example.com",
+				Providers: []string{"cloudflare", "godaddy"},
+			},
+		},
+		{
+			name: "duplicate provider",
+			domain: config.Domain{
+				ZoneName:  "example.com",
+				Providers: []string{"route53", "route53"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.domain.Records = []config.Record{{Name: "@", Type: "A"}}
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains:     []config.Domain{tt.domain},
+			}
+			if err := cfg.Validate(); err == nil {
+				t.Fatal("Expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ExecProvider(t *testing.T) {
+	content := "refresh_rate: 0.5\n" +
+		"sync_rate: 1\n" +
+		"exec:\n" +
+		"  command: /usr/local/bin/update-dns\n" +
+		"  args: [\"--verbose\"]\n" +
+		"  timeout: 45s\n" +
+		"domains:\n" +
+		"  - zone_name: example.com\n" +
+		"    provider: exec\n" +
+		"    records:\n" +
+		"      - name: \"@\"\n" +
+		"        type: A\n"
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Exec == nil || cfg.Exec.Command != "/usr/local/bin/update-dns" {
+		t.Fatalf("Expected exec command to be parsed, got %+v", cfg.Exec)
+	}
+	if cfg.Exec.Timeout != 45*time.Second {
+		t.Errorf("Expected exec timeout 45s, got %v", cfg.Exec.Timeout)
+	}
+}
+
+func TestValidate_ExecProviderWithoutCommand(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				ZoneName: "example.com",
+				Provider: "exec",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected error for exec provider without exec.command, got nil")
+	}
+}
+
+func TestDomain_CloudflareToken(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	inline := config.Domain{ZoneName: "example.com", APIToken: "inline-token"}
+	if got, err := inline.CloudflareToken(); err != nil || got != "inline-token" {
+		t.Errorf("Expected inline-token, got %q (err %v)", got, err)
+	}
+
+	fromFile := config.Domain{ZoneName: "example.com", APITokenFile: tokenPath}
+	if got, err := fromFile.CloudflareToken(); err != nil || got != "file-token" {
+		t.Errorf("Expected file-token, got %q (err %v)", got, err)
+	}
+
+	missing := config.Domain{ZoneName: "example.com", APITokenFile: filepath.Join(t.TempDir(), "missing")}
+	if _, err := missing.CloudflareToken(); err == nil {
+		t.Error("Expected error for missing token file")
+	}
+}
+
+func TestDomain_ProviderKey(t *testing.T) {
+	shared := config.Domain{ZoneName: "example.com"}
+	if got := shared.ProviderKey("cloudflare"); got != "cloudflare" {
+		t.Errorf("Expected shared cloudflare key, got %s", got)
+	}
+
+	scoped := config.Domain{ZoneName: "example.com", APIToken: "token", Providers: []string{"cloudflare", "route53"}}
+	if got := scoped.ProviderKey("cloudflare"); got != "cloudflare:example.com" {
+		t.Errorf("Expected zone-scoped cloudflare key, got %s", got)
+	}
+	if got := scoped.ProviderKey("route53"); got != "route53" {
+		t.Errorf("Expected route53 key to be unaffected by api_token, got %s", got)
+	}
+}
+
+func TestValidate_APITokenInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain config.Domain
+	}{
+		{
+			name:   "api_token and api_token_file both set",
+			domain: config.Domain{ZoneName: "example.com", APIToken: "token", APITokenFile: "/run/secrets/token"},
+		},
+		{
+			name:   "api_token on route53 domain",
+			domain: config.Domain{ZoneName: "example.com", Provider: "route53", APIToken: "token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.domain.Records = []config.Record{{Name: "@", Type: "A"}}
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains:     []config.Domain{tt.domain},
+			}
+			if err := cfg.Validate(); err == nil {
+				t.Fatal("Expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestConfig_Priorities(t *testing.T) {
+	cfg := &config.Config{
+		Domains: []config.Domain{
+			{
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "www", Type: "A"},
+					{Name: "mail", Type: "A", Priority: 10},
+				},
+			},
+			{
+				ZoneName: "example.net",
+				Records: []config.Record{
+					{Name: "vpn", Type: "A", Priority: 10},
+					{Name: "legacy", Type: "A", Priority: -5},
+				},
+			},
+		},
+	}
+
+	got := cfg.Priorities()
+	expected := []int{10, 0, -5}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected priorities %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected priorities %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestValidate_CloudflareAccounts(t *testing.T) {
+	newConfig := func(accounts []config.CloudflareAccount, domain config.Domain) *config.Config {
+		domain.Records = []config.Record{{Name: "@", Type: "A"}}
+		return &config.Config{
+			RefreshRate:        1.0,
+			SyncRate:           1.0,
+			CloudflareAccounts: accounts,
+			Domains:            []config.Domain{domain},
+		}
+	}
+	clientA := config.CloudflareAccount{Name: "client-a", APIToken: "token-a"}
+
+	if err := newConfig([]config.CloudflareAccount{clientA}, config.Domain{ZoneName: "a.com", Account: "client-a"}).Validate(); err != nil {
+		t.Fatalf("Expected valid account config, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		accounts []config.CloudflareAccount
+		domain   config.Domain
+	}{
+		{
+			name:     "unknown account",
+			accounts: []config.CloudflareAccount{clientA},
+			domain:   config.Domain{ZoneName: "a.com", Account: "client-b"},
+		},
+		{
+			name:     "duplicate account",
+			accounts: []config.CloudflareAccount{clientA, clientA},
+			domain:   config.Domain{ZoneName: "a.com", Account: "client-a"},
+		},
+		{
+			name:     "account without token",
+			accounts: []config.CloudflareAccount{{Name: "client-a"}},
+			domain:   config.Domain{ZoneName: "a.com", Account: "client-a"},
+		},
+		{
+			name:     "account and api_token on domain",
+			accounts: []config.CloudflareAccount{clientA},
+			domain:   config.Domain{ZoneName: "a.com", Account: "client-a", APIToken: "token"},
+		},
+		{
+			name:     "account on route53 domain",
+			accounts: []config.CloudflareAccount{clientA},
+			domain:   config.Domain{ZoneName: "a.com", Provider: "route53", Account: "client-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newConfig(tt.accounts, tt.domain).Validate(); err == nil {
+				t.Fatal("Expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestDomain_ProviderKey_Account(t *testing.T) {
+	d := config.Domain{ZoneName: "a.com", Account: "client-a"}
+	if got := d.ProviderKey("cloudflare"); got != config.CloudflareAccountKey("client-a") {
+		t.Errorf("Expected account provider key, got %s", got)
+	}
+}
+
+func TestConfig_CloudflareAccountID(t *testing.T) {
+	cfg := &config.Config{
+		CloudflareAccounts: []config.CloudflareAccount{
+			{Name: "client-a", AccountID: "account-a", APIToken: "token-a"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		domain   config.Domain
+		expected string
+	}{
+		{name: "no account", domain: config.Domain{ZoneName: "a.com"}, expected: ""},
+		{name: "domain account_id", domain: config.Domain{ZoneName: "a.com", AccountID: "account-x"}, expected: "account-x"},
+		{name: "inherited from account", domain: config.Domain{ZoneName: "a.com", Account: "client-a"}, expected: "account-a"},
+		{name: "domain overrides account", domain: config.Domain{ZoneName: "a.com", Account: "client-a", AccountID: "account-x"}, expected: "account-x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.CloudflareAccountID(tt.domain); got != tt.expected {
+				t.Errorf("Expected account ID %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidate_InvalidAuditRate(t *testing.T) {
+	for _, rate := range []float64{-1, math.NaN(), math.Inf(1), 1e20} {
+		cfg := &config.Config{
+			RefreshRate: 1.0,
+			SyncRate:    1.0,
+			AuditRate:   rate,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for audit_rate %v, got nil", rate)
+		}
+	}
+}
+
+func TestValidate_ZoneIDWithMultipleProviders(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				ZoneName:  "example.com",
+				ZoneID:    "zone-123",
+				Providers: []string{"cloudflare", "route53"},
+				Records:   []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected error for zone_id with multiple providers, got nil")
+	}
+
+	cfg.Domains[0].Providers = nil
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected zone_id with a single provider to be valid, got: %v", err)
+	}
+}
+
+func TestValidate_HTTPListen(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		HTTPListen:  []string{"127.0.0.1:8080", "[::1]:8080", "unix:/run/ipwatcher/http.sock"},
+		Domains: []config.Domain{
+			{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid http_listen, got: %v", err)
+	}
+
+	cfg.HTTPListen = append(cfg.HTTPListen, "8080")
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected error for http_listen address without a port, got nil")
+	}
+}
+
+func TestValidate_CloudflareBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL     string
+		expectError bool
+	}{
+		{baseURL: ""},
+		{baseURL: "https://cf-gateway.internal/client/v4"},
+		{baseURL: "http://127.0.0.1:8787"},
+		{baseURL: "cf-gateway.internal/client/v4", expectError: true},
+		{baseURL: "ftp://cf-gateway.internal", expectError: true},
+		{baseURL: "https://", expectError: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{
+			RefreshRate:       1.0,
+			SyncRate:          1.0,
+			CloudflareBaseURL: tt.baseURL,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if tt.expectError && err == nil {
+			t.Errorf("Expected error for cloudflare_base_url %q, got nil", tt.baseURL)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("Expected cloudflare_base_url %q to be valid, got: %v", tt.baseURL, err)
+		}
+	}
+}
+
+func TestValidate_IPSources(t *testing.T) {
+	valid := config.IPSource{
+		URL:    "https://echo.example/ip",
+		Family: "ipv4",
+		Headers: []config.Header{
+			{Name: "X-API-Key", ValueEnv: "ECHO_API_KEY"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		source      config.IPSource
+		expectError bool
+	}{
+		{name: "valid", source: valid},
+		{name: "relative URL", source: config.IPSource{URL: "echo.example/ip", Family: "ipv4"}, expectError: true},
+		{name: "unknown family", source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv5"}, expectError: true},
+		{name: "ipv6 without support", source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv6"}, expectError: true},
+		{name: "typed source without URL", source: config.IPSource{Type: "router", Family: "ipv4", Options: map[string]string{"host": "192.168.1.1"}}},
+		{name: "http source without URL", source: config.IPSource{Type: "http", Family: "ipv4"}, expectError: true},
+		{name: "typed source with relative URL", source: config.IPSource{Type: "router", URL: "192.168.1.1", Family: "ipv4"}, expectError: true},
+		{name: "pinned network and connect", source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv4", Network: "tcp4", Connect: "192.0.2.10:443"}},
+		{name: "unknown network", source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv4", Network: "udp"}, expectError: true},
+		{name: "network on typed source", source: config.IPSource{Type: "router", Family: "ipv4", Network: "tcp4"}, expectError: true},
+		{
+			name: "header without value",
+			source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv4", Headers: []config.Header{
+				{Name: "X-API-Key"},
+			}},
+			expectError: true,
+		},
+		{
+			name: "header with two values",
+			source: config.IPSource{URL: "https://echo.example/ip", Family: "ipv4", Headers: []config.Header{
+				{Name: "X-API-Key", Value: "inline", ValueFile: "/run/secrets/echo"},
+			}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				IPSources:   []config.IPSource{tt.source},
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestHeader_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "echo-key")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("IPWATCHER_TEST_ECHO_KEY", "from-env")
+
+	tests := []struct {
+		header      config.Header
+		expected    string
+		expectError bool
+	}{
+		{header: config.Header{Name: "X-API-Key", Value: "inline"}, expected: "inline"},
+		{header: config.Header{Name: "X-API-Key", ValueFile: file}, expected: "from-file"},
+		{header: config.Header{Name: "X-API-Key", ValueEnv: "IPWATCHER_TEST_ECHO_KEY"}, expected: "from-env"},
+		{header: config.Header{Name: "X-API-Key", ValueFile: filepath.Join(dir, "missing")}, expectError: true},
+		{header: config.Header{Name: "X-API-Key", ValueEnv: "IPWATCHER_TEST_UNSET"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		value, err := tt.header.Resolve()
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %+v, got nil", tt.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %+v: %v", tt.header, err)
+			continue
+		}
+		if value != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, value)
+		}
+	}
+}
+
+func TestValidate_IPSourcePolicy(t *testing.T) {
+	for policy, valid := range map[string]bool{"": true, "first": true, "prefer-first": true, "majority": true, "hold": true, "random": false} {
+		cfg := &config.Config{
+			RefreshRate:    1.0,
+			SyncRate:       1.0,
+			IPSourcePolicy: policy,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if valid && err != nil {
+			t.Errorf("Expected ip_source_policy %q to be valid, got: %v", policy, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected error for ip_source_policy %q, got nil", policy)
+		}
+	}
+}
+
+func TestValidate_CloudflareTags(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:    1.0,
+		SyncRate:       1.0,
+		CloudflareTags: []string{"managed-by:ipwatcher", "env:"},
+		Domains: []config.Domain{
+			{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid cloudflare_tags, got: %v", err)
+	}
+
+	for _, tag := range []string{"managed-by", ":ipwatcher"} {
+		cfg.CloudflareTags = []string{tag}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for cloudflare tag %q, got nil", tag)
+		}
+	}
+}
+
+func TestValidate_IntervalJitter(t *testing.T) {
+	for _, tt := range []struct {
+		jitter      float64
+		expectError bool
+	}{
+		{jitter: 0},
+		{jitter: 0.2},
+		{jitter: 1},
+		{jitter: -0.1, expectError: true},
+		{jitter: 1.5, expectError: true},
+		{jitter: math.NaN(), expectError: true},
+	} {
+		cfg := &config.Config{
+			RefreshRate:    1.0,
+			SyncRate:       1.0,
+			IntervalJitter: tt.jitter,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if tt.expectError && err == nil {
+			t.Errorf("Expected error for interval_jitter %v, got nil", tt.jitter)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("Unexpected error for interval_jitter %v: %v", tt.jitter, err)
+		}
+	}
+}
+
+func TestValidate_CloudflareRetry(t *testing.T) {
+	jitter := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name        string
+		retry       config.Retry
+		expectError bool
+	}{
+		{name: "custom", retry: config.Retry{Attempts: 5, BaseDelay: 500 * time.Millisecond, Jitter: jitter(0.5)}},
+		{name: "no jitter", retry: config.Retry{Jitter: jitter(0)}},
+		{name: "negative attempts", retry: config.Retry{Attempts: -1}, expectError: true},
+		{name: "negative base delay", retry: config.Retry{BaseDelay: -time.Second}, expectError: true},
+		{name: "jitter above one", retry: config.Retry{Jitter: jitter(1.5)}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate:     1.0,
+				SyncRate:        1.0,
+				CloudflareRetry: &tt.retry,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_CloudflareCircuitBreaker(t *testing.T) {
+	failures := func(n int) *int { return &n }
+	tests := []struct {
+		name        string
+		breaker     config.CircuitBreaker
+		expectError bool
+	}{
+		{name: "custom", breaker: config.CircuitBreaker{Failures: failures(3), Cooldown: time.Minute}},
+		{name: "disabled", breaker: config.CircuitBreaker{Failures: failures(0)}},
+		{name: "negative failures", breaker: config.CircuitBreaker{Failures: failures(-1)}, expectError: true},
+		{name: "negative cooldown", breaker: config.CircuitBreaker{Cooldown: -time.Minute}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate:              1.0,
+				SyncRate:                 1.0,
+				CloudflareCircuitBreaker: &tt.breaker,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_Batch(t *testing.T) {
+	cfg, err := config.Parse([]byte(`refresh_rate: 1.0
+sync_rate: 1.0
+cloudflare_batch:
+  max_changes: 50
+  delay: 2s
+route53_batch:
+  delay: 0s
+domains:
+  - zone_name: example.com
+    records:
+      - {name: "@", type: A}
+`), "")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if b := cfg.CloudflareBatch; b == nil || b.MaxChanges != 50 || b.Delay == nil || *b.Delay != 2*time.Second {
+		t.Errorf("unexpected cloudflare_batch %+v", b)
+	}
+	if b := cfg.Route53Batch; b == nil || b.MaxChanges != 0 || b.Delay == nil || *b.Delay != 0 {
+		t.Errorf("expected route53_batch to keep an explicit zero delay, got %+v", b)
+	}
+
+	delay := -time.Second
+	cfg.CloudflareBatch = &config.Batch{MaxChanges: -1}
+	cfg.Route53Batch = &config.Batch{Delay: &delay}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected errors for a negative batch size and delay, got nil")
+	}
+	for _, want := range []string{"cloudflare_batch.max_changes", "route53_batch.delay"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %s in %v", want, err)
+		}
+	}
+}
+
+func TestValidate_WorkersKV(t *testing.T) {
+	tests := []struct {
+		name        string
+		kv          config.WorkersKV
+		expectError bool
+	}{
+		{name: "valid", kv: config.WorkersKV{AccountID: "account", NamespaceID: "namespace"}},
+		{name: "own token", kv: config.WorkersKV{AccountID: "account", NamespaceID: "namespace", APIToken: "token"}},
+		{name: "missing account", kv: config.WorkersKV{NamespaceID: "namespace"}, expectError: true},
+		{name: "missing namespace", kv: config.WorkersKV{AccountID: "account"}, expectError: true},
+		{name: "token and token file", kv: config.WorkersKV{AccountID: "account", NamespaceID: "namespace", APIToken: "token", APITokenFile: "/run/secrets/kv"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				WorkersKV:   &tt.kv,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_OwnerID(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		OwnerID:     "home-router",
+		Domains: []config.Domain{
+			{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid owner_id, got: %v", err)
+	}
+
+	for _, owner := range []string{"home router", "a,b", "a=b", `"home"`} {
+		cfg.OwnerID = owner
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for owner_id %q, got nil", owner)
+		}
+	}
+}
+
+func TestValidate_Route53WebIdentity(t *testing.T) {
+	tests := []struct {
+		name        string
+		route53     config.Route53Config
+		expectError bool
+	}{
+		{name: "token file", route53: config.Route53Config{RoleARN: "arn:aws:iam::123456789012:role/ipwatcher", WebIdentityTokenFile: "/var/run/secrets/token"}},
+		{name: "github actions", route53: config.Route53Config{RoleARN: "arn:aws:iam::123456789012:role/ipwatcher", GitHubActionsOIDC: true}},
+		{name: "no role", route53: config.Route53Config{WebIdentityTokenFile: "/var/run/secrets/token"}, expectError: true},
+		{name: "no token", route53: config.Route53Config{RoleARN: "arn:aws:iam::123456789012:role/ipwatcher"}, expectError: true},
+		{name: "both tokens", route53: config.Route53Config{RoleARN: "arn:aws:iam::123456789012:role/ipwatcher", WebIdentityTokenFile: "/token", GitHubActionsOIDC: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Route53:     &tt.route53,
+				Domains: []config.Domain{
+					{Provider: "route53", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RecordTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      config.Record
+		expectError bool
+	}{
+		{name: "default", record: config.Record{Name: "@", Type: "A"}},
+		{name: "custom", record: config.Record{Name: "@", Type: "A", TTL: 120}},
+		{name: "too low", record: config.Record{Name: "@", Type: "A", TTL: 30}, expectError: true},
+		{name: "too high", record: config.Record{Name: "@", Type: "A", TTL: 172800}, expectError: true},
+		{name: "negative", record: config.Record{Name: "@", Type: "A", TTL: -1}, expectError: true},
+		{name: "proxied", record: config.Record{Name: "@", Type: "A", Proxied: true, TTL: 120}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{tt.record}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RecordPurgeCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      config.Record
+		expectError bool
+	}{
+		{name: "proxied", record: config.Record{Name: "@", Type: "A", Proxied: true, PurgeCache: true}},
+		{name: "not proxied", record: config.Record{Name: "@", Type: "A", PurgeCache: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{tt.record}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_RecordCreateAfter(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      config.Record
+		expectError bool
+	}{
+		{name: "address record", record: config.Record{Name: "@", Type: "A", CreateAfter: 10 * time.Minute}},
+		{name: "negative", record: config.Record{Name: "@", Type: "A", CreateAfter: -time.Minute}, expectError: true},
+		{name: "CNAME", record: config.Record{Name: "www", Type: "CNAME", Target: "example.com", CreateAfter: time.Minute}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{tt.record}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_Channels(t *testing.T) {
+	lte := config.Channel{Name: "lte-backup", Family: "ipv4", Sources: []config.IPSource{{URL: "https://echo.lte.example/ip"}}}
+	tests := []struct {
+		name        string
+		channels    []config.Channel
+		record      config.Record
+		expectError bool
+	}{
+		{name: "valid", channels: []config.Channel{lte}, record: config.Record{Name: "@", Type: "A", Channel: "lte-backup"}},
+		{name: "unknown channel", channels: []config.Channel{lte}, record: config.Record{Name: "@", Type: "A", Channel: "wan6"}, expectError: true},
+		{name: "family mismatch", channels: []config.Channel{lte}, record: config.Record{Name: "@", Type: "AAAA", Channel: "lte-backup"}, expectError: true},
+		{name: "duplicate", channels: []config.Channel{lte, lte}, record: config.Record{Name: "@", Type: "A"}, expectError: true},
+		{name: "missing name", channels: []config.Channel{{Family: "ipv4", Sources: lte.Sources}}, record: config.Record{Name: "@", Type: "A"}, expectError: true},
+		{name: "no sources", channels: []config.Channel{{Name: "wan4", Family: "ipv4"}}, record: config.Record{Name: "@", Type: "A"}, expectError: true},
+		{name: "source family mismatch", channels: []config.Channel{{Name: "wan4", Family: "ipv4", Sources: []config.IPSource{{URL: "https://echo.example/ip", Family: "ipv6"}}}}, record: config.Record{Name: "@", Type: "A"}, expectError: true},
+		{name: "invalid policy", channels: []config.Channel{{Name: "wan4", Family: "ipv4", Sources: lte.Sources, Policy: "random"}}, record: config.Record{Name: "@", Type: "A"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Channels:    tt.channels,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{tt.record}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_CNAME(t *testing.T) {
+	tests := []struct {
+		name        string
+		providers   []string
+		records     []config.Record
+		expectError bool
+	}{
+		{name: "valid", records: []config.Record{{Name: "@", Type: "A"}, {Name: "www", Type: "CNAME", Target: "example.com"}}},
+		{name: "missing target", records: []config.Record{{Name: "www", Type: "CNAME"}}, expectError: true},
+		{name: "target on A record", records: []config.Record{{Name: "www", Type: "A", Target: "example.com"}}, expectError: true},
+		{name: "shared name", records: []config.Record{{Name: "www", Type: "A"}, {Name: "www", Type: "CNAME", Target: "example.com"}}, expectError: true},
+		{name: "apex on cloudflare", records: []config.Record{{Name: "@", Type: "CNAME", Target: "example.net"}}},
+		{name: "apex on route53", providers: []string{"route53"}, records: []config.Record{{Name: "@", Type: "CNAME", Target: "example.net"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Providers: tt.providers, Records: tt.records},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_MetricsTextfile(t *testing.T) {
+	for path, expectError := range map[string]bool{
+		"":                                      false,
+		"/var/lib/node_exporter/ipwatcher.prom": false,
+		"/var/lib/node_exporter/ipwatcher.txt":  true,
+	} {
+		cfg := &config.Config{
+			RefreshRate:     1.0,
+			SyncRate:        1.0,
+			MetricsTextfile: path,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		if err := cfg.Validate(); (err != nil) != expectError {
+			t.Errorf("metrics_textfile %q: expected error %t, got %v", path, expectError, err)
+		}
+	}
+}
+
+func TestValidate_StatsD(t *testing.T) {
+	tests := []struct {
+		name        string
+		statsd      config.StatsD
+		expectError bool
+	}{
+		{name: "udp", statsd: config.StatsD{Address: "127.0.0.1:8125"}},
+		{name: "dogstatsd socket", statsd: config.StatsD{Address: "unix:/var/run/datadog/dsd.socket", DogStatsD: true, Tags: []string{"env:prod"}}},
+		{name: "no address", statsd: config.StatsD{}, expectError: true},
+		{name: "no port", statsd: config.StatsD{Address: "localhost"}, expectError: true},
+		{name: "bad prefix", statsd: config.StatsD{Address: "127.0.0.1:8125", Prefix: "home|dns"}, expectError: true},
+		{name: "tags without dogstatsd", statsd: config.StatsD{Address: "127.0.0.1:8125", Tags: []string{"env:prod"}}, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				StatsD:      &tt.statsd,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Expected error %t, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := config.ParseLogLevel("warn,dnsmanager=debug, sync=ERROR")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for module, want := range map[string]slog.Level{"": slog.LevelWarn, "ip": slog.LevelWarn, "dnsmanager": slog.LevelDebug, "sync": slog.LevelError} {
+		if got := level.Level(module); got != want {
+			t.Errorf("Expected %s for module %q, got %s", want, module, got)
+		}
+	}
+
+	// The default level can be left out
+	level, err = config.ParseLogLevel("sync=warn")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if level.Default != slog.LevelInfo || level.Level("sync") != slog.LevelWarn {
+		t.Errorf("Expected info with sync at warn, got %+v", level)
+	}
+}
+
+func TestValidate_LogLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		logLevel    string
+		expectError bool
+	}{
+		{name: "level", logLevel: "debug"},
+		{name: "overrides", logLevel: "info,dnsmanager=debug,sync=warn"},
+		{name: "unknown level", logLevel: "loud", expectError: true},
+		{name: "unknown module", logLevel: "info,cloudflare=debug", expectError: true},
+		{name: "default after overrides", logLevel: "sync=warn,debug", expectError: true},
+		{name: "empty override", logLevel: "info,", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate: 1.0,
+				SyncRate:    1.0,
+				LogLevel:    tt.logLevel,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Expected error %t, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestValidate_SyncSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		syncRate    float64
+		schedule    string
+		expectError bool
+	}{
+		{name: "schedule without rate", schedule: "*/15 * * * *"},
+		{name: "macro", schedule: "@hourly"},
+		{name: "invalid schedule", syncRate: 1.0, schedule: "*/15 * * *", expectError: true},
+		{name: "neither", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate:  1.0,
+				SyncRate:     tt.syncRate,
+				SyncSchedule: tt.schedule,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"@", "@"},
+		{"www", "www"},
+		{"example.com", "@"},
+		{"example.com.", "@"},
+		{"www.example.com", "www"},
+		{"WWW.Example.COM.", "WWW"},
+		{"a.b.example.com", "a.b"},
+		{"www.example.net", "www.example.net"},
+		{"wwwexample.com", "wwwexample.com"},
+	}
+	for _, tt := range tests {
+		if got := config.RelativeName(tt.name, "example.com"); got != tt.want {
+			t.Errorf("RelativeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_NormalizesRecordNames(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{ZoneName: "example.com", Records: []config.Record{{Name: "example.com", Type: "A"}, {Name: "www.example.com.", Type: "A"}}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := cfg.Domains[0].Records; got[0].Name != "@" || got[1].Name != "www" {
+		t.Errorf("Expected names @ and www, got %s and %s", got[0].Name, got[1].Name)
+	}
+}
+
+func TestValidate_InternationalizedNames(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{ZoneName: "München.example", Records: []config.Record{
+				{Name: "@", Type: "A"},
+				{Name: "büro", Type: "A"},
+				{Name: "www.münchen.example.", Type: "A"},
+				{Name: "_acme", Type: "CNAME", Target: "prüfung.example.net"},
+			}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	domain := cfg.Domains[0]
+	if domain.ZoneName != "xn--mnchen-3ya.example" {
+		t.Errorf("Expected zone xn--mnchen-3ya.example, got %s", domain.ZoneName)
+	}
+	want := []string{"@", "xn--bro-hoa", "www", "_acme"}
+	for i, name := range want {
+		if got := domain.Records[i].Name; got != name {
+			t.Errorf("Record %d: expected name %s, got %s", i, name, got)
+		}
+	}
+	if got := domain.Records[3].Target; got != "xn--prfung-4ya.example.net" {
+		t.Errorf("Expected target xn--prfung-4ya.example.net, got %s", got)
+	}
+
+	cfg.Domains[0].ZoneName = "a\u200db.example" // A zero width joiner is only valid after a virama
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for an invalid internationalized zone name")
+	}
+}
+
+func TestValidate_Verify(t *testing.T) {
+	for verify, expectError := range map[string]bool{
+		"":         false,
+		"content":  false,
+		"full":     false,
+		"resolver": false,
+		"deep":     true,
+	} {
+		cfg := &config.Config{
+			RefreshRate: 1.0,
+			SyncRate:    1.0,
+			Domains: []config.Domain{
+				{ZoneName: "example.com", Verify: verify, Records: []config.Record{{Name: "@", Type: "A"}}},
+			},
+		}
+		err := cfg.Validate()
+		if (err != nil) != expectError {
+			t.Errorf("verify %q: expected error %t, got %v", verify, expectError, err)
+		}
+		if verify == "" && err == nil && cfg.Domains[0].Verify != config.VerifyContent {
+			t.Errorf("Expected verify to default to content, got %q", cfg.Domains[0].Verify)
+		}
+	}
+}
+
+func TestValidate_AliasWWW(t *testing.T) {
+	tests := []struct {
+		name        string
+		providers   []string
+		records     []config.Record
+		want        []config.Record
+		expectError bool
+	}{
+		{
+			name:      "cname",
+			providers: []string{"cloudflare", "route53"},
+			records:   []config.Record{{Name: "@", Type: "A", Proxied: true, Priority: 5}, {Name: "@", Type: "AAAA", Proxied: true, Priority: 5}},
+			want:      []config.Record{{Name: "www", Type: "CNAME", Proxied: true, Priority: 5, Target: "example.com"}},
+		},
+		{
+			name:      "exec copies addresses",
+			providers: []string{"exec"},
+			records:   []config.Record{{Name: "@", Type: "A", TTL: 120}, {Name: "vpn", Type: "A"}},
+			want:      []config.Record{{Name: "www", Type: "A", TTL: 120}},
+		},
+		{name: "no apex", providers: []string{"cloudflare"}, records: []config.Record{{Name: "vpn", Type: "A"}}, expectError: true},
+		{name: "www configured", providers: []string{"cloudflare"}, records: []config.Record{{Name: "@", Type: "A"}, {Name: "www", Type: "A"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate:  1.0,
+				SyncRate:     1.0,
+				SupportsIPv6: true,
+				Exec:         &config.ExecConfig{Command: "/usr/local/bin/update-dns"},
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Providers: tt.providers, AliasWWW: true, Records: tt.records},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got := cfg.Domains[0].Records[len(tt.records):]
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d www records, got %+v", len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %+v, got %+v", tt.want[i], got[i])
+				}
+			}
+
+			// Validating again keeps the expanded records as they are
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Unexpected error validating again: %v", err)
+			}
+			if n := len(cfg.Domains[0].Records); n != len(tt.records)+len(tt.want) {
+				t.Errorf("Expected %d records after validating again, got %+v", len(tt.records)+len(tt.want), cfg.Domains[0].Records)
+			}
+		})
+	}
+}
+
+func TestNotifications_Enabled(t *testing.T) {
+	var unset *config.Notifications
+	if unset.Enabled("start") {
+		t.Error("Expected notifications to be disabled when unset")
+	}
+
+	all := &config.Notifications{WebhookURL: "https://hooks.example/ipwatcher"}
+	if !all.Enabled("crash_loop") {
+		t.Error("Expected every event to be enabled when events is empty")
+	}
+
+	some := &config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", Events: []string{"crash_loop"}}
+	if some.Enabled("start") || !some.Enabled("crash_loop") {
+		t.Error("Expected only listed events to be enabled")
+	}
+}
+
+func TestValidate_Notifications(t *testing.T) {
+	tests := []struct {
+		name          string
+		notifications config.Notifications
+		expectError   bool
+	}{
+		{name: "valid", notifications: config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", Events: []string{"start", "crash_loop"}}},
+		{name: "missing webhook", notifications: config.Notifications{}, expectError: true},
+		{name: "unknown event", notifications: config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", Events: []string{"reboot"}}, expectError: true},
+		{name: "negative window", notifications: config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", CrashLoopWindow: -time.Minute}, expectError: true},
+		{name: "summary schedule", notifications: config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", Events: []string{"summary"}, SummarySchedule: "@weekly"}},
+		{name: "invalid summary schedule", notifications: config.Notifications{WebhookURL: "https://hooks.example/ipwatcher", SummarySchedule: "every day"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RefreshRate:   1.0,
+				SyncRate:      1.0,
+				Notifications: &tt.notifications,
+				Domains: []config.Domain{
+					{ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			}
+			err := cfg.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		warnings int
+	}{
+		{
+			name: "clean",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{
+						{Name: "@", Type: "A", Proxied: true},
+						{Name: "@", Type: "AAAA", Proxied: true},
+					}},
+				},
+			},
+		},
+		{
+			name: "fast refresh and slow sync",
+			cfg: config.Config{
+				RefreshRate: 2,
+				SyncRate:    0.1,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+				},
+			},
+			warnings: 2,
+		},
+		{
+			name: "sync slower than a custom ttl",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    0.5,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{
+						{Name: "@", Type: "A", Proxied: true},
+						{Name: "home", Type: "A", TTL: 60},
+					}},
+				},
+			},
+			warnings: 1,
+		},
+		{
+			name: "sync faster than a long ttl",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    0.1,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A", TTL: 3600}}},
+				},
+			},
+		},
+		{
+			name: "duplicate record",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+				},
+			},
+			warnings: 1,
+		},
+		{
+			name: "proxied without cloudflare",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{Provider: "route53", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A", Proxied: true}}},
+				},
+			},
+			warnings: 1,
+		},
+		{
+			name: "proxied AAAA with unproxied A",
+			cfg: config.Config{
+				RefreshRate: 0.1,
+				SyncRate:    1.0,
+				Domains: []config.Domain{
+					{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{
+						{Name: "@", Type: "A"},
+						{Name: "@", Type: "AAAA", Proxied: true},
+					}},
+				},
+			},
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if warnings := tt.cfg.Lint(); len(warnings) != tt.warnings {
+				t.Errorf("Expected %d warnings, got %d: %v", tt.warnings, len(warnings), warnings)
+			}
+		})
+	}
+}
+
+func TestConfig_Snapshot(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 1.0,
+		SyncRate:    1.0,
+		IPSources: []config.IPSource{
+			{URL: "https://ip.example.net/?key=abc", Headers: []config.Header{{Name: "X-Api-Key", Value: "source-secret"}}},
+		},
+		Notifications: &config.Notifications{WebhookURL: "https://hooks.example.com/services/T000/B000/XXXX"},
+		Debug:         &config.Debug{Token: "debug-secret"},
+		API:           &config.API{Token: "api-secret"},
+		Domains: []config.Domain{
+			{ZoneName: "example.com", APIToken: "zone-secret", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	snapshot, err := cfg.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(data)
+	for _, secret := range []string{"source-secret", "zone-secret", "debug-secret", "api-secret", "abc", "B000"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("expected %q to be redacted, got:\n%s", secret, dump)
+		}
+	}
+	for _, kept := range []string{"example.com", "X-Api-Key", "https://hooks.example.com/REDACTED", "https://ip.example.net/?key=REDACTED"} {
+		if !strings.Contains(dump, kept) {
+			t.Errorf("expected %q in the snapshot, got:\n%s", kept, dump)
+		}
+	}
+	if cfg.Domains[0].APIToken != "zone-secret" {
+		t.Error("expected Snapshot to leave the config unchanged")
+	}
+}
+
+func TestConfig_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROBE_KEY", "probe-secret")
+
+	cfg := &config.Config{
+		IPSources: []config.IPSource{
+			{URL: "https://ip.example.net/?key=query-secret", Headers: []config.Header{{Name: "X-Api-Key", Value: "source-secret"}}},
+		},
+		Notifications: &config.Notifications{WebhookURL: "https://hooks.example.com/services/T000/B000/XXXX"},
+		Propagation:   &config.Propagation{Probes: []config.Probe{{URL: "https://probe.example.net/resolve", Headers: []config.Header{{Name: "X-Key", ValueEnv: "PROBE_KEY"}}}}},
+		Debug:         &config.Debug{Token: "debug-secret"},
+		Domains: []config.Domain{
+			{ZoneName: "example.com", APIToken: "zone-secret"},
+			{ZoneName: "example.org", APITokenFile: tokenFile},
+			{ZoneName: "example.net", APITokenFile: filepath.Join(dir, "missing")},
+		},
+		CloudflareAccounts: []config.CloudflareAccount{{Name: "main", APIToken: "account-secret"}},
+		Profiles: map[string]config.Profile{
+			"staging": {Domains: []config.Domain{{ZoneName: "staging.example.com", APIToken: "staging-secret"}}},
+		},
+	}
+
+	secrets := cfg.Secrets()
+	for _, want := range []string{
+		"query-secret", "source-secret", "https://hooks.example.com/services/T000/B000/XXXX", "/services/T000/B000/XXXX",
+		"probe-secret", "debug-secret", "zone-secret", "file-secret", "account-secret", "staging-secret",
+	} {
+		if !slices.Contains(secrets, want) {
+			t.Errorf("expected %q among the secrets, got %q", want, secrets)
+		}
+	}
+	if slices.Contains(secrets, "") {
+		t.Error("expected no empty secrets")
+	}
+}
+
+func TestRemote_Fetch(t *testing.T) {
+	content := `refresh_rate: 0.5
+sync_rate: 2.0
+domains:
+  - zone_name: "example.com"
+    records:
+      - name: "@"
+        type: "A"
+`
+	downloads := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	remote := config.NewRemote(server.URL+"/config.yaml", server.Client())
+	data, changed, err := remote.Fetch(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("expected the first fetch to download the file, got changed %v, %v", changed, err)
+	}
+	cfg, err := config.Parse(data, "")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if cfg.Domains[0].ZoneName != "example.com" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	if data, changed, err := remote.Fetch(context.Background()); err != nil || changed || data != nil {
+		t.Errorf("expected an unchanged file to be reported as not changed, got %v, %q, %v", changed, data, err)
+	}
+	if downloads != 1 {
+		t.Errorf("expected one download, got %d", downloads)
+	}
+
+	if _, err := config.LoadConfig("http://config.example.com/config.yaml"); err == nil {
+		t.Error("expected an error for a plain http config URL")
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the names of environment variables that override config values
+const EnvPrefix = "IPWATCHER_"
+
+// applyEnv overrides values of the config document doc with the IPWATCHER_* variables of environ.
+// Names map to YAML keys in upper case, with list indexes as numbers: IPWATCHER_REFRESH_RATE
+// sets refresh_rate and IPWATCHER_DOMAINS_0_ZONE_NAME the zone_name of the first domain.
+// Variables naming lists, maps or sections take a YAML value, e.g. IPWATCHER_HTTP_LISTEN="[':9180']".
+// Variables that do not name a config value are ignored, since other tools share the prefix.
+func applyEnv(doc *yaml.Node, environ []string) error {
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	// Sorted, so list entries are added in index order
+	environ = slices.Clone(environ)
+	slices.Sort(environ)
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		path, t, ok := envPath(reflect.TypeOf(Config{}), strings.Split(strings.TrimPrefix(name, EnvPrefix), "_"))
+		if !ok || len(path) == 0 {
+			continue
+		}
+
+		node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		if k := indirect(t).Kind(); k == reflect.Struct || k == reflect.Slice || k == reflect.Map {
+			var parsed yaml.Node
+			if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+				return fmt.Errorf("environment variable %s: %w", name, err)
+			}
+			if len(parsed.Content) == 0 {
+				continue
+			}
+			node = parsed.Content[0]
+		}
+		if err := setNode(doc.Content[0], path, node); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// indirect returns the type t points to, or t itself
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// envPath resolves the upper-case segments of a variable name to a path of YAML keys and list
+// indexes inside a value of type t, and returns the type of the value at the end of the path
+func envPath(t reflect.Type, segs []string) ([]any, reflect.Type, bool) {
+	if len(segs) == 0 {
+		return nil, t, true
+	}
+
+	switch t = indirect(t); t.Kind() {
+	case reflect.Struct:
+		// Try longer keys first, so RECORD_CACHE_FILE is not read as a RECORD key
+		type match struct {
+			key  string
+			n    int
+			elem reflect.Type
+		}
+		var matches []match
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if !f.IsExported() || key == "" || key == "-" {
+				continue
+			}
+			keySegs := strings.Split(strings.ToUpper(key), "_")
+			if len(keySegs) <= len(segs) && slices.Equal(keySegs, segs[:len(keySegs)]) {
+				matches = append(matches, match{key: key, n: len(keySegs), elem: f.Type})
+			}
+		}
+		slices.SortFunc(matches, func(a, b match) int { return b.n - a.n })
+		for _, m := range matches {
+			if rest, elem, ok := envPath(m.elem, segs[m.n:]); ok {
+				return append([]any{m.key}, rest...), elem, true
+			}
+		}
+	case reflect.Slice:
+		i, err := strconv.Atoi(segs[0])
+		if err != nil || i < 0 {
+			return nil, nil, false
+		}
+		if rest, elem, ok := envPath(t.Elem(), segs[1:]); ok {
+			return append([]any{i}, rest...), elem, true
+		}
+	case reflect.Map:
+		// Map keys are given in lower case and may contain underscores themselves
+		for n := 1; n <= len(segs); n++ {
+			key := strings.ToLower(strings.Join(segs[:n], "_"))
+			if rest, elem, ok := envPath(t.Elem(), segs[n:]); ok {
+				return append([]any{key}, rest...), elem, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// setNode sets the value at path below the mapping or sequence n, creating missing sections.
+// A list index may name an existing entry or the one after the last.
+func setNode(n *yaml.Node, path []any, value *yaml.Node) error {
+	for i, step := range path {
+		last := i == len(path)-1
+		next := value
+		if !last {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if _, ok := path[i+1].(int); ok {
+				next = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+		}
+
+		switch step := step.(type) {
+		case string:
+			if n.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s is not inside a section", step)
+			}
+			found := false
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if n.Content[j].Value == step {
+					if last {
+						n.Content[j+1] = value
+					}
+					next, found = n.Content[j+1], true
+					break
+				}
+			}
+			if !found {
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: step}, next)
+			}
+		case int:
+			if n.Kind != yaml.SequenceNode {
+				return fmt.Errorf("index %d is not inside a list", step)
+			}
+			switch {
+			case step < len(n.Content):
+				if last {
+					n.Content[step] = value
+				}
+				next = n.Content[step]
+			case step == len(n.Content):
+				n.Content = append(n.Content, next)
+			default:
+				return fmt.Errorf("index %d skips entries of a list of %d", step, len(n.Content))
+			}
+		}
+		n = next
+	}
+	return nil
+}
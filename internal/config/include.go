@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadDocument reads the config document of a file, or of a conf.d-style directory, and merges
+// the fragments it includes into it. A directory is read as if it were a file including the
+// *.yaml and *.yml files inside it. The returned map names the file every node was read from.
+func loadDocument(filename string) (*yaml.Node, map[*yaml.Node]string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	files := make(map[*yaml.Node]string)
+
+	dir := filepath.Dir(filename)
+	var doc *yaml.Node
+	var patterns []string
+	if info.IsDir() {
+		dir = filename
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		patterns = []string{"*.yaml", "*.yml"}
+	} else {
+		if doc, err = readDocument(filename); err != nil {
+			return nil, nil, err
+		}
+		if patterns, err = includes(doc); err != nil {
+			return nil, nil, err
+		}
+		nodeFiles(doc, filename, files)
+	}
+
+	included, err := includedFiles(dir, patterns, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range included {
+		fragment, err := readDocument(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if nested, err := includes(fragment); err != nil || len(nested) > 0 {
+			return nil, nil, fmt.Errorf("%s: include is only supported in the main config file", file)
+		}
+		nodeFiles(fragment, file, files)
+		if len(fragment.Content) == 0 {
+			continue
+		}
+		if len(doc.Content) == 0 {
+			doc.Content = fragment.Content
+			continue
+		}
+		if err := mergeNode(doc.Content[0], fragment.Content[0], ""); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return doc, files, nil
+}
+
+// readDocument parses a YAML file
+func readDocument(filename string) (*yaml.Node, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+	return &doc, nil
+}
+
+// includes returns the include patterns of a config document
+func includes(doc *yaml.Node) ([]string, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	value := mappingValue(doc.Content[0], "include")
+	if value == nil {
+		return nil, nil
+	}
+	var patterns []string
+	if err := value.Decode(&patterns); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	return patterns, nil
+}
+
+// mappingValue returns the value of a key of a YAML mapping, or nil
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// includedFiles expands include patterns relative to dir. Files are merged in the order of the
+// patterns and in lexical order within a pattern, each once, and never the main file itself.
+func includedFiles(dir string, patterns []string, main string) ([]string, error) {
+	self, _ := filepath.Abs(main)
+	seen := map[string]bool{self: true}
+	var files []string
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("include: patterns must not be empty")
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include: %w", err)
+		}
+		for _, match := range matches {
+			abs, _ := filepath.Abs(match)
+			if info, err := os.Stat(match); err != nil || info.IsDir() || seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// mergeNode merges the YAML value src into dst. Mappings are merged key by key and lists are
+// concatenated, so fragments can each add domains, record sets or accounts. A scalar set in
+// both must have the same value, since which fragment should win is not defined.
+func mergeNode(dst, src *yaml.Node, path string) error {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			existing := mappingValue(dst, key.Value)
+			if existing == nil {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+			if err := mergeNode(existing, value, joinPath(path, key.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		dst.Content = append(dst.Content, src.Content...)
+		return nil
+	case dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode:
+		if dst.Tag == "!!null" {
+			*dst = *src
+			return nil
+		}
+		if src.Tag == "!!null" || dst.Value == src.Value {
+			return nil
+		}
+		return fmt.Errorf("%s is set to both %q and %q", path, dst.Value, src.Value)
+	case dst.Kind == yaml.ScalarNode && dst.Tag == "!!null":
+		*dst = *src
+		return nil
+	case src.Kind == yaml.ScalarNode && src.Tag == "!!null":
+		return nil
+	}
+	return fmt.Errorf("%s has a different type than in another config file", path)
+}
+
+// joinPath appends a key to a dotted config path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// defaultRecordTTL is the TTL the providers give the records they write without a ttl,
+// and the automatic TTL of proxied records
+const defaultRecordTTL = 300 * time.Second
+
+// shortestTTL returns the shortest TTL of the records, or 0 without records
+func (c *Config) shortestTTL() time.Duration {
+	var shortest time.Duration
+	for _, domain := range c.Domains {
+		for _, record := range domain.Records {
+			ttl := defaultRecordTTL
+			if record.TTL != 0 && !record.Proxied {
+				ttl = time.Duration(record.TTL) * time.Second
+			}
+			if shortest == 0 || ttl < shortest {
+				shortest = ttl
+			}
+		}
+	}
+	return shortest
+}
+
+// Lint returns warnings about settings that are valid but probably not intended.
+// It expects a configuration that passed Validate.
+func (c *Config) Lint() []string {
+	var warnings []string
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if c.RefreshRate > 1 {
+		warn("refresh_rate %g checks the public IP more than once a second; IP echo services may rate limit the watcher", c.RefreshRate)
+	}
+	if c.SyncSchedule == "" {
+		interval := time.Duration(float64(time.Minute) / c.SyncRate)
+		if ttl := c.shortestTTL(); ttl != 0 && interval > ttl {
+			warn("sync_rate %g reconciles DNS every %s, slower than the %s record TTL; records changed by hand stay wrong for longer than resolvers cache them", c.SyncRate, interval, ttl)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, domain := range c.Domains {
+		proxied := make(map[string]map[string]bool) // record name -> type -> proxied
+		for _, record := range domain.Records {
+			for _, provider := range domain.ProviderNames() {
+				key := domain.ProviderKey(provider) + "|" + domain.ZoneName + "|" + record.Name + "|" + record.Type
+				if seen[key] {
+					warn("domain %s, record %s %s: configured more than once for %s", domain.ZoneName, record.Name, record.Type, provider)
+				}
+				seen[key] = true
+			}
+
+			if proxied[record.Name] == nil {
+				proxied[record.Name] = make(map[string]bool)
+			}
+			proxied[record.Name][record.Type] = record.Proxied
+
+			if record.Proxied && !slices.Contains(domain.ProviderNames(), "cloudflare") {
+				warn("domain %s, record %s: proxied is ignored because only Cloudflare can proxy records", domain.ZoneName, record.Name)
+			}
+		}
+
+		for _, record := range domain.Records {
+			if record.Type == "AAAA" && record.Proxied {
+				if v4proxied, ok := proxied[record.Name]["A"]; ok && !v4proxied {
+					warn("domain %s, record %s: AAAA is proxied but A is not; behind CGNAT the A record publishes a shared address that is not reachable, so proxy it too or drop it", domain.ZoneName, record.Name)
+				}
+			}
+		}
+	}
+
+	return warnings
+}
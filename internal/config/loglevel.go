@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// LogModules are the parts of ipwatcher whose log level can be set apart from the others
+var LogModules = []string{"ip", "sync", "dnsmanager", "control", "http"}
+
+// logLevelNames are the levels of log_level and -log-level, least severe first
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// LogLevel is a parsed log_level: the level of every module without one of its own
+type LogLevel struct {
+	Default slog.Level
+	Modules map[string]slog.Level
+}
+
+// ParseLogLevel parses a level optionally followed by module=level overrides, e.g.
+// "info,dnsmanager=debug,sync=warn". The default level can be left out, which keeps it at info.
+func ParseLogLevel(s string) (*LogLevel, error) {
+	l := &LogLevel{Default: slog.LevelInfo}
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		module, name, override := strings.Cut(part, "=")
+		if !override {
+			name = part
+		}
+		if !slices.Contains(logLevelNames, strings.ToLower(name)) {
+			return nil, fmt.Errorf("log level must be one of %s, not %q", strings.Join(logLevelNames, ", "), name)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return nil, err
+		}
+		switch {
+		case !override && i > 0:
+			return nil, fmt.Errorf("log level %q must come before the module overrides", part)
+		case !override:
+			l.Default = level
+		case !slices.Contains(LogModules, module):
+			return nil, fmt.Errorf("log module must be one of %s, not %q", strings.Join(LogModules, ", "), module)
+		default:
+			if l.Modules == nil {
+				l.Modules = make(map[string]slog.Level)
+			}
+			l.Modules[module] = level
+		}
+	}
+	return l, nil
+}
+
+// Level returns the least severe level logged for module
+func (l *LogLevel) Level(module string) slog.Level {
+	if level, ok := l.Modules[module]; ok {
+		return level
+	}
+	return l.Default
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a validation problem, at the config value it concerns
+type Problem struct {
+	Path   string // Config path of the value, e.g. domains[0].records[1].type
+	File   string // File the value was read from; empty when unknown
+	Line   int    // Position of the value in its file; 0 when unknown
+	Column int
+	Err    error
+}
+
+func (p Problem) Error() string {
+	switch {
+	case p.Line > 0 && p.File != "":
+		return fmt.Sprintf("%s:%d:%d: %v", p.File, p.Line, p.Column, p.Err)
+	case p.Line > 0:
+		return fmt.Sprintf("line %d:%d: %v", p.Line, p.Column, p.Err)
+	}
+	return p.Err.Error()
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// ValidationError lists every problem Validate found, in the order they were found
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// problems collects the problems found by Validate
+type problems []Problem
+
+func (ps *problems) add(path, format string, args ...any) {
+	*ps = append(*ps, Problem{Path: path, Err: fmt.Errorf(format, args...)})
+}
+
+// err returns the collected problems as a *ValidationError, or nil without any
+func (ps problems) err() error {
+	if len(ps) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: ps}
+}
+
+// profileSections are the top-level sections a profile replaces
+var profileSections = []string{"domains", "cloudflare_accounts", "notifications"}
+
+// locate sets the position of every problem to that of its value in doc, the document the config
+// was decoded from, or of the closest enclosing value found there. files names the file every
+// node was read from, and profile is the profile in use, whose sections replace the top-level ones.
+func (e *ValidationError) locate(doc *yaml.Node, files map[*yaml.Node]string, profile string) {
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	for i := range e.Problems {
+		p := &e.Problems[i]
+		path := p.Path
+		if profile != "" {
+			for _, section := range profileSections {
+				if (path == section || strings.HasPrefix(path, section+".") || strings.HasPrefix(path, section+"[")) &&
+					findNode(root, "profiles."+profile+"."+section) != nil {
+					path = "profiles." + profile + "." + path
+				}
+			}
+		}
+		n := closestNode(root, path)
+		if n == nil || n.Line == 0 {
+			continue
+		}
+		p.File, p.Line, p.Column = files[n], n.Line, n.Column
+	}
+}
+
+// findNode returns the node at path inside root, or nil
+func findNode(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for _, seg := range pathSegments(path) {
+		if n = childNode(n, seg); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// closestNode returns the node at path inside root, or the deepest node on the way to it
+func closestNode(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for _, seg := range pathSegments(path) {
+		child := childNode(n, seg)
+		if child == nil {
+			break
+		}
+		n = child
+	}
+	if n == root {
+		return nil
+	}
+	return n
+}
+
+// pathSegments splits a config path such as domains[0].records[1].type into keys and indexes
+func pathSegments(path string) []string {
+	var segs []string
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			segs = append(segs, key)
+		}
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			segs = append(segs, "["+index+"]")
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return segs
+}
+
+// childNode returns the value of a key of a mapping, or the item of a sequence for an [index]
+func childNode(n *yaml.Node, seg string) *yaml.Node {
+	if index, ok := strings.CutPrefix(seg, "["); ok {
+		i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+		if n.Kind != yaml.SequenceNode || err != nil || i < 0 || i >= len(n.Content) {
+			return nil
+		}
+		return n.Content[i]
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	return mappingValue(n, seg)
+}
+
+// nodeFiles maps every node of doc to file
+func nodeFiles(doc *yaml.Node, file string, files map[*yaml.Node]string) {
+	files[doc] = file
+	for _, c := range doc.Content {
+		nodeFiles(c, file, files)
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secrets in config snapshots, and redactedURLPart the secret parts of URLs,
+// where brackets would be escaped
+const (
+	Redacted        = "[REDACTED]"
+	redactedURLPart = "REDACTED"
+)
+
+// secretKeys are the config keys whose values are secrets
+var secretKeys = map[string]bool{
+	"api_token": true, // domains, cloudflare_accounts, workers_kv
+	"token":     true, // debug
+	"password":  true, // local_dns
+	"value":     true, // headers of ip_sources, notifications and probes
+}
+
+// Snapshot returns the config as YAML would decode it into generic maps and lists, with secrets
+// replaced by Redacted, for debug dumps. Files holding secrets are named but not read.
+func (c *Config) Snapshot() (map[string]any, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	redactNode(&doc, "")
+
+	var snapshot map[string]any
+	if err := doc.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return snapshot, nil
+}
+
+// redactNode replaces the secrets inside n, the value of key
+func redactNode(n *yaml.Node, key string) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			redactNode(c, key)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			redactNode(n.Content[i+1], n.Content[i].Value)
+		}
+	case yaml.ScalarNode:
+		if n.Value == "" || n.Tag == "!!null" {
+			return
+		}
+		switch {
+		case secretKeys[key]:
+			n.Value, n.Tag, n.Style = Redacted, "!!str", 0
+		case strings.HasSuffix(key, "url"):
+			n.Value = redactURL(n.Value, key == "webhook_url")
+		}
+	}
+}
+
+// redactURL removes the password and query values of a URL, and its path when the path is
+// the secret, as with webhook URLs of chat services
+func redactURL(raw string, secretPath bool) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedURLPart)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{redactedURLPart}
+		}
+		u.RawQuery = q.Encode()
+	}
+	if secretPath && strings.Trim(u.Path, "/") != "" {
+		u.Path, u.RawPath = "/"+redactedURLPart, ""
+	}
+	return u.String()
+}
+
+// Secrets returns every secret the config holds or refers to, such as API tokens, header values
+// and webhook URLs, for redacting them from logs and error messages. Secrets in files and
+// environment variables are read; ones that cannot be read are left out.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	add := func(values ...string) {
+		for _, v := range values {
+			if v != "" {
+				secrets = append(secrets, v)
+			}
+		}
+	}
+	addToken := func(token func() (string, error)) {
+		if t, err := token(); err == nil {
+			add(t)
+		}
+	}
+	addHeaders := func(headers []Header) {
+		for _, h := range headers {
+			addToken(h.Resolve)
+		}
+	}
+	// addURL adds the parts of a URL Snapshot redacts
+	addURL := func(raw string, secretPath bool) {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return
+		}
+		if password, ok := u.User.Password(); ok {
+			add(password)
+		}
+		for _, values := range u.Query() {
+			add(values...)
+		}
+		if secretPath && strings.Trim(u.Path, "/") != "" {
+			add(raw, u.Path)
+		}
+	}
+	addNotifications := func(n *Notifications) {
+		if n == nil {
+			return
+		}
+		addURL(n.WebhookURL, true)
+		addHeaders(n.Headers)
+	}
+	addDomains := func(domains []Domain) {
+		for _, d := range domains {
+			addToken(d.CloudflareToken)
+		}
+	}
+	addAccounts := func(accounts []CloudflareAccount) {
+		for _, a := range accounts {
+			addToken(a.Token)
+		}
+	}
+
+	addDomains(c.Domains)
+	addAccounts(c.CloudflareAccounts)
+	addNotifications(c.Notifications)
+	for _, name := range c.ProfileNames() {
+		p := c.Profiles[name]
+		addDomains(p.Domains)
+		addAccounts(p.CloudflareAccounts)
+		addNotifications(p.Notifications)
+	}
+	if c.WorkersKV != nil {
+		addToken(c.WorkersKV.Token)
+	}
+	for _, src := range c.IPSources {
+		addURL(src.URL, false)
+		addHeaders(src.Headers)
+	}
+	for _, ch := range c.Channels {
+		for _, src := range ch.Sources {
+			addURL(src.URL, false)
+			addHeaders(src.Headers)
+		}
+	}
+	if c.Propagation != nil {
+		for _, p := range c.Propagation.Probes {
+			addURL(p.URL, false)
+			addHeaders(p.Headers)
+		}
+	}
+	if c.Debug != nil {
+		addToken(c.Debug.ResolveToken)
+	}
+	if c.API != nil {
+		addToken(c.API.ResolveToken)
+	}
+	if c.LocalDNS != nil {
+		addToken(c.LocalDNS.ResolvePassword)
+	}
+	return secrets
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	remoteTimeout = 30 * time.Second
+	maxRemoteSize = 1 << 20
+)
+
+// IsRemote reports whether a config file name is a URL rather than a path
+func IsRemote(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// Remote fetches a config file from an https URL. It remembers the ETag of the last response,
+// so polling a file that did not change costs a 304 Not Modified instead of a download.
+type Remote struct {
+	url    string
+	client *http.Client
+	mu     sync.Mutex
+	etag   string
+}
+
+// NewRemote creates a fetcher for url; a nil client uses one with a 30s timeout
+func NewRemote(url string, client *http.Client) *Remote {
+	if client == nil {
+		client = &http.Client{Timeout: remoteTimeout}
+	}
+	return &Remote{url: url, client: client}
+}
+
+// Fetch downloads the config file. changed is false, with no data, when the server reports the
+// file unchanged since the previous Fetch.
+func (r *Remote) Fetch(ctx context.Context) (data []byte, changed bool, err error) {
+	if !strings.HasPrefix(r.url, "https://") {
+		return nil, false, fmt.Errorf("config URL %s must use https", r.url)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, false, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, false, fmt.Errorf("config URL %s returned status %d", r.url, resp.StatusCode)
+	}
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxRemoteSize {
+		return nil, false, fmt.Errorf("config URL %s returned more than %d bytes", r.url, maxRemoteSize)
+	}
+	r.etag = resp.Header.Get("ETag")
+	return data, true, nil
+}
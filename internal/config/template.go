@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// nameFuncs are the variables record names may use
+var nameFuncs = template.FuncMap{
+	"hostname": shortHostname,
+	"env":      requireEnv,
+}
+
+// shortHostname returns the first label of the host name in lower case, so web1.lan becomes web1
+func shortHostname() (string, error) {
+	name, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	name, _, _ = strings.Cut(name, ".")
+	if name == "" {
+		return "", fmt.Errorf("host name is empty")
+	}
+	return strings.ToLower(name), nil
+}
+
+// requireEnv returns the value of the environment variable name, which must be set and not empty
+func requireEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// expandName expands the {{hostname}} and {{env "NAME"}} variables of a record name.
+// Names without variables are returned as they are.
+func expandName(name string) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+	tmpl, err := template.New("name").Funcs(nameFuncs).Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// expandNames expands the variables in the record names of every domain, so one config can be
+// deployed to many hosts that each register their own name. Expanded names hold no variables,
+// so validating the config again leaves them as they are.
+func (c *Config) expandNames(ps *problems) {
+	for i := range c.Domains {
+		domain := &c.Domains[i]
+		for j := range domain.Records {
+			record := &domain.Records[j]
+			name, err := expandName(record.Name)
+			if err != nil {
+				ps.add(fmt.Sprintf("domains[%d].records[%d].name", i, j), "domain %s, record %s: name: %w", domain.ZoneName, record.Name, err)
+				continue
+			}
+			record.Name = name
+		}
+	}
+}
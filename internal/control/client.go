@@ -0,0 +1,84 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Watch connects to the daemon's control socket and calls fn for every streamed event
+// until ctx is cancelled, the daemon closes the connection, or fn returns an error.
+func Watch(ctx context.Context, path string, filter Filter, fn func(Event) error) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control socket %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := json.NewEncoder(conn).Encode(Request{Command: "watch", Filter: filter}); err != nil {
+		return fmt.Errorf("failed to send watch request: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid event from daemon: %w", err)
+		}
+		// Errors about the request itself come back as an event without a kind
+		if e.Kind == "" && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	return nil
+}
+
+// Call sends a command to the daemon's control socket and decodes its result into result
+func Call(ctx context.Context, path, command string, result any) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control socket %s: %w", path, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(Request{Command: command}); err != nil {
+		return fmt.Errorf("failed to send %s request: %w", command, err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("invalid response from daemon: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
@@ -0,0 +1,294 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event kinds
+const (
+	KindLog          = "log"          // A daemon log line
+	KindUpdate       = "update"       // Records of a zone were pushed to a provider
+	KindPanic        = "panic"        // The daemon recovered from a panic
+	KindDisagreement = "disagreement" // IP sources returned different addresses
+	KindProgress     = "progress"     // A record change was planned, sent, confirmed or failed
+)
+
+// logger returns the default logger with the module attribute of this package, whose log
+// level can be set apart from the rest of ipwatcher
+func logger() *slog.Logger {
+	return slog.Default().With("module", "control")
+}
+
+// subscriberBuffer is the number of events buffered per subscriber before events are dropped
+const subscriberBuffer = 256
+
+// Event is a single entry of the daemon's live event stream
+type Event struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Zone     string    `json:"zone,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Records  []string  `json:"records,omitempty"` // Fully qualified record names
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// Filter selects events by zone and record name; empty fields match everything
+type Filter struct {
+	Zone   string `json:"zone,omitempty"`
+	Record string `json:"record,omitempty"`
+}
+
+// Match reports whether the event passes the filter.
+// Log lines carry no structured zone or record, so they match when their message mentions the value.
+func (f Filter) Match(e Event) bool {
+	if f.Zone != "" && !strings.EqualFold(e.Zone, f.Zone) && !containsFold(e.Message, f.Zone) {
+		return false
+	}
+	if f.Record != "" {
+		found := containsFold(e.Message, f.Record)
+		for _, r := range e.Records {
+			if strings.EqualFold(r, f.Record) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Broker fans out events to all current subscribers.
+// Slow subscribers miss events instead of blocking the daemon.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewBroker creates a new event broker
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends the event to every subscriber
+func (b *Broker) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a new subscriber; call the returned function to unsubscribe
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Write implements io.Writer so the broker can be the output of a log handler;
+// every written line is published as a log event.
+func (b *Broker) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			b.Publish(Event{Kind: KindLog, Message: line})
+		}
+	}
+	return len(p), nil
+}
+
+// Request is sent by a client as the first line of a control connection
+type Request struct {
+	Command string `json:"command"`
+	Filter
+}
+
+// Response answers a command registered with Handle
+type Response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Handler answers a command with a result that is encoded as JSON
+type Handler func(ctx context.Context) (any, error)
+
+// Server serves the control interface on a unix domain socket
+type Server struct {
+	path     string
+	broker   *Broker
+	handlers map[string]Handler
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a control server for the given socket path
+func NewServer(path string, broker *Broker) *Server {
+	return &Server{path: path, broker: broker, handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler of a command that is answered with a single Response.
+// It must be called before Serve.
+func (s *Server) Handle(command string, h Handler) {
+	s.handlers[command] = h
+}
+
+// Listen creates the unix socket, replacing a stale socket file left by a previous run
+func (s *Server) Listen() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	l, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("failed to restrict control socket permissions: %w", err)
+	}
+	s.listener = l
+	return nil
+}
+
+// Serve accepts connections until ctx is cancelled
+func (s *Server) Serve(ctx context.Context) error {
+	if s.listener == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept control connection: %w", err)
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		writeError(conn, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	if req.Command == "watch" {
+		s.watch(ctx, conn, req.Filter)
+		return
+	}
+	h, ok := s.handlers[req.Command]
+	if !ok {
+		writeError(conn, fmt.Errorf("unknown command %q", req.Command))
+		return
+	}
+	result, err := h(ctx)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(conn, fmt.Errorf("failed to encode result: %w", err))
+		return
+	}
+	if err := json.NewEncoder(conn).Encode(Response{Result: data}); err != nil {
+		logger().Error("Failed to write control response", "error", err)
+	}
+}
+
+func (s *Server) watch(ctx context.Context, conn net.Conn, filter Filter) {
+	events, unsubscribe := s.broker.Subscribe()
+	defer unsubscribe()
+
+	// Detect the client hanging up while no events are flowing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.Match(e) {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeError(conn net.Conn, err error) {
+	if encErr := json.NewEncoder(conn).Encode(map[string]string{"error": err.Error()}); encErr != nil {
+		logger().Error("Failed to write control error", "error", encErr)
+	}
+}
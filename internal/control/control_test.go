@@ -0,0 +1,151 @@
+package control_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+)
+
+func TestFilter_Match(t *testing.T) {
+	update := control.Event{
+		Kind:    control.KindUpdate,
+		Zone:    "example.com",
+		Records: []string{"example.com", "www.example.com"},
+	}
+	logLine := control.Event{Kind: control.KindLog, Message: "Failed to get zone ID for example.net (route53)"}
+
+	tests := []struct {
+		name     string
+		filter   control.Filter
+		event    control.Event
+		expected bool
+	}{
+		{name: "empty filter", filter: control.Filter{}, event: update, expected: true},
+		{name: "matching zone", filter: control.Filter{Zone: "EXAMPLE.com"}, event: update, expected: true},
+		{name: "other zone", filter: control.Filter{Zone: "example.net"}, event: update, expected: false},
+		{name: "matching record", filter: control.Filter{Record: "www.example.com"}, event: update, expected: true},
+		{name: "other record", filter: control.Filter{Record: "vpn.example.com"}, event: update, expected: false},
+		{name: "log line mentions zone", filter: control.Filter{Zone: "example.net"}, event: logLine, expected: true},
+		{name: "log line without zone", filter: control.Filter{Zone: "example.com"}, event: logLine, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.event); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBroker_WritePublishesLogLines(t *testing.T) {
+	broker := control.NewBroker()
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	if _, err := broker.Write([]byte("first line\nsecond line\n")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	for _, expected := range []string{"first line", "second line"} {
+		e := <-events
+		if e.Kind != control.KindLog || e.Message != expected {
+			t.Errorf("expected log event %q, got %+v", expected, e)
+		}
+		if e.Time.IsZero() {
+			t.Error("expected event time to be set")
+		}
+	}
+}
+
+func TestBroker_UnsubscribeClosesChannel(t *testing.T) {
+	broker := control.NewBroker()
+	events, unsubscribe := broker.Subscribe()
+	unsubscribe()
+	unsubscribe()
+
+	broker.Publish(control.Event{Kind: control.KindLog, Message: "dropped"})
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after unsubscribe")
+	}
+}
+
+func TestServer_WatchStreamsFilteredEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	broker := control.NewBroker()
+	path := filepath.Join(t.TempDir(), "ipwatcher.sock")
+	server := control.NewServer(path, broker)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen returned error: %v", err)
+	}
+	go server.Serve(ctx)
+
+	// Keep publishing until the watcher has subscribed
+	go func() {
+		for ctx.Err() == nil {
+			broker.Publish(control.Event{Kind: control.KindUpdate, Zone: "example.net", Message: "skipped"})
+			broker.Publish(control.Event{Kind: control.KindUpdate, Zone: "example.com", Message: "wanted"})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	errDone := errors.New("done")
+	var got control.Event
+	err := control.Watch(ctx, path, control.Filter{Zone: "example.com"}, func(e control.Event) error {
+		got = e
+		return errDone
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("expected watch to stop with errDone, got %v", err)
+	}
+	if got.Zone != "example.com" || got.Message != "wanted" {
+		t.Errorf("expected filtered event for example.com, got %+v", got)
+	}
+}
+
+func TestServer_HandleAnswersCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "ipwatcher.sock")
+	server := control.NewServer(path, control.NewBroker())
+	server.Handle("dump", func(ctx context.Context) (any, error) {
+		return map[string]string{"ipv4": "203.0.113.10"}, nil
+	})
+	server.Handle("fail", func(ctx context.Context) (any, error) {
+		return nil, errors.New("not now")
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen returned error: %v", err)
+	}
+	go server.Serve(ctx)
+
+	var got map[string]string
+	if err := control.Call(ctx, path, "dump", &got); err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if got["ipv4"] != "203.0.113.10" {
+		t.Errorf("expected the handler's result, got %v", got)
+	}
+	if err := control.Call(ctx, path, "fail", nil); err == nil || err.Error() != "not now" {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+	if err := control.Call(ctx, path, "reboot", nil); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
+
+func TestWatch_NoDaemon(t *testing.T) {
+	err := control.Watch(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), control.Filter{}, func(control.Event) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error when no daemon is listening")
+	}
+}
@@ -0,0 +1,54 @@
+package dnsmanager
+
+import (
+	"context"
+	"time"
+)
+
+// BatchPolicy controls how the record changes of a zone are split into API calls, for accounts
+// with strict payload or rate limits
+type BatchPolicy struct {
+	MaxChanges int           // Most record changes sent in one call; 0 sends every change of a zone in one call
+	Delay      time.Duration // Pause between the calls of one zone
+}
+
+// DefaultCloudflareBatch is used by the Cloudflare provider unless overridden. Batch requests of
+// the Free plan take at most 200 changes, and the pause keeps large zones under the API rate limit
+// of 1200 requests per five minutes.
+var DefaultCloudflareBatch = BatchPolicy{
+	MaxChanges: 200,
+	Delay:      250 * time.Millisecond,
+}
+
+// DefaultRoute53Batch is used by the Route53 provider unless overridden. A change batch holds at
+// most 1000 resource records, where every UPSERT counts twice, and Route53 allows five requests
+// per second per account.
+var DefaultRoute53Batch = BatchPolicy{
+	MaxChanges: 500,
+	Delay:      200 * time.Millisecond,
+}
+
+// sendChunks calls send with consecutive ranges [start, end) of n changes, each at most
+// policy.MaxChanges long, pausing policy.Delay between calls. It returns how many changes were
+// sent before send failed or ctx was done; those were applied and the others were not.
+func sendChunks(ctx context.Context, policy BatchPolicy, n int, send func(start, end int) error) (int, error) {
+	size := n
+	if policy.MaxChanges > 0 && policy.MaxChanges < n {
+		size = policy.MaxChanges
+	}
+	for start := 0; start < n; start += size {
+		if start > 0 && policy.Delay > 0 {
+			timer := time.NewTimer(policy.Delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return start, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err := send(start, min(start+size, n)); err != nil {
+			return start, err
+		}
+	}
+	return n, nil
+}
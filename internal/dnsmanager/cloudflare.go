@@ -2,10 +2,18 @@ package dnsmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/cache"
 	"github.com/cloudflare/cloudflare-go/v6/dns"
 	"github.com/cloudflare/cloudflare-go/v6/option"
 	"github.com/cloudflare/cloudflare-go/v6/zones"
@@ -18,6 +26,8 @@ type CloudflareClient interface {
 	ListDNSRecords(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error)
 	BatchDNSRecords(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error)
 	DeleteDNSRecord(ctx context.Context, recordID string, params dns.RecordDeleteParams) (*dns.RecordDeleteResponse, error)
+	VerifyToken(ctx context.Context, accountID string) (string, error)
+	PurgeCache(ctx context.Context, zoneID string, hosts []string) error
 }
 
 // RealCloudflareClient wraps the actual Cloudflare client
@@ -25,9 +35,18 @@ type RealCloudflareClient struct {
 	client *cloudflare.Client
 }
 
+// UserAgent is sent with every request to the Cloudflare API; the SDK's own is sent when empty
+var UserAgent = "ipwatcher"
+
 // NewRealCloudflareClient creates a new real Cloudflare client wrapper
-func NewRealCloudflareClient(apiToken string) *RealCloudflareClient {
-	client := cloudflare.NewClient(option.WithAPIToken(apiToken))
+func NewRealCloudflareClient(apiToken string, opts ...option.RequestOption) *RealCloudflareClient {
+	// Rate limits are retried by CloudflareProvider so that it can back off across requests
+	defaults := []option.RequestOption{option.WithAPIToken(apiToken), option.WithMaxRetries(0)}
+	if UserAgent != "" {
+		defaults = append(defaults, option.WithHeader("User-Agent", UserAgent))
+	}
+	opts = append(defaults, opts...)
+	client := cloudflare.NewClient(opts...)
 	return &RealCloudflareClient{client: client}
 }
 
@@ -48,7 +67,9 @@ func (r *RealCloudflareClient) ListDNSRecords(ctx context.Context, params dns.Re
 	cur := r.client.DNS.Records.ListAutoPaging(ctx, params)
 	records := []dns.RecordResponse{}
 	for cur.Next() {
-		if rec := cur.Current(); rec.Type == dns.RecordResponseTypeA || rec.Type == dns.RecordResponseTypeAAAA {
+		rec := cur.Current()
+		switch {
+		case rec.Type == dns.RecordResponseTypeA, rec.Type == dns.RecordResponseTypeAAAA, rec.Type == dns.RecordResponseTypeCNAME, rec.Type == dns.RecordResponseTypeTXT:
 			records = append(records, rec)
 		}
 	}
@@ -68,99 +89,498 @@ func (r *RealCloudflareClient) DeleteDNSRecord(ctx context.Context, recordID str
 	return r.client.DNS.Records.Delete(ctx, recordID, params)
 }
 
+// VerifyToken implements CloudflareClient and returns the token status, e.g. "active". The
+// token is verified as a user token first, since an account ID is also set for user tokens
+// that see several accounts, and against the account only when that fails, for account-owned
+// tokens, which the user endpoint rejects.
+func (r *RealCloudflareClient) VerifyToken(ctx context.Context, accountID string) (string, error) {
+	status, err := r.verifyToken(ctx, "user/tokens/verify")
+	if err == nil || accountID == "" {
+		return status, err
+	}
+	return r.verifyToken(ctx, "accounts/"+accountID+"/tokens/verify")
+}
+
+// verifyToken returns the token status answered by the verify endpoint at path
+func (r *RealCloudflareClient) verifyToken(ctx context.Context, path string) (string, error) {
+	var res struct {
+		Result struct {
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+	if err := r.client.Get(ctx, path, nil, &res); err != nil {
+		return "", err
+	}
+	return res.Result.Status, nil
+}
+
+// PurgeCache implements CloudflareClient by purging everything cached for the given hosts
+func (r *RealCloudflareClient) PurgeCache(ctx context.Context, zoneID string, hosts []string) error {
+	_, err := r.client.Cache.Purge(ctx, cache.CachePurgeParams{
+		ZoneID: cloudflare.F(zoneID),
+		Body:   cache.CachePurgeParamsBodyCachePurgeFlexPurgeByHostnames{Hosts: cloudflare.F(hosts)},
+	})
+	return err
+}
+
+// classifyCloudflareError tags Cloudflare API errors with an error kind based on the HTTP status;
+// notFound is the kind of a 404, which depends on what the request addressed
+func classifyCloudflareError(err, notFound error) error {
+	var apiErr *cloudflare.Error
+	if errors.As(err, &apiErr) {
+		return withKind(kindFromStatus(apiErr.StatusCode, notFound), err)
+	}
+	return err
+}
+
+// maxPurgeHosts is the most hosts Cloudflare accepts in one cache purge request
+const maxPurgeHosts = 30
+
+// ManagedComment is set as the comment of every record the Cloudflare provider creates or updates,
+// so watcher-managed records can be told apart from hand-created ones
+const ManagedComment = "managed-by=ipwatcher"
+
 // CloudflareProvider handles Cloudflare DNS operations
 type CloudflareProvider struct {
-	client CloudflareClient
+	client   CloudflareClient
+	retry    RetryPolicy
+	batch    BatchPolicy
+	cooldown cooldown  // set when Cloudflare asks to wait longer than retry.MaxDelay
+	breaker  breaker   // opened by consecutive server and network failures
+	tags     []string  // name:value tags set on created and updated records
+	owner    string    // instance ID written to ownership TXT records; empty disables ownership
+	refuse   bool      // leave unmanaged records with different content alone instead of adopting them
+	dryRun   io.Writer // receives the planned changes instead of applying them when set
+	cache    *StateCache
 }
 
 // NewCloudflareProvider creates a new Cloudflare provider instance
 func NewCloudflareProvider(apiToken string) (*CloudflareProvider, error) {
-	client := NewRealCloudflareClient(apiToken)
+	return NewCloudflareProviderWithBaseURL(apiToken, "")
+}
+
+// NewCloudflareProviderWithBaseURL creates a new Cloudflare provider that sends API requests to baseURL,
+// such as an API gateway or a local mock server; an empty baseURL uses the public Cloudflare API
+func NewCloudflareProviderWithBaseURL(apiToken, baseURL string) (*CloudflareProvider, error) {
+	return NewCloudflareProviderWithHTTPClient(apiToken, baseURL, nil)
+}
+
+// NewCloudflareProviderWithHTTPClient creates a new Cloudflare provider like
+// NewCloudflareProviderWithBaseURL that sends its requests with httpClient, e.g. one bound to an
+// interface; a nil httpClient uses the default client
+func NewCloudflareProviderWithHTTPClient(apiToken, baseURL string, httpClient *http.Client) (*CloudflareProvider, error) {
+	var opts []option.RequestOption
+	if httpClient != nil {
+		opts = append(opts, option.WithHTTPClient(httpClient))
+	}
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid Cloudflare base URL %q", baseURL)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		opts = append(opts, option.WithBaseURL(u.String()))
+	}
 	return &CloudflareProvider{
-		client: client,
+		client:  NewRealCloudflareClient(apiToken, opts...),
+		retry:   DefaultRetryPolicy,
+		batch:   DefaultCloudflareBatch,
+		breaker: breaker{policy: DefaultCircuitBreaker},
 	}, nil
 }
 
 // NewCloudflareProviderWithClient creates a new Cloudflare provider with a custom client (for testing)
 func NewCloudflareProviderWithClient(client CloudflareClient) *CloudflareProvider {
 	return &CloudflareProvider{
-		client: client,
+		client:  client,
+		retry:   DefaultRetryPolicy,
+		batch:   DefaultCloudflareBatch,
+		breaker: breaker{policy: DefaultCircuitBreaker},
 	}
 }
 
+// SetRetryPolicy replaces the policy used to retry rate-limited and failed requests
+func (p *CloudflareProvider) SetRetryPolicy(policy RetryPolicy) {
+	p.retry = policy
+}
+
+// SetBatchPolicy replaces the policy that splits the changes of a zone into batch requests
+func (p *CloudflareProvider) SetBatchPolicy(policy BatchPolicy) {
+	p.batch = policy
+}
+
+// SetCircuitBreaker replaces the policy that pauses requests after consecutive server and network failures
+func (p *CloudflareProvider) SetCircuitBreaker(policy CircuitBreaker) {
+	p.breaker.mu.Lock()
+	defer p.breaker.mu.Unlock()
+	p.breaker.policy = policy
+}
+
+// SetRecordTags sets the name:value tags added to created and updated records.
+// Record tags require a paid Cloudflare plan.
+func (p *CloudflareProvider) SetRecordTags(tags []string) {
+	p.tags = tags
+}
+
+// SetOwner enables ownership TXT records. Records claimed by a different owner are left alone,
+// and records without an ownership record are claimed for ownerID.
+func (p *CloudflareProvider) SetOwner(ownerID string) {
+	p.owner = ownerID
+}
+
+// SetAdopt sets whether existing records without the managed comment, or an ownership record of
+// this instance, are taken over when their content differs. Adoption is on by default.
+func (p *CloudflareProvider) SetAdopt(adopt bool) {
+	p.refuse = !adopt
+}
+
+// SetStateCache sets the cache of record IDs and content that EnsureDNSRecordsCached works from.
+// Every zone listing refreshes it.
+func (p *CloudflareProvider) SetStateCache(cache *StateCache) {
+	p.cache = cache
+}
+
+// SetDryRun makes EnsureDNSRecords print its planned changes to out instead of applying them;
+// a nil out applies changes again
+func (p *CloudflareProvider) SetDryRun(out io.Writer) {
+	p.dryRun = out
+}
+
+// call runs a Cloudflare request that is safe to repeat, retrying it with exponential backoff
+// while it is rate limited, and on server and network errors. Retry-After is honoured; when it asks for more than the policy's
+// MaxDelay, or retries run out while rate limited, the provider stops calling the API until the
+// requested time instead of failing on every tick. Requests that still fail with server or network
+// errors open the circuit breaker, which pauses the API the same way during an outage.
+func (p *CloudflareProvider) call(ctx context.Context, fn func() error) error {
+	return p.callRetrying(ctx, true, fn)
+}
+
+// callOnce is call for a request that must not be repeated once it may have been applied. It
+// is retried only when rate limited, which the API answers without processing the request.
+func (p *CloudflareProvider) callOnce(ctx context.Context, fn func() error) error {
+	return p.callRetrying(ctx, false, fn)
+}
+
+// callRetrying is call, retrying server and network errors only when repeatable
+func (p *CloudflareProvider) callRetrying(ctx context.Context, repeatable bool, fn func() error) error {
+	now := time.Now()
+	if until, ok := p.cooldown.active(now); ok {
+		return fmt.Errorf("Cloudflare API rate limited until %s: %w", until.Format(time.RFC3339), ErrRateLimited)
+	}
+	if until, ok := p.breaker.open(now); ok {
+		return fmt.Errorf("Cloudflare API paused until %s after repeated failures: %w", until.Format(time.RFC3339), ErrUnavailable)
+	}
+
+	err := p.retryCall(ctx, repeatable, fn)
+	var apiErr *cloudflare.Error
+	status := 0
+	if errors.As(err, &apiErr) {
+		status = apiErr.StatusCode
+	}
+	if until, opened := p.breaker.record(transient(err, status), time.Now()); opened {
+		logger().Error("Cloudflare API keeps failing, pausing requests", "until", until, "error", err)
+	}
+	return err
+}
+
+// retryCall runs fn until it succeeds, fails permanently or the retry policy gives up. Server
+// and network errors are retried only when repeatable.
+func (p *CloudflareProvider) retryCall(ctx context.Context, repeatable bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		var apiErr *cloudflare.Error
+		status := 0
+		if errors.As(err, &apiErr) {
+			status = apiErr.StatusCode
+		}
+
+		var wait time.Duration
+		switch {
+		case status == http.StatusTooManyRequests:
+			var ok bool
+			if wait, ok = retryAfter(apiErr.Response, time.Now()); !ok {
+				wait = p.retry.backoff(attempt)
+			}
+			if attempt >= p.retry.MaxRetries || wait > p.retry.MaxDelay {
+				p.cooldown.set(time.Now().Add(wait))
+				return err
+			}
+			logger().Warn("Cloudflare API rate limited, retrying", "duration", wait)
+		case repeatable && transient(err, status):
+			if attempt >= p.retry.MaxRetries {
+				return err
+			}
+			wait = p.retry.backoff(attempt)
+			logger().Warn("Cloudflare API request failed, retrying", "duration", wait, "error", err)
+		default:
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// VerifyCredentials checks that the API token is valid and active
+func (p *CloudflareProvider) VerifyCredentials(ctx context.Context, accountID string) error {
+	var status string
+	err := p.call(ctx, func() (err error) {
+		status, err = p.client.VerifyToken(ctx, accountID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify API token: %w", classifyCloudflareError(err, nil))
+	}
+	if status != "active" {
+		return fmt.Errorf("API token is %s: %w", status, ErrAuth)
+	}
+	return nil
+}
+
 // GetZoneIDByName retrieves the Zone ID for a given zone name
 func (p *CloudflareProvider) GetZoneIDByName(ctx context.Context, zoneName string) (string, error) {
-	zones, err := p.client.ListZones(ctx, zones.ZoneListParams{Name: cloudflare.String(zoneName)})
+	return p.GetZoneIDByNameInAccount(ctx, zoneName, "")
+}
+
+// GetZoneIDByNameInAccount retrieves the Zone ID for a given zone name, restricted to the
+// given account when accountID is not empty
+func (p *CloudflareProvider) GetZoneIDByNameInAccount(ctx context.Context, zoneName, accountID string) (string, error) {
+	params := zones.ZoneListParams{Name: cloudflare.String(zoneName)}
+	if accountID != "" {
+		params.Account = cloudflare.F(zones.ZoneListParamsAccount{ID: cloudflare.String(accountID)})
+	}
+
+	var found []zones.Zone
+	err := p.call(ctx, func() (err error) {
+		found, err = p.client.ListZones(ctx, params)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to list zones: %w", err)
+		return "", fmt.Errorf("failed to list zones: %w", classifyCloudflareError(err, ErrZoneNotFound))
 	}
-	if len(zones) == 0 {
-		return "", fmt.Errorf("zone %s not found", zoneName)
+	if len(found) == 0 {
+		if accountID != "" {
+			return "", fmt.Errorf("zone %s not found in account %s: %w", zoneName, accountID, ErrZoneNotFound)
+		}
+		return "", fmt.Errorf("zone %s not found: %w", zoneName, ErrZoneNotFound)
 	}
-	return zones[0].ID, nil
+	return found[0].ID, nil
 }
 
 // GetDNSRecords retrieves all DNS records for a domain
 func (p *CloudflareProvider) GetDNSRecords(ctx context.Context, zoneID string) ([]dns.RecordResponse, error) {
-	records, err := p.client.ListDNSRecords(ctx, dns.RecordListParams{ZoneID: cloudflare.String(zoneID)})
+	var records []dns.RecordResponse
+	err := p.call(ctx, func() (err error) {
+		records, err = p.client.ListDNSRecords(ctx, dns.RecordListParams{ZoneID: cloudflare.String(zoneID)})
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list DNS records: %w", err)
+		return nil, fmt.Errorf("failed to list DNS records: %w", classifyCloudflareError(err, ErrZoneNotFound))
+	}
+	return records, nil
+}
+
+// ListAddressRecords implements RecordLister, sorted by name and type. Records with an
+// automatic TTL have TTL 0.
+func (p *CloudflareProvider) ListAddressRecords(ctx context.Context, zoneID string) ([]ExistingRecord, error) {
+	all, err := p.GetDNSRecords(ctx, zoneID)
+	if err != nil {
+		return nil, err
 	}
+	var records []ExistingRecord
+	for _, rec := range all {
+		if rec.Type != dns.RecordResponseTypeA && rec.Type != dns.RecordResponseTypeAAAA {
+			continue
+		}
+		r := ExistingRecord{Name: rec.Name, Type: DNSRecordType(rec.Type), Content: rec.Content, Proxied: rec.Proxied}
+		if rec.TTL != dns.TTL1 {
+			r.TTL = int(rec.TTL)
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].Type < records[j].Type
+	})
 	return records, nil
 }
 
+// maxNameQueries is the most records, ownership records included, that are looked up by name.
+// Beyond it the zone is listed in full, which takes fewer requests than one query per name.
+const maxNameQueries = 10
+
+// listRecords returns the existing records of the zone relevant to records: those with the
+// same names, and their ownership records. Small sets are looked up name by name, so large
+// zones are not listed in full on every sync.
+func (p *CloudflareProvider) listRecords(ctx context.Context, zoneID string, records []DNSRecord) ([]dns.RecordResponse, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		candidates := []string{record.FQDN()}
+		if p.owner != "" {
+			candidates = append(candidates, ownershipName(record.FQDN()))
+		}
+		for _, name := range candidates {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) > maxNameQueries {
+		return p.GetDNSRecords(ctx, zoneID)
+	}
+	return p.listNames(ctx, zoneID, names)
+}
+
+// listNames returns the existing records of the zone with the given names
+func (p *CloudflareProvider) listNames(ctx context.Context, zoneID string, names []string) ([]dns.RecordResponse, error) {
+	var existing []dns.RecordResponse
+	found := make(map[string]bool)
+	for _, name := range names {
+		var matches []dns.RecordResponse
+		err := p.call(ctx, func() (err error) {
+			matches, err = p.client.ListDNSRecords(ctx, dns.RecordListParams{
+				ZoneID: cloudflare.String(zoneID),
+				Name:   cloudflare.F(dns.RecordListParamsName{Exact: cloudflare.String(name)}),
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list DNS records: %w", classifyCloudflareError(err, ErrZoneNotFound))
+		}
+		for _, rec := range matches {
+			if !found[rec.ID] {
+				found[rec.ID] = true
+				existing = append(existing, rec)
+			}
+		}
+	}
+	return existing, nil
+}
+
 type UpdateDNSRecord struct {
 	ID string
 	DNSRecord
 }
 
-func toDNSARecord(record DNSRecord, ipv4 string) dns.ARecordParam {
-	return dns.ARecordParam{
+func toDNSARecord(record DNSRecord, ipv4 string, tags []string) dns.ARecordParam {
+	param := dns.ARecordParam{
 		Name:    cloudflare.String(record.Name),
 		Type:    cloudflare.F(dns.ARecordTypeA),
 		Content: cloudflare.String(ipv4),
 		Proxied: cloudflare.Bool(record.Proxied),
-		TTL:     cloudflare.F(dns.TTL1), // Auto TTL
+		TTL:     cloudflare.F(cloudflareTTL(record)),
+		Comment: cloudflare.String(ManagedComment),
 	}
+	if len(tags) > 0 {
+		param.Tags = cloudflare.F(tags)
+	}
+	return param
 }
 
-func toDNSAAAARecord(record DNSRecord, ipv6 string) dns.AAAARecordParam {
-	return dns.AAAARecordParam{
+func toDNSAAAARecord(record DNSRecord, ipv6 string, tags []string) dns.AAAARecordParam {
+	param := dns.AAAARecordParam{
 		Name:    cloudflare.String(record.Name),
 		Type:    cloudflare.F(dns.AAAARecordTypeAAAA),
 		Content: cloudflare.String(ipv6),
 		Proxied: cloudflare.Bool(record.Proxied),
-		TTL:     cloudflare.F(dns.TTL1), // Auto TTL
+		TTL:     cloudflare.F(cloudflareTTL(record)),
+		Comment: cloudflare.String(ManagedComment),
+	}
+	if len(tags) > 0 {
+		param.Tags = cloudflare.F(tags)
+	}
+	return param
+}
+
+func toDNSCNAMERecord(record DNSRecord, tags []string) dns.CNAMERecordParam {
+	param := dns.CNAMERecordParam{
+		Name:    cloudflare.String(record.Name),
+		Type:    cloudflare.F(dns.CNAMERecordTypeCNAME),
+		Content: cloudflare.String(recordContent(record, "", "")),
+		Proxied: cloudflare.Bool(record.Proxied),
+		TTL:     cloudflare.F(cloudflareTTL(record)),
+		Comment: cloudflare.String(ManagedComment),
+	}
+	if len(tags) > 0 {
+		param.Tags = cloudflare.F(tags)
+	}
+	return param
+}
+
+func toDNSTXTRecord(record DNSRecord, tags []string) dns.TXTRecordParam {
+	param := dns.TXTRecordParam{
+		Name:    cloudflare.String(record.Name),
+		Type:    cloudflare.F(dns.TXTRecordTypeTXT),
+		Content: cloudflare.String(recordContent(record, "", "")),
+		TTL:     cloudflare.F(cloudflareTTL(record)),
+		Comment: cloudflare.String(ManagedComment),
+	}
+	if len(tags) > 0 {
+		param.Tags = cloudflare.F(tags)
+	}
+	return param
+}
+
+// cloudflareTTL returns the TTL to write for record, automatic unless it sets its own
+func cloudflareTTL(record DNSRecord) dns.TTL {
+	if record.TTL == 0 {
+		return dns.TTL1 // Auto TTL
 	}
+	return dns.TTL(record.TTL)
 }
 
-func prepareBatchCreate(records []DNSRecord, ipv4, ipv6 string) []dns.RecordBatchParamsPostUnion {
+func prepareBatchCreate(records []DNSRecord, ipv4, ipv6 string, tags []string) []dns.RecordBatchParamsPostUnion {
 	var newRecords []dns.RecordBatchParamsPostUnion
 	for _, record := range records {
 		switch record.Type {
 		case ARecord:
-			newRecords = append(newRecords, toDNSARecord(record, ipv4))
+			newRecords = append(newRecords, toDNSARecord(record, ipv4, tags))
 		case AAAARecord:
-			newRecords = append(newRecords, toDNSAAAARecord(record, ipv6))
+			newRecords = append(newRecords, toDNSAAAARecord(record, ipv6, tags))
+		case CNAMERecord:
+			newRecords = append(newRecords, toDNSCNAMERecord(record, tags))
+		case TXTRecord:
+			newRecords = append(newRecords, toDNSTXTRecord(record, tags))
 		}
 	}
 
 	return newRecords
 }
 
-func prepareBatchUpdate(records []UpdateDNSRecord, ipv4, ipv6 string) []dns.BatchPutUnionParam {
+func prepareBatchUpdate(records []UpdateDNSRecord, ipv4, ipv6 string, tags []string) []dns.BatchPutUnionParam {
 	var updateRecords []dns.BatchPutUnionParam
 	for _, record := range records {
 		switch record.Type {
 		case ARecord:
 			updateRecords = append(updateRecords, dns.BatchPutARecordParam{
 				ID:           cloudflare.String(record.ID),
-				ARecordParam: toDNSARecord(record.DNSRecord, ipv4),
+				ARecordParam: toDNSARecord(record.DNSRecord, ipv4, tags),
 			})
 		case AAAARecord:
 			updateRecords = append(updateRecords, dns.BatchPutAAAARecordParam{
 				ID:              cloudflare.String(record.ID),
-				AAAARecordParam: toDNSAAAARecord(record.DNSRecord, ipv6),
+				AAAARecordParam: toDNSAAAARecord(record.DNSRecord, ipv6, tags),
+			})
+		case CNAMERecord:
+			updateRecords = append(updateRecords, dns.BatchPutCNAMERecordParam{
+				ID:               cloudflare.String(record.ID),
+				CNAMERecordParam: toDNSCNAMERecord(record.DNSRecord, tags),
+			})
+		case TXTRecord:
+			updateRecords = append(updateRecords, dns.BatchPutTXTRecordParam{
+				ID:             cloudflare.String(record.ID),
+				TXTRecordParam: toDNSTXTRecord(record.DNSRecord, tags),
 			})
 		}
 	}
@@ -168,24 +588,62 @@ func prepareBatchUpdate(records []UpdateDNSRecord, ipv4, ipv6 string) []dns.Batc
 	return updateRecords
 }
 
+func prepareOwnershipCreate(names []string, owner string) []dns.RecordBatchParamsPostUnion {
+	var newRecords []dns.RecordBatchParamsPostUnion
+	for _, name := range names {
+		newRecords = append(newRecords, dns.TXTRecordParam{
+			Name:    cloudflare.String(name),
+			Type:    cloudflare.F(dns.TXTRecordTypeTXT),
+			Content: cloudflare.String(ownershipContent(owner)),
+			TTL:     cloudflare.F(dns.TTL1), // Auto TTL
+			Comment: cloudflare.String(ManagedComment),
+		})
+	}
+
+	return newRecords
+}
+
 func prepareRecordKey(record DNSRecord) string {
-	name := record.Root
-	if record.Name != "@" {
-		name = record.Name + "." + record.Root
+	return record.FQDN() + "|" + record.Type.String()
+}
+
+// checkAdoption applies the adoption policy to the records that would update an existing record.
+// A record is managed when it carries ManagedComment or an ownership record of this instance.
+func (p *CloudflareProvider) checkAdoption(existingRecords []dns.RecordResponse, records []DNSRecord, claims []string, ipv4, ipv6 string) ([]DNSRecord, []string, []DNSRecord, []DNSRecord) {
+	byID := make(map[string]dns.RecordResponse)
+	for _, rec := range existingRecords {
+		byID[rec.ID] = rec
 	}
-	return name + "|" + record.Type.String()
+	_, recordsToUpdate := diffCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	existing := make(map[string]dns.RecordResponse)
+	overwriting := make([]DNSRecord, len(recordsToUpdate))
+	for i, u := range recordsToUpdate {
+		existing[prepareRecordKey(u.DNSRecord)] = byID[u.ID]
+		overwriting[i] = u.DNSRecord
+	}
+
+	owners := cloudflareOwnership(existingRecords)
+	return checkAdoption(!p.refuse, records, overwriting, claims, func(r DNSRecord) bool {
+		return existing[prepareRecordKey(r)].Comment == ManagedComment || ownedBy(p.owner, owners, r.FQDN())
+	})
 }
 
-// EnsureDNSRecords checks if the DNS records match the provided IPs and creates or updates them as necessary
-func (p *CloudflareProvider) EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) error {
-	existingRecords, err := p.GetDNSRecords(ctx, zoneID)
-	if err != nil {
-		return fmt.Errorf("failed to get existing DNS records: %w", err)
+// cloudflareOwnership maps the names of the ownership TXT records in a zone to their content
+func cloudflareOwnership(existingRecords []dns.RecordResponse) map[string]string {
+	owners := make(map[string]string)
+	for _, rec := range existingRecords {
+		if rec.Type == dns.RecordResponseTypeTXT && strings.HasPrefix(rec.Name, OwnershipPrefix) {
+			owners[rec.Name] = rec.Content
+		}
 	}
+	return owners
+}
 
+// diffCloudflareRecords compares the records with the zone and returns those that must be created or updated
+func diffCloudflareRecords(existingRecords []dns.RecordResponse, records []DNSRecord, ipv4, ipv6 string) ([]DNSRecord, []UpdateDNSRecord) {
 	existingRecordMap := make(map[string]dns.RecordResponse)
 	for _, rec := range existingRecords {
-		if rec.Type == dns.RecordResponseTypeA || rec.Type == dns.RecordResponseTypeAAAA {
+		if rec.Type == dns.RecordResponseTypeA || rec.Type == dns.RecordResponseTypeAAAA || rec.Type == dns.RecordResponseTypeCNAME || rec.Type == dns.RecordResponseTypeTXT {
 			existingRecordMap[rec.Name+"|"+string(rec.Type)] = rec
 		}
 	}
@@ -202,19 +660,19 @@ func (p *CloudflareProvider) EnsureDNSRecords(ctx context.Context, zoneID string
 		key := prepareRecordKey(record)
 		existingRec, exists := existingRecordMap[key]
 		if !exists {
-			recordsToCreate = append(recordsToCreate, record)
+			if !record.NoCreate {
+				recordsToCreate = append(recordsToCreate, record)
+			}
 			continue
 		}
 
-		var expectedContent string
-		switch record.Type {
-		case ARecord:
-			expectedContent = ipv4
-		case AAAARecord:
-			expectedContent = ipv6
+		expectedContent := recordContent(record, ipv4, ipv6)
+		ttlDiffers := record.TTL != 0 && existingRec.TTL != dns.TTL(record.TTL)
+		if record.Strict {
+			ttlDiffers = existingRec.TTL != cloudflareTTL(record)
 		}
-
-		if existingRec.Content != expectedContent || existingRec.Proxied != record.Proxied {
+		commentDiffers := record.Strict && existingRec.Comment != ManagedComment
+		if existingRec.Content != expectedContent || existingRec.Proxied != record.Proxied || ttlDiffers || commentDiffers {
 			recordsToUpdate = append(recordsToUpdate, UpdateDNSRecord{
 				ID:        existingRec.ID,
 				DNSRecord: record,
@@ -222,38 +680,509 @@ func (p *CloudflareProvider) EnsureDNSRecords(ctx context.Context, zoneID string
 		}
 	}
 
-	if len(recordsToCreate) == 0 && len(recordsToUpdate) == 0 {
-		log.Println("No DNS records to create or update")
-		return nil
+	return recordsToCreate, recordsToUpdate
+}
+
+// duplicateCloudflareRecords returns the managed records that share the name and type of one of
+// records with the record EnsureDNSRecords keeps, the last one listed, so they are deleted in the
+// same batch. Duplicates without ManagedComment or an ownership record of this instance may be
+// intentional, such as round-robin addresses, and are left alone.
+func (p *CloudflareProvider) duplicateCloudflareRecords(existingRecords []dns.RecordResponse, records []DNSRecord, ipv4, ipv6 string) []dns.RecordResponse {
+	wanted := make(map[string]bool)
+	for _, record := range records {
+		if recordContent(record, ipv4, ipv6) != "" {
+			wanted[prepareRecordKey(record)] = true
+		}
+	}
+	kept := make(map[string]string)
+	for _, rec := range existingRecords {
+		kept[rec.Name+"|"+string(rec.Type)] = rec.ID
 	}
 
-	batchReq := dns.RecordBatchParams{
-		ZoneID: cloudflare.String(zoneID),
+	owners := cloudflareOwnership(existingRecords)
+	var duplicates []dns.RecordResponse
+	for _, rec := range existingRecords {
+		key := rec.Name + "|" + string(rec.Type)
+		if !wanted[key] || kept[key] == rec.ID {
+			continue
+		}
+		if rec.Comment == ManagedComment || ownedBy(p.owner, owners, rec.Name) {
+			duplicates = append(duplicates, rec)
+		}
 	}
+	return duplicates
+}
 
-	if len(recordsToCreate) > 0 {
-		batchReq.Posts = cloudflare.F(prepareBatchCreate(recordsToCreate, ipv4, ipv6))
+func prepareBatchDelete(records []dns.RecordResponse) []dns.RecordBatchParamsDelete {
+	deletes := make([]dns.RecordBatchParamsDelete, len(records))
+	for i, rec := range records {
+		deletes[i] = dns.RecordBatchParamsDelete{ID: cloudflare.String(rec.ID)}
 	}
+	return deletes
+}
 
-	if len(recordsToUpdate) > 0 {
-		batchReq.Puts = cloudflare.F(prepareBatchUpdate(recordsToUpdate, ipv4, ipv6))
+// planCloudflareChanges describes the creates, updates, deletes and ownership claims EnsureDNSRecords would send
+func planCloudflareChanges(existingRecords []dns.RecordResponse, recordsToCreate []DNSRecord, recordsToUpdate []UpdateDNSRecord, recordsToDelete []dns.RecordResponse, claims []string, owner, ipv4, ipv6 string) []Change {
+	existingByID := make(map[string]dns.RecordResponse)
+	for _, rec := range existingRecords {
+		existingByID[rec.ID] = rec
 	}
 
-	_, err = p.client.BatchDNSRecords(ctx, batchReq)
+	var changes []Change
+	for _, record := range recordsToCreate {
+		changes = append(changes, Change{
+			Action:     ChangeCreate,
+			Name:       record.FQDN(),
+			Type:       record.Type.String(),
+			NewContent: recordContent(record, ipv4, ipv6),
+			NewProxied: record.Proxied,
+			NewTTL:     record.TTL,
+		})
+	}
+	for _, record := range recordsToUpdate {
+		existing := existingByID[record.ID]
+		c := Change{
+			Action:     ChangeUpdate,
+			Name:       record.FQDN(),
+			Type:       record.Type.String(),
+			OldContent: existing.Content,
+			NewContent: recordContent(record.DNSRecord, ipv4, ipv6),
+			OldProxied: existing.Proxied,
+			NewProxied: record.Proxied,
+		}
+		if record.TTL != 0 {
+			c.OldTTL, c.NewTTL = int(existing.TTL), record.TTL
+		}
+		changes = append(changes, c)
+	}
+	for _, rec := range recordsToDelete {
+		changes = append(changes, Change{
+			Action:     ChangeDelete,
+			Name:       rec.Name,
+			Type:       string(rec.Type),
+			OldContent: rec.Content,
+			OldProxied: rec.Proxied,
+		})
+	}
+	for _, name := range claims {
+		changes = append(changes, Change{
+			Action:     ChangeCreate,
+			Name:       name,
+			Type:       "TXT",
+			NewContent: ownershipContent(owner),
+		})
+	}
+	return changes
+}
+
+// PlanDNSRecords returns the changes EnsureDNSRecords would make, without applying them
+func (p *CloudflareProvider) PlanDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]Change, error) {
+	existingRecords, err := p.listRecords(ctx, zoneID, records)
 	if err != nil {
-		return fmt.Errorf("failed to execute batch DNS record update: %w", err)
+		return nil, fmt.Errorf("failed to get existing DNS records: %w", err)
 	}
 
-	return nil
+	owners := cloudflareOwnership(existingRecords)
+	records, claims, conflicts := checkOwnership(p.owner, owners, records)
+	records, claims, _, unmanaged := p.checkAdoption(existingRecords, records, claims, ipv4, ipv6)
+	recordsToCreate, recordsToUpdate := diffCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	duplicates := p.duplicateCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	return planCloudflareChanges(existingRecords, recordsToCreate, recordsToUpdate, duplicates, claims, p.owner, ipv4, ipv6), errors.Join(ownershipError(conflicts, owners), unmanagedError(unmanaged))
+}
+
+// CheckDNSRecords returns the records that are missing or differ from the provided IPs, without changing them
+func (p *CloudflareProvider) CheckDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]DNSRecord, error) {
+	existingRecords, err := p.listRecords(ctx, zoneID, records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing DNS records: %w", err)
+	}
+
+	recordsToCreate, recordsToUpdate := diffCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	for _, record := range recordsToUpdate {
+		recordsToCreate = append(recordsToCreate, record.DNSRecord)
+	}
+	return recordsToCreate, nil
+}
+
+// EnsureDNSRecords checks if the DNS records match the provided IPs and creates or updates them as necessary.
+// With an owner set, records claimed by another owner are skipped and reported as ErrNotOwner
+// after the remaining records have been applied. The result lists what was created, updated and
+// skipped, and every record that failed.
+func (p *CloudflareProvider) EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) (Result, error) {
+	return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, nil)
+}
+
+// EnsureDNSRecordsStream is EnsureDNSRecords reporting every record change to progress.
+// The changes of a zone go out in batch requests of at most the batch policy's MaxChanges, each
+// sent and confirmed together; when a request fails, the changes of earlier ones stay applied.
+func (p *CloudflareProvider) EnsureDNSRecordsStream(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error) {
+	if p.dryRun != nil {
+		return dryRun(ctx, p.dryRun, p, zoneID, records, ipv4, ipv6)
+	}
+
+	existingRecords, err := p.listRecords(ctx, zoneID, records)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to get existing DNS records: %w", err)
+	}
+
+	owners := cloudflareOwnership(existingRecords)
+	records, claims, conflicts := checkOwnership(p.owner, owners, records)
+	records, claims, adopted, unmanaged := p.checkAdoption(existingRecords, records, claims, ipv4, ipv6)
+	recordsToCreate, recordsToUpdate := diffCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	duplicates := p.duplicateCloudflareRecords(existingRecords, records, ipv4, ipv6)
+	refusedErr := errors.Join(ownershipError(conflicts, owners), unmanagedError(unmanaged))
+
+	if len(recordsToCreate) == 0 && len(recordsToUpdate) == 0 && len(duplicates) == 0 && len(claims) == 0 {
+		logger().Debug("No DNS records to create or update", "zone", zoneID)
+		p.cacheRecords(zoneID, existingRecords, records, ipv4, ipv6)
+		return newResult(records, nil, conflicts, unmanaged, nil), refusedErr
+	}
+	logAdopted(adopted)
+
+	changes := planCloudflareChanges(existingRecords, recordsToCreate, recordsToUpdate, duplicates, claims, p.owner, ipv4, ipv6)
+	report(progress, StagePlanned, changes, nil)
+
+	// Ops follow the order planCloudflareChanges lists the changes in: creates, updates, deletes, claims
+	var ops []cloudflareOp
+	created, updated, deleted := len(recordsToCreate), len(recordsToUpdate), len(duplicates)
+	for i, post := range prepareBatchCreate(recordsToCreate, ipv4, ipv6, p.tags) {
+		ops = append(ops, cloudflareOp{change: changes[i], post: post})
+	}
+	for i, put := range prepareBatchUpdate(recordsToUpdate, ipv4, ipv6, p.tags) {
+		ops = append(ops, cloudflareOp{change: changes[created+i], put: put})
+	}
+	for i, del := range prepareBatchDelete(duplicates) {
+		ops = append(ops, cloudflareOp{change: changes[created+updated+i], delete: &del})
+	}
+	for i, post := range prepareOwnershipCreate(claims, p.owner) {
+		ops = append(ops, cloudflareOp{change: changes[created+updated+deleted+i], post: post})
+	}
+
+	posts, sent, err := p.sendBatch(ctx, zoneID, ops, progress)
+	if err != nil {
+		err = fmt.Errorf("failed to execute batch DNS record update: %w", classifyCloudflareError(err, ErrRecordNotFound))
+		applied, failed := opChanges(ops[:sent]), opChanges(ops[sent:])
+		report(progress, StageFailed, failed, err)
+		if sent > 0 {
+			p.purgeCache(ctx, zoneID, records, applied)
+			p.forgetRecords(zoneID)
+		}
+		return newPartialResult(records, applied, failed, conflicts, unmanaged, err), err
+	}
+	p.purgeCache(ctx, zoneID, records, changes)
+
+	existingRecords = append(existingRecords, posts...)
+	p.cacheRecords(zoneID, existingRecords, records, ipv4, ipv6)
+	return newResult(records, changes, conflicts, unmanaged, nil), refusedErr
+}
+
+// cloudflareOp is one operation of a batch request with the change it makes; exactly one of
+// post, put and delete is set
+type cloudflareOp struct {
+	change Change
+	post   dns.RecordBatchParamsPostUnion
+	put    dns.BatchPutUnionParam
+	delete *dns.RecordBatchParamsDelete
+}
+
+// sendBatch sends ops in batch requests split by the batch policy, reporting each request's
+// changes to progress as it is sent and confirmed. It returns the records created and the number
+// of ops applied before a request failed.
+func (p *CloudflareProvider) sendBatch(ctx context.Context, zoneID string, ops []cloudflareOp, progress func(Progress)) ([]dns.RecordResponse, int, error) {
+	var created []dns.RecordResponse
+	sent, err := sendChunks(ctx, p.batch, len(ops), func(start, end int) error {
+		req := dns.RecordBatchParams{ZoneID: cloudflare.String(zoneID)}
+		var posts []dns.RecordBatchParamsPostUnion
+		var puts []dns.BatchPutUnionParam
+		var deletes []dns.RecordBatchParamsDelete
+		for _, op := range ops[start:end] {
+			switch {
+			case op.delete != nil:
+				deletes = append(deletes, *op.delete)
+			case op.put != nil:
+				puts = append(puts, op.put)
+			default:
+				posts = append(posts, op.post)
+			}
+		}
+		if len(posts) > 0 {
+			req.Posts = cloudflare.F(posts)
+		}
+		if len(puts) > 0 {
+			req.Puts = cloudflare.F(puts)
+		}
+		if len(deletes) > 0 {
+			req.Deletes = cloudflare.F(deletes)
+		}
+
+		changes := opChanges(ops[start:end])
+		report(progress, StageSent, changes, nil)
+		var batch *dns.RecordBatchResponse
+		var err error
+		if len(posts) > 0 {
+			batch, err = p.sendCreates(ctx, zoneID, req, ops[start:end])
+		} else {
+			err = p.call(ctx, func() (err error) {
+				batch, err = p.client.BatchDNSRecords(ctx, req)
+				return err
+			})
+		}
+		if err != nil {
+			return err
+		}
+		report(progress, StageConfirmed, changes, nil)
+		if batch != nil {
+			created = append(created, batch.Posts...)
+		}
+		return nil
+	})
+	return created, sent, err
+}
+
+// sendCreates sends a batch request that creates records. Sending it again after a failure
+// that may have reached the API could create them twice, so before every retry the names of
+// the records are listed again: a batch is applied all or nothing, and when the records it
+// creates exist the request went through and is not sent again.
+func (p *CloudflareProvider) sendCreates(ctx context.Context, zoneID string, req dns.RecordBatchParams, ops []cloudflareOp) (*dns.RecordBatchResponse, error) {
+	for attempt := 0; ; attempt++ {
+		var batch *dns.RecordBatchResponse
+		err := p.callOnce(ctx, func() (err error) {
+			batch, err = p.client.BatchDNSRecords(ctx, req)
+			return err
+		})
+		var apiErr *cloudflare.Error
+		status := 0
+		if errors.As(err, &apiErr) {
+			status = apiErr.StatusCode
+		}
+		if !transient(err, status) || attempt >= p.retry.MaxRetries {
+			return batch, err
+		}
+
+		wait := p.retry.backoff(attempt)
+		logger().Warn("Batch DNS record update failed, listing the records before retrying", "zone", zoneID, "duration", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		created, listErr := p.listCreated(ctx, zoneID, ops)
+		if listErr != nil {
+			return nil, errors.Join(err, listErr)
+		}
+		if created != nil {
+			logger().Info("Batch DNS record update was applied despite the error", "zone", zoneID, "error", err)
+			return &dns.RecordBatchResponse{Posts: created}, nil
+		}
+	}
+}
+
+// listCreated returns the records the creates of ops made, or nil when any of them does not exist
+func (p *CloudflareProvider) listCreated(ctx context.Context, zoneID string, ops []cloudflareOp) ([]dns.RecordResponse, error) {
+	var names []string
+	for _, op := range ops {
+		if op.post != nil && !slices.Contains(names, op.change.Name) {
+			names = append(names, op.change.Name)
+		}
+	}
+	existing, err := p.listNames(ctx, zoneID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []dns.RecordResponse
+	for _, op := range ops {
+		if op.post == nil {
+			continue
+		}
+		i := slices.IndexFunc(existing, func(rec dns.RecordResponse) bool {
+			return rec.Name == op.change.Name && string(rec.Type) == op.change.Type
+		})
+		if i < 0 {
+			return nil, nil
+		}
+		created = append(created, existing[i])
+	}
+	return created, nil
+}
+
+// opChanges returns the changes made by ops
+func opChanges(ops []cloudflareOp) []Change {
+	changes := make([]Change, len(ops))
+	for i, op := range ops {
+		changes[i] = op.change
+	}
+	return changes
+}
+
+// EnsureDNSRecordsCached is EnsureDNSRecordsStream working from the state cache: when every record
+// is cached with its configured proxy and TTL settings, the changed ones are written by ID without
+// listing the zone. It lists the zone like EnsureDNSRecordsStream on a cache miss, and when the
+// write is rejected because a cached record no longer exists or changed.
+func (p *CloudflareProvider) EnsureDNSRecordsCached(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error) {
+	if p.cache == nil || p.dryRun != nil {
+		return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, progress)
+	}
+
+	var keys []string
+	for _, record := range records {
+		if recordContent(record, ipv4, ipv6) != "" {
+			keys = append(keys, prepareRecordKey(record))
+		}
+	}
+	cached, ok := p.cache.Lookup(zoneID, keys)
+	if !ok {
+		return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, progress)
+	}
+
+	var recordsToUpdate []UpdateDNSRecord
+	var changes []Change
+	for _, record := range records {
+		content := recordContent(record, ipv4, ipv6)
+		if content == "" {
+			continue
+		}
+		rec := cached[prepareRecordKey(record)]
+		if rec.Proxied != record.Proxied || rec.TTL != record.TTL {
+			return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, progress)
+		}
+		if rec.Content == content {
+			continue
+		}
+		recordsToUpdate = append(recordsToUpdate, UpdateDNSRecord{ID: rec.ID, DNSRecord: record})
+		changes = append(changes, Change{
+			Action:     ChangeUpdate,
+			Name:       record.FQDN(),
+			Type:       record.Type.String(),
+			OldContent: rec.Content,
+			NewContent: content,
+			OldProxied: rec.Proxied,
+			NewProxied: record.Proxied,
+			OldTTL:     rec.TTL,
+			NewTTL:     record.TTL,
+		})
+	}
+	if len(recordsToUpdate) == 0 {
+		logger().Debug("No DNS records to create or update", "zone", zoneID)
+		return newResult(records, nil, nil, nil, nil), nil
+	}
+
+	report(progress, StagePlanned, changes, nil)
+	ops := make([]cloudflareOp, len(recordsToUpdate))
+	for i, put := range prepareBatchUpdate(recordsToUpdate, ipv4, ipv6, p.tags) {
+		ops[i] = cloudflareOp{change: changes[i], put: put}
+	}
+	if _, sent, err := p.sendBatch(ctx, zoneID, ops, progress); err != nil {
+		err = classifyCloudflareError(err, ErrRecordNotFound)
+		p.forgetRecords(zoneID)
+		if errors.Is(err, ErrRecordNotFound) || errors.Is(err, ErrValidation) {
+			logger().Info("Cached records of the zone are stale, listing them", "zone", zoneID, "error", err)
+			return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, progress)
+		}
+		err = fmt.Errorf("failed to execute batch DNS record update: %w", err)
+		applied, failed := opChanges(ops[:sent]), opChanges(ops[sent:])
+		report(progress, StageFailed, failed, err)
+		p.purgeCache(ctx, zoneID, records, applied)
+		return newPartialResult(records, applied, failed, nil, nil, err), err
+	}
+	p.purgeCache(ctx, zoneID, records, changes)
+
+	updated := make(map[string]CachedRecord, len(recordsToUpdate))
+	for _, record := range recordsToUpdate {
+		updated[prepareRecordKey(record.DNSRecord)] = CachedRecord{
+			ID:      record.ID,
+			Content: recordContent(record.DNSRecord, ipv4, ipv6),
+			Proxied: record.Proxied,
+			TTL:     record.TTL,
+		}
+	}
+	if err := p.cache.Store(zoneID, updated); err != nil {
+		logger().Error("Failed to update record cache", "zone", zoneID, "error", err)
+	}
+	return newResult(records, changes, nil, nil, nil), nil
+}
+
+// cacheRecords stores the records of the zone that now hold their expected content, as found in
+// existingRecords; records ensured without an error do, since the write succeeded
+func (p *CloudflareProvider) cacheRecords(zoneID string, existingRecords []dns.RecordResponse, records []DNSRecord, ipv4, ipv6 string) {
+	if p.cache == nil {
+		return
+	}
+
+	ids := make(map[string]string)
+	for _, rec := range existingRecords {
+		ids[rec.Name+"|"+string(rec.Type)] = rec.ID
+	}
+	cached := make(map[string]CachedRecord)
+	for _, record := range records {
+		content := recordContent(record, ipv4, ipv6)
+		key := prepareRecordKey(record)
+		if id, ok := ids[key]; ok && content != "" {
+			cached[key] = CachedRecord{ID: id, Content: content, Proxied: record.Proxied, TTL: record.TTL}
+		}
+	}
+	if err := p.cache.Store(zoneID, cached); err != nil {
+		logger().Error("Failed to update record cache", "zone", zoneID, "error", err)
+	}
+}
+
+// forgetRecords drops the cached records of the zone after changes were only partly applied,
+// so the next update lists the zone again
+func (p *CloudflareProvider) forgetRecords(zoneID string) {
+	if p.cache == nil {
+		return
+	}
+	if err := p.cache.Forget(zoneID); err != nil {
+		logger().Error("Failed to update record cache", "zone", zoneID, "error", err)
+	}
+}
+
+// purgeCache purges the Cloudflare cache of the created and updated records that set PurgeCache,
+// so error pages cached while the old origin address was unreachable are not served any longer.
+// The records are already written, so a failed purge is only logged.
+func (p *CloudflareProvider) purgeCache(ctx context.Context, zoneID string, records []DNSRecord, changes []Change) {
+	purge := make(map[string]bool)
+	for _, record := range records {
+		if record.PurgeCache {
+			purge[record.FQDN()] = true
+		}
+	}
+
+	var hosts []string
+	for _, c := range changes {
+		if c.Action != ChangeDelete && purge[c.Name] {
+			hosts = append(hosts, c.Name)
+			delete(purge, c.Name)
+		}
+	}
+
+	for len(hosts) > 0 {
+		n := min(len(hosts), maxPurgeHosts)
+		err := p.call(ctx, func() error {
+			return p.client.PurgeCache(ctx, zoneID, hosts[:n])
+		})
+		if err != nil {
+			logger().Error("Failed to purge Cloudflare cache", "zone", zoneID, "records", strings.Join(hosts[:n], ", "), "error", classifyCloudflareError(err, nil))
+		} else {
+			logger().Info("Purged Cloudflare cache", "zone", zoneID, "records", strings.Join(hosts[:n], ", "))
+		}
+		hosts = hosts[n:]
+	}
 }
 
 // DeleteDNSRecord deletes a DNS record by ID
 func (p *CloudflareProvider) DeleteDNSRecord(ctx context.Context, zoneID, recordID string) error {
-	_, err := p.client.DeleteDNSRecord(ctx, recordID, dns.RecordDeleteParams{
-		ZoneID: cloudflare.String(zoneID),
+	err := p.call(ctx, func() error {
+		_, err := p.client.DeleteDNSRecord(ctx, recordID, dns.RecordDeleteParams{
+			ZoneID: cloudflare.String(zoneID),
+		})
+		return err
 	})
 	if err != nil {
-		return fmt.Errorf("failed to delete DNS record %s: %w", recordID, err)
+		return fmt.Errorf("failed to delete DNS record %s: %w", recordID, classifyCloudflareError(err, ErrRecordNotFound))
 	}
 	return nil
 }
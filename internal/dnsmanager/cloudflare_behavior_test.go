@@ -2,6 +2,8 @@ package dnsmanager_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/cloudflare/cloudflare-go/v6/dns"
@@ -28,7 +30,7 @@ func TestCloudflareEnsureDNSRecords_NoChangesSkipsBatch(t *testing.T) {
 	}
 
 	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
-	err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{{
+	_, err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{{
 		Root:    "example.com",
 		Name:    "www",
 		Type:    dnsmanager.ARecord,
@@ -63,7 +65,7 @@ func TestCloudflareEnsureDNSRecords_ProxiedChangeTriggersBatch(t *testing.T) {
 	}
 
 	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
-	err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{{
+	_, err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{{
 		Root:    "example.com",
 		Name:    "www",
 		Type:    dnsmanager.ARecord,
@@ -92,7 +94,7 @@ func TestCloudflareEnsureDNSRecords_EmptyIPsSkipAll(t *testing.T) {
 	}
 
 	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
-	err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{
+	_, err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{
 		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, Proxied: true},
 		{Root: "example.com", Name: "www", Type: dnsmanager.AAAARecord, Proxied: true},
 	}, "", "")
@@ -104,3 +106,124 @@ func TestCloudflareEnsureDNSRecords_EmptyIPsSkipAll(t *testing.T) {
 		t.Fatalf("expected zero batch calls when both IPv4/IPv6 are empty, got %d", batchCalls)
 	}
 }
+
+func TestCloudflareEnsureDNSRecords_ListsByName(t *testing.T) {
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.AAAARecord},
+		{Root: "example.com", Name: "api", Type: dnsmanager.ARecord},
+	}
+
+	tests := []struct {
+		name    string
+		records []dnsmanager.DNSRecord
+		want    []string
+	}{
+		{"few names", records, []string{"www.example.com", "api.example.com"}},
+		{"many names", manyRecords(11), []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listed []string
+			mockClient := &MockCloudflareClient{
+				ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+					listed = append(listed, params.Name.Value.Exact.Value)
+					return nil, nil
+				},
+			}
+
+			provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+			if _, err := provider.EnsureDNSRecords(context.Background(), "zone-1", tt.records, "203.0.113.10", "2001:db8::1"); err != nil {
+				t.Fatalf("EnsureDNSRecords returned error: %v", err)
+			}
+
+			if len(listed) != len(tt.want) {
+				t.Fatalf("expected %d list calls, got %q", len(tt.want), listed)
+			}
+			for i, name := range tt.want {
+				if listed[i] != name {
+					t.Errorf("list call %d: expected name filter %q, got %q", i, name, listed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCloudflareEnsureDNSRecords_NoCreate(t *testing.T) {
+	var batch dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			if params.Name.Value.Exact.Value != "www.example.com" {
+				return nil, nil
+			}
+			return []dns.RecordResponse{
+				{ID: "www", Name: "www.example.com", Type: dns.RecordResponseTypeA, Content: "198.51.100.1", Comment: dnsmanager.ManagedComment},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			batch = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+
+	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	result, err := provider.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, NoCreate: true},
+		{Root: "example.com", Name: "new", Type: dnsmanager.ARecord, NoCreate: true},
+	}, "203.0.113.10", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+
+	// The existing record is still updated; the missing one is left for later
+	if len(batch.Posts.Value) != 0 || len(batch.Puts.Value) != 1 {
+		t.Fatalf("expected only an update, got %d creates and %d updates", len(batch.Posts.Value), len(batch.Puts.Value))
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "new.example.com A" {
+		t.Errorf("expected new.example.com to be skipped, got %q", result.Skipped)
+	}
+}
+
+func TestCloudflareEnsureDNSRecords_PurgesCache(t *testing.T) {
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, Proxied: true, PurgeCache: true},
+		{Root: "example.com", Name: "www", Type: dnsmanager.AAAARecord, Proxied: true, PurgeCache: true},
+		{Root: "example.com", Name: "api", Type: dnsmanager.ARecord, Proxied: true},
+		{Root: "example.com", Name: "shop", Type: dnsmanager.ARecord, Proxied: true, PurgeCache: true},
+	}
+
+	var purged [][]string
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			if params.Name.Value.Exact.Value != "shop.example.com" {
+				return nil, nil
+			}
+			return []dns.RecordResponse{
+				{ID: "shop", Name: "shop.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10", Proxied: true, Comment: dnsmanager.ManagedComment},
+			}, nil
+		},
+		PurgeCacheFunc: func(ctx context.Context, zoneID string, hosts []string) error {
+			purged = append(purged, hosts)
+			return errors.New("purge failed")
+		},
+	}
+
+	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	if _, err := provider.EnsureDNSRecords(context.Background(), "zone-1", records, "203.0.113.10", "2001:db8::1"); err != nil {
+		t.Fatalf("a failed purge should not fail the update: %v", err)
+	}
+
+	// www changed and asks for a purge; api does not ask for one and shop is unchanged
+	if len(purged) != 1 || len(purged[0]) != 1 || purged[0][0] != "www.example.com" {
+		t.Fatalf("expected one purge of www.example.com, got %q", purged)
+	}
+}
+
+func manyRecords(n int) []dnsmanager.DNSRecord {
+	records := make([]dnsmanager.DNSRecord, n)
+	for i := range records {
+		records[i] = dnsmanager.DNSRecord{Root: "example.com", Name: fmt.Sprintf("host%d", i), Type: dnsmanager.ARecord}
+	}
+	return records
+}
@@ -141,7 +141,7 @@ func TestIntegration_EnsureDNSRecords_CreateAndUpdate(t *testing.T) {
 
 	// Step 1: Create the records
 	t.Log("Creating DNS records...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, testIPv6)
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, testIPv6)
 	if err != nil {
 		t.Fatalf("Failed to create DNS records: %v", err)
 	}
@@ -189,7 +189,7 @@ func TestIntegration_EnsureDNSRecords_CreateAndUpdate(t *testing.T) {
 	newIPv4 := "203.0.113.101"
 	newIPv6 := "2001:db8::101"
 
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, newIPv4, newIPv6)
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, newIPv4, newIPv6)
 	if err != nil {
 		t.Fatalf("Failed to update DNS records: %v", err)
 	}
@@ -268,7 +268,7 @@ func TestIntegration_EnsureDNSRecords_NoUpdatesNeeded(t *testing.T) {
 
 	// Create the record
 	t.Log("Creating initial DNS record...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
 	if err != nil {
 		t.Fatalf("Failed to create DNS record: %v", err)
 	}
@@ -277,7 +277,7 @@ func TestIntegration_EnsureDNSRecords_NoUpdatesNeeded(t *testing.T) {
 
 	// Call EnsureDNSRecords again with the same IP (should be a no-op)
 	t.Log("Calling EnsureDNSRecords with same IP (should skip update)...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
 	if err != nil {
 		t.Fatalf("Failed on second EnsureDNSRecords call: %v", err)
 	}
@@ -325,7 +325,7 @@ func TestIntegration_EnsureDNSRecords_ProxiedToggle(t *testing.T) {
 	}
 
 	t.Log("Creating DNS record with proxied=false...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
 	if err != nil {
 		t.Fatalf("Failed to create DNS record: %v", err)
 	}
@@ -335,7 +335,7 @@ func TestIntegration_EnsureDNSRecords_ProxiedToggle(t *testing.T) {
 	// Update to proxied=true
 	records[0].Proxied = true
 	t.Log("Updating DNS record to proxied=true...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, testIPv4, "")
 	if err != nil {
 		t.Fatalf("Failed to update proxied status: %v", err)
 	}
@@ -406,7 +406,7 @@ func TestIntegration_EnsureDNSRecords_EmptyIPs(t *testing.T) {
 
 	// Call with empty IPs - should skip both records
 	t.Log("Calling EnsureDNSRecords with empty IPs...")
-	err = manager.EnsureDNSRecords(ctx, zoneID, records, "", "")
+	_, err = manager.EnsureDNSRecords(ctx, zoneID, records, "", "")
 	if err != nil {
 		t.Fatalf("EnsureDNSRecords failed with empty IPs: %v", err)
 	}
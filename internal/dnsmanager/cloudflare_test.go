@@ -3,8 +3,18 @@ package dnsmanager_test
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cloudflare/cloudflare-go/v6"
 	"github.com/cloudflare/cloudflare-go/v6/dns"
 	"github.com/cloudflare/cloudflare-go/v6/zones"
 	"github.com/msyrus/ipwatcher/internal/dnsmanager"
@@ -16,6 +26,8 @@ type MockCloudflareClient struct {
 	ListDNSRecordsFunc  func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error)
 	BatchDNSRecordsFunc func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error)
 	DeleteDNSRecordFunc func(ctx context.Context, recordID string, params dns.RecordDeleteParams) (*dns.RecordDeleteResponse, error)
+	VerifyTokenFunc     func(ctx context.Context, accountID string) (string, error)
+	PurgeCacheFunc      func(ctx context.Context, zoneID string, hosts []string) error
 }
 
 func (m *MockCloudflareClient) ListZones(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
@@ -39,6 +51,20 @@ func (m *MockCloudflareClient) BatchDNSRecords(ctx context.Context, params dns.R
 	return &dns.RecordBatchResponse{}, nil
 }
 
+func (m *MockCloudflareClient) VerifyToken(ctx context.Context, accountID string) (string, error) {
+	if m.VerifyTokenFunc != nil {
+		return m.VerifyTokenFunc(ctx, accountID)
+	}
+	return "active", nil
+}
+
+func (m *MockCloudflareClient) PurgeCache(ctx context.Context, zoneID string, hosts []string) error {
+	if m.PurgeCacheFunc != nil {
+		return m.PurgeCacheFunc(ctx, zoneID, hosts)
+	}
+	return nil
+}
+
 func (m *MockCloudflareClient) DeleteDNSRecord(ctx context.Context, recordID string, params dns.RecordDeleteParams) (*dns.RecordDeleteResponse, error) {
 	if m.DeleteDNSRecordFunc != nil {
 		return m.DeleteDNSRecordFunc(ctx, recordID, params)
@@ -73,6 +99,29 @@ func TestDNSRecordType_String(t *testing.T) {
 	}
 }
 
+func TestDNSRecord_FQDN(t *testing.T) {
+	apex := dnsmanager.DNSRecord{Root: "example.com", Name: "@"}
+	if got := apex.FQDN(); got != "example.com" {
+		t.Errorf("Expected example.com, got %s", got)
+	}
+
+	sub := dnsmanager.DNSRecord{Root: "example.com", Name: "www"}
+	if got := sub.FQDN(); got != "www.example.com" {
+		t.Errorf("Expected www.example.com, got %s", got)
+	}
+
+	for _, name := range []string{"www.example.com", "www.example.com."} {
+		full := dnsmanager.DNSRecord{Root: "example.com", Name: name}
+		if got := full.FQDN(); got != "www.example.com" {
+			t.Errorf("Expected %s to stay www.example.com, got %s", name, got)
+		}
+	}
+	fullApex := dnsmanager.DNSRecord{Root: "example.com", Name: "example.com"}
+	if got := fullApex.FQDN(); got != "example.com" {
+		t.Errorf("Expected example.com, got %s", got)
+	}
+}
+
 func TestNewCloudflareProvider(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -201,6 +250,37 @@ func TestGetZoneIDByName_WithMock(t *testing.T) {
 	}
 }
 
+func TestGetZoneIDByNameInAccount_FiltersByAccount(t *testing.T) {
+	var captured zones.ZoneListParams
+	mockClient := &MockCloudflareClient{
+		ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+			captured = params
+			return []zones.Zone{{ID: "zone-in-account", Name: "example.com"}}, nil
+		},
+	}
+
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	zoneID, err := manager.GetZoneIDByNameInAccount(context.Background(), "example.com", "account-123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if zoneID != "zone-in-account" {
+		t.Errorf("Expected zone ID zone-in-account, got %q", zoneID)
+	}
+	if !captured.Account.Present || captured.Account.Value.ID.Value != "account-123" {
+		t.Errorf("Expected account filter account-123, got %+v", captured.Account)
+	}
+
+	// Without an account ID no filter is sent
+	if _, err := manager.GetZoneIDByName(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if captured.Account.Present {
+		t.Errorf("Expected no account filter, got %+v", captured.Account)
+	}
+}
+
 func TestGetDNSRecords_WithMock(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -370,6 +450,375 @@ func TestGetZoneIDByName_ErrorHandling(t *testing.T) {
 	}
 }
 
+func TestNewCloudflareProviderWithBaseURL(t *testing.T) {
+	defer func(ua string) { dnsmanager.UserAgent = ua }(dnsmanager.UserAgent)
+	dnsmanager.UserAgent = "ipwatcher/v1.2.3"
+
+	var gotPath, gotAuth, gotAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"success":true,"errors":[],"messages":[],"result":[{"id":"zone-123","name":"example.com"}],"result_info":{"page":1,"per_page":20,"count":1,"total_count":1}}`)
+	}))
+	defer server.Close()
+
+	manager, err := dnsmanager.NewCloudflareProviderWithBaseURL("test-token", server.URL+"/client/v4")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	zoneID, err := manager.GetZoneIDByName(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if zoneID != "zone-123" {
+		t.Errorf("Expected zone ID zone-123, got %s", zoneID)
+	}
+	if gotPath != "/client/v4/zones" {
+		t.Errorf("Expected request to /client/v4/zones, got %s", gotPath)
+	}
+	if gotAuth != "Bearer test-token" {
+		t.Errorf("Expected bearer token to be sent, got %q", gotAuth)
+	}
+	if gotAgent != "ipwatcher/v1.2.3" {
+		t.Errorf("Expected User-Agent ipwatcher/v1.2.3, got %q", gotAgent)
+	}
+
+	for _, baseURL := range []string{"localhost:8787", "ftp://example.com", "https://"} {
+		if _, err := dnsmanager.NewCloudflareProviderWithBaseURL("test-token", baseURL); err == nil {
+			t.Errorf("Expected error for base URL %q, got nil", baseURL)
+		}
+	}
+}
+
+func TestCloudflare_ErrorKinds(t *testing.T) {
+	apiError := func(status int) error {
+		return &cloudflare.Error{
+			StatusCode: status,
+			Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+			Response:   &http.Response{StatusCode: status},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		zones    []zones.Zone
+		expected error
+	}{
+		{name: "unauthorized", err: apiError(http.StatusUnauthorized), expected: dnsmanager.ErrAuth},
+		{name: "forbidden", err: apiError(http.StatusForbidden), expected: dnsmanager.ErrAuth},
+		{name: "rate limited", err: apiError(http.StatusTooManyRequests), expected: dnsmanager.ErrRateLimited},
+		{name: "bad request", err: apiError(http.StatusBadRequest), expected: dnsmanager.ErrValidation},
+		{name: "no matching zone", zones: []zones.Zone{}, expected: dnsmanager.ErrZoneNotFound},
+		{name: "unclassified", err: errors.New("connection reset"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+				ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+					return tt.zones, tt.err
+				},
+			})
+			manager.SetRetryPolicy(dnsmanager.RetryPolicy{})
+
+			_, err := manager.GetZoneIDByName(context.Background(), "example.com")
+			if err == nil {
+				t.Fatal("Expected error but got nil")
+			}
+			if kind := dnsmanager.ErrorKind(err); kind != tt.expected {
+				t.Errorf("Expected error kind %v, got %v", tt.expected, kind)
+			}
+
+			var apiErr *cloudflare.Error
+			if tt.err != nil && tt.expected != nil && !errors.As(err, &apiErr) {
+				t.Error("Expected the Cloudflare API error to stay reachable with errors.As")
+			}
+		})
+	}
+}
+
+func TestCloudflare_NotFoundKinds(t *testing.T) {
+	notFound := &cloudflare.Error{
+		StatusCode: http.StatusNotFound,
+		Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones/zone-1/dns_records", nil),
+		Response:   &http.Response{StatusCode: http.StatusNotFound},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			if params.ZoneID.Value == "gone" {
+				return nil, notFound
+			}
+			return []dns.RecordResponse{{ID: "rec-1", Name: "www.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10"}}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			return nil, notFound
+		},
+		DeleteDNSRecordFunc: func(ctx context.Context, recordID string, params dns.RecordDeleteParams) (*dns.RecordDeleteResponse, error) {
+			return nil, notFound
+		},
+	})
+	ctx := context.Background()
+
+	// Listing a zone that no longer exists
+	if _, err := manager.GetDNSRecords(ctx, "gone"); dnsmanager.ErrorKind(err) != dnsmanager.ErrZoneNotFound {
+		t.Errorf("Expected ErrZoneNotFound listing a missing zone, got %v", err)
+	}
+	// Records that no longer exist in a zone that does
+	if err := manager.DeleteDNSRecord(ctx, "zone-1", "rec-1"); dnsmanager.ErrorKind(err) != dnsmanager.ErrRecordNotFound {
+		t.Errorf("Expected ErrRecordNotFound deleting a missing record, got %v", err)
+	}
+	_, err := manager.EnsureDNSRecords(ctx, "zone-1", []dnsmanager.DNSRecord{{Root: "example.com", Name: "www", Type: dnsmanager.ARecord}}, "203.0.113.20", "")
+	if errors.Is(err, dnsmanager.ErrZoneNotFound) || !errors.Is(err, dnsmanager.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, not ErrZoneNotFound, for a failed batch, got %v", err)
+	}
+}
+
+func TestCloudflare_RateLimitRetry(t *testing.T) {
+	rateLimited := func(retryAfter string) error {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return &cloudflare.Error{
+			StatusCode: http.StatusTooManyRequests,
+			Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+			Response:   resp,
+		}
+	}
+	policy := dnsmanager.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	tests := []struct {
+		name          string
+		failures      int
+		retryAfter    string
+		expectedCalls int
+		expectError   bool
+	}{
+		{name: "succeeds after backoff", failures: 2, expectedCalls: 3},
+		{name: "honours short Retry-After", failures: 1, retryAfter: "0", expectedCalls: 2},
+		{name: "gives up after max retries", failures: 10, expectedCalls: 4, expectError: true},
+		{name: "gives up on long Retry-After", failures: 10, retryAfter: "120", expectedCalls: 1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+				ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+					calls++
+					if calls <= tt.failures {
+						return nil, rateLimited(tt.retryAfter)
+					}
+					return []zones.Zone{{ID: "zone-123"}}, nil
+				},
+			})
+			manager.SetRetryPolicy(policy)
+
+			zoneID, err := manager.GetZoneIDByName(context.Background(), "example.com")
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+			if tt.expectError {
+				if !errors.Is(err, dnsmanager.ErrRateLimited) {
+					t.Errorf("Expected ErrRateLimited, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if zoneID != "zone-123" {
+				t.Errorf("Expected zone ID zone-123, got %s", zoneID)
+			}
+		})
+	}
+}
+
+func TestCloudflare_TransientRetry(t *testing.T) {
+	apiError := func(status int) error {
+		return &cloudflare.Error{
+			StatusCode: status,
+			Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+			Response:   &http.Response{StatusCode: status, Header: http.Header{}},
+		}
+	}
+	networkError := &url.Error{Op: "Get", URL: "https://api.cloudflare.com/client/v4/zones", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	policy := dnsmanager.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Jitter: 0.5}
+
+	tests := []struct {
+		name          string
+		err           error
+		failures      int
+		expectedCalls int
+		expectError   bool
+	}{
+		{name: "server error", err: apiError(http.StatusBadGateway), failures: 2, expectedCalls: 3},
+		{name: "network error", err: networkError, failures: 1, expectedCalls: 2},
+		{name: "gives up after max retries", err: apiError(http.StatusServiceUnavailable), failures: 10, expectedCalls: 3, expectError: true},
+		{name: "client error is not retried", err: apiError(http.StatusForbidden), failures: 10, expectedCalls: 1, expectError: true},
+		{name: "unknown host is not retried", err: &net.DNSError{Err: "no such host", Name: "api.cloudflare.com", IsNotFound: true}, failures: 10, expectedCalls: 1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+				ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+					calls++
+					if calls <= tt.failures {
+						return nil, tt.err
+					}
+					return []zones.Zone{{ID: "zone-123"}}, nil
+				},
+			})
+			manager.SetRetryPolicy(policy)
+
+			_, err := manager.GetZoneIDByName(context.Background(), "example.com")
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+			if tt.expectError != (err != nil) {
+				t.Errorf("Expected error: %v, got %v", tt.expectError, err)
+			}
+			if errors.Is(err, dnsmanager.ErrRateLimited) {
+				t.Errorf("Expected no rate limit cooldown after failures, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCloudflare_BatchCreateRetry(t *testing.T) {
+	badGateway := &cloudflare.Error{
+		StatusCode: http.StatusBadGateway,
+		Request:    httptest.NewRequest(http.MethodPost, "https://api.cloudflare.com/client/v4/zones/zone-1/dns_records/batch", nil),
+		Response:   &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}},
+	}
+	policy := dnsmanager.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	existing := dns.RecordResponse{ID: "rec-1", Name: "www.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10"}
+
+	tests := []struct {
+		name          string
+		existing      bool // Whether www exists and is updated rather than created
+		applied       bool // Whether the failed request went through
+		expectedCalls int
+		expectedLists int
+	}{
+		{name: "update is sent again", existing: true, expectedCalls: 2, expectedLists: 1},
+		{name: "create that went through is not sent again", applied: true, expectedCalls: 1, expectedLists: 2},
+		{name: "create that did not go through is sent again", expectedCalls: 2, expectedLists: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, lists := 0, 0
+			zone := []dns.RecordResponse{}
+			if tt.existing {
+				zone = append(zone, existing)
+			}
+			manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+				ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+					lists++
+					return zone, nil
+				},
+				BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+					calls++
+					if calls == 1 {
+						if tt.applied {
+							zone = append(zone, dns.RecordResponse{ID: "rec-2", Name: "www.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.20"})
+						}
+						return nil, badGateway
+					}
+					return &dns.RecordBatchResponse{Posts: []dns.RecordResponse{{ID: "rec-2", Name: "www.example.com", Type: dns.RecordResponseTypeA}}}, nil
+				},
+			})
+			manager.SetRetryPolicy(policy)
+
+			result, err := manager.EnsureDNSRecords(context.Background(), "zone-1", []dnsmanager.DNSRecord{{Root: "example.com", Name: "www", Type: dnsmanager.ARecord}}, "203.0.113.20", "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Changed() != 1 {
+				t.Errorf("Expected one changed record, got %+v", result)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d batch requests, got %d", tt.expectedCalls, calls)
+			}
+			if lists != tt.expectedLists {
+				t.Errorf("Expected %d list requests, got %d", tt.expectedLists, lists)
+			}
+		})
+	}
+}
+
+func TestCloudflare_RateLimitCooldown(t *testing.T) {
+	calls := 0
+	manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+		ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+			calls++
+			return nil, &cloudflare.Error{
+				StatusCode: http.StatusTooManyRequests,
+				Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+				Response:   &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"300"}}},
+			}
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := manager.GetZoneIDByName(context.Background(), "example.com")
+		if !errors.Is(err, dnsmanager.ErrRateLimited) {
+			t.Fatalf("Expected ErrRateLimited, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected API to be called once during the cooldown, got %d calls", calls)
+	}
+}
+
+func TestCloudflare_CircuitBreaker(t *testing.T) {
+	calls := 0
+	failing := true
+	manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+		ListZonesFunc: func(ctx context.Context, params zones.ZoneListParams) ([]zones.Zone, error) {
+			calls++
+			if failing {
+				return nil, &cloudflare.Error{
+					StatusCode: http.StatusServiceUnavailable,
+					Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+					Response:   &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}},
+				}
+			}
+			return []zones.Zone{{ID: "zone-123"}}, nil
+		},
+	})
+	manager.SetRetryPolicy(dnsmanager.RetryPolicy{})
+	manager.SetCircuitBreaker(dnsmanager.CircuitBreaker{Failures: 3, Cooldown: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		if _, err := manager.GetZoneIDByName(context.Background(), "example.com"); errors.Is(err, dnsmanager.ErrUnavailable) {
+			t.Fatalf("Expected the circuit to stay closed on failure %d, got %v", i+1, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		_, err := manager.GetZoneIDByName(context.Background(), "example.com")
+		if !errors.Is(err, dnsmanager.ErrUnavailable) {
+			t.Fatalf("Expected ErrUnavailable while the circuit is open, got %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected no API calls while the circuit is open, got %d calls", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	failing = false
+	if _, err := manager.GetZoneIDByName(context.Background(), "example.com"); err != nil {
+		t.Fatalf("Expected the API to be called again after the cooldown, got %v", err)
+	}
+}
+
 func TestGetDNSRecords_ErrorHandling(t *testing.T) {
 	// This test verifies that we handle errors properly
 	manager, err := dnsmanager.NewCloudflareProvider("test-token")
@@ -400,7 +849,7 @@ func TestEnsureDNSRecords_EmptyRecords(t *testing.T) {
 
 	// This should handle empty records gracefully
 	// Will fail at API call, but we're testing the function can be called
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
 	if err == nil {
 		t.Log("Note: This test expects an error without real credentials")
 	}
@@ -440,7 +889,7 @@ func TestEnsureDNSRecords_WithARecordOnly(t *testing.T) {
 	}
 
 	// Provide only IPv4, no IPv6
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
 	// Will fail without real API, but we're testing the function accepts these params
 	t.Logf("Called EnsureDNSRecords with A record only")
 }
@@ -464,7 +913,7 @@ func TestEnsureDNSRecords_WithAAAARecordOnly(t *testing.T) {
 	}
 
 	// Provide only IPv6, no IPv4
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "", "2001:db8::1")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "", "2001:db8::1")
 	// Will fail without real API, but we're testing the function accepts these params
 	t.Logf("Called EnsureDNSRecords with AAAA record only")
 }
@@ -494,7 +943,7 @@ func TestEnsureDNSRecords_WithBothRecordTypes(t *testing.T) {
 	}
 
 	// Provide both IPv4 and IPv6
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
 	// Will fail without real API, but we're testing the function accepts these params
 	t.Logf("Called EnsureDNSRecords with both A and AAAA records")
 }
@@ -524,7 +973,7 @@ func TestEnsureDNSRecords_SkipsARecordWhenNoIPv4(t *testing.T) {
 	}
 
 	// Provide only IPv6, A record should be skipped
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "", "2001:db8::1")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "", "2001:db8::1")
 	t.Logf("Called EnsureDNSRecords with empty IPv4 (A record should be skipped)")
 }
 
@@ -553,7 +1002,7 @@ func TestEnsureDNSRecords_SkipsAAAARecordWhenNoIPv6(t *testing.T) {
 	}
 
 	// Provide only IPv4, AAAA record should be skipped
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
 	t.Logf("Called EnsureDNSRecords with empty IPv6 (AAAA record should be skipped)")
 }
 
@@ -587,7 +1036,7 @@ func TestEnsureDNSRecords_MultipleSubdomains(t *testing.T) {
 		},
 	}
 
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
 	t.Logf("Called EnsureDNSRecords with multiple subdomains")
 }
 
@@ -615,7 +1064,7 @@ func TestEnsureDNSRecords_RootDomain(t *testing.T) {
 		},
 	}
 
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "2001:db8::1")
 	t.Logf("Called EnsureDNSRecords with root domain (@)")
 }
 
@@ -673,7 +1122,7 @@ func TestEnsureDNSRecords_ProxiedVariations(t *testing.T) {
 			}
 
 			ctx := context.Background()
-			err = manager.EnsureDNSRecords(ctx, "zone-id", tt.records, "192.168.1.1", "")
+			_, err = manager.EnsureDNSRecords(ctx, "zone-id", tt.records, "192.168.1.1", "")
 			t.Logf("Called EnsureDNSRecords with %s configuration", tt.name)
 		})
 	}
@@ -735,7 +1184,7 @@ func TestEnsureDNSRecords_DifferentIPFormats(t *testing.T) {
 				},
 			}
 
-			err = manager.EnsureDNSRecords(ctx, "zone-id", records, tt.ipv4, tt.ipv6)
+			_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, tt.ipv4, tt.ipv6)
 			t.Logf("Called EnsureDNSRecords with %s", tt.name)
 		})
 	}
@@ -778,7 +1227,7 @@ func TestEnsureDNSRecords_InvalidZoneID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err = manager.EnsureDNSRecords(ctx, tt.zoneID, records, "192.168.1.1", "")
+			_, err = manager.EnsureDNSRecords(ctx, tt.zoneID, records, "192.168.1.1", "")
 			// Should fail with invalid zone ID
 			t.Logf("Called EnsureDNSRecords with %s", tt.name)
 		})
@@ -804,7 +1253,752 @@ func TestEnsureDNSRecords_ContextCancellation(t *testing.T) {
 		},
 	}
 
-	err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
+	_, err = manager.EnsureDNSRecords(ctx, "zone-id", records, "192.168.1.1", "")
 	// Should handle cancelled context
 	t.Logf("Called EnsureDNSRecords with cancelled context")
 }
+
+func TestCheckDNSRecords_ReportsDriftWithoutChanges(t *testing.T) {
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "example.com", Type: "A", Content: "192.0.2.1"},
+				{ID: "record-2", Name: "www.example.com", Type: "A", Content: "198.51.100.1"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			t.Fatal("CheckDNSRecords must not change records")
+			return nil, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	drifted, err := manager.CheckDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, r := range drifted {
+		names = append(names, r.FQDN())
+	}
+	if len(names) != 2 || names[0] != "vpn.example.com" || names[1] != "example.com" {
+		t.Errorf("Expected vpn.example.com (missing) and example.com (stale) to drift, got %v", names)
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		err         error
+		expectError bool
+	}{
+		{name: "active token", status: "active"},
+		{name: "disabled token", status: "disabled", expectError: true},
+		{name: "expired token", status: "expired", expectError: true},
+		{
+			name: "invalid token",
+			err: &cloudflare.Error{
+				StatusCode: http.StatusUnauthorized,
+				Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/user/tokens/verify", nil),
+				Response:   &http.Response{StatusCode: http.StatusUnauthorized},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAccount string
+			manager := dnsmanager.NewCloudflareProviderWithClient(&MockCloudflareClient{
+				VerifyTokenFunc: func(ctx context.Context, accountID string) (string, error) {
+					gotAccount = accountID
+					return tt.status, tt.err
+				},
+			})
+
+			err := manager.VerifyCredentials(context.Background(), "acc-1")
+			if gotAccount != "acc-1" {
+				t.Errorf("Expected token to be verified in account acc-1, got %q", gotAccount)
+			}
+			if !tt.expectError {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, dnsmanager.ErrAuth) {
+				t.Errorf("Expected ErrAuth, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCredentials_UserAndAccountTokens(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/client/v4/user/tokens/verify" && token == "user-token" ||
+			r.URL.Path == "/client/v4/accounts/acc-1/tokens/verify" && token == "account-token" {
+			io.WriteString(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"tok-1","status":"active"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"success":false,"errors":[{"code":1000,"message":"Invalid API Token"}],"messages":[],"result":null}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		token       string
+		accountID   string
+		wantPaths   []string
+		expectError bool
+	}{
+		{
+			name:      "user token with an account ID",
+			token:     "user-token",
+			accountID: "acc-1",
+			wantPaths: []string{"/client/v4/user/tokens/verify"},
+		},
+		{
+			name:      "account token",
+			token:     "account-token",
+			accountID: "acc-1",
+			wantPaths: []string{"/client/v4/user/tokens/verify", "/client/v4/accounts/acc-1/tokens/verify"},
+		},
+		{
+			name:        "account token without an account ID",
+			token:       "account-token",
+			wantPaths:   []string{"/client/v4/user/tokens/verify"},
+			expectError: true,
+		},
+		{
+			name:        "invalid token",
+			token:       "wrong",
+			accountID:   "acc-1",
+			wantPaths:   []string{"/client/v4/user/tokens/verify", "/client/v4/accounts/acc-1/tokens/verify"},
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths = nil
+			manager, err := dnsmanager.NewCloudflareProviderWithBaseURL(tt.token, server.URL+"/client/v4")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err = manager.VerifyCredentials(context.Background(), tt.accountID)
+			if !slices.Equal(paths, tt.wantPaths) {
+				t.Errorf("Expected requests to %v, got %v", tt.wantPaths, paths)
+			}
+			if !tt.expectError {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, dnsmanager.ErrAuth) {
+				t.Errorf("Expected ErrAuth, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsureDNSRecords_MarksManagedRecords(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	manager.SetRecordTags([]string{"managed-by:ipwatcher"})
+
+	_, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(captured.Posts.Value) != 1 || len(captured.Puts.Value) != 1 {
+		t.Fatalf("Expected one create and one update, got %d and %d", len(captured.Posts.Value), len(captured.Puts.Value))
+	}
+	created, ok := captured.Posts.Value[0].(dns.ARecordParam)
+	if !ok {
+		t.Fatalf("Expected an A record create, got %T", captured.Posts.Value[0])
+	}
+	updated, ok := captured.Puts.Value[0].(dns.BatchPutARecordParam)
+	if !ok {
+		t.Fatalf("Expected an A record update, got %T", captured.Puts.Value[0])
+	}
+	for _, param := range []dns.ARecordParam{created, updated.ARecordParam} {
+		if param.Comment.Value != dnsmanager.ManagedComment {
+			t.Errorf("Expected comment %q, got %q", dnsmanager.ManagedComment, param.Comment.Value)
+		}
+		if len(param.Tags.Value) != 1 || param.Tags.Value[0] != "managed-by:ipwatcher" {
+			t.Errorf("Expected tag managed-by:ipwatcher, got %v", param.Tags.Value)
+		}
+	}
+}
+
+func TestEnsureDNSRecords_Ownership(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+				{ID: "record-2", Name: "_ipwatcher.www.example.com", Type: "TXT", Content: `"heritage=ipwatcher,ipwatcher/owner=other"`},
+				{ID: "record-3", Name: "api.example.com", Type: "A", Content: "192.0.2.1"},
+				{ID: "record-4", Name: "_ipwatcher.api.example.com", Type: "TXT", Content: `"heritage=ipwatcher,ipwatcher/owner=home"`},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	manager.SetOwner("home")
+
+	_, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "api", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if !errors.Is(err, dnsmanager.ErrNotOwner) {
+		t.Fatalf("Expected ErrNotOwner for www.example.com, got %v", err)
+	}
+	var conflictErr *dnsmanager.ConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0] != (dnsmanager.Conflict{Name: "www.example.com", Type: "A", Owner: "other"}) {
+		t.Errorf("Expected a conflict naming owner other for www.example.com, got %v", err)
+	}
+
+	if len(captured.Puts.Value) != 1 {
+		t.Fatalf("Expected only api.example.com to be updated, got %d updates", len(captured.Puts.Value))
+	}
+	if len(captured.Posts.Value) != 2 {
+		t.Fatalf("Expected the apex record and its ownership record to be created, got %d creates", len(captured.Posts.Value))
+	}
+	claim, ok := captured.Posts.Value[1].(dns.TXTRecordParam)
+	if !ok {
+		t.Fatalf("Expected a TXT record create, got %T", captured.Posts.Value[1])
+	}
+	if claim.Name.Value != "_ipwatcher.example.com" {
+		t.Errorf("Expected ownership record _ipwatcher.example.com, got %s", claim.Name.Value)
+	}
+	if claim.Content.Value != `"heritage=ipwatcher,ipwatcher/owner=home"` {
+		t.Errorf("Expected ownership for home, got %s", claim.Content.Value)
+	}
+}
+
+func TestEnsureDNSRecords_DryRun(t *testing.T) {
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			t.Fatal("Dry run must not call the batch API")
+			return nil, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	var out strings.Builder
+	manager.SetDryRun(&out)
+
+	_, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, Proxied: true},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"+ example.com A 198.51.100.1",
+		"~ www.example.com A 192.0.2.1 -> 198.51.100.1 (proxied false -> true)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in dry-run output, got %q", want, out.String())
+		}
+	}
+}
+
+func TestEnsureDNSRecordsStream_ReportsProgress(t *testing.T) {
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+			}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	counts := make(map[dnsmanager.Stage]int)
+	_, err := manager.EnsureDNSRecordsStream(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "", func(p dnsmanager.Progress) {
+		counts[p.Stage]++
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, stage := range []dnsmanager.Stage{dnsmanager.StagePlanned, dnsmanager.StageSent, dnsmanager.StageConfirmed} {
+		if counts[stage] != 2 {
+			t.Errorf("Expected 2 %s events, got %d", stage, counts[stage])
+		}
+	}
+	if counts[dnsmanager.StageFailed] != 0 {
+		t.Errorf("Expected no failed events, got %d", counts[dnsmanager.StageFailed])
+	}
+}
+
+func TestEnsureDNSRecords_Result(t *testing.T) {
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+				{ID: "record-2", Name: "mail.example.com", Type: "A", Content: "198.51.100.1"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	result, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "mail", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Created) != 1 || result.Created[0].Name != "example.com" {
+		t.Errorf("Expected example.com to be created, got %v", result.Created)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].Name != "www.example.com" {
+		t.Errorf("Expected www.example.com to be updated, got %v", result.Updated)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "mail.example.com A" {
+		t.Errorf("Expected mail.example.com A to be skipped, got %v", result.Skipped)
+	}
+	if got := result.String(); got != "created 1, updated 1, skipped 1, failed 0" {
+		t.Errorf("Expected summary of counts, got %q", got)
+	}
+
+	mockClient.BatchDNSRecordsFunc = func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+		return nil, errors.New("batch rejected")
+	}
+	result, err = manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if err == nil {
+		t.Fatal("Expected error when the batch fails")
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Name != "www.example.com" || result.Errors[0].Err == nil {
+		t.Errorf("Expected www.example.com to be reported as failed, got %v", result.Errors)
+	}
+	if result.Changed() != 0 {
+		t.Errorf("Expected no changes when the batch fails, got %d", result.Changed())
+	}
+}
+
+func TestEnsureDNSRecords_CustomTTL(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "198.51.100.1", TTL: dns.TTL1},
+				{ID: "record-2", Name: "mail.example.com", Type: "A", Content: "198.51.100.1", TTL: 300},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	_, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord, TTL: 120},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, TTL: 300},
+		{Root: "example.com", Name: "mail", Type: dnsmanager.ARecord, TTL: 300},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(captured.Posts.Value) != 1 || len(captured.Puts.Value) != 1 {
+		t.Fatalf("Expected one create and one TTL update, got %d and %d", len(captured.Posts.Value), len(captured.Puts.Value))
+	}
+	created, ok := captured.Posts.Value[0].(dns.ARecordParam)
+	if !ok || created.TTL.Value != 120 {
+		t.Errorf("Expected create with TTL 120, got %+v", captured.Posts.Value[0])
+	}
+	updated, ok := captured.Puts.Value[0].(dns.BatchPutARecordParam)
+	if !ok || updated.ID.Value != "record-1" || updated.TTL.Value != 300 {
+		t.Errorf("Expected record-1 updated to TTL 300, got %+v", captured.Puts.Value[0])
+	}
+}
+
+func TestEnsureDNSRecords_Strict(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "example.com", Type: "A", Content: "198.51.100.1", TTL: 300, Comment: dnsmanager.ManagedComment},
+				{ID: "record-2", Name: "www.example.com", Type: "A", Content: "198.51.100.1", TTL: dns.TTL1, Comment: "edited by hand"},
+				{ID: "record-3", Name: "vpn.example.com", Type: "A", Content: "198.51.100.1", TTL: dns.TTL1, Comment: dnsmanager.ManagedComment},
+				{ID: "record-4", Name: "mail.example.com", Type: "A", Content: "198.51.100.1", TTL: 300},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	_, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord, Strict: true},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord, Strict: true},
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord, Strict: true},
+		{Root: "example.com", Name: "mail", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The apex has a manual TTL and www a foreign comment; mail is not strict
+	if len(captured.Puts.Value) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(captured.Puts.Value))
+	}
+	for i, id := range []string{"record-1", "record-2"} {
+		updated, ok := captured.Puts.Value[i].(dns.BatchPutARecordParam)
+		if !ok || updated.ID.Value != id || updated.TTL.Value != dns.TTL1 || updated.Comment.Value != dnsmanager.ManagedComment {
+			t.Errorf("Expected %s updated to automatic TTL and the managed comment, got %+v", id, captured.Puts.Value[i])
+		}
+	}
+}
+
+func TestEnsureDNSRecords_Adopt(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "example.com", Type: "A", Content: "192.0.2.1", Comment: dnsmanager.ManagedComment},
+				{ID: "record-2", Name: "www.example.com", Type: "A", Content: "192.0.2.1", Comment: "added by hand"},
+				{ID: "record-3", Name: "mail.example.com", Type: "A", Content: "198.51.100.1"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "mail", Type: dnsmanager.ARecord},
+	}
+
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	manager.SetAdopt(false)
+	result, err := manager.EnsureDNSRecords(context.Background(), "zone-123", records, "198.51.100.1", "")
+	if !errors.Is(err, dnsmanager.ErrUnmanaged) {
+		t.Fatalf("Expected ErrUnmanaged for www.example.com, got %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Name != "www.example.com" {
+		t.Errorf("Expected www.example.com to be refused, got %v", result.Errors)
+	}
+	// mail already has the right content, so it is not overwritten and not refused either
+	if len(captured.Puts.Value) != 1 || captured.Puts.Value[0].(dns.BatchPutARecordParam).ID.Value != "record-1" {
+		t.Fatalf("Expected only the managed apex to be updated, got %+v", captured.Puts.Value)
+	}
+
+	manager.SetAdopt(true)
+	if _, err := manager.EnsureDNSRecords(context.Background(), "zone-123", records, "198.51.100.1", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(captured.Puts.Value) != 2 {
+		t.Errorf("Expected the unmanaged record to be adopted, got %d updates", len(captured.Puts.Value))
+	}
+}
+
+func TestEnsureDNSRecords_CNAME(t *testing.T) {
+	var captured dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "example.com", Type: "A", Content: "198.51.100.1"},
+				{ID: "record-2", Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+				{ID: "record-3", Name: "blog.example.com", Type: "CNAME", Content: "old.example.net"},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			captured = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	result, err := manager.EnsureDNSRecords(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.CNAMERecord, Target: "example.com."},
+		{Root: "example.com", Name: "blog", Type: dnsmanager.CNAMERecord, Target: "blog.example.net"},
+		{Root: "example.com", Name: "shop", Type: dnsmanager.CNAMERecord, Target: "shops.example.net"},
+	}, "198.51.100.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(captured.Posts.Value) != 1 || len(captured.Puts.Value) != 1 {
+		t.Fatalf("Expected one create and one update, got %d and %d", len(captured.Posts.Value), len(captured.Puts.Value))
+	}
+	created, ok := captured.Posts.Value[0].(dns.CNAMERecordParam)
+	if !ok || created.Name.Value != "shop" || created.Content.Value != "shops.example.net" {
+		t.Errorf("Expected shop CNAME created, got %+v", captured.Posts.Value[0])
+	}
+	updated, ok := captured.Puts.Value[0].(dns.BatchPutCNAMERecordParam)
+	if !ok || updated.ID.Value != "record-3" || updated.Content.Value != "blog.example.net" {
+		t.Errorf("Expected record-3 pointed at blog.example.net, got %+v", captured.Puts.Value[0])
+	}
+	if len(result.Skipped) != 2 {
+		t.Errorf("Expected the apex and www to be skipped, got %v", result.Skipped)
+	}
+}
+
+func TestCloudflareEnsureDNSRecordsCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	records := []dnsmanager.DNSRecord{{Root: "example.com", Name: "home", Type: dnsmanager.ARecord}}
+
+	var lists int
+	var puts []string
+	var batchErr error
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			lists++
+			return []dns.RecordResponse{{ID: "rec-1", Name: "home.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10", Comment: dnsmanager.ManagedComment}}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			if err := batchErr; err != nil {
+				batchErr = nil
+				return nil, err
+			}
+			for _, put := range params.Puts.Value {
+				puts = append(puts, put.(dns.BatchPutARecordParam).ID.Value)
+			}
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+
+	newProvider := func() *dnsmanager.CloudflareProvider {
+		cache, err := dnsmanager.NewStateCache(path)
+		if err != nil {
+			t.Fatalf("NewStateCache failed: %v", err)
+		}
+		provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+		provider.SetStateCache(cache)
+		return provider
+	}
+
+	// Nothing is cached yet, so the zone is listed
+	provider := newProvider()
+	if _, err := provider.EnsureDNSRecordsCached(context.Background(), "zone-1", records, "203.0.113.10", "", nil); err != nil {
+		t.Fatalf("EnsureDNSRecordsCached failed: %v", err)
+	}
+	if lists != 1 || len(puts) != 0 {
+		t.Fatalf("expected one listing and no writes, got %d listings and writes %q", lists, puts)
+	}
+
+	// The listing was cached on disk, so a restarted provider writes the change by ID
+	provider = newProvider()
+	result, err := provider.EnsureDNSRecordsCached(context.Background(), "zone-1", records, "203.0.113.20", "", nil)
+	if err != nil {
+		t.Fatalf("EnsureDNSRecordsCached failed: %v", err)
+	}
+	if lists != 1 || len(puts) != 1 || puts[0] != "rec-1" {
+		t.Fatalf("expected rec-1 written without listing, got %d listings and writes %q", lists, puts)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].OldContent != "203.0.113.10" {
+		t.Errorf("expected an update from the cached content, got %+v", result.Updated)
+	}
+
+	// A cached record that no longer exists makes the provider list the zone again
+	batchErr = &cloudflare.Error{
+		StatusCode: http.StatusNotFound,
+		Request:    httptest.NewRequest(http.MethodPost, "https://api.cloudflare.com/client/v4/zones/zone-1/dns_records/batch", nil),
+		Response:   &http.Response{StatusCode: http.StatusNotFound},
+	}
+	if _, err := provider.EnsureDNSRecordsCached(context.Background(), "zone-1", records, "203.0.113.30", "", nil); err != nil {
+		t.Fatalf("EnsureDNSRecordsCached failed: %v", err)
+	}
+	if lists != 2 || len(puts) != 2 {
+		t.Fatalf("expected a listing and a write after the stale cache, got %d listings and writes %q", lists, puts)
+	}
+
+	// A changed proxy setting is not trusted to the cache
+	proxied := []dnsmanager.DNSRecord{{Root: "example.com", Name: "home", Type: dnsmanager.ARecord, Proxied: true}}
+	if _, err := provider.EnsureDNSRecordsCached(context.Background(), "zone-1", proxied, "203.0.113.30", "", nil); err != nil {
+		t.Fatalf("EnsureDNSRecordsCached failed: %v", err)
+	}
+	if lists != 3 {
+		t.Fatalf("expected the zone to be listed for a changed proxy setting, got %d listings", lists)
+	}
+}
+
+func TestEnsureDNSRecords_DeletesDuplicates(t *testing.T) {
+	var batch dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "home-old", Name: "home.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.9", Comment: dnsmanager.ManagedComment},
+				{ID: "home-1", Name: "home.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10", Comment: dnsmanager.ManagedComment},
+				{ID: "rr-manual", Name: "rr.example.com", Type: dns.RecordResponseTypeA, Content: "198.51.100.1"},
+				{ID: "rr-1", Name: "rr.example.com", Type: dns.RecordResponseTypeA, Content: "203.0.113.10", Comment: dnsmanager.ManagedComment},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			batch = params
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	provider := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "home", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "rr", Type: dnsmanager.ARecord},
+	}
+
+	changes, err := provider.PlanDNSRecords(context.Background(), "zone-1", records, "203.0.113.10", "")
+	if err != nil {
+		t.Fatalf("PlanDNSRecords failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].String() != "- home.example.com A 203.0.113.9" {
+		t.Fatalf("expected the managed duplicate to be planned for deletion, got %v", changes)
+	}
+
+	result, err := provider.EnsureDNSRecords(context.Background(), "zone-1", records, "203.0.113.10", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords failed: %v", err)
+	}
+
+	// Only the managed duplicate goes, in the same batch; the hand-made round-robin address stays
+	if len(batch.Deletes.Value) != 1 || batch.Deletes.Value[0].ID.Value != "home-old" {
+		t.Fatalf("expected home-old to be deleted in the batch, got %+v", batch.Deletes.Value)
+	}
+	if batch.Posts.Present || batch.Puts.Present {
+		t.Errorf("expected no creates or updates, got %+v", batch)
+	}
+	if got := result.String(); got != "created 0, updated 0, deleted 1, skipped 1, failed 0" {
+		t.Errorf("unexpected result %q", got)
+	}
+}
+
+func TestEnsureDNSRecords_SplitsBatches(t *testing.T) {
+	var batches []dns.RecordBatchParams
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "A", Content: "192.0.2.1", Comment: dnsmanager.ManagedComment},
+			}, nil
+		},
+		BatchDNSRecordsFunc: func(ctx context.Context, params dns.RecordBatchParams) (*dns.RecordBatchResponse, error) {
+			batches = append(batches, params)
+			if len(batches) == 2 {
+				return nil, errors.New("payload too large")
+			}
+			return &dns.RecordBatchResponse{}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+	manager.SetBatchPolicy(dnsmanager.BatchPolicy{MaxChanges: 2, Delay: time.Millisecond})
+
+	var stages []dnsmanager.Stage
+	result, err := manager.EnsureDNSRecordsStream(context.Background(), "zone-123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "a", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "b", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "c", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "198.51.100.1", "", func(p dnsmanager.Progress) {
+		stages = append(stages, p.Stage)
+	})
+	if err == nil {
+		t.Fatal("Expected the failed second batch to be reported")
+	}
+
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batch requests, got %d", len(batches))
+	}
+	if len(batches[0].Posts.Value) != 2 || batches[0].Puts.Present {
+		t.Errorf("Expected the first batch to create a and b, got %+v", batches[0])
+	}
+	if len(batches[1].Posts.Value) != 1 || len(batches[1].Puts.Value) != 1 {
+		t.Errorf("Expected the second batch to create c and update www, got %+v", batches[1])
+	}
+
+	if len(result.Created) != 2 || len(result.Errors) != 2 {
+		t.Fatalf("Expected 2 created and 2 failed records, got %s", result)
+	}
+	for _, e := range result.Errors {
+		if e.Name != "c.example.com" && e.Name != "www.example.com" {
+			t.Errorf("Unexpected failed record %s", e.Name)
+		}
+	}
+	want := []dnsmanager.Stage{
+		dnsmanager.StagePlanned, dnsmanager.StagePlanned, dnsmanager.StagePlanned, dnsmanager.StagePlanned,
+		dnsmanager.StageSent, dnsmanager.StageSent, dnsmanager.StageConfirmed, dnsmanager.StageConfirmed,
+		dnsmanager.StageSent, dnsmanager.StageSent, dnsmanager.StageFailed, dnsmanager.StageFailed,
+	}
+	if !slices.Equal(stages, want) {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+}
+
+func TestListAddressRecords(t *testing.T) {
+	mockClient := &MockCloudflareClient{
+		ListDNSRecordsFunc: func(ctx context.Context, params dns.RecordListParams) ([]dns.RecordResponse, error) {
+			return []dns.RecordResponse{
+				{ID: "record-1", Name: "www.example.com", Type: "AAAA", Content: "2001:db8::1", TTL: 300},
+				{ID: "record-2", Name: "example.com", Type: "A", Content: "192.0.2.1", Proxied: true, TTL: dns.TTL1},
+				{ID: "record-3", Name: "example.com", Type: "TXT", Content: `"v=spf1 -all"`, TTL: dns.TTL1},
+				{ID: "record-4", Name: "www.example.com", Type: "A", Content: "192.0.2.2", TTL: 120},
+			}, nil
+		},
+	}
+	manager := dnsmanager.NewCloudflareProviderWithClient(mockClient)
+
+	records, err := manager.ListAddressRecords(context.Background(), "zone-123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []dnsmanager.ExistingRecord{
+		{Name: "example.com", Type: dnsmanager.ARecord, Content: "192.0.2.1", Proxied: true},
+		{Name: "www.example.com", Type: dnsmanager.ARecord, Content: "192.0.2.2", TTL: 120},
+		{Name: "www.example.com", Type: dnsmanager.AAAARecord, Content: "2001:db8::1", TTL: 300},
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("records = %+v, want %+v", records, want)
+	}
+}
@@ -0,0 +1,74 @@
+package dnsmanager
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error kinds returned by providers; match them with errors.Is
+var (
+	ErrZoneNotFound   = errors.New("zone not found")
+	ErrRecordNotFound = errors.New("record not found")
+	ErrAuth           = errors.New("authentication or authorization failed")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrUnavailable    = errors.New("provider unavailable")
+	ErrValidation     = errors.New("request rejected as invalid")
+	ErrNotOwner       = errors.New("record is owned by another instance")
+	ErrUnmanaged      = errors.New("record exists but is not managed by ipwatcher")
+)
+
+// Refused reports whether err only lists records that were left alone on purpose, because
+// another instance owns them or they are not managed by ipwatcher
+func Refused(err error) bool {
+	return errors.Is(err, ErrNotOwner) || errors.Is(err, ErrUnmanaged)
+}
+
+// kindError tags a provider error with one of the error kinds while keeping
+// the original error, and its message, reachable through errors.Is and errors.As
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind tags err with kind; nil kinds leave err untouched
+func withKind(kind, err error) error {
+	if kind == nil || err == nil {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// kindFromStatus maps an HTTP status code to an error kind. A 404 means whatever the request
+// addressed was not found, so notFound is its kind: ErrZoneNotFound for zone lookups and
+// listings, ErrRecordNotFound for requests on records, nil for anything else.
+func kindFromStatus(status int, notFound error) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusNotFound:
+		return notFound
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return ErrValidation
+	}
+	return nil
+}
+
+// ErrorKind returns the kind of a provider error, or nil when it is not classified
+func ErrorKind(err error) error {
+	for _, kind := range []error{ErrZoneNotFound, ErrRecordNotFound, ErrAuth, ErrRateLimited, ErrUnavailable, ErrValidation, ErrNotOwner, ErrUnmanaged} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package dnsmanager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExecTimeout = 30 * time.Second
+
+// CommandRunner defines the interface for running external commands
+// This allows for dependency injection and mocking in tests
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args []string, env []string) ([]byte, error)
+}
+
+// RealCommandRunner runs commands with os/exec
+type RealCommandRunner struct{}
+
+// Run implements CommandRunner
+func (RealCommandRunner) Run(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// ExecProvider delegates DNS updates to a user-supplied script or binary.
+// The command is invoked once per record as:
+//
+//	<command> [args...] <fqdn> <type> <ip>
+//
+// with the same values also exported as IPWATCHER_* environment variables.
+// A zero exit status means the record was updated.
+type ExecProvider struct {
+	runner  CommandRunner
+	command string
+	args    []string
+	timeout time.Duration
+	dryRun  io.Writer // receives the planned changes instead of running the command when set
+
+	mu      sync.Mutex
+	applied map[string]string // record key -> last content pushed successfully
+}
+
+// NewExecProvider creates a new exec provider instance
+func NewExecProvider(command string, args []string, timeout time.Duration) (*ExecProvider, error) {
+	if command == "" {
+		return nil, fmt.Errorf("exec command is required")
+	}
+	return NewExecProviderWithRunner(RealCommandRunner{}, command, args, timeout), nil
+}
+
+// NewExecProviderWithRunner creates a new exec provider with a custom runner (for testing)
+func NewExecProviderWithRunner(runner CommandRunner, command string, args []string, timeout time.Duration) *ExecProvider {
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	return &ExecProvider{
+		runner:  runner,
+		command: command,
+		args:    args,
+		timeout: timeout,
+		applied: make(map[string]string),
+	}
+}
+
+// SetDryRun makes EnsureDNSRecords print the records it would push to out instead of running the command;
+// a nil out runs the command again
+func (p *ExecProvider) SetDryRun(out io.Writer) {
+	p.dryRun = out
+}
+
+// GetZoneIDByName returns the zone name itself; scripts address zones by name
+func (p *ExecProvider) GetZoneIDByName(ctx context.Context, zoneName string) (string, error) {
+	return zoneName, nil
+}
+
+// EnsureDNSRecords runs the command for every record whose content differs from what was last pushed.
+// The command has no way to report existing state, so it must be idempotent. A failing record does
+// not stop the others; the failures are listed in the result and joined in the error.
+func (p *ExecProvider) EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) (Result, error) {
+	return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, nil)
+}
+
+// EnsureDNSRecordsStream is EnsureDNSRecords reporting every record change to progress.
+// The command runs once per record, so each record is sent and confirmed on its own.
+func (p *ExecProvider) EnsureDNSRecordsStream(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error) {
+	if p.dryRun != nil {
+		return dryRun(ctx, p.dryRun, p, zoneID, records, ipv4, ipv6)
+	}
+
+	changes, err := p.PlanDNSRecords(ctx, zoneID, records, ipv4, ipv6)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Skipped: newResult(records, changes, nil, nil, nil).Skipped}
+	if len(changes) == 0 {
+		logger().Debug("No exec DNS records to update", "zone", zoneID)
+		return result, nil
+	}
+	report(progress, StagePlanned, changes, nil)
+
+	byKey := make(map[string]DNSRecord, len(records))
+	for _, record := range records {
+		byKey[record.FQDN()+"|"+record.Type.String()] = record
+	}
+	for i, change := range changes {
+		key := change.Name + "|" + change.Type
+		report(progress, StageSent, changes[i:i+1], nil)
+		if err := p.run(ctx, zoneID, change.Name, byKey[key], change.NewContent); err != nil {
+			report(progress, StageFailed, changes[i:i+1], err)
+			result.Errors = append(result.Errors, RecordError{Name: change.Name, Type: change.Type, Err: err})
+			continue
+		}
+
+		p.mu.Lock()
+		p.applied[key] = change.NewContent
+		p.mu.Unlock()
+		report(progress, StageConfirmed, changes[i:i+1], nil)
+		result.Updated = append(result.Updated, change)
+	}
+
+	if len(result.Updated) > 0 {
+		logger().Info("Updated records with the exec command", "zone", zoneID, "changes", len(result.Updated), "command", p.command)
+	}
+	return result, result.Err()
+}
+
+// PlanDNSRecords returns the records EnsureDNSRecords would push. The command cannot report
+// existing state, so every push is an update from the content last pushed by this process.
+func (p *ExecProvider) PlanDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]Change, error) {
+	var changes []Change
+	for _, record := range records {
+		content := recordContent(record, ipv4, ipv6)
+		if content == "" {
+			continue
+		}
+
+		fqdn := record.FQDN()
+		p.mu.Lock()
+		last := p.applied[fqdn+"|"+record.Type.String()]
+		p.mu.Unlock()
+		if last == content {
+			continue
+		}
+		changes = append(changes, Change{
+			Action:     ChangeUpdate,
+			Name:       fqdn,
+			Type:       record.Type.String(),
+			OldContent: last,
+			NewContent: content,
+		})
+	}
+	return changes, nil
+}
+
+func (p *ExecProvider) run(ctx context.Context, zone, fqdn string, record DNSRecord, content string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	args := append(append([]string{}, p.args...), fqdn, record.Type.String(), content)
+	env := []string{
+		"IPWATCHER_ZONE=" + zone,
+		"IPWATCHER_RECORD_NAME=" + fqdn,
+		"IPWATCHER_RECORD_TYPE=" + record.Type.String(),
+		"IPWATCHER_IP=" + content,
+		"IPWATCHER_PROXIED=" + strconv.FormatBool(record.Proxied),
+		"IPWATCHER_TTL=" + strconv.Itoa(record.TTL),
+	}
+
+	out, err := p.runner.Run(ctx, p.command, args, env)
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		if output != "" {
+			return fmt.Errorf("exec %s for %s %s failed: %w: %s", p.command, fqdn, record.Type, err, output)
+		}
+		return fmt.Errorf("exec %s for %s %s failed: %w", p.command, fqdn, record.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package dnsmanager_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+type mockCommandRunner struct {
+	runFunc func(ctx context.Context, name string, args []string, env []string) ([]byte, error)
+}
+
+func (m *mockCommandRunner) Run(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+	if m.runFunc != nil {
+		return m.runFunc(ctx, name, args, env)
+	}
+	return nil, nil
+}
+
+func TestNewExecProvider_RequiresCommand(t *testing.T) {
+	if _, err := dnsmanager.NewExecProvider("", nil, 0); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+}
+
+func TestExecProviderGetZoneIDByName_ReturnsZoneName(t *testing.T) {
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{}, "/bin/true", nil, 0)
+
+	zoneID, err := provider.GetZoneIDByName(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("GetZoneIDByName returned error: %v", err)
+	}
+	if zoneID != "example.com" {
+		t.Fatalf("expected example.com, got %s", zoneID)
+	}
+}
+
+func TestExecProviderEnsureDNSRecords_PassesArgsAndEnv(t *testing.T) {
+	var calls [][]string
+	var envs [][]string
+
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			if name != "/usr/local/bin/update-dns" {
+				t.Errorf("unexpected command %s", name)
+			}
+			calls = append(calls, args)
+			envs = append(envs, env)
+			return nil, nil
+		},
+	}, "/usr/local/bin/update-dns", []string{"--registrar", "acme"}, 0)
+
+	_, err := provider.EnsureDNSRecords(context.Background(), "example.com", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.AAAARecord},
+	}, "203.0.113.10", "2001:db8::10")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 invocations, got %d", len(calls))
+	}
+	if got := strings.Join(calls[0], " "); got != "--registrar acme example.com A 203.0.113.10" {
+		t.Errorf("unexpected args for apex record: %s", got)
+	}
+	if got := strings.Join(calls[1], " "); got != "--registrar acme www.example.com AAAA 2001:db8::10" {
+		t.Errorf("unexpected args for www record: %s", got)
+	}
+	if got := strings.Join(envs[1], " "); !strings.Contains(got, "IPWATCHER_RECORD_NAME=www.example.com") || !strings.Contains(got, "IPWATCHER_IP=2001:db8::10") {
+		t.Errorf("expected record env vars, got %s", got)
+	}
+}
+
+func TestExecProviderEnsureDNSRecords_SkipsUnchanged(t *testing.T) {
+	calls := 0
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			calls++
+			return nil, nil
+		},
+	}, "update-dns", nil, 0)
+
+	records := []dnsmanager.DNSRecord{{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord}}
+	for i := 0; i < 2; i++ {
+		if _, err := provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.10", ""); err != nil {
+			t.Fatalf("EnsureDNSRecords returned error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 invocation for unchanged IP, got %d", calls)
+	}
+
+	if _, err := provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.20", ""); err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected invocation after IP change, got %d", calls)
+	}
+}
+
+func TestExecProviderEnsureDNSRecords_CommandFailure(t *testing.T) {
+	calls := 0
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			calls++
+			return []byte("registrar said no\n"), errors.New("exit status 1")
+		},
+	}, "update-dns", nil, 0)
+
+	records := []dnsmanager.DNSRecord{{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord}}
+	_, err := provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.10", "")
+	if err == nil {
+		t.Fatal("expected error when command fails")
+	}
+	if !strings.Contains(err.Error(), "registrar said no") {
+		t.Errorf("expected command output in error, got: %v", err)
+	}
+
+	// A failed run must not be remembered as applied
+	_, _ = provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.10", "")
+	if calls != 2 {
+		t.Fatalf("expected retry after failure, got %d calls", calls)
+	}
+}
+
+func TestExecProviderEnsureDNSRecords_DryRun(t *testing.T) {
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			t.Fatal("dry run must not run the command")
+			return nil, nil
+		},
+	}, "update-dns", nil, 0)
+	var out strings.Builder
+	provider.SetDryRun(&out)
+
+	records := []dnsmanager.DNSRecord{{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord}}
+	if _, err := provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.10", ""); err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "~ vpn.example.com A 203.0.113.10") {
+		t.Fatalf("expected planned update in dry-run output, got %q", out.String())
+	}
+}
+
+func TestChange_String(t *testing.T) {
+	tests := []struct {
+		change dnsmanager.Change
+		want   string
+	}{
+		{
+			change: dnsmanager.Change{Action: dnsmanager.ChangeCreate, Name: "www.example.com", Type: "A", NewContent: "192.0.2.1", NewProxied: true},
+			want:   "+ www.example.com A 192.0.2.1 (proxied)",
+		},
+		{
+			change: dnsmanager.Change{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "AAAA", OldContent: "2001:db8::1", NewContent: "2001:db8::2"},
+			want:   "~ www.example.com AAAA 2001:db8::1 -> 2001:db8::2",
+		},
+		{
+			change: dnsmanager.Change{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "A", OldContent: "192.0.2.1", NewContent: "192.0.2.1", NewProxied: true},
+			want:   "~ www.example.com A 192.0.2.1 (proxied false -> true)",
+		},
+		{
+			change: dnsmanager.Change{Action: dnsmanager.ChangeCreate, Name: "vpn.example.com", Type: "A", NewContent: "192.0.2.1", NewTTL: 120},
+			want:   "+ vpn.example.com A 192.0.2.1 (ttl 120)",
+		},
+		{
+			change: dnsmanager.Change{Action: dnsmanager.ChangeUpdate, Name: "vpn.example.com", Type: "A", OldContent: "192.0.2.1", NewContent: "192.0.2.1", OldTTL: 300, NewTTL: 120},
+			want:   "~ vpn.example.com A 192.0.2.1 (ttl 300 -> 120)",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestExecProviderEnsureDNSRecordsStream_ReportsProgress(t *testing.T) {
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			if args[0] == "bad.example.com" {
+				return []byte("rejected"), errors.New("exit status 1")
+			}
+			return nil, nil
+		},
+	}, "update-dns", nil, 0)
+
+	var stages []string
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "bad", Type: dnsmanager.ARecord},
+	}
+	_, err := provider.EnsureDNSRecordsStream(context.Background(), "example.com", records, "203.0.113.10", "", func(p dnsmanager.Progress) {
+		stages = append(stages, string(p.Stage)+" "+p.Change.Name)
+	})
+	if err == nil {
+		t.Fatal("expected error for failing record")
+	}
+
+	want := []string{
+		"planned vpn.example.com",
+		"planned bad.example.com",
+		"sent vpn.example.com",
+		"confirmed vpn.example.com",
+		"sent bad.example.com",
+		"failed bad.example.com",
+	}
+	if strings.Join(stages, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected progress %v, got %v", want, stages)
+	}
+}
+
+func TestExecProviderEnsureDNSRecords_ContinuesPastFailures(t *testing.T) {
+	var ran []string
+	provider := dnsmanager.NewExecProviderWithRunner(&mockCommandRunner{
+		runFunc: func(ctx context.Context, name string, args []string, env []string) ([]byte, error) {
+			ran = append(ran, args[0])
+			if args[0] == "bad.example.com" {
+				return nil, errors.New("exit status 1")
+			}
+			return nil, nil
+		},
+	}, "update-dns", nil, 0)
+
+	records := []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "bad", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.AAAARecord},
+	}
+	result, err := provider.EnsureDNSRecords(context.Background(), "example.com", records, "203.0.113.10", "")
+	if err == nil {
+		t.Fatal("expected error for failing record")
+	}
+	if len(ran) != 2 {
+		t.Fatalf("expected the command to run for both A records, got %v", ran)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].Name != "vpn.example.com" {
+		t.Errorf("expected vpn.example.com to be updated, got %v", result.Updated)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Name != "bad.example.com" {
+		t.Errorf("expected bad.example.com to fail, got %v", result.Errors)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "vpn.example.com AAAA" {
+		t.Errorf("expected the AAAA record without an IPv6 to be skipped, got %v", result.Skipped)
+	}
+}
@@ -0,0 +1,83 @@
+package dnsmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// GitHubActionsAudience is the audience AWS STS expects in GitHub Actions OIDC tokens
+const GitHubActionsAudience = "sts.amazonaws.com"
+
+// GitHubActionsToken requests OIDC tokens from the GitHub Actions token endpoint.
+// The job needs the `id-token: write` permission, which exposes the endpoint through
+// the ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN variables.
+type GitHubActionsToken struct {
+	client       *http.Client
+	requestURL   string
+	requestToken string
+	audience     string
+}
+
+// NewGitHubActionsToken creates a token source from the GitHub Actions environment
+func NewGitHubActionsToken(audience string) (*GitHubActionsToken, error) {
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return nil, fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN are not set; the job needs the id-token: write permission")
+	}
+	return NewGitHubActionsTokenWithClient(&http.Client{Timeout: 10 * time.Second}, requestURL, requestToken, audience), nil
+}
+
+// NewGitHubActionsTokenWithClient creates a token source for the given endpoint (for testing)
+func NewGitHubActionsTokenWithClient(client *http.Client, requestURL, requestToken, audience string) *GitHubActionsToken {
+	return &GitHubActionsToken{
+		client:       client,
+		requestURL:   requestURL,
+		requestToken: requestToken,
+		audience:     audience,
+	}
+}
+
+// GetIdentityToken requests a fresh OIDC token; it implements stscreds.IdentityTokenRetriever
+func (g *GitHubActionsToken) GetIdentityToken() ([]byte, error) {
+	u, err := url.Parse(g.requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	if g.audience != "" {
+		q := u.Query()
+		q.Set("audience", g.audience)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OIDC token request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.requestToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request OIDC token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC token request returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode OIDC token response: %w", err)
+	}
+	if body.Value == "" {
+		return nil, fmt.Errorf("OIDC token response has no token")
+	}
+	return []byte(body.Value), nil
+}
@@ -0,0 +1,47 @@
+package dnsmanager_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+func TestGitHubActionsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer request-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("audience") != dnsmanager.GitHubActionsAudience {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"count":1,"value":"oidc-token"}`)
+	}))
+	defer server.Close()
+
+	token := dnsmanager.NewGitHubActionsTokenWithClient(server.Client(), server.URL+"/token?api-version=2.0", "request-token", dnsmanager.GitHubActionsAudience)
+	got, err := token.GetIdentityToken()
+	if err != nil {
+		t.Fatalf("GetIdentityToken returned error: %v", err)
+	}
+	if string(got) != "oidc-token" {
+		t.Fatalf("expected oidc-token, got %s", got)
+	}
+
+	bad := dnsmanager.NewGitHubActionsTokenWithClient(server.Client(), server.URL, "wrong", dnsmanager.GitHubActionsAudience)
+	if _, err := bad.GetIdentityToken(); err == nil {
+		t.Fatal("expected error for rejected request token")
+	}
+}
+
+func TestNewGitHubActionsToken_RequiresEnvironment(t *testing.T) {
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "")
+	if _, err := dnsmanager.NewGitHubActionsToken(dnsmanager.GitHubActionsAudience); err == nil {
+		t.Fatal("expected error outside GitHub Actions")
+	}
+}
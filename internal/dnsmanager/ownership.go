@@ -0,0 +1,157 @@
+package dnsmanager
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OwnershipPrefix is prepended to a record name to form the name of its ownership TXT record
+const OwnershipPrefix = "_ipwatcher."
+
+// ownershipName returns the name of the ownership TXT record guarding fqdn
+func ownershipName(fqdn string) string {
+	return OwnershipPrefix + strings.TrimSuffix(fqdn, ".")
+}
+
+// ownershipContent returns the TXT content claiming a record for owner, in external-dns style
+func ownershipContent(owner string) string {
+	return `"heritage=ipwatcher,ipwatcher/owner=` + owner + `"`
+}
+
+// parseOwner returns the owner encoded in ownership TXT content
+func parseOwner(content string) (string, bool) {
+	content = strings.Trim(content, `"`)
+	for _, field := range strings.Split(content, ",") {
+		if owner, ok := strings.CutPrefix(field, "ipwatcher/owner="); ok {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// checkOwnership splits records into those owner may manage and those claimed by another owner.
+// owners maps ownership record names to their TXT content. claims lists the ownership records
+// still to be written for the allowed records. Without an owner every record is allowed.
+func checkOwnership(owner string, owners map[string]string, records []DNSRecord) (allowed []DNSRecord, claims []string, conflicts []DNSRecord) {
+	if owner == "" {
+		return records, nil, nil
+	}
+
+	claimed := make(map[string]bool)
+	for _, record := range records {
+		name := ownershipName(record.FQDN())
+		content, exists := owners[name]
+		if exists {
+			if current, ok := parseOwner(content); ok && current != owner {
+				conflicts = append(conflicts, record)
+				continue
+			}
+		} else if !claimed[name] {
+			claimed[name] = true
+			claims = append(claims, name)
+		}
+		allowed = append(allowed, record)
+	}
+	return allowed, claims, conflicts
+}
+
+// Conflict is a record skipped because another instance claims it
+type Conflict struct {
+	Name  string `json:"name"` // Fully qualified record name
+	Type  string `json:"type"`
+	Owner string `json:"owner"` // owner_id of the instance claiming the record
+}
+
+// ConflictError reports the records skipped because other instances claim them.
+// It matches ErrNotOwner with errors.Is.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	names := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		names[i] = fmt.Sprintf("%s %s (owned by %s)", c.Name, c.Type, c.Owner)
+	}
+	return fmt.Sprintf("skipped %s: %v", strings.Join(names, ", "), ErrNotOwner)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrNotOwner
+}
+
+// ownershipError reports records that were skipped because another owner claims them, with
+// the owners named by the ownership records in owners
+func ownershipError(conflicts []DNSRecord, owners map[string]string) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	err := &ConflictError{Conflicts: make([]Conflict, len(conflicts))}
+	for i, record := range conflicts {
+		owner, _ := parseOwner(owners[ownershipName(record.FQDN())])
+		err.Conflicts[i] = Conflict{Name: record.FQDN(), Type: record.Type.String(), Owner: owner}
+	}
+	return err
+}
+
+// ownedBy reports whether the ownership TXT record of fqdn claims it for owner
+func ownedBy(owner string, owners map[string]string, fqdn string) bool {
+	current, ok := parseOwner(owners[ownershipName(fqdn)])
+	return owner != "" && ok && current == owner
+}
+
+// checkAdoption finds the records of overwriting that would change an existing record ipwatcher
+// does not manage yet, as managed reports. With adopt set they are taken over and returned as
+// adopted; otherwise they are removed from records, along with their ownership claims, and
+// returned as unmanaged.
+func checkAdoption(adopt bool, records, overwriting []DNSRecord, claims []string, managed func(DNSRecord) bool) (allowed []DNSRecord, allowedClaims []string, adopted, unmanaged []DNSRecord) {
+	for _, record := range overwriting {
+		if managed(record) {
+			continue
+		}
+		if adopt {
+			adopted = append(adopted, record)
+		} else {
+			unmanaged = append(unmanaged, record)
+		}
+	}
+	if len(unmanaged) == 0 {
+		return records, claims, adopted, nil
+	}
+
+	refused := make(map[string]bool)
+	for _, record := range unmanaged {
+		refused[record.FQDN()+"|"+record.Type.String()] = true
+	}
+	records = slices.DeleteFunc(slices.Clone(records), func(r DNSRecord) bool {
+		return refused[r.FQDN()+"|"+r.Type.String()]
+	})
+
+	// Names still published by another record keep their claim
+	claimed := make(map[string]bool)
+	for _, record := range records {
+		claimed[ownershipName(record.FQDN())] = true
+	}
+	claims = slices.DeleteFunc(slices.Clone(claims), func(name string) bool { return !claimed[name] })
+	return records, claims, adopted, unmanaged
+}
+
+// logAdopted logs the unmanaged records that are about to be taken over
+func logAdopted(adopted []DNSRecord) {
+	for _, record := range adopted {
+		logger().Info("Adopting unmanaged record", "record", record.FQDN(), "type", record.Type.String())
+	}
+}
+
+// unmanagedError reports records that were not changed because ipwatcher does not manage them
+func unmanagedError(unmanaged []DNSRecord) error {
+	if len(unmanaged) == 0 {
+		return nil
+	}
+	names := make([]string, len(unmanaged))
+	for i, record := range unmanaged {
+		names[i] = record.FQDN() + " " + record.Type.String()
+	}
+	return fmt.Errorf("refused to overwrite %s, set adopt: true or run ipwatcher adopt to take them over: %w", strings.Join(names, ", "), ErrUnmanaged)
+}
@@ -0,0 +1,113 @@
+package dnsmanager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChangeAction is what a planned change does to a record
+type ChangeAction string
+
+const (
+	ChangeCreate ChangeAction = "create"
+	ChangeUpdate ChangeAction = "update"
+	ChangeDelete ChangeAction = "delete"
+)
+
+// Change is one record change EnsureDNSRecords would make
+type Change struct {
+	Action     ChangeAction `json:"action"`
+	Name       string       `json:"name"` // Fully qualified record name
+	Type       string       `json:"type"` // A, AAAA, CNAME or TXT
+	OldContent string       `json:"old_content,omitempty"`
+	NewContent string       `json:"new_content"`
+	OldProxied bool         `json:"old_proxied,omitempty"`
+	NewProxied bool         `json:"new_proxied,omitempty"`
+	OldTTL     int          `json:"old_ttl,omitempty"`
+	NewTTL     int          `json:"new_ttl,omitempty"` // Set when the record has a custom TTL or its TTL changes
+}
+
+// String formats the change as one diff line, e.g. "~ www.example.com A 192.0.2.1 -> 198.51.100.1"
+func (c Change) String() string {
+	var b strings.Builder
+	switch c.Action {
+	case ChangeCreate:
+		fmt.Fprintf(&b, "+ %s %s %s", c.Name, c.Type, c.NewContent)
+		if c.NewProxied {
+			b.WriteString(" (proxied)")
+		}
+		if c.NewTTL != 0 {
+			fmt.Fprintf(&b, " (ttl %d)", c.NewTTL)
+		}
+	case ChangeDelete:
+		fmt.Fprintf(&b, "- %s %s %s", c.Name, c.Type, c.OldContent)
+		if c.OldProxied {
+			b.WriteString(" (proxied)")
+		}
+	default:
+		fmt.Fprintf(&b, "~ %s %s", c.Name, c.Type)
+		if c.OldContent != "" && c.OldContent != c.NewContent {
+			fmt.Fprintf(&b, " %s -> %s", c.OldContent, c.NewContent)
+		} else {
+			fmt.Fprintf(&b, " %s", c.NewContent)
+		}
+		if c.OldProxied != c.NewProxied {
+			fmt.Fprintf(&b, " (proxied %t -> %t)", c.OldProxied, c.NewProxied)
+		}
+		if c.OldTTL != c.NewTTL {
+			fmt.Fprintf(&b, " (ttl %d -> %d)", c.OldTTL, c.NewTTL)
+		}
+	}
+	return b.String()
+}
+
+// Planner is implemented by providers that can report the changes EnsureDNSRecords would make.
+// Records owned by another instance are left out of the plan and reported as ErrNotOwner,
+// and unmanaged records that may not be adopted as ErrUnmanaged.
+type Planner interface {
+	PlanDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]Change, error)
+}
+
+// DryRunner is implemented by providers that can print the changes EnsureDNSRecords
+// would make instead of applying them
+type DryRunner interface {
+	SetDryRun(out io.Writer)
+}
+
+// dryRun prints the changes planner would make for a zone to out, returning refused
+// records like EnsureDNSRecords
+func dryRun(ctx context.Context, out io.Writer, planner Planner, zoneID string, records []DNSRecord, ipv4, ipv6 string) (Result, error) {
+	changes, err := planner.PlanDNSRecords(ctx, zoneID, records, ipv4, ipv6)
+	if err != nil && !Refused(err) {
+		return Result{}, err
+	}
+	writePlan(out, zoneID, changes)
+	return Result{}, err
+}
+
+// writePlan prints the planned changes for a zone to out
+func writePlan(out io.Writer, zone string, changes []Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "Dry run: no changes for zone %s\n", zone)
+		return
+	}
+	fmt.Fprintf(out, "Dry run: %d changes for zone %s\n", len(changes), zone)
+	for _, c := range changes {
+		fmt.Fprintf(out, "  %s\n", c)
+	}
+}
+
+// recordContent returns the content a record should have for the given IPs
+func recordContent(record DNSRecord, ipv4, ipv6 string) string {
+	switch record.Type {
+	case AAAARecord:
+		return ipv6
+	case CNAMERecord:
+		return strings.TrimSuffix(record.Target, ".")
+	case TXTRecord:
+		return record.Target
+	}
+	return ipv4
+}
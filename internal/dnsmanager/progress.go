@@ -0,0 +1,42 @@
+package dnsmanager
+
+import "context"
+
+// Stage is how far a record change has progressed through EnsureDNSRecords
+type Stage string
+
+const (
+	StagePlanned   Stage = "planned"   // The change was computed from the zone's current records
+	StageSent      Stage = "sent"      // The change was sent to the provider
+	StageConfirmed Stage = "confirmed" // The provider accepted the change
+	StageFailed    Stage = "failed"    // The provider rejected the change or could not be reached
+)
+
+// Progress reports one record change moving to a new stage
+type Progress struct {
+	Stage  Stage
+	Change Change
+	Err    error // Set for StageFailed
+}
+
+// StreamingEnsurer is implemented by providers that report per-record progress while ensuring records,
+// so large zones can be followed live
+type StreamingEnsurer interface {
+	EnsureDNSRecordsStream(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error)
+}
+
+// CachedEnsurer is implemented by providers that keep the IDs and content of the records they wrote,
+// and can apply an IP change from that state without reading the zone first
+type CachedEnsurer interface {
+	EnsureDNSRecordsCached(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error)
+}
+
+// report sends every change at the given stage to progress, which may be nil
+func report(progress func(Progress), stage Stage, changes []Change, err error) {
+	if progress == nil {
+		return
+	}
+	for _, c := range changes {
+		progress(Progress{Stage: stage, Change: c, Err: err})
+	}
+}
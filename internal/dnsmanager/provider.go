@@ -2,10 +2,62 @@ package dnsmanager
 
 import (
 	"context"
+	"log/slog"
 )
 
+// logger returns the default logger with the module attribute of this package, whose log
+// level can be set apart from the rest of ipwatcher
+func logger() *slog.Logger {
+	return slog.Default().With("module", "dnsmanager")
+}
+
 // DNSProvider defines the interface for DNS operations across different providers
 type DNSProvider interface {
 	GetZoneIDByName(ctx context.Context, zoneName string) (string, error)
-	EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) error
+	EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) (Result, error)
+}
+
+// AccountZoneResolver is implemented by providers that can scope zone lookups to an account,
+// for credentials that can see zones with the same name in several accounts
+type AccountZoneResolver interface {
+	GetZoneIDByNameInAccount(ctx context.Context, zoneName, accountID string) (string, error)
+}
+
+// DriftChecker is implemented by providers that can report which records differ from
+// the expected IPs without changing anything, as used by read-only mode
+type DriftChecker interface {
+	CheckDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]DNSRecord, error)
+}
+
+// CredentialVerifier is implemented by providers that can check their credentials up front.
+// accountID scopes the check for account-owned credentials and may be empty.
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, accountID string) error
+}
+
+// OwnershipTracker is implemented by providers that can guard records with ownership TXT records,
+// so that several instances or tools do not fight over the same names
+type OwnershipTracker interface {
+	SetOwner(ownerID string)
+}
+
+// Adopter is implemented by providers that can tell records ipwatcher manages from records
+// created by hand or other tools, and leave the latter alone unless adoption is allowed
+type Adopter interface {
+	SetAdopt(adopt bool)
+}
+
+// ExistingRecord is an address record as it currently exists at the provider
+type ExistingRecord struct {
+	Name    string // Fully qualified record name
+	Type    DNSRecordType
+	Content string
+	Proxied bool
+	TTL     int // Seconds; 0 for the provider default
+}
+
+// RecordLister is implemented by providers that can list the A and AAAA records of a zone,
+// e.g. to import an existing setup into a config
+type RecordLister interface {
+	ListAddressRecords(ctx context.Context, zoneID string) ([]ExistingRecord, error)
 }
@@ -0,0 +1,101 @@
+package dnsmanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Result summarises what EnsureDNSRecords did to a zone
+type Result struct {
+	Created []Change
+	Updated []Change
+	Deleted []Change // Duplicates of managed records
+	Skipped []string // Records left alone, as "name type": already up to date or no IP for their family
+	Errors  []RecordError
+}
+
+// RecordError is the failure of a single record
+type RecordError struct {
+	Name string // Fully qualified record name
+	Type string
+	Err  error
+}
+
+// Changed returns the number of records created, updated or deleted
+func (r Result) Changed() int {
+	return len(r.Created) + len(r.Updated) + len(r.Deleted)
+}
+
+// newResult builds the result of applying changes for records. When err is set the changes
+// were not applied and each of them is reported as failed. Records claimed by another owner
+// are reported as ErrNotOwner failures, and unmanaged records that were not adopted as
+// ErrUnmanaged failures. Ownership TXT records are bookkeeping and left out.
+func newResult(records []DNSRecord, changes []Change, conflicts, unmanaged []DNSRecord, err error) Result {
+	if err != nil {
+		return newPartialResult(records, nil, changes, conflicts, unmanaged, err)
+	}
+	return newPartialResult(records, changes, nil, conflicts, unmanaged, nil)
+}
+
+// newPartialResult is newResult for changes sent in several calls, where the applied changes
+// went through before a call failed with err and the failed ones were rejected or never sent
+func newPartialResult(records []DNSRecord, applied, failed []Change, conflicts, unmanaged []DNSRecord, err error) Result {
+	var result Result
+	touched := make(map[string]bool)
+	for _, c := range failed {
+		if c.Type == "TXT" && strings.HasPrefix(c.Name, OwnershipPrefix) {
+			continue
+		}
+		touched[c.Name+" "+c.Type] = true
+		result.Errors = append(result.Errors, RecordError{Name: c.Name, Type: c.Type, Err: err})
+	}
+	for _, c := range applied {
+		if c.Type == "TXT" && strings.HasPrefix(c.Name, OwnershipPrefix) {
+			continue
+		}
+		touched[c.Name+" "+c.Type] = true
+		switch c.Action {
+		case ChangeCreate:
+			result.Created = append(result.Created, c)
+		case ChangeDelete:
+			result.Deleted = append(result.Deleted, c)
+		default:
+			result.Updated = append(result.Updated, c)
+		}
+	}
+	for _, r := range conflicts {
+		touched[r.FQDN()+" "+r.Type.String()] = true
+		result.Errors = append(result.Errors, RecordError{Name: r.FQDN(), Type: r.Type.String(), Err: ErrNotOwner})
+	}
+	for _, r := range unmanaged {
+		touched[r.FQDN()+" "+r.Type.String()] = true
+		result.Errors = append(result.Errors, RecordError{Name: r.FQDN(), Type: r.Type.String(), Err: ErrUnmanaged})
+	}
+	for _, r := range records {
+		if key := r.FQDN() + " " + r.Type.String(); !touched[key] {
+			touched[key] = true
+			result.Skipped = append(result.Skipped, key)
+		}
+	}
+	return result
+}
+
+// String summarises the result as counts, e.g. "created 1, updated 2, skipped 0, failed 0";
+// deletions are only listed when there are any
+func (r Result) String() string {
+	deleted := ""
+	if len(r.Deleted) > 0 {
+		deleted = fmt.Sprintf(", deleted %d", len(r.Deleted))
+	}
+	return fmt.Sprintf("created %d, updated %d%s, skipped %d, failed %d", len(r.Created), len(r.Updated), deleted, len(r.Skipped), len(r.Errors))
+}
+
+// Err joins the per-record errors of the result
+func (r Result) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		errs = append(errs, e.Err)
+	}
+	return errors.Join(errs...)
+}
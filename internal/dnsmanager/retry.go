@@ -0,0 +1,142 @@
+package dnsmanager
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how rate-limited requests, server errors and network failures are retried
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt
+	BaseDelay  time.Duration // Backoff before the first retry, doubled on every further retry
+	MaxDelay   time.Duration // Longest wait; a longer Retry-After gives up until the next sync
+	Jitter     float64       // Fraction of every backoff, 0 to 1, that is randomly left out
+}
+
+// DefaultRetryPolicy is used by providers unless overridden
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+	Jitter:     0.2,
+}
+
+// CircuitBreaker controls when a provider stops calling an API that keeps failing
+type CircuitBreaker struct {
+	Failures int           // Consecutive failed requests that open the circuit; 0 disables the breaker
+	Cooldown time.Duration // How long requests fail immediately once the circuit is open
+}
+
+// DefaultCircuitBreaker is used by providers unless overridden
+var DefaultCircuitBreaker = CircuitBreaker{
+	Failures: 5,
+	Cooldown: 5 * time.Minute,
+}
+
+// backoff returns the wait before the given retry (0-based), without a Retry-After hint
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	// Jitter spreads out the retries of watchers that failed at the same time
+	return delay - time.Duration(p.Jitter*rand.Float64()*float64(delay))
+}
+
+// transient reports whether err is a failure that may pass on its own: a 5xx response or a
+// network error. Cancellations and deadlines of the caller's context are not, and neither is
+// an API host name that does not resolve.
+func transient(err error, status int) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var netErr net.Error
+	return status == 0 && errors.As(err, &netErr)
+}
+
+// retryAfter parses the Retry-After header of a response, in seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// cooldown remembers until when an API asked not to be called again
+type cooldown struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// set extends the cooldown to t
+func (c *cooldown) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.until) {
+		c.until = t
+	}
+}
+
+// active returns the end of the cooldown when it has not passed yet
+func (c *cooldown) active(now time.Time) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.until, now.Before(c.until)
+}
+
+// breaker counts consecutive failed requests and opens the circuit after too many
+type breaker struct {
+	mu       sync.Mutex
+	policy   CircuitBreaker
+	failures int
+	until    time.Time
+}
+
+// open returns the end of the open circuit when it has not passed yet
+func (b *breaker) open(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.until, now.Before(b.until)
+}
+
+// record counts a request outcome and returns the end of the circuit when failed opened it
+func (b *breaker) record(failed bool, now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return time.Time{}, false
+	}
+	b.failures++
+	if b.policy.Failures == 0 || b.failures < b.policy.Failures {
+		return time.Time{}, false
+	}
+	// A request let through after the cooldown that fails again reopens the circuit at once
+	b.failures = 0
+	b.until = now.Add(b.policy.Cooldown)
+	return b.until, true
+}
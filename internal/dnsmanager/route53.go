@@ -2,14 +2,19 @@ package dnsmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 )
 
 // Route53Client defines the subset of Route53 API methods used by the provider.
@@ -19,26 +24,132 @@ type Route53Client interface {
 	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
 }
 
+// classifyRoute53Error tags Route53 API errors with an error kind based on the AWS error code
+func classifyRoute53Error(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.ErrorCode() {
+	case "NoSuchHostedZone", "HostedZoneNotFound":
+		return withKind(ErrZoneNotFound, err)
+	case "AccessDenied", "AccessDeniedException", "InvalidClientTokenId", "ExpiredToken", "SignatureDoesNotMatch", "UnrecognizedClientException":
+		return withKind(ErrAuth, err)
+	case "Throttling", "ThrottlingException", "PriorRequestNotComplete":
+		return withKind(ErrRateLimited, err)
+	case "InvalidChangeBatch", "InvalidInput", "InvalidDomainName":
+		return withKind(ErrValidation, err)
+	}
+	return err
+}
+
 // Route53Provider handles AWS Route53 DNS operations
 type Route53Provider struct {
 	client Route53Client
+	batch  BatchPolicy
+	owner  string    // instance ID written to ownership TXT records; empty disables ownership
+	refuse bool      // leave unmanaged records with different content alone instead of adopting them
+	dryRun io.Writer // receives the planned changes instead of applying them when set
+}
+
+// Route53Option customizes the AWS configuration a Route53 provider is created with
+type Route53Option = func(*config.LoadOptions) error
+
+// Route53HTTPClient makes the provider send its AWS requests with client, e.g. one bound to an interface
+func Route53HTTPClient(client *http.Client) Route53Option {
+	return config.WithHTTPClient(client)
 }
 
 // NewRoute53Provider creates a new Route53 provider instance
-func NewRoute53Provider(ctx context.Context) (*Route53Provider, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+func NewRoute53Provider(ctx context.Context, opts ...Route53Option) (*Route53Provider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 	client := route53.NewFromConfig(cfg)
 	return &Route53Provider{
 		client: client,
+		batch:  DefaultRoute53Batch,
+	}, nil
+}
+
+// WebIdentity configures workload identity federation: Route53 is called with short-lived
+// credentials for RoleARN, obtained by exchanging an OIDC token with AWS STS
+type WebIdentity struct {
+	RoleARN       string
+	TokenFile     string // File holding the OIDC token, e.g. a projected Kubernetes service account token
+	GitHubActions bool   // Request the OIDC token from the GitHub Actions token endpoint instead
+	SessionName   string // Role session name; defaults to ipwatcher
+}
+
+// NewRoute53ProviderWithWebIdentity creates a Route53 provider that assumes a role with an OIDC token
+// instead of using long-lived keys. Credentials are refreshed before they expire.
+func NewRoute53ProviderWithWebIdentity(ctx context.Context, identity WebIdentity, opts ...Route53Option) (*Route53Provider, error) {
+	var token stscreds.IdentityTokenRetriever
+	switch {
+	case identity.GitHubActions:
+		gh, err := NewGitHubActionsToken(GitHubActionsAudience)
+		if err != nil {
+			return nil, err
+		}
+		token = gh
+	case identity.TokenFile != "":
+		token = stscreds.IdentityTokenFile(identity.TokenFile)
+	default:
+		return nil, fmt.Errorf("web identity needs a token file or GitHub Actions")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1" // Route53 is global, but STS needs a region
+	}
+
+	sessionName := identity.SessionName
+	if sessionName == "" {
+		sessionName = "ipwatcher"
+	}
+	provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), identity.RoleARN, token, func(o *stscreds.WebIdentityRoleOptions) {
+		o.RoleSessionName = sessionName
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	return &Route53Provider{
+		client: route53.NewFromConfig(cfg),
+		batch:  DefaultRoute53Batch,
 	}, nil
 }
 
 // NewRoute53ProviderWithClient creates a Route53 provider with a custom client (for testing).
 func NewRoute53ProviderWithClient(client Route53Client) *Route53Provider {
-	return &Route53Provider{client: client}
+	return &Route53Provider{client: client, batch: DefaultRoute53Batch}
+}
+
+// SetOwner enables ownership TXT records. Records claimed by a different owner are left alone,
+// and records without an ownership record are claimed for ownerID.
+func (p *Route53Provider) SetOwner(ownerID string) {
+	p.owner = ownerID
+}
+
+// SetAdopt sets whether existing records without an ownership record of this instance are
+// taken over when their content differs. Route53 records carry no comment, so telling managed
+// records apart needs an owner; without one every record counts as managed. Adoption is on by default.
+func (p *Route53Provider) SetAdopt(adopt bool) {
+	p.refuse = !adopt
+}
+
+// SetBatchPolicy replaces the policy that splits the changes of a zone into change batches
+func (p *Route53Provider) SetBatchPolicy(policy BatchPolicy) {
+	p.batch = policy
+}
+
+// SetDryRun makes EnsureDNSRecords print its planned changes to out instead of applying them;
+// a nil out applies changes again
+func (p *Route53Provider) SetDryRun(out io.Writer) {
+	p.dryRun = out
 }
 
 // GetZoneIDByName retrieves the Hosted Zone ID for a given zone name
@@ -54,7 +165,7 @@ func (p *Route53Provider) GetZoneIDByName(ctx context.Context, zoneName string)
 
 	output, err := p.client.ListHostedZonesByName(ctx, input)
 	if err != nil {
-		return "", fmt.Errorf("failed to list hosted zones: %w", err)
+		return "", fmt.Errorf("failed to list hosted zones: %w", classifyRoute53Error(err))
 	}
 
 	for _, zone := range output.HostedZones {
@@ -68,7 +179,7 @@ func (p *Route53Provider) GetZoneIDByName(ctx context.Context, zoneName string)
 		}
 	}
 
-	return "", fmt.Errorf("hosted zone %s not found", zoneName)
+	return "", fmt.Errorf("hosted zone %s not found: %w", zoneName, ErrZoneNotFound)
 }
 
 func (p *Route53Provider) listAllResourceRecordSets(ctx context.Context, zoneID string) ([]types.ResourceRecordSet, error) {
@@ -80,7 +191,7 @@ func (p *Route53Provider) listAllResourceRecordSets(ctx context.Context, zoneID
 	for {
 		output, err := p.client.ListResourceRecordSets(ctx, input)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list resource record sets: %w", err)
+			return nil, fmt.Errorf("failed to list resource record sets: %w", classifyRoute53Error(err))
 		}
 
 		all = append(all, output.ResourceRecordSets...)
@@ -97,21 +208,18 @@ func (p *Route53Provider) listAllResourceRecordSets(ctx context.Context, zoneID
 	return all, nil
 }
 
-// EnsureDNSRecords checks if the DNS records match the provided IPs and updates them if necessary
-func (p *Route53Provider) EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) error {
-	allRecords, err := p.listAllResourceRecordSets(ctx, zoneID)
-	if err != nil {
-		return err
-	}
-
+// diffRoute53Records compares the records with the hosted zone and returns the upserts needed,
+// along with the records they apply to
+func diffRoute53Records(allRecords []types.ResourceRecordSet, records []DNSRecord, ipv4, ipv6 string) ([]types.Change, []DNSRecord) {
 	existingRecordMap := make(map[string]types.ResourceRecordSet)
 	for _, rs := range allRecords {
-		if rs.Type == types.RRTypeA || rs.Type == types.RRTypeAaaa {
+		if rs.Type == types.RRTypeA || rs.Type == types.RRTypeAaaa || rs.Type == types.RRTypeCname || rs.Type == types.RRTypeTxt {
 			existingRecordMap[*rs.Name+"|"+string(rs.Type)] = rs
 		}
 	}
 
 	var changes []types.Change
+	var changed []DNSRecord
 
 	for _, record := range records {
 		if record.Type == ARecord && ipv4 == "" {
@@ -121,30 +229,37 @@ func (p *Route53Provider) EnsureDNSRecords(ctx context.Context, zoneID string, r
 			continue
 		}
 
-		fqdn := record.Root
-		if record.Name != "@" {
-			fqdn = record.Name + "." + record.Root
-		}
-		if !strings.HasSuffix(fqdn, ".") {
-			fqdn += "."
-		}
+		fqdn := record.FQDN() + "."
 
-		var targetIP string
+		var content string
 		var rrType types.RRType
-		if record.Type == ARecord {
-			targetIP = ipv4
+		switch record.Type {
+		case ARecord:
+			content = ipv4
 			rrType = types.RRTypeA
-		} else {
-			targetIP = ipv6
+		case AAAARecord:
+			content = ipv6
 			rrType = types.RRTypeAaaa
+		case CNAMERecord:
+			content = recordContent(record, ipv4, ipv6) + "." // Route53 returns CNAME targets fully qualified
+			rrType = types.RRTypeCname
+		case TXTRecord:
+			content = recordContent(record, ipv4, ipv6)
+			rrType = types.RRTypeTxt
 		}
 
 		key := fqdn + "|" + string(rrType)
 		existing, exists := existingRecordMap[key]
+		if !exists && record.NoCreate {
+			continue
+		}
 
 		needsUpdate := !exists
 		if exists {
-			if len(existing.ResourceRecords) != 1 || *existing.ResourceRecords[0].Value != targetIP {
+			if len(existing.ResourceRecords) != 1 || *existing.ResourceRecords[0].Value != content {
+				needsUpdate = true
+			}
+			if (record.TTL != 0 || record.Strict) && aws.ToInt64(existing.TTL) != route53TTL(record) {
 				needsUpdate = true
 			}
 		}
@@ -155,33 +270,199 @@ func (p *Route53Provider) EnsureDNSRecords(ctx context.Context, zoneID string, r
 				ResourceRecordSet: &types.ResourceRecordSet{
 					Name: aws.String(fqdn),
 					Type: rrType,
-					TTL:  aws.Int64(300), // Default TTL
+					TTL:  aws.Int64(route53TTL(record)),
 					ResourceRecords: []types.ResourceRecord{
 						{
-							Value: aws.String(targetIP),
+							Value: aws.String(content),
 						},
 					},
 				},
 			})
+			changed = append(changed, record)
+		}
+	}
+
+	return changes, changed
+}
+
+// defaultRoute53TTL is the TTL of records that do not set their own
+const defaultRoute53TTL = 300
+
+// route53TTL returns the TTL to write for record
+func route53TTL(record DNSRecord) int64 {
+	if record.TTL == 0 {
+		return defaultRoute53TTL
+	}
+	return int64(record.TTL)
+}
+
+// route53Ownership maps the names of the ownership TXT records in a zone to their content
+func route53Ownership(allRecords []types.ResourceRecordSet) map[string]string {
+	owners := make(map[string]string)
+	for _, rs := range allRecords {
+		name := strings.TrimSuffix(aws.ToString(rs.Name), ".")
+		if rs.Type == types.RRTypeTxt && strings.HasPrefix(name, OwnershipPrefix) && len(rs.ResourceRecords) > 0 {
+			owners[name] = aws.ToString(rs.ResourceRecords[0].Value)
+		}
+	}
+	return owners
+}
+
+// planRoute53Changes describes the upserts EnsureDNSRecords would send
+func planRoute53Changes(allRecords []types.ResourceRecordSet, changes []types.Change) []Change {
+	existingRecordMap := make(map[string]types.ResourceRecordSet)
+	for _, rs := range allRecords {
+		existingRecordMap[aws.ToString(rs.Name)+"|"+string(rs.Type)] = rs
+	}
+
+	var plan []Change
+	for _, change := range changes {
+		rs := change.ResourceRecordSet
+		c := Change{
+			Action:     ChangeCreate,
+			Name:       strings.TrimSuffix(aws.ToString(rs.Name), "."),
+			Type:       string(rs.Type),
+			NewContent: aws.ToString(rs.ResourceRecords[0].Value),
+		}
+		if ttl := aws.ToInt64(rs.TTL); ttl != defaultRoute53TTL {
+			c.NewTTL = int(ttl)
+		}
+		if existing, ok := existingRecordMap[aws.ToString(rs.Name)+"|"+string(rs.Type)]; ok {
+			c.Action = ChangeUpdate
+			if len(existing.ResourceRecords) > 0 {
+				c.OldContent = aws.ToString(existing.ResourceRecords[0].Value)
+			}
+			if ttl := aws.ToInt64(rs.TTL); ttl != aws.ToInt64(existing.TTL) {
+				c.OldTTL, c.NewTTL = int(aws.ToInt64(existing.TTL)), int(ttl)
+			}
+		}
+		plan = append(plan, c)
+	}
+	return plan
+}
+
+// ownershipChanges returns the changes writing ownership TXT records for names
+func ownershipChanges(names []string, owner string) []types.Change {
+	var changes []types.Change
+	for _, name := range names {
+		changes = append(changes, types.Change{
+			Action: types.ChangeActionUpsert,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name: aws.String(name + "."),
+				Type: types.RRTypeTxt,
+				TTL:  aws.Int64(defaultRoute53TTL),
+				ResourceRecords: []types.ResourceRecord{
+					{
+						Value: aws.String(ownershipContent(owner)),
+					},
+				},
+			},
+		})
+	}
+	return changes
+}
+
+// checkAdoption applies the adoption policy to the records that would change an existing record set
+func (p *Route53Provider) checkAdoption(allRecords []types.ResourceRecordSet, records []DNSRecord, claims []string, ipv4, ipv6 string) ([]DNSRecord, []string, []DNSRecord, []DNSRecord) {
+	exists := make(map[string]bool)
+	for _, rs := range allRecords {
+		exists[aws.ToString(rs.Name)+"|"+string(rs.Type)] = true
+	}
+	_, changed := diffRoute53Records(allRecords, records, ipv4, ipv6)
+	var overwriting []DNSRecord
+	for _, record := range changed {
+		if exists[record.FQDN()+".|"+record.Type.String()] {
+			overwriting = append(overwriting, record)
 		}
 	}
 
+	owners := route53Ownership(allRecords)
+	return checkAdoption(!p.refuse, records, overwriting, claims, func(r DNSRecord) bool {
+		return p.owner == "" || ownedBy(p.owner, owners, r.FQDN())
+	})
+}
+
+// CheckDNSRecords returns the records that are missing or differ from the provided IPs, without changing them
+func (p *Route53Provider) CheckDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]DNSRecord, error) {
+	allRecords, err := p.listAllResourceRecordSets(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	_, changed := diffRoute53Records(allRecords, records, ipv4, ipv6)
+	return changed, nil
+}
+
+// PlanDNSRecords returns the changes EnsureDNSRecords would make, without applying them
+func (p *Route53Provider) PlanDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) ([]Change, error) {
+	allRecords, err := p.listAllResourceRecordSets(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := route53Ownership(allRecords)
+	records, claims, conflicts := checkOwnership(p.owner, owners, records)
+	records, claims, _, unmanaged := p.checkAdoption(allRecords, records, claims, ipv4, ipv6)
+	changes, _ := diffRoute53Records(allRecords, records, ipv4, ipv6)
+	changes = append(changes, ownershipChanges(claims, p.owner)...)
+	return planRoute53Changes(allRecords, changes), errors.Join(ownershipError(conflicts, owners), unmanagedError(unmanaged))
+}
+
+// EnsureDNSRecords checks if the DNS records match the provided IPs and updates them if necessary.
+// With an owner set, records claimed by another owner are skipped and reported as ErrNotOwner
+// after the remaining records have been applied. The result lists what was created, updated and
+// skipped, and every record that failed.
+func (p *Route53Provider) EnsureDNSRecords(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string) (Result, error) {
+	return p.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, nil)
+}
+
+// EnsureDNSRecordsStream is EnsureDNSRecords reporting every record change to progress.
+// The changes of a zone go out in change batches of at most the batch policy's MaxChanges, each
+// sent and confirmed together; when a batch fails, the changes of earlier ones stay applied.
+func (p *Route53Provider) EnsureDNSRecordsStream(ctx context.Context, zoneID string, records []DNSRecord, ipv4, ipv6 string, progress func(Progress)) (Result, error) {
+	if p.dryRun != nil {
+		return dryRun(ctx, p.dryRun, p, zoneID, records, ipv4, ipv6)
+	}
+
+	allRecords, err := p.listAllResourceRecordSets(ctx, zoneID)
+	if err != nil {
+		return Result{}, err
+	}
+
+	owners := route53Ownership(allRecords)
+	records, claims, conflicts := checkOwnership(p.owner, owners, records)
+	records, claims, adopted, unmanaged := p.checkAdoption(allRecords, records, claims, ipv4, ipv6)
+	changes, _ := diffRoute53Records(allRecords, records, ipv4, ipv6)
+	changes = append(changes, ownershipChanges(claims, p.owner)...)
+	refusedErr := errors.Join(ownershipError(conflicts, owners), unmanagedError(unmanaged))
+
 	if len(changes) == 0 {
-		log.Println("No Route53 DNS records to update")
-		return nil
+		logger().Debug("No Route53 DNS records to update", "zone", zoneID)
+		return newResult(records, nil, conflicts, unmanaged, nil), refusedErr
 	}
+	logAdopted(adopted)
 
-	_, err = p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(zoneID),
-		ChangeBatch: &types.ChangeBatch{
-			Changes: changes,
-		},
+	plan := planRoute53Changes(allRecords, changes)
+	report(progress, StagePlanned, plan, nil)
+	sent, err := sendChunks(ctx, p.batch, len(changes), func(start, end int) error {
+		report(progress, StageSent, plan[start:end], nil)
+		_, err := p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch: &types.ChangeBatch{
+				Changes: changes[start:end],
+			},
+		})
+		if err == nil {
+			report(progress, StageConfirmed, plan[start:end], nil)
+		}
+		return err
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to change resource record sets: %w", err)
+		err = fmt.Errorf("failed to change resource record sets: %w", classifyRoute53Error(err))
+		report(progress, StageFailed, plan[sent:], err)
+		return newPartialResult(records, plan[:sent], plan[sent:], conflicts, unmanaged, err), err
 	}
 
-	log.Printf("Successfully updated %d records in Route53", len(changes))
-	return nil
+	logger().Info("Updated records in Route53", "zone", zoneID, "changes", len(changes))
+	return newResult(records, plan, conflicts, unmanaged, nil), refusedErr
 }
@@ -186,7 +186,7 @@ func TestIntegration_Route53_EnsureDNSRecords_CreateUpdateAndCleanup(t *testing.
 	ipv4First := "203.0.113.210"
 	ipv6First := "2001:db8::210"
 
-	if err := provider.EnsureDNSRecords(ctx, zoneID, records, ipv4First, ipv6First); err != nil {
+	if _, err := provider.EnsureDNSRecords(ctx, zoneID, records, ipv4First, ipv6First); err != nil {
 		t.Fatalf("EnsureDNSRecords create failed: %v", err)
 	}
 
@@ -196,7 +196,7 @@ func TestIntegration_Route53_EnsureDNSRecords_CreateUpdateAndCleanup(t *testing.
 	ipv4Second := "203.0.113.211"
 	ipv6Second := "2001:db8::211"
 
-	if err := provider.EnsureDNSRecords(ctx, zoneID, records, ipv4Second, ipv6Second); err != nil {
+	if _, err := provider.EnsureDNSRecords(ctx, zoneID, records, ipv4Second, ipv6Second); err != nil {
 		t.Fatalf("EnsureDNSRecords update failed: %v", err)
 	}
 
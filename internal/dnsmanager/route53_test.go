@@ -2,11 +2,14 @@ package dnsmanager_test
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
 	"github.com/msyrus/ipwatcher/internal/dnsmanager"
 )
 
@@ -88,7 +91,7 @@ func TestRoute53EnsureDNSRecords_PaginatesAndSkipsUnchanged(t *testing.T) {
 		},
 	})
 
-	err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
+	_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
 		Root: "example.com",
 		Name: "www",
 		Type: dnsmanager.ARecord,
@@ -120,7 +123,7 @@ func TestRoute53EnsureDNSRecords_UpsertsWhenMissing(t *testing.T) {
 		},
 	})
 
-	err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
+	_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
 		Root: "example.com",
 		Name: "@",
 		Type: dnsmanager.ARecord,
@@ -144,3 +147,346 @@ func TestRoute53EnsureDNSRecords_UpsertsWhenMissing(t *testing.T) {
 		t.Fatalf("expected apex fqdn example.com., got %s", got)
 	}
 }
+
+func TestRoute53EnsureDNSRecords_NoCreate(t *testing.T) {
+	changeCalls := 0
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			changeCalls++
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+
+	_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
+		Root:     "example.com",
+		Name:     "@",
+		Type:     dnsmanager.ARecord,
+		NoCreate: true,
+	}}, "203.0.113.20", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+	if changeCalls != 0 {
+		t.Fatalf("expected a missing NoCreate record not to be created, got %d change calls", changeCalls)
+	}
+}
+
+func TestRoute53EnsureDNSRecords_CustomTTL(t *testing.T) {
+	var captured *route53.ChangeResourceRecordSetsInput
+
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{{
+					Name: aws.String("vpn.example.com."),
+					Type: types.RRTypeA,
+					TTL:  aws.Int64(300),
+					ResourceRecords: []types.ResourceRecord{{
+						Value: aws.String("203.0.113.10"),
+					}},
+				}},
+			}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			captured = params
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+
+	result, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
+		Root: "example.com",
+		Name: "vpn",
+		Type: dnsmanager.ARecord,
+		TTL:  60,
+	}}, "203.0.113.10", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+
+	if captured == nil || len(captured.ChangeBatch.Changes) != 1 {
+		t.Fatalf("expected an upsert for the TTL change")
+	}
+	if got := aws.ToInt64(captured.ChangeBatch.Changes[0].ResourceRecordSet.TTL); got != 60 {
+		t.Fatalf("expected TTL 60, got %d", got)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].OldTTL != 300 || result.Updated[0].NewTTL != 60 {
+		t.Fatalf("expected TTL 300 -> 60 in the result, got %v", result.Updated)
+	}
+}
+
+func TestRoute53_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "no such hosted zone", err: &types.NoSuchHostedZone{Message: aws.String("gone")}, expected: dnsmanager.ErrZoneNotFound},
+		{name: "invalid change batch", err: &types.InvalidChangeBatch{Message: aws.String("bad")}, expected: dnsmanager.ErrValidation},
+		{name: "throttled", err: &smithy.GenericAPIError{Code: "Throttling", Message: "slow down"}, expected: dnsmanager.ErrRateLimited},
+		{name: "access denied", err: &smithy.GenericAPIError{Code: "AccessDenied", Message: "no"}, expected: dnsmanager.ErrAuth},
+		{name: "unclassified", err: errors.New("connection reset"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+				changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+					return nil, tt.err
+				},
+			})
+
+			_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{{
+				Root: "example.com",
+				Name: "@",
+				Type: dnsmanager.ARecord,
+			}}, "203.0.113.20", "")
+			if err == nil {
+				t.Fatal("expected error but got nil")
+			}
+			if kind := dnsmanager.ErrorKind(err); kind != tt.expected {
+				t.Fatalf("expected error kind %v, got %v", tt.expected, kind)
+			}
+		})
+	}
+}
+
+func TestRoute53GetZoneIDByName_NotFound(t *testing.T) {
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{})
+
+	_, err := provider.GetZoneIDByName(context.Background(), "example.com")
+	if !errors.Is(err, dnsmanager.ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestRoute53CheckDNSRecords_ReportsDriftWithoutChanges(t *testing.T) {
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{
+					{
+						Name:            aws.String("example.com."),
+						Type:            types.RRTypeA,
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String("203.0.113.20")}},
+					},
+				},
+			}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			t.Fatal("CheckDNSRecords must not change records")
+			return nil, nil
+		},
+	})
+
+	drifted, err := provider.CheckDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "203.0.113.20", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(drifted) != 1 || drifted[0].FQDN() != "www.example.com" {
+		t.Fatalf("expected only www.example.com to drift, got %v", drifted)
+	}
+}
+
+func TestRoute53EnsureDNSRecords_Ownership(t *testing.T) {
+	var changes []types.Change
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{
+					{
+						Name:            aws.String("_ipwatcher.www.example.com."),
+						Type:            types.RRTypeTxt,
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String(`"heritage=ipwatcher,ipwatcher/owner=other"`)}},
+					},
+				},
+			}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			changes = params.ChangeBatch.Changes
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+	provider.SetOwner("home")
+
+	_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+	}, "203.0.113.20", "")
+	if !errors.Is(err, dnsmanager.ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner for www.example.com, got %v", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("expected the apex record and its ownership record to change, got %d changes", len(changes))
+	}
+	if name := aws.ToString(changes[0].ResourceRecordSet.Name); name != "example.com." {
+		t.Errorf("expected upsert of example.com., got %s", name)
+	}
+	claim := changes[1].ResourceRecordSet
+	if aws.ToString(claim.Name) != "_ipwatcher.example.com." || claim.Type != types.RRTypeTxt {
+		t.Errorf("expected ownership TXT for _ipwatcher.example.com., got %s %s", aws.ToString(claim.Name), claim.Type)
+	}
+}
+
+func TestRoute53EnsureDNSRecords_RefuseUnmanaged(t *testing.T) {
+	var changes []types.Change
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{
+					{
+						Name:            aws.String("example.com."),
+						Type:            types.RRTypeA,
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String("192.0.2.1")}},
+					},
+					{
+						Name:            aws.String("_ipwatcher.example.com."),
+						Type:            types.RRTypeTxt,
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String(`"heritage=ipwatcher,ipwatcher/owner=home"`)}},
+					},
+					{
+						Name:            aws.String("www.example.com."),
+						Type:            types.RRTypeA,
+						ResourceRecords: []types.ResourceRecord{{Value: aws.String("192.0.2.1")}},
+					},
+				},
+			}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			changes = params.ChangeBatch.Changes
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+	provider.SetOwner("home")
+	provider.SetAdopt(false)
+
+	result, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "@", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "www", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "vpn", Type: dnsmanager.ARecord},
+	}, "203.0.113.20", "")
+	if !errors.Is(err, dnsmanager.ErrUnmanaged) {
+		t.Fatalf("expected ErrUnmanaged for www.example.com, got %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Name != "www.example.com" {
+		t.Errorf("expected www.example.com to be reported as refused, got %v", result.Errors)
+	}
+
+	// The owned apex is updated and the new vpn record created and claimed; www is left alone
+	var names []string
+	for _, c := range changes {
+		names = append(names, aws.ToString(c.ResourceRecordSet.Name))
+	}
+	if got := strings.Join(names, ","); got != "example.com.,vpn.example.com.,_ipwatcher.vpn.example.com." {
+		t.Errorf("expected changes to the apex and vpn only, got %s", got)
+	}
+}
+
+func TestRoute53EnsureDNSRecords_CNAME(t *testing.T) {
+	var captured *route53.ChangeResourceRecordSetsInput
+
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{
+				ResourceRecordSets: []types.ResourceRecordSet{{
+					Name: aws.String("www.example.com."),
+					Type: types.RRTypeCname,
+					TTL:  aws.Int64(300),
+					ResourceRecords: []types.ResourceRecord{{
+						Value: aws.String("example.com."),
+					}},
+				}},
+			}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			captured = params
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+
+	_, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "www", Type: dnsmanager.CNAMERecord, Target: "example.com"},
+		{Root: "example.com", Name: "shop", Type: dnsmanager.CNAMERecord, Target: "shops.example.net"},
+	}, "203.0.113.10", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+
+	if captured == nil || len(captured.ChangeBatch.Changes) != 1 {
+		t.Fatalf("expected a single upsert for the missing CNAME")
+	}
+	rs := captured.ChangeBatch.Changes[0].ResourceRecordSet
+	if aws.ToString(rs.Name) != "shop.example.com." || rs.Type != types.RRTypeCname || aws.ToString(rs.ResourceRecords[0].Value) != "shops.example.net." {
+		t.Fatalf("expected shop CNAME to shops.example.net., got %s %s %s", aws.ToString(rs.Name), rs.Type, aws.ToString(rs.ResourceRecords[0].Value))
+	}
+}
+
+func TestRoute53EnsureDNSRecords_SplitsChangeBatches(t *testing.T) {
+	var batches [][]types.Change
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			batches = append(batches, params.ChangeBatch.Changes)
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+	provider.SetBatchPolicy(dnsmanager.BatchPolicy{MaxChanges: 2})
+
+	var records []dnsmanager.DNSRecord
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		records = append(records, dnsmanager.DNSRecord{Root: "example.com", Name: name, Type: dnsmanager.ARecord})
+	}
+	result, err := provider.EnsureDNSRecords(context.Background(), "Z123", records, "203.0.113.20", "")
+	if err != nil {
+		t.Fatalf("EnsureDNSRecords returned error: %v", err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[1]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("expected change batches of 2, 2 and 1 changes, got %d batches", len(batches))
+	}
+	if got := aws.ToString(batches[2][0].ResourceRecordSet.Name); got != "e.example.com." {
+		t.Errorf("expected the last batch to hold e.example.com., got %s", got)
+	}
+	if len(result.Created) != 5 {
+		t.Errorf("expected 5 created records, got %s", result)
+	}
+}
+
+func TestRoute53EnsureDNSRecords_StopsAtFailedChangeBatch(t *testing.T) {
+	calls := 0
+	provider := dnsmanager.NewRoute53ProviderWithClient(&mockRoute53Client{
+		listResourceRecordSetsFunc: func(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+			return &route53.ListResourceRecordSetsOutput{}, nil
+		},
+		changeResourceRecordSetsFunc: func(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+			calls++
+			if calls == 2 {
+				return nil, errors.New("throttled")
+			}
+			return &route53.ChangeResourceRecordSetsOutput{}, nil
+		},
+	})
+	provider.SetBatchPolicy(dnsmanager.BatchPolicy{MaxChanges: 1})
+
+	result, err := provider.EnsureDNSRecords(context.Background(), "Z123", []dnsmanager.DNSRecord{
+		{Root: "example.com", Name: "a", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "b", Type: dnsmanager.ARecord},
+		{Root: "example.com", Name: "c", Type: dnsmanager.ARecord},
+	}, "203.0.113.20", "")
+	if err == nil {
+		t.Fatal("expected the failed change batch to be reported")
+	}
+	if calls != 2 {
+		t.Errorf("expected no change batch after the failed one, got %d calls", calls)
+	}
+	if len(result.Created) != 1 || result.Created[0].Name != "a.example.com" || len(result.Errors) != 2 {
+		t.Errorf("expected a created and b and c failed, got %s", result)
+	}
+}
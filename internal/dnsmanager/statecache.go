@@ -0,0 +1,107 @@
+package dnsmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CachedRecord is a record as ipwatcher last wrote or listed it
+type CachedRecord struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied,omitempty"`
+	TTL     int    `json:"ttl,omitempty"` // As configured; 0 is the provider default
+}
+
+// StateCache keeps the IDs and content of managed records per zone on disk, so an IP change can
+// be written without listing the zone first. It is safe for concurrent use and may be shared by
+// providers, since zone IDs do not collide.
+type StateCache struct {
+	mu    sync.Mutex
+	path  string
+	zones map[string]map[string]CachedRecord // zone ID -> record key -> record
+}
+
+// NewStateCache creates a cache persisted to path and loads the records a previous run left in it.
+// An unreadable cache is logged and started empty; the next sync rebuilds it.
+func NewStateCache(path string) (*StateCache, error) {
+	c := &StateCache{path: path, zones: make(map[string]map[string]CachedRecord)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.zones); err != nil {
+		logger().Warn("Ignoring record cache", "path", path, "error", err)
+		c.zones = make(map[string]map[string]CachedRecord)
+	}
+	return c, nil
+}
+
+// Lookup returns the cached records of the zone with the given keys, and false if any is missing
+func (c *StateCache) Lookup(zoneID string, keys []string) (map[string]CachedRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := make(map[string]CachedRecord, len(keys))
+	for _, key := range keys {
+		rec, ok := c.zones[zoneID][key]
+		if !ok {
+			return nil, false
+		}
+		found[key] = rec
+	}
+	return found, true
+}
+
+// Store adds or replaces records of the zone
+func (c *StateCache) Store(zoneID string, records map[string]CachedRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone := c.zones[zoneID]
+	if zone == nil {
+		zone = make(map[string]CachedRecord)
+		c.zones[zoneID] = zone
+	}
+	for key, rec := range records {
+		zone[key] = rec
+	}
+	return c.save()
+}
+
+// Forget drops every record of the zone, so the next update lists it again
+func (c *StateCache) Forget(zoneID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.zones[zoneID]; !ok {
+		return nil
+	}
+	delete(c.zones, zoneID)
+	return c.save()
+}
+
+func (c *StateCache) save() error {
+	data, err := json.Marshal(c.zones)
+	if err != nil {
+		return fmt.Errorf("failed to encode record cache: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write record cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write record cache: %w", err)
+	}
+	return nil
+}
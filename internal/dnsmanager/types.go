@@ -1,5 +1,7 @@
 package dnsmanager
 
+import "strings"
+
 type DNSRecordType string
 
 func (r DNSRecordType) String() string {
@@ -7,16 +9,37 @@ func (r DNSRecordType) String() string {
 }
 
 const (
-	ARecord    DNSRecordType = "A"
-	AAAARecord DNSRecordType = "AAAA"
+	ARecord     DNSRecordType = "A"
+	AAAARecord  DNSRecordType = "AAAA"
+	CNAMERecord DNSRecordType = "CNAME"
+	TXTRecord   DNSRecordType = "TXT"
 )
 
 // DNSRecord represents a DNS record configuration
 type DNSRecord struct {
-	Root    string
-	Name    string
-	Type    DNSRecordType
-	Proxied bool
+	Root       string
+	Name       string
+	Type       DNSRecordType
+	Proxied    bool
+	TTL        int    // Seconds; 0 uses the provider default
+	Target     string // Static content of CNAME and TXT records; A and AAAA records publish the current IPs
+	Strict     bool   // Also reconcile an automatic TTL and the managed comment, not only explicit settings
+	PurgeCache bool   // Purge the provider's cache of the host after changing the record
+	NoCreate   bool   // Update the record if it exists, but do not create it
+}
+
+// FQDN returns the fully qualified record name without a trailing dot.
+// Name may be relative to Root, "@" for Root itself, or already fully qualified.
+func (r DNSRecord) FQDN() string {
+	root := strings.TrimSuffix(r.Root, ".")
+	name := strings.TrimSuffix(r.Name, ".")
+	if name == "@" || strings.EqualFold(name, root) {
+		return root
+	}
+	if len(name) > len(root) && strings.EqualFold(name[len(name)-len(root)-1:], "."+root) {
+		return name[:len(name)-len(root)] + root
+	}
+	return name + "." + root
 }
 
 // Domain represents a domain with its DNS records
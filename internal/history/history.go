@@ -0,0 +1,232 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status is the overall outcome of a transaction
+type Status string
+
+const (
+	StatusApplied    Status = "applied"     // Every zone was updated
+	StatusPartial    Status = "partial"     // Some zones failed and nothing was rolled back
+	StatusFailed     Status = "failed"      // No zone could be updated
+	StatusRolledBack Status = "rolled_back" // Some zones failed and the applied ones were reverted
+)
+
+// ZoneResult records the outcome of a transaction for one zone on one provider
+type ZoneResult struct {
+	Zone       string `json:"zone"`
+	Provider   string `json:"provider"`
+	Error      string `json:"error,omitempty"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+}
+
+// Transaction groups every record update caused by a single IP change
+type Transaction struct {
+	ID         uint64       `json:"id"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	OldIPv4    string       `json:"old_ipv4,omitempty"`
+	NewIPv4    string       `json:"new_ipv4,omitempty"`
+	OldIPv6    string       `json:"old_ipv6,omitempty"`
+	NewIPv6    string       `json:"new_ipv6,omitempty"`
+	Status     Status       `json:"status"`
+	Zones      []ZoneResult `json:"zones"`
+	Instance   string       `json:"instance,omitempty"` // owner_id of the instance that made the change
+
+	// FinishedAt according to the NTP-checked clock; unset when the clock was not checked
+	NTPFinishedAt time.Time `json:"ntp_finished_at,omitzero"`
+}
+
+// Failed reports whether any zone of the transaction failed
+func (t *Transaction) Failed() bool {
+	for _, z := range t.Zones {
+		if z.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Finish stamps the transaction and derives its overall status from the zone results
+func (t *Transaction) Finish(now time.Time) {
+	t.FinishedAt = now
+
+	failed, rolledBack := 0, false
+	for _, z := range t.Zones {
+		if z.Error != "" {
+			failed++
+		}
+		if z.RolledBack {
+			rolledBack = true
+		}
+	}
+
+	switch {
+	case failed == 0:
+		t.Status = StatusApplied
+	case failed == len(t.Zones):
+		t.Status = StatusFailed
+	case rolledBack:
+		t.Status = StatusRolledBack
+	default:
+		t.Status = StatusPartial
+	}
+}
+
+// Answer is the address one IP source returned
+type Answer struct {
+	Source string `json:"source"`
+	IP     string `json:"ip"`
+}
+
+// Disagreement records IP sources returning different addresses for the same family
+type Disagreement struct {
+	Time    time.Time `json:"time"`
+	Family  string    `json:"family"` // ipv4 or ipv6
+	Policy  string    `json:"policy"`
+	Answers []Answer  `json:"answers"`
+	Chosen  string    `json:"chosen,omitempty"` // Empty when the current address was kept
+}
+
+// History keeps the most recent transactions and source disagreements in memory
+type History struct {
+	mu            sync.Mutex
+	limit         int
+	nextID        uint64
+	entries       []Transaction
+	disagreements []Disagreement
+}
+
+// New creates a history that retains at most limit transactions
+func New(limit int) *History {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &History{limit: limit}
+}
+
+// Record assigns an ID to the transaction, stores it and returns the stored copy
+func (h *History) Record(tx Transaction) Transaction {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	tx.ID = h.nextID
+	tx.Zones = append([]ZoneResult(nil), tx.Zones...)
+
+	h.entries = append(h.entries, tx)
+	if len(h.entries) > h.limit {
+		h.entries = append([]Transaction(nil), h.entries[len(h.entries)-h.limit:]...)
+	}
+
+	return tx
+}
+
+// List returns the retained transactions, oldest first
+func (h *History) List() []Transaction {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]Transaction, len(h.entries))
+	for i, tx := range h.entries {
+		tx.Zones = append([]ZoneResult(nil), tx.Zones...)
+		out[i] = tx
+	}
+	return out
+}
+
+// RecordDisagreement stores a source disagreement, keeping at most the history limit
+func (h *History) RecordDisagreement(d Disagreement) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d.Answers = append([]Answer(nil), d.Answers...)
+	h.disagreements = append(h.disagreements, d)
+	if len(h.disagreements) > h.limit {
+		h.disagreements = append([]Disagreement(nil), h.disagreements[len(h.disagreements)-h.limit:]...)
+	}
+}
+
+// Disagreements returns the retained source disagreements, oldest first
+func (h *History) Disagreements() []Disagreement {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]Disagreement, len(h.disagreements))
+	for i, d := range h.disagreements {
+		d.Answers = append([]Answer(nil), d.Answers...)
+		out[i] = d
+	}
+	return out
+}
+
+// State is the content of a History together with the addresses last published, as saved
+// to a history file so both survive restarts
+type State struct {
+	IPv4          string         `json:"ipv4,omitempty"`
+	IPv6          string         `json:"ipv6,omitempty"`
+	NextID        uint64         `json:"next_id"` // ID of the latest transaction
+	Transactions  []Transaction  `json:"transactions"`
+	Disagreements []Disagreement `json:"disagreements,omitempty"`
+}
+
+// State returns the retained transactions and disagreements; the addresses are left empty
+func (h *History) State() State {
+	h.mu.Lock()
+	nextID := h.nextID
+	h.mu.Unlock()
+	return State{NextID: nextID, Transactions: h.List(), Disagreements: h.Disagreements()}
+}
+
+// Restore replaces the content of h with s, keeping at most the history limit of each.
+// Transactions recorded afterwards continue the IDs of s.
+func (h *History) Restore(s State) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID = s.NextID
+	h.entries = append([]Transaction(nil), s.Transactions[max(len(s.Transactions)-h.limit, 0):]...)
+	h.disagreements = append([]Disagreement(nil), s.Disagreements[max(len(s.Disagreements)-h.limit, 0):]...)
+	for _, tx := range h.entries {
+		h.nextID = max(h.nextID, tx.ID)
+	}
+}
+
+// ReadFile reads a state saved by WriteFile; a missing file is an empty state
+func ReadFile(path string) (State, error) {
+	var s State
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read history file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse history file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// WriteFile saves s to path, replacing the file atomically
+func WriteFile(path string, s State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
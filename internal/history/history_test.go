@@ -0,0 +1,149 @@
+package history_test
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/history"
+)
+
+func TestTransactionFinish_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    []history.ZoneResult
+		expected history.Status
+	}{
+		{
+			name:     "all zones applied",
+			zones:    []history.ZoneResult{{Zone: "a.com"}, {Zone: "b.com"}},
+			expected: history.StatusApplied,
+		},
+		{
+			name:     "all zones failed",
+			zones:    []history.ZoneResult{{Zone: "a.com", Error: "boom"}, {Zone: "b.com", Error: "boom"}},
+			expected: history.StatusFailed,
+		},
+		{
+			name:     "some zones failed",
+			zones:    []history.ZoneResult{{Zone: "a.com"}, {Zone: "b.com", Error: "boom"}},
+			expected: history.StatusPartial,
+		},
+		{
+			name:     "applied zones rolled back",
+			zones:    []history.ZoneResult{{Zone: "a.com", RolledBack: true}, {Zone: "b.com", Error: "boom"}},
+			expected: history.StatusRolledBack,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := history.Transaction{Zones: tt.zones}
+			now := time.Now()
+			tx.Finish(now)
+			if tx.Status != tt.expected {
+				t.Errorf("expected status %s, got %s", tt.expected, tx.Status)
+			}
+			if !tx.FinishedAt.Equal(now) {
+				t.Errorf("expected FinishedAt to be set")
+			}
+		})
+	}
+}
+
+func TestHistory_RecordAssignsIDsAndTrims(t *testing.T) {
+	h := history.New(2)
+
+	for i := 0; i < 3; i++ {
+		tx := h.Record(history.Transaction{NewIPv4: "203.0.113." + strconv.Itoa(i+1)})
+		if tx.ID != uint64(i+1) {
+			t.Errorf("expected ID %d, got %d", i+1, tx.ID)
+		}
+	}
+
+	list := h.List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 retained transactions, got %d", len(list))
+	}
+	if list[0].ID != 2 || list[1].ID != 3 {
+		t.Errorf("expected the newest transactions to be retained, got IDs %d and %d", list[0].ID, list[1].ID)
+	}
+}
+
+func TestHistory_ListReturnsCopies(t *testing.T) {
+	h := history.New(10)
+	h.Record(history.Transaction{Zones: []history.ZoneResult{{Zone: "a.com"}}})
+
+	list := h.List()
+	list[0].Zones[0].Zone = "changed.com"
+
+	if got := h.List()[0].Zones[0].Zone; got != "a.com" {
+		t.Errorf("expected stored transaction to be unaffected, got %s", got)
+	}
+}
+
+func TestHistory_RecordDisagreementTrims(t *testing.T) {
+	h := history.New(2)
+
+	for i := 0; i < 3; i++ {
+		h.RecordDisagreement(history.Disagreement{
+			Family: "ipv4",
+			Chosen: "203.0.113." + strconv.Itoa(i+1),
+			Answers: []history.Answer{
+				{Source: "https://a.example", IP: "203.0.113." + strconv.Itoa(i+1)},
+				{Source: "https://b.example", IP: "198.51.100.1"},
+			},
+		})
+	}
+
+	list := h.Disagreements()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 retained disagreements, got %d", len(list))
+	}
+	if list[0].Chosen != "203.0.113.2" || list[1].Chosen != "203.0.113.3" {
+		t.Errorf("expected the newest disagreements to be retained, got %s and %s", list[0].Chosen, list[1].Chosen)
+	}
+
+	list[0].Answers[0].IP = "changed"
+	if got := h.Disagreements()[0].Answers[0].IP; got != "203.0.113.2" {
+		t.Errorf("expected stored disagreement to be unaffected, got %s", got)
+	}
+}
+
+func TestHistory_StateRoundTrip(t *testing.T) {
+	h := history.New(2)
+	for i := 0; i < 3; i++ {
+		h.Record(history.Transaction{NewIPv4: "203.0.113." + strconv.Itoa(i)})
+	}
+	h.RecordDisagreement(history.Disagreement{Family: "ipv4", Answers: []history.Answer{{Source: "a", IP: "203.0.113.1"}}})
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	state := h.State()
+	state.IPv4 = "203.0.113.2"
+	if err := history.WriteFile(path, state); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	loaded, err := history.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if loaded.IPv4 != "203.0.113.2" || len(loaded.Transactions) != 2 || len(loaded.Disagreements) != 1 {
+		t.Fatalf("unexpected state %+v", loaded)
+	}
+
+	// A restored history with a smaller limit keeps the newest entries and continues the IDs
+	restored := history.New(1)
+	restored.Restore(loaded)
+	if list := restored.List(); len(list) != 1 || list[0].ID != 3 {
+		t.Fatalf("expected only transaction 3 to be kept, got %+v", list)
+	}
+	if tx := restored.Record(history.Transaction{}); tx.ID != 4 {
+		t.Errorf("expected the next transaction to get ID 4, got %d", tx.ID)
+	}
+
+	if empty, err := history.ReadFile(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(empty.Transactions) != 0 {
+		t.Errorf("expected an empty state for a missing file, got %+v, %v", empty, err)
+	}
+}
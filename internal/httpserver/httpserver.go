@@ -0,0 +1,143 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger returns the default logger with the module attribute of this package, whose log
+// level can be set apart from the rest of ipwatcher
+func logger() *slog.Logger {
+	return slog.Default().With("module", "http")
+}
+
+// shutdownTimeout bounds how long in-flight requests may run after the context is cancelled
+const shutdownTimeout = 5 * time.Second
+
+// ParseAddress splits a listen address into a network and an address for net.Listen.
+//
+//	127.0.0.1:8080, [::1]:8080   TCP on the given address
+//	:8080                        TCP on all IPv4 and IPv6 addresses (dual-stack)
+//	tcp4::8080, tcp6:[::]:8080   TCP restricted to one address family
+//	unix:/run/ipwatcher.sock     Unix domain socket
+func ParseAddress(addr string) (network, address string, err error) {
+	network = "tcp"
+	address = addr
+	for _, prefix := range []string{"unix", "tcp4", "tcp6"} {
+		if rest, ok := strings.CutPrefix(addr, prefix+":"); ok {
+			network, address = prefix, rest
+			break
+		}
+	}
+
+	if network == "unix" {
+		if address == "" {
+			return "", "", fmt.Errorf("unix listen address %q has no socket path", addr)
+		}
+		return network, address, nil
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	return network, address, nil
+}
+
+// Server serves one HTTP handler on any number of TCP and unix socket listeners
+type Server struct {
+	addrs     []string
+	server    *http.Server
+	listeners []net.Listener
+}
+
+// New creates a server for the given listen addresses; see ParseAddress for the format
+func New(handler http.Handler, addrs []string) *Server {
+	return &Server{
+		addrs:  addrs,
+		server: &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second},
+	}
+}
+
+// Listen opens every listener, closing those already opened when one fails
+func (s *Server) Listen() error {
+	for _, addr := range s.addrs {
+		network, address, err := ParseAddress(addr)
+		if err != nil {
+			s.close()
+			return err
+		}
+		if network == "unix" {
+			if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+				s.close()
+				return fmt.Errorf("failed to remove stale HTTP socket: %w", err)
+			}
+		}
+		l, err := net.Listen(network, address)
+		if err != nil {
+			s.close()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		s.listeners = append(s.listeners, l)
+	}
+	return nil
+}
+
+// Addrs returns the addresses the server is listening on
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+// Serve serves requests on all listeners until ctx is cancelled
+func (s *Server) Serve(ctx context.Context) error {
+	if s.listeners == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
+
+	errs := make(chan error, len(s.listeners))
+	var wg sync.WaitGroup
+	for _, l := range s.listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("HTTP server on %s failed: %w", l.Addr(), err)
+			}
+		}()
+		logger().Info("HTTP server listening", "network", l.Addr().Network(), "address", l.Addr().String())
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := s.server.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = fmt.Errorf("failed to shut down HTTP server: %w", shutdownErr)
+	}
+	wg.Wait()
+	return err
+}
+
+func (s *Server) close() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+}
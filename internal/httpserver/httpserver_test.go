@@ -0,0 +1,102 @@
+package httpserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/httpserver"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr        string
+		network     string
+		address     string
+		expectError bool
+	}{
+		{addr: "127.0.0.1:8080", network: "tcp", address: "127.0.0.1:8080"},
+		{addr: "[::1]:8080", network: "tcp", address: "[::1]:8080"},
+		{addr: ":8080", network: "tcp", address: ":8080"},
+		{addr: "tcp4::8080", network: "tcp4", address: ":8080"},
+		{addr: "tcp6:[::]:8080", network: "tcp6", address: "[::]:8080"},
+		{addr: "unix:/run/ipwatcher/http.sock", network: "unix", address: "/run/ipwatcher/http.sock"},
+		{addr: "unix:", expectError: true},
+		{addr: "::1:8080", expectError: true},
+		{addr: "localhost", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			network, address, err := httpserver.ParseAddress(tt.addr)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got nil", tt.addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if network != tt.network || address != tt.address {
+				t.Errorf("Expected %s %s, got %s %s", tt.network, tt.address, network, address)
+			}
+		})
+	}
+}
+
+func TestServer_ServesAllListeners(t *testing.T) {
+	addrs := []string{"127.0.0.1:0", "unix:" + filepath.Join(t.TempDir(), "http.sock")}
+	if l, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		l.Close()
+		addrs = append(addrs, "[::1]:0")
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	server := httpserver.New(handler, addrs)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx) }()
+
+	for _, addr := range server.Addrs() {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, addr.Network(), addr.String())
+			},
+		}}
+		resp, err := client.Get("http://ipwatcher/")
+		if err != nil {
+			t.Fatalf("Request over %s %s failed: %v", addr.Network(), addr, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("Expected body ok over %s, got %q", addr, body)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+}
+
+func TestServer_ListenFailureClosesListeners(t *testing.T) {
+	server := httpserver.New(http.NotFoundHandler(), []string{"127.0.0.1:0", "not-an-address"})
+	if err := server.Listen(); err == nil {
+		t.Fatal("Expected error for invalid address, got nil")
+	}
+	if got := len(server.Addrs()); got != 0 {
+		t.Errorf("Expected no open listeners after failure, got %d", got)
+	}
+}
@@ -0,0 +1,134 @@
+package ipfetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+func init() {
+	Register(TypeHTTP, func(cfg SourceConfig) (Source, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return &HTTPSource{URL: cfg.URL, Header: cfg.Header, Network: cfg.Network, Connect: cfg.Connect}, nil
+	})
+}
+
+// TypeHTTP is the type of echo endpoints, used for sources without a type
+const TypeHTTP = "http"
+
+// UserAgent is sent with every request to an echo endpoint, unless its headers set one; Go's
+// default is sent when empty
+var UserAgent = "ipwatcher"
+
+// HTTPSource is an echo endpoint that returns the caller's public IP as plain text
+type HTTPSource struct {
+	URL    string
+	Header http.Header // Sent with every request, e.g. an API key
+
+	// Network pins the connection to tcp4 or tcp6, so a dual-stack endpoint reports the address of
+	// the family the source is for; any family when empty
+	Network string
+	// Connect is the address dialed instead of the URL's host, as host or host:port; the URL's
+	// host is still sent for TLS and the Host header
+	Connect string
+
+	mu      sync.Mutex
+	base    *http.Client // Client the pinned client was derived from
+	derived *http.Client
+}
+
+// Name implements Source
+func (s *HTTPSource) Name() string {
+	return s.URL
+}
+
+// Fetch implements Source
+func (s *HTTPSource) Fetch(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	for name, values := range s.Header {
+		req.Header[name] = values
+	}
+
+	resp, err := s.client(client).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch IP: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return string(body), nil
+}
+
+// client returns client with its connections pinned to Network and Connect. Clients with a
+// transport other than *http.Transport, such as test doubles, are used as they are.
+func (s *HTTPSource) client(client *http.Client) *http.Client {
+	if s.Network == "" && s.Connect == "" {
+		return client
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.base == client {
+		return s.derived
+	}
+
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return client
+	}
+	// Keep the client's own dialer, e.g. one bound to an interface
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if s.Network != "" {
+			network = s.Network
+		}
+		if s.Connect != "" {
+			addr = connectAddr(s.Connect, addr)
+		}
+		return dial(ctx, network, addr)
+	}
+
+	derived := *client
+	derived.Transport = transport
+	s.base, s.derived = client, &derived
+	return s.derived
+}
+
+// connectAddr returns the address to dial for connect, taking the port from addr when
+// connect has none
+func connectAddr(connect, addr string) string {
+	if _, _, err := net.SplitHostPort(connect); err == nil {
+		return connect
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return connect
+	}
+	return net.JoinHostPort(connect, port)
+}
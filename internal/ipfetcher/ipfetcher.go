@@ -2,11 +2,12 @@ package ipfetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,15 +17,53 @@ const (
 	timeout = 10 * time.Second
 )
 
+// Source disagreement policies
+const (
+	PolicyFirst       = "first"        // Use the first source that answers; later sources are only tried on failure
+	PolicyPreferFirst = "prefer-first" // Ask every source and use the first answer
+	PolicyMajority    = "majority"     // Ask every source and use the address more than half of the answers agree on
+	PolicyHold        = "hold"         // Ask every source and keep the current address while they disagree
+)
+
+// ErrSourcesDisagree is returned when sources disagree and the policy does not pick an address
+var ErrSourcesDisagree = errors.New("IP sources disagree")
+
+// Answer is the address one source returned
+type Answer struct {
+	Source string
+	IP     string
+}
+
+// Disagreement describes sources returning different addresses for the same family
+type Disagreement struct {
+	Family  string // ipv4 or ipv6
+	Policy  string
+	Answers []Answer
+	Chosen  string // Empty when no address was picked
+}
+
 // Fetcher is an interface for fetching public IP addresses
 type Fetcher interface {
 	GetIPv4(ctx context.Context) (string, error)
 	GetIPv6(ctx context.Context) (string, error)
 }
 
+// Source detects the public address of one family. Sources are created by type from the
+// registry, so a detection method can live in a package of its own.
+type Source interface {
+	// Name identifies the source in errors and disagreements, such as its URL
+	Name() string
+	// Fetch returns the address; client is the fetcher's HTTP client, for sources that need one
+	Fetch(ctx context.Context, client *http.Client) (string, error)
+}
+
 // IPFetcher handles fetching public IP addresses
 type IPFetcher struct {
-	client *http.Client
+	client         *http.Client
+	ipv4Sources    []Source
+	ipv6Sources    []Source
+	policy         string
+	onDisagreement func(Disagreement)
 }
 
 // NewIPFetcher creates a new IP fetcher instance
@@ -35,48 +74,155 @@ func NewIPFetcher() *IPFetcher {
 // NewIPFetcherWithClient creates a new IP fetcher with a custom HTTP client.
 // If client is nil, a default client with timeout is used.
 func NewIPFetcherWithClient(client *http.Client) *IPFetcher {
+	return NewIPFetcherWithSources(client, nil, nil)
+}
+
+// NewIPFetcherWithSources creates a new IP fetcher that tries the given sources in order,
+// falling back to the next one on failure. A family without sources uses ipify, over a
+// connection of that family, so a dual-stack host never reports its other address.
+// If client is nil, a default client with timeout is used.
+func NewIPFetcherWithSources(client *http.Client, ipv4, ipv6 []Source) *IPFetcher {
 	if client == nil {
 		client = &http.Client{Timeout: timeout}
 	}
+	if len(ipv4) == 0 {
+		ipv4 = []Source{&HTTPSource{URL: ipv4URL, Network: "tcp4"}}
+	}
+	if len(ipv6) == 0 {
+		ipv6 = []Source{&HTTPSource{URL: ipv6URL, Network: "tcp6"}}
+	}
 
 	return &IPFetcher{
-		client: client,
+		client:      client,
+		ipv4Sources: ipv4,
+		ipv6Sources: ipv6,
+		policy:      PolicyFirst,
 	}
 }
 
+// SetPolicy sets how answers from several sources of the same family are combined.
+// onDisagreement, when not nil, is called whenever the sources return different addresses.
+func (f *IPFetcher) SetPolicy(policy string, onDisagreement func(Disagreement)) {
+	f.policy = policy
+	f.onDisagreement = onDisagreement
+}
+
 // GetIPv4 fetches the public IPv4 address
 func (f *IPFetcher) GetIPv4(ctx context.Context) (string, error) {
-	return f.fetchIP(ctx, ipv4URL)
+	return f.fetch(ctx, "ipv4", f.ipv4Sources)
 }
 
 // GetIPv6 fetches the public IPv6 address
 func (f *IPFetcher) GetIPv6(ctx context.Context) (string, error) {
-	return f.fetchIP(ctx, ipv6URL)
+	return f.fetch(ctx, "ipv6", f.ipv6Sources)
 }
 
-// fetchIP performs the actual HTTP request to fetch IP
-func (f *IPFetcher) fetchIP(ctx context.Context, url string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// fetch resolves the address of one family according to the policy
+func (f *IPFetcher) fetch(ctx context.Context, family string, sources []Source) (string, error) {
+	if f.policy == PolicyFirst || len(sources) == 1 {
+		return f.fetchFirst(ctx, sources)
 	}
 
-	resp, err := f.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch IP: %w", err)
+	answers, err := f.fetchAll(ctx, sources)
+	if len(answers) == 0 {
+		return "", err
+	}
+
+	counts := make(map[string]int)
+	for _, a := range answers {
+		counts[a.IP]++
+	}
+	if len(counts) == 1 {
+		return answers[0].IP, nil
+	}
+
+	d := Disagreement{Family: family, Policy: f.policy, Answers: answers}
+	switch f.policy {
+	case PolicyPreferFirst:
+		d.Chosen = answers[0].IP
+	case PolicyMajority:
+		for _, a := range answers {
+			if counts[a.IP]*2 > len(answers) {
+				d.Chosen = a.IP
+				break
+			}
+		}
+	}
+	if f.onDisagreement != nil {
+		f.onDisagreement(d)
+	}
+
+	if d.Chosen == "" {
+		return "", fmt.Errorf("%w: %s", ErrSourcesDisagree, formatAnswers(answers))
+	}
+	return d.Chosen, nil
+}
+
+// fetchAll asks every source concurrently and returns the successful answers in source order
+func (f *IPFetcher) fetchAll(ctx context.Context, sources []Source) ([]Answer, error) {
+	ips := make([]string, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip, err := f.fetchIP(ctx, src)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", src.Name(), err)
+				return
+			}
+			ips[i] = ip
+		}()
+	}
+	wg.Wait()
+
+	var answers []Answer
+	for i, ip := range ips {
+		if ip != "" {
+			answers = append(answers, Answer{Source: sources[i].Name(), IP: ip})
+		}
+	}
+	return answers, errors.Join(errs...)
+}
+
+func formatAnswers(answers []Answer) string {
+	parts := make([]string, len(answers))
+	for i, a := range answers {
+		parts[i] = a.Source + "=" + a.IP
 	}
-	defer resp.Body.Close()
+	return strings.Join(parts, ", ")
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// fetchFirst returns the IP from the first source that answers successfully
+func (f *IPFetcher) fetchFirst(ctx context.Context, sources []Source) (string, error) {
+	if len(sources) == 1 {
+		return f.fetchIP(ctx, sources[0])
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	var errs []error
+	for _, src := range sources {
+		ip, err := f.fetchIP(ctx, src)
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// fetchIP asks one source for the address and checks that it is one
+func (f *IPFetcher) fetchIP(ctx context.Context, src Source) (string, error) {
+	ip, err := src.Fetch(ctx, f.client)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", err
 	}
 
-	ip := strings.TrimSpace(string(body))
+	ip = strings.TrimSpace(ip)
 	if ip == "" {
 		return "", fmt.Errorf("empty IP address received")
 	}
@@ -2,9 +2,12 @@ package ipfetcher_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -146,3 +149,245 @@ func TestGetIPv4_TransportError(t *testing.T) {
 		t.Fatal("Expected transport error, got nil")
 	}
 }
+
+func TestGetIPv4_CustomSourcesWithHeaders(t *testing.T) {
+	var requested []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		switch req.URL.String() {
+		case "https://primary.example/ip":
+			if got := req.Header.Get("X-API-Key"); got != "secret" {
+				t.Errorf("expected X-API-Key header secret, got %q", got)
+			}
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Body:       io.NopCloser(strings.NewReader("")),
+				Header:     make(http.Header),
+			}, nil
+		case "https://fallback.example/ip":
+			if got := req.Header.Get("X-API-Key"); got != "" {
+				t.Errorf("expected no X-API-Key header on fallback, got %q", got)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("198.51.100.2\n")),
+				Header:     make(http.Header),
+			}, nil
+		}
+		t.Fatalf("unexpected URL: %s", req.URL.String())
+		return nil, nil
+	})}
+
+	header := make(http.Header)
+	header.Set("X-API-Key", "secret")
+	fetcher := ipfetcher.NewIPFetcherWithSources(client, []ipfetcher.Source{
+		&ipfetcher.HTTPSource{URL: "https://primary.example/ip", Header: header},
+		&ipfetcher.HTTPSource{URL: "https://fallback.example/ip"},
+	}, nil)
+
+	ip, err := fetcher.GetIPv4(context.Background())
+	if err != nil {
+		t.Fatalf("GetIPv4 failed: %v", err)
+	}
+	if ip != "198.51.100.2" {
+		t.Fatalf("expected 198.51.100.2, got %s", ip)
+	}
+	if len(requested) != 2 {
+		t.Fatalf("expected 2 requests, got %v", requested)
+	}
+}
+
+func TestGetIPv4_UserAgent(t *testing.T) {
+	defer func(ua string) { ipfetcher.UserAgent = ua }(ipfetcher.UserAgent)
+	ipfetcher.UserAgent = "ipwatcher/v1.2.3"
+
+	var agents []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		agents = append(agents, req.Header.Get("User-Agent"))
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	// A source that sets its own User-Agent keeps it
+	header := make(http.Header)
+	header.Set("User-Agent", "curl/8.0")
+	fetcher := ipfetcher.NewIPFetcherWithSources(client, []ipfetcher.Source{
+		&ipfetcher.HTTPSource{URL: "https://primary.example/ip"},
+		&ipfetcher.HTTPSource{URL: "https://fallback.example/ip", Header: header},
+	}, nil)
+	if _, err := fetcher.GetIPv4(context.Background()); err == nil {
+		t.Fatal("expected every source to fail")
+	}
+	if want := []string{"ipwatcher/v1.2.3", "curl/8.0"}; !slices.Equal(agents, want) {
+		t.Errorf("expected User-Agents %v, got %v", want, agents)
+	}
+}
+
+func TestGetIPv4_AllSourcesFail(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("connection refused")
+	})}
+	fetcher := ipfetcher.NewIPFetcherWithSources(client, []ipfetcher.Source{
+		&ipfetcher.HTTPSource{URL: "https://primary.example/ip"},
+		&ipfetcher.HTTPSource{URL: "https://fallback.example/ip"},
+	}, nil)
+
+	_, err := fetcher.GetIPv4(context.Background())
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	for _, url := range []string{"https://primary.example/ip", "https://fallback.example/ip"} {
+		if !strings.Contains(err.Error(), url) {
+			t.Errorf("expected error to mention %s, got %v", url, err)
+		}
+	}
+}
+
+func TestHTTPSource_NetworkAndConnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "echo.invalid" {
+			t.Errorf("expected Host echo.invalid, got %s", r.Host)
+		}
+		fmt.Fprint(w, "203.0.113.7")
+	}))
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	// The URL's host does not resolve; connect dials the test server instead
+	fetcher := ipfetcher.NewIPFetcherWithSources(nil, []ipfetcher.Source{
+		&ipfetcher.HTTPSource{URL: "http://echo.invalid/ip", Network: "tcp4", Connect: addr},
+	}, nil)
+	ip, err := fetcher.GetIPv4(context.Background())
+	if err != nil {
+		t.Fatalf("GetIPv4 failed: %v", err)
+	}
+	if ip != "203.0.113.7" {
+		t.Errorf("expected 203.0.113.7, got %s", ip)
+	}
+
+	// The test server only listens on IPv4, so pinning to tcp6 must not reach it
+	fetcher = ipfetcher.NewIPFetcherWithSources(nil, []ipfetcher.Source{
+		&ipfetcher.HTTPSource{URL: "http://echo.invalid/ip", Network: "tcp6", Connect: addr},
+	}, nil)
+	if _, err := fetcher.GetIPv4(context.Background()); err == nil {
+		t.Error("expected error for an IPv4 address pinned to tcp6, got nil")
+	}
+}
+
+func TestGetIPv4_DisagreementPolicies(t *testing.T) {
+	answers := map[string]string{
+		"https://a.example/ip": "203.0.113.1",
+		"https://b.example/ip": "203.0.113.2",
+		"https://c.example/ip": "203.0.113.2",
+	}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		ip, ok := answers[req.URL.String()]
+		if !ok {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(ip)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	tests := []struct {
+		name         string
+		policy       string
+		sources      []string
+		expectedIP   string
+		disagreement bool
+		expectError  bool
+	}{
+		{name: "first stops at first answer", policy: ipfetcher.PolicyFirst, sources: []string{"https://a.example/ip", "https://b.example/ip"}, expectedIP: "203.0.113.1"},
+		{name: "prefer-first", policy: ipfetcher.PolicyPreferFirst, sources: []string{"https://a.example/ip", "https://b.example/ip"}, expectedIP: "203.0.113.1", disagreement: true},
+		{name: "majority", policy: ipfetcher.PolicyMajority, sources: []string{"https://a.example/ip", "https://b.example/ip", "https://c.example/ip"}, expectedIP: "203.0.113.2", disagreement: true},
+		{name: "majority tie", policy: ipfetcher.PolicyMajority, sources: []string{"https://a.example/ip", "https://b.example/ip"}, disagreement: true, expectError: true},
+		{name: "hold", policy: ipfetcher.PolicyHold, sources: []string{"https://a.example/ip", "https://b.example/ip"}, disagreement: true, expectError: true},
+		{name: "agreement", policy: ipfetcher.PolicyHold, sources: []string{"https://b.example/ip", "https://c.example/ip"}, expectedIP: "203.0.113.2"},
+		{name: "failed source is ignored", policy: ipfetcher.PolicyHold, sources: []string{"https://down.example/ip", "https://b.example/ip"}, expectedIP: "203.0.113.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []ipfetcher.Source
+			for _, url := range tt.sources {
+				sources = append(sources, &ipfetcher.HTTPSource{URL: url})
+			}
+			fetcher := ipfetcher.NewIPFetcherWithSources(client, sources, nil)
+
+			var reported []ipfetcher.Disagreement
+			fetcher.SetPolicy(tt.policy, func(d ipfetcher.Disagreement) {
+				reported = append(reported, d)
+			})
+
+			ip, err := fetcher.GetIPv4(context.Background())
+			if tt.expectError {
+				if !errors.Is(err, ipfetcher.ErrSourcesDisagree) {
+					t.Errorf("expected ErrSourcesDisagree, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("GetIPv4 failed: %v", err)
+			}
+			if ip != tt.expectedIP {
+				t.Errorf("expected %q, got %q", tt.expectedIP, ip)
+			}
+			if tt.disagreement != (len(reported) == 1) {
+				t.Fatalf("expected disagreement reported: %v, got %v", tt.disagreement, reported)
+			}
+			if tt.disagreement && (reported[0].Family != "ipv4" || reported[0].Chosen != tt.expectedIP) {
+				t.Errorf("unexpected disagreement %+v", reported[0])
+			}
+		})
+	}
+}
+
+// staticSource always answers with the same address
+type staticSource struct{ ip string }
+
+func (s staticSource) Name() string { return "static:" + s.ip }
+
+func (s staticSource) Fetch(ctx context.Context, client *http.Client) (string, error) {
+	return s.ip, nil
+}
+
+func TestRegistry(t *testing.T) {
+	ipfetcher.Register("static", func(cfg ipfetcher.SourceConfig) (ipfetcher.Source, error) {
+		if cfg.Options["ip"] == "" {
+			return nil, fmt.Errorf("option ip is required")
+		}
+		return staticSource{ip: cfg.Options["ip"]}, nil
+	})
+
+	if types := ipfetcher.Types(); !slices.Equal(types, []string{"http", "static"}) {
+		t.Errorf("expected http and static types, got %v", types)
+	}
+
+	src, err := ipfetcher.NewSource("static", ipfetcher.SourceConfig{Options: map[string]string{"ip": "198.51.100.7"}})
+	if err != nil {
+		t.Fatalf("NewSource failed: %v", err)
+	}
+	fetcher := ipfetcher.NewIPFetcherWithSources(nil, []ipfetcher.Source{src}, nil)
+	if ip, err := fetcher.GetIPv4(context.Background()); err != nil || ip != "198.51.100.7" {
+		t.Errorf("expected 198.51.100.7 from the static source, got %q, %v", ip, err)
+	}
+
+	// Sources without a type are echo endpoints
+	if src, err := ipfetcher.NewSource("", ipfetcher.SourceConfig{URL: "https://echo.example/ip"}); err != nil || src.Name() != "https://echo.example/ip" {
+		t.Errorf("expected an http source, got %v, %v", src, err)
+	}
+
+	for name, cfg := range map[string]ipfetcher.SourceConfig{
+		"static":  {},
+		"http":    {},
+		"unknown": {URL: "https://echo.example/ip"},
+	} {
+		if _, err := ipfetcher.NewSource(name, cfg); err == nil {
+			t.Errorf("expected an error for type %s with %+v", name, cfg)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package metadata provides IP sources that read the public address of a cloud VM from its
+// provider's instance metadata service, so no external echo service is needed. Importing it
+// registers the ec2, gce, azure and hetzner source types.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+)
+
+// Source types
+const (
+	TypeEC2     = "ec2"
+	TypeGCE     = "gce"
+	TypeAzure   = "azure"
+	TypeHetzner = "hetzner"
+)
+
+const (
+	ec2Endpoint     = "http://169.254.169.254"
+	gceEndpoint     = "http://metadata.google.internal"
+	azureEndpoint   = "http://169.254.169.254"
+	hetznerEndpoint = "http://169.254.169.254"
+
+	azureAPIVersion = "2021-02-01"
+	ec2TokenTTL     = "300" // Seconds an IMDSv2 session token is valid
+	timeout         = 2 * time.Second
+)
+
+func init() {
+	ipfetcher.Register(TypeEC2, newSource(TypeEC2, map[string]string{
+		"ipv4": "/latest/meta-data/public-ipv4",
+		"ipv6": "/latest/meta-data/ipv6",
+	}, ec2Endpoint))
+	ipfetcher.Register(TypeGCE, newSource(TypeGCE, map[string]string{
+		"ipv4": "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+	}, gceEndpoint))
+	ipfetcher.Register(TypeAzure, newSource(TypeAzure, map[string]string{
+		"ipv4": "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=" + azureAPIVersion + "&format=text",
+		"ipv6": "/metadata/instance/network/interface/0/ipv6/ipAddress/0/publicIpAddress?api-version=" + azureAPIVersion + "&format=text",
+	}, azureEndpoint))
+	ipfetcher.Register(TypeHetzner, newSource(TypeHetzner, map[string]string{
+		"ipv4": "/hetzner/v1/metadata/public-ipv4",
+	}, hetznerEndpoint))
+}
+
+// Source reads the public address of one family from an instance metadata service.
+// It sends its requests directly, without the fetcher's client or any proxy from the
+// environment, since the service only answers on the link-local network.
+type Source struct {
+	kind     string
+	endpoint string
+	path     string
+	client   *http.Client
+}
+
+// newSource returns the factory of a source type; paths maps each supported family to the
+// path of its address, and endpoint is the metadata service unless the config sets url
+func newSource(kind string, paths map[string]string, endpoint string) ipfetcher.Factory {
+	return func(cfg ipfetcher.SourceConfig) (ipfetcher.Source, error) {
+		path, ok := paths[cfg.Family]
+		if !ok {
+			return nil, fmt.Errorf("%s metadata does not provide a public %s address", kind, cfg.Family)
+		}
+		base := endpoint
+		if cfg.URL != "" {
+			base = cfg.URL
+		}
+		return &Source{
+			kind:     kind,
+			endpoint: strings.TrimSuffix(base, "/"),
+			path:     path,
+			client:   &http.Client{Timeout: timeout, Transport: &http.Transport{Proxy: nil}},
+		}, nil
+	}
+}
+
+// Name implements ipfetcher.Source
+func (s *Source) Name() string {
+	return s.kind + " metadata"
+}
+
+// Fetch implements ipfetcher.Source; the fetcher's client is not used
+func (s *Source) Fetch(ctx context.Context, _ *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+s.path, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	switch s.kind {
+	case TypeEC2:
+		token, err := s.ec2Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	case TypeGCE:
+		req.Header.Set("Metadata-Flavor", "Google")
+	case TypeAzure:
+		req.Header.Set("Metadata", "true")
+	}
+
+	body, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	// EC2 lists every IPv6 address of the instance, one per line; the first is the primary one
+	ip, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	return ip, nil
+}
+
+// ec2Token requests an IMDSv2 session token, which EC2 requires on instances that disable IMDSv1
+func (s *Source) ec2Token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", ec2TokenTTL)
+
+	token, err := s.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get metadata token: %w", err)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func (s *Source) do(req *http.Request) (string, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A 404 means the instance has no public address of the family
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return string(body), nil
+}
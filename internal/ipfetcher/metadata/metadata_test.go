@@ -0,0 +1,96 @@
+package metadata_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+	"github.com/msyrus/ipwatcher/internal/ipfetcher/metadata"
+)
+
+func TestMetadataSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				http.Error(w, "missing TTL", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("ec2-token"))
+		case r.URL.Path == "/latest/meta-data/public-ipv4" && r.Header.Get("X-aws-ec2-metadata-token") == "ec2-token":
+			w.Write([]byte("198.51.100.1"))
+		case r.URL.Path == "/latest/meta-data/ipv6" && r.Header.Get("X-aws-ec2-metadata-token") == "ec2-token":
+			w.Write([]byte("2001:db8::1\n2001:db8::2\n"))
+		case r.URL.Path == "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip" && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Write([]byte("198.51.100.2"))
+		case r.URL.Path == "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress" && r.Header.Get("Metadata") == "true" && r.URL.Query().Get("format") == "text":
+			w.Write([]byte("198.51.100.3"))
+		case r.URL.Path == "/hetzner/v1/metadata/public-ipv4":
+			w.Write([]byte("198.51.100.4\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		kind       string
+		family     string
+		expectedIP string
+	}{
+		{kind: metadata.TypeEC2, family: "ipv4", expectedIP: "198.51.100.1"},
+		{kind: metadata.TypeEC2, family: "ipv6", expectedIP: "2001:db8::1"},
+		{kind: metadata.TypeGCE, family: "ipv4", expectedIP: "198.51.100.2"},
+		{kind: metadata.TypeAzure, family: "ipv4", expectedIP: "198.51.100.3"},
+		{kind: metadata.TypeHetzner, family: "ipv4", expectedIP: "198.51.100.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.family, func(t *testing.T) {
+			src, err := ipfetcher.NewSource(tt.kind, ipfetcher.SourceConfig{Family: tt.family, URL: server.URL})
+			if err != nil {
+				t.Fatalf("NewSource failed: %v", err)
+			}
+			var fetcher *ipfetcher.IPFetcher
+			if tt.family == "ipv6" {
+				fetcher = ipfetcher.NewIPFetcherWithSources(nil, nil, []ipfetcher.Source{src})
+			} else {
+				fetcher = ipfetcher.NewIPFetcherWithSources(nil, []ipfetcher.Source{src}, nil)
+			}
+
+			get := fetcher.GetIPv4
+			if tt.family == "ipv6" {
+				get = fetcher.GetIPv6
+			}
+			ip, err := get(context.Background())
+			if err != nil {
+				t.Fatalf("fetch failed: %v", err)
+			}
+			if ip != tt.expectedIP {
+				t.Errorf("expected %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+}
+
+func TestMetadataSources_Errors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// Without a public address the service answers 404
+	src, err := ipfetcher.NewSource(metadata.TypeGCE, ipfetcher.SourceConfig{Family: "ipv4", URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewSource failed: %v", err)
+	}
+	if _, err := src.Fetch(context.Background(), nil); err == nil {
+		t.Error("expected an error for an instance without a public address")
+	}
+
+	for _, kind := range []string{metadata.TypeGCE, metadata.TypeHetzner} {
+		if _, err := ipfetcher.NewSource(kind, ipfetcher.SourceConfig{Family: "ipv6"}); err == nil {
+			t.Errorf("expected %s to reject ipv6", kind)
+		}
+	}
+}
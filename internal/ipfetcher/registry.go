@@ -0,0 +1,71 @@
+package ipfetcher
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SourceConfig is the configuration of one source, as given in ip_sources
+type SourceConfig struct {
+	Family  string // ipv4 or ipv6
+	URL     string
+	Header  http.Header       // Resolved header values
+	Options map[string]string // Settings specific to the source type
+	Network string            // tcp4 or tcp6 to pin connections to one family; any family when empty
+	Connect string            // Address dialed instead of the URL's host, as host or host:port
+}
+
+// Factory creates a source of one type from its configuration
+type Factory func(cfg SourceConfig) (Source, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a source type available by name. Packages implementing a source call it from
+// their init function, so importing the package is all it takes to enable the type in config.
+// It panics when the name is empty or already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("ipfetcher: Register needs a name and a factory")
+	}
+	if _, ok := registry[name]; ok {
+		panic("ipfetcher: source type " + name + " registered twice")
+	}
+	registry[name] = factory
+}
+
+// NewSource creates a source of the named type; an empty name is TypeHTTP
+func NewSource(name string, cfg SourceConfig) (Source, error) {
+	if name == "" {
+		name = TypeHTTP
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q (available: %s)", name, strings.Join(Types(), ", "))
+	}
+	return factory(cfg)
+}
+
+// Types returns the names of the registered source types, sorted
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,160 @@
+// Package jobs keeps a journal of the DNS updates that were started but not confirmed yet, with
+// their attempts and last error, in a file that outlives restarts. It is not a queue that
+// replays them: the jobs record what was attempted, and the daemon retries by syncing the
+// records again from the current IPs, so an update to an address that is no longer current
+// is never sent.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is one update of a set of records in a zone at a provider
+type Job struct {
+	Key         string    `json:"key"` // Identifies the zone, provider and records; a new job with the same key replaces the old one
+	Zone        string    `json:"zone"`
+	Provider    string    `json:"provider"`
+	Records     []string  `json:"records"`
+	IPv4        string    `json:"ipv4,omitempty"`
+	IPv6        string    `json:"ipv6,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	Enqueued    time.Time `json:"enqueued"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// Journal holds the jobs that were started but have not succeeded yet, oldest first.
+// Every change is written to the file before it returns.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewJournal creates a journal persisted to path; jobs left in the file by a previous run are kept
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Begin records an attempt of job before it is applied. When a job with the same key is
+// pending, its attempts and enqueue time carry over, so retries never add a duplicate.
+func (q *Journal) Begin(job Job, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.load()
+	if err != nil {
+		return err
+	}
+
+	job.Enqueued, job.LastAttempt, job.Attempts = now, now, 1
+	for i, p := range pending {
+		if p.Key == job.Key {
+			job.Enqueued = p.Enqueued
+			job.Attempts = p.Attempts + 1
+			job.LastError = p.LastError
+			pending[i] = job
+			return q.save(pending)
+		}
+	}
+	return q.save(append(pending, job))
+}
+
+// Finish records the outcome of the job with key: it leaves the journal when err is nil and
+// stays pending with err as its last error otherwise
+func (q *Journal) Finish(key string, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, loadErr := q.load()
+	if loadErr != nil {
+		return loadErr
+	}
+
+	for i, p := range pending {
+		if p.Key != key {
+			continue
+		}
+		if err == nil {
+			pending = append(pending[:i], pending[i+1:]...)
+		} else {
+			pending[i].LastError = err.Error()
+		}
+		return q.save(pending)
+	}
+	return nil
+}
+
+// Prune drops the jobs not attempted since before, such as those of zones removed from the
+// config while the daemon was down, and returns them
+func (q *Journal) Prune(before time.Time) ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, dropped []Job
+	for _, p := range pending {
+		if p.LastAttempt.Before(before) {
+			dropped = append(dropped, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	if len(dropped) == 0 {
+		return nil, nil
+	}
+	return dropped, q.save(kept)
+}
+
+// Pending returns the pending jobs, oldest first
+func (q *Journal) Pending() ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.load()
+}
+
+func (q *Journal) load() ([]Job, error) {
+	var pending []Job
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job file: %w", err)
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse job file %s: %w", q.path, err)
+	}
+	return pending, nil
+}
+
+func (q *Journal) save(pending []Job) error {
+	if len(pending) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear job file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to encode job file: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package jobs_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/jobs"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	journal := jobs.NewJournal(path)
+	start := time.Now()
+
+	if err := journal.Begin(jobs.Job{Key: "a", Zone: "example.com", IPv4: "198.51.100.1"}, start); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := journal.Begin(jobs.Job{Key: "b", Zone: "example.net"}, start); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := journal.Finish("b", nil); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if err := journal.Finish("a", errors.New("rate limited")); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	// A new journal on the same file picks up where the previous run left off
+	journal = jobs.NewJournal(path)
+	pending, err := journal.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Key != "a" || pending[0].LastError != "rate limited" {
+		t.Fatalf("Expected job a to stay pending with its error, got %+v, %v", pending, err)
+	}
+
+	// Retrying replaces the job instead of adding a duplicate
+	retry := start.Add(time.Minute)
+	if err := journal.Begin(jobs.Job{Key: "a", Zone: "example.com", IPv4: "198.51.100.2"}, retry); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	pending, _ = journal.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 2 || pending[0].IPv4 != "198.51.100.2" || !pending[0].Enqueued.Equal(start) {
+		t.Fatalf("Expected one job on its second attempt with the new address, got %+v", pending)
+	}
+
+	if err := journal.Finish("a", nil); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if pending, _ := journal.Pending(); len(pending) != 0 {
+		t.Errorf("Expected an empty journal, got %+v", pending)
+	}
+}
+
+func TestJournal_Prune(t *testing.T) {
+	journal := jobs.NewJournal(filepath.Join(t.TempDir(), "jobs.json"))
+	start := time.Now()
+
+	_ = journal.Begin(jobs.Job{Key: "removed"}, start.Add(-time.Hour))
+	_ = journal.Begin(jobs.Job{Key: "retried"}, start.Add(-time.Hour))
+	_ = journal.Begin(jobs.Job{Key: "retried"}, start)
+
+	dropped, err := journal.Prune(start)
+	if err != nil || len(dropped) != 1 || dropped[0].Key != "removed" {
+		t.Fatalf("Expected the job not retried since start to be dropped, got %+v, %v", dropped, err)
+	}
+	if pending, _ := journal.Pending(); len(pending) != 1 || pending[0].Key != "retried" {
+		t.Errorf("Expected the retried job to stay pending, got %+v", pending)
+	}
+}
@@ -0,0 +1,86 @@
+package localdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdGuard updates the DNS rewrites of AdGuard Home through its API
+type AdGuard struct {
+	baseURL  string
+	username string
+	password func() (string, error)
+	client   *http.Client
+}
+
+// NewAdGuard creates an AdGuard Home server for the web interface at baseURL, logging in with
+// username and the password returned by password, which is called on every sync. A nil client
+// uses the default client.
+func NewAdGuard(baseURL, username string, password func() (string, error), client *http.Client) *AdGuard {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &AdGuard{baseURL: strings.TrimSuffix(baseURL, "/"), username: username, password: password, client: client}
+}
+
+// rewrite is a DNS rewrite of AdGuard Home
+type rewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// Sync implements Server
+func (a *AdGuard) Sync(ctx context.Context, hosts []Host) error {
+	password, err := a.password()
+	if err != nil {
+		return err
+	}
+
+	var list []rewrite
+	if err := a.do(ctx, http.MethodGet, "/control/rewrite/list", password, nil, &list); err != nil {
+		return fmt.Errorf("failed to list AdGuard Home rewrites: %w", err)
+	}
+	existing := make([]entry, len(list))
+	for i, r := range list {
+		existing[i] = entry{name: r.Domain, ip: r.Answer}
+	}
+
+	add, remove := diff(existing, hosts)
+	for _, e := range remove {
+		if err := a.do(ctx, http.MethodPost, "/control/rewrite/delete", password, rewrite{Domain: e.name, Answer: e.ip}, nil); err != nil {
+			return fmt.Errorf("failed to remove AdGuard Home rewrite %s -> %s: %w", e.name, e.ip, err)
+		}
+	}
+	for _, e := range add {
+		if err := a.do(ctx, http.MethodPost, "/control/rewrite/add", password, rewrite{Domain: e.name, Answer: e.ip}, nil); err != nil {
+			return fmt.Errorf("failed to add AdGuard Home rewrite %s -> %s: %w", e.name, e.ip, err)
+		}
+	}
+	return nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into result when set
+func (a *AdGuard) do(ctx context.Context, method, path, password string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.username != "" || password != "" {
+		req.SetBasicAuth(a.username, password)
+	}
+	return send(a.client, req, result)
+}
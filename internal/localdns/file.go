@@ -0,0 +1,125 @@
+package localdns
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Default files of the file-based servers
+const (
+	DefaultDnsmasqFile = "/etc/dnsmasq.d/ipwatcher.conf"
+	DefaultHostsFile   = "/etc/hosts"
+)
+
+// Markers around the block of a hosts file that ipwatcher manages
+const (
+	hostsBegin = "# BEGIN ipwatcher"
+	hostsEnd   = "# END ipwatcher"
+)
+
+// Dnsmasq writes the hosts as host-record lines to a config file of its own, which must be in a
+// directory dnsmasq reads with conf-dir. dnsmasq reads config files only at startup, so the
+// reload command should restart it.
+type Dnsmasq struct {
+	path   string
+	reload []string
+}
+
+// NewDnsmasq creates a dnsmasq server writing to path, or DefaultDnsmasqFile when empty, and
+// running reload after every change
+func NewDnsmasq(path string, reload []string) *Dnsmasq {
+	if path == "" {
+		path = DefaultDnsmasqFile
+	}
+	return &Dnsmasq{path: path, reload: reload}
+}
+
+// Sync implements Server. The file is owned by ipwatcher, so names no longer published are
+// removed from it.
+func (d *Dnsmasq) Sync(ctx context.Context, hosts []Host) error {
+	var b strings.Builder
+	b.WriteString("# Managed by ipwatcher; changes are overwritten\n")
+	for _, h := range hosts {
+		if h.IPv4 == "" && h.IPv6 == "" {
+			continue
+		}
+		fields := []string{strings.TrimSuffix(h.Name, ".")}
+		for _, ip := range []string{h.IPv4, h.IPv6} {
+			if ip != "" {
+				fields = append(fields, ip)
+			}
+		}
+		fmt.Fprintf(&b, "host-record=%s\n", strings.Join(fields, ","))
+	}
+
+	changed, err := writeFile(d.path, []byte(b.String()))
+	if err != nil || !changed {
+		return err
+	}
+	return reload(ctx, d.reload)
+}
+
+// HostsFile writes the hosts to a block of a hosts file, such as the one dnsmasq answers from
+// or /etc/hosts of a host serving the LAN. Lines outside of the block are kept.
+type HostsFile struct {
+	path   string
+	reload []string
+}
+
+// NewHostsFile creates a hosts file server writing to path, or DefaultHostsFile when empty, and
+// running reload after every change
+func NewHostsFile(path string, reload []string) *HostsFile {
+	if path == "" {
+		path = DefaultHostsFile
+	}
+	return &HostsFile{path: path, reload: reload}
+}
+
+// Sync implements Server. The block is owned by ipwatcher, so names no longer published are
+// removed from it.
+func (f *HostsFile) Sync(ctx context.Context, hosts []Host) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+
+	var block strings.Builder
+	block.WriteString(hostsBegin + "\n")
+	for _, e := range entries(hosts) {
+		fmt.Fprintf(&block, "%s\t%s\n", e.ip, e.name)
+	}
+	block.WriteString(hostsEnd + "\n")
+
+	content, err := replaceBlock(string(data), block.String())
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	changed, err := writeFile(f.path, []byte(content))
+	if err != nil || !changed {
+		return err
+	}
+	return reload(ctx, f.reload)
+}
+
+// replaceBlock returns content with the managed block replaced by block, which is appended when
+// content has none
+func replaceBlock(content, block string) (string, error) {
+	start := strings.Index(content, hostsBegin+"\n")
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + block, nil
+	}
+	end := strings.Index(content[start:], hostsEnd)
+	if end < 0 {
+		return "", fmt.Errorf("%q without %q", hostsBegin, hostsEnd)
+	}
+	end += start + len(hostsEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:start] + block + content[end:], nil
+}
@@ -0,0 +1,160 @@
+// Package localdns keeps a DNS server on the local network in step with the public records, so
+// the managed names resolve to the internal address inside the network and to the public one
+// outside of it.
+//
+// Pi-hole and AdGuard Home are updated through their web APIs. dnsmasq gets a config file of its
+// own, and a hosts file a block between markers that is rewritten as a whole.
+package localdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Host is a name with the internal addresses it should resolve to; an empty family is left out
+type Host struct {
+	Name string
+	IPv4 string
+	IPv6 string
+}
+
+// Server is a local DNS server the hosts are published to
+type Server interface {
+	// Sync makes the names of hosts resolve to exactly their addresses. Entries of other names
+	// are left alone.
+	Sync(ctx context.Context, hosts []Host) error
+}
+
+// entry is one name to address mapping of a server
+type entry struct {
+	name string
+	ip   string
+}
+
+// entries returns the mappings of hosts, with names lower-cased
+func entries(hosts []Host) []entry {
+	var es []entry
+	for _, h := range hosts {
+		name := strings.ToLower(strings.TrimSuffix(h.Name, "."))
+		for _, ip := range []string{h.IPv4, h.IPv6} {
+			if ip != "" {
+				es = append(es, entry{name: name, ip: ip})
+			}
+		}
+	}
+	return es
+}
+
+// diff returns the entries to add and to remove so the names of hosts map to exactly their
+// addresses, given the entries a server has
+func diff(existing []entry, hosts []Host) (add, remove []entry) {
+	want := entries(hosts)
+	managed := make(map[string]bool)
+	for _, e := range want {
+		managed[e.name] = true
+	}
+	for _, e := range existing {
+		if managed[strings.ToLower(e.name)] && !slices.Contains(want, entry{name: strings.ToLower(e.name), ip: e.ip}) {
+			remove = append(remove, e)
+		}
+	}
+	for _, e := range want {
+		if !slices.ContainsFunc(existing, func(x entry) bool { return strings.EqualFold(x.name, e.name) && x.ip == e.ip }) {
+			add = append(add, e)
+		}
+	}
+	return add, remove
+}
+
+// InternalAddresses returns the first IPv4 and IPv6 address of iface that are neither loopback
+// nor link-local. Without iface, the interface of the default route is used; no packets are sent
+// to find it. A family without an address is returned empty; an error means neither was found.
+func InternalAddresses(iface string) (ipv4, ipv6 string, err error) {
+	if iface == "" {
+		ipv4 = routeAddress("udp4", "192.0.2.1:53")
+		ipv6 = routeAddress("udp6", "[2001:db8::1]:53")
+		if ipv4 == "" && ipv6 == "" {
+			return "", "", fmt.Errorf("no default route to find the internal address by")
+		}
+		return ipv4, ipv6, nil
+	}
+
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find interface %s: %w", iface, err)
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the addresses of %s: %w", iface, err)
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !usable(ipnet.IP) {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			if ipv4 == "" {
+				ipv4 = ipnet.IP.String()
+			}
+		} else if ipv6 == "" {
+			ipv6 = ipnet.IP.String()
+		}
+	}
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", fmt.Errorf("interface %s has no usable address", iface)
+	}
+	return ipv4, ipv6, nil
+}
+
+// routeAddress returns the local address the system would send packets to addr from. Connecting
+// a UDP socket only picks the route.
+func routeAddress(network, addr string) string {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || !usable(local.IP) {
+		return ""
+	}
+	return local.IP.String()
+}
+
+func usable(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// writeFile replaces the contents of path with data unless they are the same, and reports
+// whether it did. The file is rewritten in place rather than replaced, since hosts files are
+// often bind-mounted into containers, where they cannot be renamed over.
+func writeFile(path string, data []byte) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err == nil && string(current) == string(data) {
+		return false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// reload runs command, if any, so the server picks up a changed file
+func reload(ctx context.Context, command []string) error {
+	if len(command) == 0 {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("reload command %s failed: %w: %s", command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
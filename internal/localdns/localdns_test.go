@@ -0,0 +1,193 @@
+package localdns_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/localdns"
+)
+
+var hosts = []localdns.Host{
+	{Name: "home.example.com", IPv4: "192.168.1.10", IPv6: "fd00::10"},
+	{Name: "nas.example.com.", IPv4: "192.168.1.10"},
+}
+
+func password(p string) func() (string, error) {
+	return func() (string, error) { return p, nil }
+}
+
+func TestHostsFile_Sync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	original := "127.0.0.1\tlocalhost\n# BEGIN ipwatcher\n192.168.1.9\thome.example.com\n# END ipwatcher\n10.0.0.1\trouter\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := localdns.NewHostsFile(path, nil)
+	if err := f.Sync(context.Background(), hosts); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "127.0.0.1\tlocalhost\n# BEGIN ipwatcher\n192.168.1.10\thome.example.com\nfd00::10\thome.example.com\n192.168.1.10\tnas.example.com\n# END ipwatcher\n10.0.0.1\trouter\n"
+	if string(data) != want {
+		t.Errorf("unexpected hosts file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestHostsFile_SyncAppendsBlockAndReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(dir, "reloaded")
+	f := localdns.NewHostsFile(path, []string{"touch", marker})
+
+	if err := f.Sync(context.Background(), hosts[1:]); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "127.0.0.1 localhost\n# BEGIN ipwatcher\n") {
+		t.Errorf("expected the block to be appended, got:\n%s", data)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("expected the reload command to run after a change")
+	}
+
+	// Unchanged hosts leave the file alone and do not reload
+	os.Remove(marker)
+	if err := f.Sync(context.Background(), hosts[1:]); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected no reload without a change")
+	}
+}
+
+func TestDnsmasq_Sync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipwatcher.conf")
+	if err := localdns.NewDnsmasq(path, nil).Sync(context.Background(), hosts); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"host-record=home.example.com,192.168.1.10,fd00::10\n", "host-record=nas.example.com,192.168.1.10\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestPiHole_Sync(t *testing.T) {
+	var mu sync.Mutex
+	records := []string{"192.168.1.9 home.example.com router.example.com", "10.0.0.5 printer.lan", "192.168.1.10 nas.example.com"}
+	var loggedOut bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/api/auth" {
+			if r.Method == http.MethodDelete {
+				loggedOut = true
+				return
+			}
+			var body struct{ Password string }
+			json.NewDecoder(r.Body).Decode(&body)
+			json.NewEncoder(w).Encode(map[string]any{"session": map[string]any{"valid": body.Password == "secret", "sid": "sid1"}})
+			return
+		}
+		if r.Header.Get("X-FTL-SID") != "sid1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		line, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/config/dns/hosts/"))
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]any{"config": map[string]any{"dns": map[string]any{"hosts": records}}})
+		case http.MethodPut:
+			records = append(records, line)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			records = slices.DeleteFunc(records, func(r string) bool { return r == line })
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := localdns.NewPiHole(server.URL, password("secret"), server.Client())
+	if err := p.Sync(context.Background(), hosts); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	mu.Lock()
+	slices.Sort(records)
+	want := []string{"10.0.0.5 printer.lan", "192.168.1.10 home.example.com", "192.168.1.10 nas.example.com", "192.168.1.9 router.example.com", "fd00::10 home.example.com"}
+	if !slices.Equal(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+	if !loggedOut {
+		t.Error("expected the session to be closed")
+	}
+	mu.Unlock()
+
+	if err := localdns.NewPiHole(server.URL, password("wrong"), server.Client()).Sync(context.Background(), hosts); err == nil {
+		t.Error("expected a rejected password to fail")
+	}
+}
+
+func TestAdGuard_Sync(t *testing.T) {
+	type rewrite struct {
+		Domain string `json:"domain"`
+		Answer string `json:"answer"`
+	}
+	var mu sync.Mutex
+	rewrites := []rewrite{{"home.example.com", "192.168.1.9"}, {"printer.lan", "10.0.0.5"}, {"NAS.example.com", "192.168.1.10"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body rewrite
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/control/rewrite/list":
+			json.NewEncoder(w).Encode(rewrites)
+		case "/control/rewrite/add":
+			rewrites = append(rewrites, body)
+		case "/control/rewrite/delete":
+			rewrites = slices.DeleteFunc(rewrites, func(r rewrite) bool { return r == body })
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := localdns.NewAdGuard(server.URL, "admin", password("secret"), server.Client())
+	if err := a.Sync(context.Background(), hosts); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []rewrite{{"printer.lan", "10.0.0.5"}, {"NAS.example.com", "192.168.1.10"}, {"home.example.com", "192.168.1.10"}, {"home.example.com", "fd00::10"}}
+	if !slices.Equal(rewrites, want) {
+		t.Errorf("rewrites = %v, want %v", rewrites, want)
+	}
+}
@@ -0,0 +1,176 @@
+package localdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PiHole updates the local DNS records of Pi-hole v6 through its API
+type PiHole struct {
+	baseURL  string
+	password func() (string, error)
+	client   *http.Client
+}
+
+// NewPiHole creates a Pi-hole server for the web interface at baseURL, e.g. http://pi.hole.
+// password is called on every sync, so a changed password file is picked up; it may return an
+// empty password when the API needs none. A nil client uses the default client.
+func NewPiHole(baseURL string, password func() (string, error), client *http.Client) *PiHole {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &PiHole{baseURL: strings.TrimSuffix(baseURL, "/"), password: password, client: client}
+}
+
+// Sync implements Server. Entries naming several hosts are rewritten without the managed name
+// when its address changes.
+func (p *PiHole) Sync(ctx context.Context, hosts []Host) error {
+	sid, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	if sid != "" {
+		defer p.logout(sid)
+	}
+
+	var list struct {
+		Config struct {
+			DNS struct {
+				Hosts []string `json:"hosts"`
+			} `json:"dns"`
+		} `json:"config"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/api/config/dns/hosts", sid, nil, &list); err != nil {
+		return fmt.Errorf("failed to list Pi-hole local DNS records: %w", err)
+	}
+
+	// Pi-hole keeps hosts file lines: an address followed by one or more names
+	var existing []entry
+	lines := make(map[entry]string)
+	for _, line := range list.Config.DNS.Hosts {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, name := range fields[1:] {
+			e := entry{name: name, ip: fields[0]}
+			existing = append(existing, e)
+			lines[e] = line
+		}
+	}
+
+	add, remove := diff(existing, hosts)
+	removed := make(map[string][]string) // Line -> names removed from it
+	var order []string
+	for _, e := range remove {
+		line := lines[e]
+		if _, ok := removed[line]; !ok {
+			order = append(order, line)
+		}
+		removed[line] = append(removed[line], e.name)
+	}
+	for _, line := range order {
+		if err := p.do(ctx, http.MethodDelete, "/api/config/dns/hosts/"+url.PathEscape(line), sid, nil, nil); err != nil {
+			return fmt.Errorf("failed to remove Pi-hole local DNS record %q: %w", line, err)
+		}
+		// Keep the other names of the line
+		fields := strings.Fields(line)
+		var rest []string
+		for _, name := range fields[1:] {
+			if !slices.Contains(removed[line], name) {
+				rest = append(rest, name)
+			}
+		}
+		if len(rest) > 0 {
+			kept := fields[0] + " " + strings.Join(rest, " ")
+			if err := p.do(ctx, http.MethodPut, "/api/config/dns/hosts/"+url.PathEscape(kept), sid, nil, nil); err != nil {
+				return fmt.Errorf("failed to restore Pi-hole local DNS record %q: %w", kept, err)
+			}
+		}
+	}
+	for _, e := range add {
+		line := e.ip + " " + e.name
+		if err := p.do(ctx, http.MethodPut, "/api/config/dns/hosts/"+url.PathEscape(line), sid, nil, nil); err != nil {
+			return fmt.Errorf("failed to add Pi-hole local DNS record %q: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// login opens an API session and returns its ID, which is empty when the API has no password
+func (p *PiHole) login(ctx context.Context) (string, error) {
+	password, err := p.password()
+	if err != nil {
+		return "", err
+	}
+	var auth struct {
+		Session struct {
+			Valid bool   `json:"valid"`
+			SID   string `json:"sid"`
+		} `json:"session"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/api/auth", "", map[string]string{"password": password}, &auth); err != nil {
+		return "", fmt.Errorf("failed to log in to Pi-hole: %w", err)
+	}
+	if !auth.Session.Valid {
+		return "", fmt.Errorf("failed to log in to Pi-hole: password rejected")
+	}
+	return auth.Session.SID, nil
+}
+
+// logout ends the session, since Pi-hole only allows a few at a time
+func (p *PiHole) logout(sid string) {
+	_ = p.do(context.Background(), http.MethodDelete, "/api/auth", sid, nil, nil)
+}
+
+// do sends a request with body encoded as JSON and decodes the response into result when set
+func (p *PiHole) do(ctx context.Context, method, path, sid string, body, result any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if sid != "" {
+		req.Header.Set("X-FTL-SID", sid)
+	}
+	return send(p.client, req, result)
+}
+
+// send sends req and decodes the JSON response into result when set. Statuses other than 2xx
+// are errors.
+func send(client *http.Client, req *http.Request, result any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned status %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package lockfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// errWouldBlock is returned by lock when another process holds the lock
+var errWouldBlock = syscall.EWOULDBLOCK
+
+// lock takes an exclusive flock on f without waiting
+func lock(f *os.File) error {
+	return flock(f, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// unlock releases the flock on f
+func unlock(f *os.File) error {
+	return flock(f, syscall.LOCK_UN)
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
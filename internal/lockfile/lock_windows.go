@@ -0,0 +1,26 @@
+package lockfile
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// errWouldBlock is returned by lock when another process holds the lock
+var errWouldBlock = windows.ERROR_LOCK_VIOLATION
+
+// Windows locks keep other processes from reading the locked bytes, so the lock covers a byte
+// past the PID, at 4 GiB
+const lockOffsetHigh = 1
+
+// lock takes an exclusive lock on f without waiting
+func lock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+}
+
+// unlock releases the lock on f
+func unlock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
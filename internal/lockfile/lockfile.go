@@ -0,0 +1,82 @@
+// Package lockfile takes advisory locks on files, so a second instance of the daemon with the same
+// config refuses to start instead of racing the first one over the same records. The operating
+// system releases a lock when its process dies, so a crash never leaves a stale lock behind.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is a lock held on a file until Release
+type Lock struct {
+	f *os.File
+}
+
+// Acquire creates path when needed and locks it without waiting, then writes the PID of this
+// process to it. When another process holds the lock, the error wraps ErrLocked and names the
+// PID that process wrote.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock(f); err != nil {
+		defer f.Close()
+		if !errors.Is(err, errWouldBlock) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if pid := readPID(f); pid != "" {
+			return nil, fmt.Errorf("%s is %w, pid %s", path, ErrLocked, pid)
+		}
+		return nil, fmt.Errorf("%s is %w", path, ErrLocked)
+	}
+
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		unlock(f)
+		f.Close()
+		return nil, fmt.Errorf("failed to write the pid to %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release unlocks the file. The file stays, as removing it could race another process locking it.
+// Releasing a nil lock does nothing.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := unlock(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// readPID returns the PID written to a locked file, or "" when it has none
+func readPID(f *os.File) string {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 32))
+	if err != nil {
+		return ""
+	}
+	pid := strings.TrimSpace(string(data))
+	if _, err := strconv.Atoi(pid); err != nil {
+		return ""
+	}
+	return pid
+}
@@ -0,0 +1,42 @@
+package lockfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/lockfile"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "ipwatcher.lock")
+	lock, err := lockfile.Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("Expected the lock file to hold the pid, got %q, %v", data, err)
+	}
+
+	// A lock is held per open file, so a second Acquire fails even in the same process
+	_, err = lockfile.Acquire(path)
+	if !errors.Is(err, lockfile.ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("Expected the error to name the pid of the holder, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	lock, err = lockfile.Acquire(path)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after Release, got %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,116 @@
+// Package logflood collapses log lines that repeat, such as the same error on every refresh,
+// into one summary line per period.
+package logflood
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler passes a warning or error through the first time it is logged, then counts its
+// repeats for a period and logs them as one line with the count instead. Lines are the same
+// when their level, message and attributes are. Less severe lines are always passed through.
+type Handler struct {
+	next   slog.Handler
+	prefix string // Attributes and groups added to next, part of the key of every line
+	state  *state
+}
+
+// state is shared by a handler and the ones derived from it with WithAttrs and WithGroup
+type state struct {
+	period time.Duration
+	mu     sync.Mutex
+	lines  map[string]*line
+}
+
+// line is a warning or error logged in the current period
+type line struct {
+	handler slog.Handler
+	last    slog.Record // The last repeat, whose attributes the summary carries
+	repeats int
+}
+
+// New returns a handler writing to next, with the repeats of every warning and error counted
+// for period
+func New(next slog.Handler, period time.Duration) *Handler {
+	return &Handler{next: next, state: &state{period: period, lines: make(map[string]*line)}}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.next.Handle(ctx, r)
+	}
+	key := h.key(r)
+	s := h.state
+	s.mu.Lock()
+	if l, ok := s.lines[key]; ok {
+		l.repeats++
+		l.last = r.Clone()
+		s.mu.Unlock()
+		return nil
+	}
+	s.lines[key] = &line{handler: h.next}
+	time.AfterFunc(s.period, func() { s.flush(key) })
+	s.mu.Unlock()
+	return h.next.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.prefix)
+	for _, a := range attrs {
+		writeAttr(&b, a)
+	}
+	return &Handler{next: h.next.WithAttrs(attrs), prefix: b.String(), state: h.state}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), prefix: h.prefix + name + ".", state: h.state}
+}
+
+// key identifies the line of r among the ones logged through the handlers sharing the state
+func (h *Handler) key(r slog.Record) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %q %s", r.Level, r.Message, h.prefix)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, a)
+		return true
+	})
+	return b.String()
+}
+
+func writeAttr(b *strings.Builder, a slog.Attr) {
+	fmt.Fprintf(b, " %s=%q", a.Key, a.Value.Resolve().String())
+}
+
+// flush logs the repeats of the line of key at the end of its period and counts them for
+// another one, or forgets the line when it was not repeated, so it is logged in full again
+func (s *state) flush(key string) {
+	s.mu.Lock()
+	l := s.lines[key]
+	if l.repeats == 0 {
+		delete(s.lines, key)
+		s.mu.Unlock()
+		return
+	}
+	last, repeats := l.last, l.repeats
+	l.repeats = 0
+	time.AfterFunc(s.period, func() { s.flush(key) })
+	s.mu.Unlock()
+
+	summary := slog.NewRecord(time.Now(), last.Level, last.Message, last.PC)
+	last.Attrs(func(a slog.Attr) bool {
+		summary.AddAttrs(a)
+		return true
+	})
+	summary.AddAttrs(slog.Int("repeated", repeats), slog.Duration("period", s.period))
+	l.handler.Handle(context.Background(), summary)
+}
@@ -0,0 +1,93 @@
+package logflood_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/logflood"
+)
+
+// syncBuffer is written by the summaries from a timer goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func newLogger(period time.Duration) (*slog.Logger, *syncBuffer) {
+	out := &syncBuffer{}
+	text := slog.NewTextHandler(out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return slog.New(logflood.New(text, period)), out
+}
+
+func TestHandler_CollapsesRepeats(t *testing.T) {
+	logger, out := newLogger(100 * time.Millisecond)
+	ipLog := logger.With("module", "ip")
+	for range 5 {
+		ipLog.Error("Failed to fetch IP", "family", "ipv4", "error", "timeout")
+	}
+	ipLog.Error("Failed to fetch IP", "family", "ipv6", "error", "timeout")
+	logger.Error("Failed to fetch IP", "family", "ipv4", "error", "timeout") // Without the module
+	for range 2 {
+		ipLog.Info("Current IP", "family", "ipv4", "ip", "203.0.113.10")
+	}
+
+	want := []string{
+		`level=ERROR msg="Failed to fetch IP" module=ip family=ipv4 error=timeout`,
+		`level=ERROR msg="Failed to fetch IP" module=ip family=ipv6 error=timeout`,
+		`level=ERROR msg="Failed to fetch IP" family=ipv4 error=timeout`,
+		`level=INFO msg="Current IP" module=ip family=ipv4 ip=203.0.113.10`,
+		`level=INFO msg="Current IP" module=ip family=ipv4 ip=203.0.113.10`,
+	}
+	if got := out.lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Expected the first of every error and all info lines, got:\n%s", strings.Join(got, "\n"))
+	}
+
+	summary := `level=ERROR msg="Failed to fetch IP" module=ip family=ipv4 error=timeout repeated=4 period=100ms`
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(strings.Join(out.lines(), "\n"), summary) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a summary of the repeats, got:\n%s", strings.Join(out.lines(), "\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(out.lines()); got != len(want)+1 {
+		t.Errorf("Expected one summary for the repeated error only, got:\n%s", strings.Join(out.lines(), "\n"))
+	}
+}
+
+func TestHandler_LogsInFullAfterQuietPeriod(t *testing.T) {
+	logger, out := newLogger(20 * time.Millisecond)
+	logger.Warn("Provider unreachable", "provider", "cloudflare")
+
+	// A period without repeats forgets the line
+	time.Sleep(100 * time.Millisecond)
+	logger.Warn("Provider unreachable", "provider", "cloudflare")
+
+	line := `level=WARN msg="Provider unreachable" provider=cloudflare`
+	if got := out.lines(); len(got) != 2 || got[0] != line || got[1] != line {
+		t.Errorf("Expected the warning in full twice, got:\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,17 @@
+package netbind
+
+import "syscall"
+
+// bindToDevice returns a dialer control function that binds sockets to iface with SO_BINDTODEVICE,
+// which needs CAP_NET_RAW on kernels before 5.7
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}, nil
+}
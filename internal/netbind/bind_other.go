@@ -0,0 +1,13 @@
+//go:build !linux
+
+package netbind
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice reports that binding to an interface needs Linux; use a bind address elsewhere
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, fmt.Errorf("bind interface %s: binding to an interface is only supported on Linux, set bind_address instead", iface)
+}
@@ -0,0 +1,52 @@
+// Package netbind makes outbound connections leave through a chosen network interface or from a
+// chosen local address, for multi-homed hosts whose default route is not the monitored WAN link.
+package netbind
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Dialer returns a dialer whose connections are bound to the interface iface and to the local
+// address localAddr; either may be empty. With localAddr set, only servers of its address family
+// can be reached.
+func Dialer(iface, localAddr string) (*net.Dialer, error) {
+	d := &net.Dialer{}
+	if localAddr != "" {
+		ip := net.ParseIP(localAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid bind address %q", localAddr)
+		}
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if iface != "" {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return nil, fmt.Errorf("bind interface %s: %w", iface, err)
+		}
+		control, err := bindToDevice(iface)
+		if err != nil {
+			return nil, err
+		}
+		d.Control = control
+	}
+	return d, nil
+}
+
+// Transport returns a copy of the default HTTP transport that dials with Dialer, or nil when
+// neither iface nor localAddr is set
+func Transport(iface, localAddr string) (*http.Transport, error) {
+	if iface == "" && localAddr == "" {
+		return nil, nil
+	}
+	d, err := Dialer(iface, localAddr)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = d.DialContext
+	// A proxy from the environment would be reached through the bound interface, but the
+	// requests it forwards would not, so proxies are not used for bound connections
+	t.Proxy = nil
+	return t, nil
+}
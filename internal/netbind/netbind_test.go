@@ -0,0 +1,51 @@
+package netbind_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/msyrus/ipwatcher/internal/netbind"
+)
+
+func TestTransport_Unset(t *testing.T) {
+	transport, err := netbind.Transport("", "")
+	if err != nil {
+		t.Fatalf("Transport failed: %v", err)
+	}
+	if transport != nil {
+		t.Error("Expected no transport without an interface or address")
+	}
+}
+
+func TestTransport_LocalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.RemoteAddr)
+	}))
+	defer server.Close()
+
+	transport, err := netbind.Transport("", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Transport failed: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) == 0 {
+		t.Error("Expected the server to see the client address")
+	}
+}
+
+func TestDialer_Invalid(t *testing.T) {
+	if _, err := netbind.Dialer("", "not-an-ip"); err == nil {
+		t.Error("Expected error for an invalid bind address, got nil")
+	}
+	if _, err := netbind.Dialer("no-such-interface0", ""); err == nil {
+		t.Error("Expected error for an unknown interface, got nil")
+	}
+}
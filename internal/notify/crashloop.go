@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runState is persisted between runs to detect restarts that were not preceded by a clean shutdown
+type runState struct {
+	Running       bool        `json:"running"`        // Set while the daemon runs, cleared on clean shutdown
+	UncleanStarts []time.Time `json:"unclean_starts"` // Starts that followed a run which did not shut down cleanly
+}
+
+// CrashLoop tracks daemon restarts in a state file
+type CrashLoop struct {
+	path     string
+	restarts int
+	window   time.Duration
+}
+
+// NewCrashLoop creates a tracker that reports a crash loop after restarts unclean starts within window
+func NewCrashLoop(path string, restarts int, window time.Duration) *CrashLoop {
+	return &CrashLoop{path: path, restarts: restarts, window: window}
+}
+
+// Started records a start at now and returns the number of unclean starts within the window
+// when it reaches the crash-loop threshold, or 0 otherwise
+func (c *CrashLoop) Started(now time.Time) (int, error) {
+	state, err := c.load()
+	if err != nil {
+		return 0, err
+	}
+
+	var recent []time.Time
+	for _, t := range state.UncleanStarts {
+		if now.Sub(t) < c.window {
+			recent = append(recent, t)
+		}
+	}
+	if state.Running {
+		recent = append(recent, now)
+	}
+
+	state = runState{Running: true, UncleanStarts: recent}
+	if err := c.save(state); err != nil {
+		return 0, err
+	}
+
+	if len(recent) >= c.restarts {
+		return len(recent), nil
+	}
+	return 0, nil
+}
+
+// Stopped records a clean shutdown
+func (c *CrashLoop) Stopped() error {
+	return c.save(runState{})
+}
+
+func (c *CrashLoop) load() (runState, error) {
+	var state runState
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return runState{}, fmt.Errorf("failed to parse state file %s: %w", c.path, err)
+	}
+	return state, nil
+}
+
+func (c *CrashLoop) save(state runState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Lifecycle events
+const (
+	EventStart     = "start"      // The daemon started
+	EventShutdown  = "shutdown"   // The daemon stopped cleanly
+	EventCrashLoop = "crash_loop" // The daemon keeps being restarted without shutting down cleanly
+	EventSummary   = "summary"    // Scheduled report on the daemon, sent even when nothing happened
+	EventConflict  = "conflict"   // Another instance claims records this one is configured to manage
+)
+
+const timeout = 10 * time.Second
+
+// Notification is a single message about the daemon itself
+type Notification struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Hostname string    `json:"hostname,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Message  string    `json:"message"`
+	Summary  *Summary  `json:"summary,omitempty"` // Set on summary notifications
+}
+
+// Summary reports what the daemon did over a period, so quiet periods still confirm it works
+type Summary struct {
+	Since         time.Time         `json:"since"` // Start of the period: the previous summary or the daemon start
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	IPChanges     int               `json:"ip_changes"`
+	IPv4          string            `json:"ipv4,omitempty"`
+	IPv6          string            `json:"ipv6,omitempty"`
+	Channels      map[string]string `json:"channels,omitempty"` // Channel name -> current address
+	Errors        []ProviderErrors  `json:"errors,omitempty"`   // Providers that failed during the period
+}
+
+// ProviderErrors counts the failed requests to one provider during a summary period
+type ProviderErrors struct {
+	Provider  string `json:"provider"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Webhook posts notifications as JSON to a URL
+type Webhook struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+// NewWebhook creates a webhook notifier that sends header with every request
+func NewWebhook(url string, header http.Header) *Webhook {
+	return NewWebhookWithClient(&http.Client{Timeout: timeout}, url, header)
+}
+
+// NewWebhookWithClient creates a webhook notifier with a custom HTTP client (for testing)
+func NewWebhookWithClient(client *http.Client, url string, header http.Header) *Webhook {
+	return &Webhook{url: url, header: header, client: client}
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range w.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/notify"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	var got notify.Notification
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer secret")
+	webhook := notify.NewWebhook(server.URL, header)
+
+	err := webhook.Notify(context.Background(), notify.Notification{Event: notify.EventStart, Message: "started"})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if got.Event != notify.EventStart || got.Message != "started" {
+		t.Errorf("unexpected notification %+v", got)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("expected Authorization header to be sent, got %q", gotAuth)
+	}
+}
+
+func TestWebhook_NotifyErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	webhook := notify.NewWebhook(server.URL, nil)
+	if err := webhook.Notify(context.Background(), notify.Notification{Event: notify.EventShutdown}); err == nil {
+		t.Fatal("expected error for non-2xx status, got nil")
+	}
+}
+
+func TestCrashLoop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	tracker := notify.NewCrashLoop(path, 3, 10*time.Minute)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A clean run never counts
+	if n, err := tracker.Started(now); err != nil || n != 0 {
+		t.Fatalf("expected no crash loop on first start, got %d, %v", n, err)
+	}
+	if err := tracker.Stopped(); err != nil {
+		t.Fatalf("Stopped failed: %v", err)
+	}
+
+	// Three starts without a clean shutdown in between
+	var n int
+	for i := 0; i < 4; i++ {
+		var err error
+		n, err = tracker.Started(now.Add(time.Duration(i) * time.Minute))
+		if err != nil {
+			t.Fatalf("Started failed: %v", err)
+		}
+		if i < 3 && n != 0 {
+			t.Fatalf("expected no crash loop after %d unclean starts, got %d", i, n)
+		}
+	}
+	if n != 3 {
+		t.Fatalf("expected crash loop after 3 unclean starts, got %d", n)
+	}
+
+	// Unclean starts outside the window are forgotten
+	if n, err := tracker.Started(now.Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected old unclean starts to expire, got %d, %v", n, err)
+	}
+}
+
+// flakyNotifier fails while down is set and records what it delivered
+type flakyNotifier struct {
+	down      bool
+	delivered []string
+}
+
+func (f *flakyNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	if f.down {
+		return errors.New("webhook unreachable")
+	}
+	f.delivered = append(f.delivered, n.Message)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	target := &flakyNotifier{down: true}
+	queue := notify.NewQueue(target, path, time.Hour)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := queue.Notify(ctx, notify.Notification{Time: now.Add(-30 * time.Minute), Message: "stale"}); err == nil {
+		t.Fatal("expected error while the target is down")
+	}
+	if err := queue.Notify(ctx, notify.Notification{Time: now, Message: "first"}); err == nil {
+		t.Fatal("expected error while the target is down")
+	}
+
+	// A new queue on the same file picks up where the previous run left off
+	queue = notify.NewQueue(target, path, 10*time.Minute)
+	if n, err := queue.Pending(); err != nil || n != 2 {
+		t.Fatalf("expected two queued notifications, got %d, %v", n, err)
+	}
+
+	target.down = false
+	if err := queue.Notify(ctx, notify.Notification{Time: now, Message: "second"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(target.delivered) != 2 || target.delivered[0] != "first" || target.delivered[1] != "second" {
+		t.Errorf("expected fresh queued notifications to be delivered in order, got %v", target.delivered)
+	}
+	if n, err := queue.Pending(); err != nil || n != 0 {
+		t.Errorf("expected an empty queue, got %d, %v", n, err)
+	}
+}
+
+// blockingNotifier waits for release or the delivery timeout, and panics on "panic" messages
+type blockingNotifier struct {
+	started   chan struct{}
+	release   chan struct{}
+	mu        sync.Mutex
+	delivered []string
+}
+
+func (b *blockingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	if n.Message == "panic" {
+		panic("broken notifier")
+	}
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.delivered = append(b.delivered, n.Message)
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	target := &blockingNotifier{started: make(chan struct{}, 1), release: make(chan struct{})}
+	var mu sync.Mutex
+	var failed []error
+	pool := notify.NewPool(target, 1, 1, 50*time.Millisecond, func(n notify.Notification, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, err)
+	})
+	ctx := context.Background()
+
+	// The first notification times out in the worker; the caller never waits for it
+	start := time.Now()
+	if err := pool.Notify(ctx, notify.Notification{Message: "slow"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if time.Since(start) > 10*time.Millisecond {
+		t.Error("expected Notify to return without waiting for the delivery")
+	}
+	<-target.started
+	if err := pool.Notify(ctx, notify.Notification{Message: "panic"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if err := pool.Notify(ctx, notify.Notification{Message: "dropped"}); !errors.Is(err, notify.ErrPoolFull) {
+		t.Errorf("expected ErrPoolFull with a busy worker and a full backlog, got %v", err)
+	}
+
+	// A panicking notifier does not stop the worker
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(failed)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the timeout and the panic to be reported, got %d failures", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !errors.Is(failed[0], context.DeadlineExceeded) {
+		t.Errorf("expected the first delivery to time out, got %v", failed[0])
+	}
+
+	close(target.release)
+	if err := pool.Notify(ctx, notify.Notification{Message: "last"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if err := pool.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(target.delivered) != 1 || target.delivered[0] != "last" {
+		t.Errorf("expected Close to wait for the queued notification, got %v", target.delivered)
+	}
+	if err := pool.Notify(ctx, notify.Notification{Message: "late"}); !errors.Is(err, notify.ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed after Close, got %v", err)
+	}
+}
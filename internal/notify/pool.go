@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPoolFull is returned when a notification is dropped because every worker is busy and the backlog is full
+	ErrPoolFull = errors.New("notification backlog is full")
+	// ErrPoolClosed is returned for notifications sent after the pool was closed
+	ErrPoolClosed = errors.New("notification pool is closed")
+)
+
+// Pool is a Notifier that hands notifications to a fixed number of workers, so a slow or hung
+// target never blocks the caller. Every delivery has its own timeout, and a target that panics
+// only loses the notification it was delivering. With more than one worker, notifications may
+// be delivered out of order.
+type Pool struct {
+	target  Notifier
+	timeout time.Duration
+	onError func(Notification, error)
+	jobs    chan Notification
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewPool starts workers that deliver to target, with up to backlog notifications waiting for a
+// free worker. onError, which may be nil, is called with every failed delivery.
+func NewPool(target Notifier, workers, backlog int, timeout time.Duration, onError func(Notification, error)) *Pool {
+	p := &Pool{
+		target:  target,
+		timeout: timeout,
+		onError: onError,
+		jobs:    make(chan Notification, backlog),
+	}
+	for range max(workers, 1) {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Notify implements Notifier. It only queues n for a worker and never waits for the delivery,
+// whose errors go to the pool's error handler.
+func (p *Pool) Notify(ctx context.Context, n Notification) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.jobs <- n:
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// Close stops accepting notifications and waits until the queued ones are delivered or ctx is done
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for n := range p.jobs {
+		if err := p.deliver(n); err != nil && p.onError != nil {
+			p.onError(n, err)
+		}
+	}
+}
+
+func (p *Pool) deliver(n Notification) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("notifier panicked: %v", r)
+		}
+	}()
+	return p.target.Notify(ctx, n)
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Queue is a Notifier that keeps the notifications its target could not deliver in a file,
+// so they survive an outage of the target and restarts of the daemon. Queued notifications
+// are delivered oldest first before any new one; those older than maxAge are dropped.
+type Queue struct {
+	mu     sync.Mutex
+	target Notifier
+	path   string
+	maxAge time.Duration
+}
+
+// NewQueue creates a queue in front of target that persists undelivered notifications to path
+func NewQueue(target Notifier, path string, maxAge time.Duration) *Queue {
+	return &Queue{target: target, path: path, maxAge: maxAge}
+}
+
+// Notify implements Notifier. When the target fails, n and every notification that was
+// not delivered yet stay queued, and the error is returned.
+func (q *Queue) Notify(ctx context.Context, n Notification) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.load()
+	if err != nil {
+		return err
+	}
+	return q.deliver(ctx, append(pending, n))
+}
+
+// Flush delivers the queued notifications
+func (q *Queue) Flush(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.load()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	return q.deliver(ctx, pending)
+}
+
+// Pending returns the number of queued notifications
+func (q *Queue) Pending() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, err := q.load()
+	return len(pending), err
+}
+
+// deliver sends pending in order and queues what is left after the first failure
+func (q *Queue) deliver(ctx context.Context, pending []Notification) error {
+	now := time.Now()
+	var fresh []Notification
+	for _, n := range pending {
+		if q.maxAge <= 0 || now.Sub(n.Time) <= q.maxAge {
+			fresh = append(fresh, n)
+		}
+	}
+
+	for i, n := range fresh {
+		if err := q.target.Notify(ctx, n); err != nil {
+			if saveErr := q.save(fresh[i:]); saveErr != nil {
+				return errors.Join(err, saveErr)
+			}
+			return fmt.Errorf("%w (%d notifications queued)", err, len(fresh)-i)
+		}
+	}
+	return q.save(nil)
+}
+
+func (q *Queue) load() ([]Notification, error) {
+	var pending []Notification
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse notification queue %s: %w", q.path, err)
+	}
+	return pending, nil
+}
+
+func (q *Queue) save(pending []Notification) error {
+	if len(pending) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear notification queue: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification queue: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write notification queue: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to write notification queue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package ntp measures the offset of the system clock against an NTP server with a single SNTP
+// request, so timestamps of DNS changes can be checked and corrected before they are compared
+// with logs kept elsewhere.
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	defaultPort = "123"
+	packetSize  = 48
+	timeout     = 5 * time.Second
+
+	// Seconds from the NTP epoch, 1900-01-01, to the Unix epoch
+	ntpEpochOffset = 2208988800
+)
+
+// Result is the outcome of one clock check
+type Result struct {
+	Server string
+	Time   time.Time     // Local time the answer arrived
+	Offset time.Duration // Server clock minus local clock; add it to local times to correct them
+	RTT    time.Duration // Round trip of the request, excluding the server's processing time
+}
+
+// Query asks server, given as host or host:port, for its time and returns the offset of the
+// local clock. now is the local clock; nil uses time.Now.
+func Query(ctx context.Context, server string, now func() time.Time) (Result, error) {
+	if now == nil {
+		now = time.Now
+	}
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, defaultPort)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("ntp %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, packetSize)
+	req[0] = 0x1B // LI 0, version 3, mode 3 (client)
+	sent := now()
+	binary.BigEndian.PutUint64(req[40:], toNTP(sent))
+	if _, err := conn.Write(req); err != nil {
+		return Result{}, fmt.Errorf("ntp %s: %w", server, err)
+	}
+
+	resp := make([]byte, packetSize)
+	n, err := conn.Read(resp)
+	received := now()
+	if err != nil {
+		return Result{}, fmt.Errorf("ntp %s: %w", server, err)
+	}
+	if n < packetSize {
+		return Result{}, fmt.Errorf("ntp %s: short answer of %d bytes", server, n)
+	}
+	if mode := resp[0] & 0x07; mode != 4 {
+		return Result{}, fmt.Errorf("ntp %s: unexpected mode %d in answer", server, mode)
+	}
+	if resp[1] == 0 {
+		return Result{}, fmt.Errorf("ntp %s: %w", server, ErrKissOfDeath)
+	}
+	if binary.BigEndian.Uint64(resp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return Result{}, fmt.Errorf("ntp %s: answer does not match the request", server)
+	}
+
+	serverReceived := fromNTP(binary.BigEndian.Uint64(resp[32:]))
+	serverSent := fromNTP(binary.BigEndian.Uint64(resp[40:]))
+	return Result{
+		Server: server,
+		Time:   received,
+		Offset: (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2,
+		RTT:    received.Sub(sent) - serverSent.Sub(serverReceived),
+	}, nil
+}
+
+// ErrKissOfDeath is returned when the server asks clients to stop querying it
+var ErrKissOfDeath = errors.New("server sent a kiss-of-death answer")
+
+// toNTP converts t to a 64-bit NTP timestamp
+func toNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// fromNTP converts a 64-bit NTP timestamp to a time
+func fromNTP(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := int64((ts & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nanos)
+}
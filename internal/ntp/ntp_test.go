@@ -0,0 +1,58 @@
+package ntp_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/ntp"
+)
+
+// serveNTP answers one request on a local UDP socket with a clock that is ahead by skew
+func serveNTP(t *testing.T, skew time.Duration, stratum byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		now := uint64(time.Now().Add(skew).Unix()+2208988800) << 32
+		resp := make([]byte, 48)
+		resp[0] = 0x1C // version 3, mode 4 (server)
+		resp[1] = stratum
+		copy(resp[24:32], buf[40:48])
+		binary.BigEndian.PutUint64(resp[32:], now)
+		binary.BigEndian.PutUint64(resp[40:], now)
+		conn.WriteTo(resp, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQuery_Offset(t *testing.T) {
+	server := serveNTP(t, 90*time.Second, 2)
+
+	res, err := ntp.Query(context.Background(), server, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if res.Offset < 88*time.Second || res.Offset > 92*time.Second {
+		t.Errorf("Expected an offset of about 90s, got %v", res.Offset)
+	}
+}
+
+func TestQuery_KissOfDeath(t *testing.T) {
+	server := serveNTP(t, 0, 0)
+
+	if _, err := ntp.Query(context.Background(), server, nil); err == nil {
+		t.Error("Expected error for a kiss-of-death answer, got nil")
+	}
+}
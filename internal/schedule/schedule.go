@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// macros are the shorthand expressions accepted in place of the five fields
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// searchLimit bounds how far ahead Next looks; every valid expression matches within it
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// field is the set of values a cron field matches, one bit per value
+type field uint64
+
+func (f field) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// Schedule is a parsed cron expression with the usual five fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is *, a value, a range a-b, or a list of those, optionally stepped with /n.
+// Day of week runs from 0 (Sunday) to 7 (Sunday again). As in cron, when both day fields are
+// restricted, a day matches if either of them does.
+type Schedule struct {
+	minute, hour, dom, month, dow field
+	domStar, dowStar              bool
+}
+
+// Parse parses a cron expression or one of the macros @yearly, @monthly, @weekly, @daily and @hourly
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+
+	s := &Schedule{domStar: strings.HasPrefix(fields[2], "*"), dowStar: strings.HasPrefix(fields[4], "*")}
+	specs := []struct {
+		dst      *field
+		name     string
+		min, max int
+	}{
+		{&s.minute, "minute", 0, 59},
+		{&s.hour, "hour", 0, 23},
+		{&s.dom, "day of month", 1, 31},
+		{&s.month, "month", 1, 12},
+		{&s.dow, "day of week", 0, 7},
+	}
+	for i, spec := range specs {
+		f, err := parseField(fields[i], spec.min, spec.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s: %w", expr, spec.name, err)
+		}
+		*spec.dst = f
+	}
+	if s.dow.has(7) {
+		s.dow |= 1 // 7 is Sunday too
+	}
+
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return s, nil
+}
+
+// parseField parses a comma-separated list of values, ranges and steps within [min, max]
+func parseField(s string, min, max int) (field, error) {
+	var f field
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(a, min, max); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(b, min, max); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q is reversed", rng)
+			}
+		default:
+			v, err := parseValue(rng, min, max)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !stepped {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+func parseValue(s string, min, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("value %d is outside %d-%d", v, min, max)
+	}
+	return v, nil
+}
+
+// dayMatches reports whether the day of t matches the day-of-month and day-of-week fields
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that matches the schedule, in t's location,
+// or the zero time if there is none
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(searchLimit)
+
+	for t.Before(end) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,66 @@
+// Package sdnotify implements the systemd service notification protocol, so the daemon can run
+// as a Type=notify service that reports when it is ready, what it is doing, and that its loop
+// is still alive to the systemd watchdog.
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeTimeout bounds a notification, which blocks while the queue of the socket is full
+const writeTimeout = time.Second
+
+// Common states, see sd_notify(3)
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns the state setting the status line that systemctl status shows
+func Status(status string) string {
+	return "STATUS=" + strings.ReplaceAll(status, "\n", " ")
+}
+
+// Enabled reports whether the daemon was started by systemd with a notification socket
+func Enabled() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// Notify sends states to the socket in NOTIFY_SOCKET, in a single datagram. It does nothing
+// when the daemon was not started with a notification socket.
+func Notify(states ...string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" || len(states) == 0 {
+		return nil
+	}
+
+	// A leading @ names an abstract socket, which the net package resolves itself
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// WatchdogInterval returns the WatchdogSec of the service when its watchdog expects keepalives
+// from this process, or 0. Keepalives should be sent at half of it at least.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
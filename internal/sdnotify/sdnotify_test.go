@@ -0,0 +1,73 @@
+package sdnotify_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/sdnotify"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets are not supported: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if !sdnotify.Enabled() {
+		t.Fatal("Expected notifications to be enabled with NOTIFY_SOCKET set")
+	}
+	if err := sdnotify.Notify(sdnotify.Ready, sdnotify.Status("IPv4 198.51.100.1\nIPv6 none")); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Expected a notification: %v", err)
+	}
+	if got, want := string(buf[:n]), "READY=1\nSTATUS=IPv4 198.51.100.1 IPv6 none"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sdnotify.Enabled() {
+		t.Error("Expected notifications to be disabled without NOTIFY_SOCKET")
+	}
+	if err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		t.Errorf("Expected no error without NOTIFY_SOCKET, got %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{name: "disabled", want: 0},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "this process", usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 30 * time.Second},
+		{name: "other process", usec: "30000000", pid: "0", want: 0},
+		{name: "invalid", usec: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := sdnotify.WatchdogInterval(); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
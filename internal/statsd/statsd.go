@@ -0,0 +1,149 @@
+// Package statsd sends metrics with the StatsD line protocol over UDP, or with the DogStatsD
+// extension, which adds tags, over UDP or a unix datagram socket.
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// maxPacket keeps every UDP datagram within the payload of a 1500-byte Ethernet frame
+const maxPacket = 1432
+
+// Metric types
+const (
+	Gauge = "g"
+	Count = "c"
+)
+
+// Tag is a label of a metric, sent as a DogStatsD tag or appended to the name in plain StatsD
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Metric is one sample sent to the server
+type Metric struct {
+	Name  string // Joined to the prefix of the client with a dot
+	Type  string // Gauge or Count
+	Value string
+	Tags  []Tag
+}
+
+// Options configures how a client names and tags the metrics
+type Options struct {
+	Prefix    string   // Prepended to every metric name with a dot
+	DogStatsD bool     // Send tags with the DogStatsD extension instead of appending their values to the names
+	Tags      []string // key:value tags added to every DogStatsD metric
+}
+
+// Client sends metrics to a StatsD or DogStatsD server
+type Client struct {
+	network string
+	address string
+	opts    Options
+}
+
+// New returns a client for address, host:port of a UDP server or unix:/path of a DogStatsD
+// socket. The address is resolved again on every Send, so a server that moves is followed.
+func New(address string, opts Options) (*Client, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("statsd address %q has no socket path", address)
+		}
+		return &Client{network: "unixgram", address: path, opts: opts}, nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid statsd address %q: %w", address, err)
+	}
+	return &Client{network: "udp", address: address, opts: opts}, nil
+}
+
+// Send writes metrics to the server, packing as many lines into every datagram as fit
+func (c *Client) Send(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	conn, err := net.Dial(c.network, c.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet []byte
+	for _, m := range metrics {
+		line := c.Line(m)
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacket {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	_, err = conn.Write(packet)
+	return err
+}
+
+// Line formats m as a line of the protocol, e.g. ipwatcher.provider_healthy:1|g|#provider:cloudflare
+// with DogStatsD, or ipwatcher.provider_healthy.cloudflare:1|g without it
+func (c *Client) Line(m Metric) string {
+	var b strings.Builder
+	if c.opts.Prefix != "" {
+		b.WriteString(c.opts.Prefix)
+		b.WriteByte('.')
+	}
+	b.WriteString(sanitizeName(m.Name))
+	if !c.opts.DogStatsD {
+		for _, t := range m.Tags {
+			b.WriteByte('.')
+			b.WriteString(sanitizeName(t.Value))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(m.Value)
+	b.WriteByte('|')
+	b.WriteString(m.Type)
+
+	if !c.opts.DogStatsD || len(m.Tags)+len(c.opts.Tags) == 0 {
+		return b.String()
+	}
+	b.WriteString("|#")
+	for i, t := range m.Tags {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizeTag(t.Key + ":" + t.Value))
+	}
+	for i, t := range c.opts.Tags {
+		if i > 0 || len(m.Tags) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizeTag(t))
+	}
+	return b.String()
+}
+
+// sanitizeName replaces what would split a plain StatsD name, such as the dots of an address,
+// with underscores
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// tagReplacer replaces the separators of the DogStatsD format in tags
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// sanitizeTag makes a key:value tag safe to send. Colons are kept, since tag values like IPv6
+// addresses contain them and DogStatsD splits a tag at its first colon.
+func sanitizeTag(s string) string {
+	return tagReplacer.Replace(s)
+}
@@ -0,0 +1,100 @@
+package statsd_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/statsd"
+)
+
+func TestLine(t *testing.T) {
+	metric := statsd.Metric{
+		Name:  "current_ip_info",
+		Type:  statsd.Gauge,
+		Value: "1",
+		Tags:  []statsd.Tag{{Key: "family", Value: "ipv6"}, {Key: "address", Value: "2001:db8::1"}},
+	}
+	tests := []struct {
+		name string
+		opts statsd.Options
+		want string
+	}{
+		{name: "statsd", opts: statsd.Options{Prefix: "ipwatcher"}, want: "ipwatcher.current_ip_info.ipv6.2001_db8__1:1|g"},
+		{name: "no prefix", want: "current_ip_info.ipv6.2001_db8__1:1|g"},
+		{
+			name: "dogstatsd",
+			opts: statsd.Options{Prefix: "ipwatcher", DogStatsD: true, Tags: []string{"env:prod"}},
+			want: "ipwatcher.current_ip_info:1|g|#family:ipv6,address:2001:db8::1,env:prod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := statsd.New("127.0.0.1:8125", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Line(metric); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLine_DogStatsDWithoutTags(t *testing.T) {
+	c, err := statsd.New("127.0.0.1:8125", statsd.Options{DogStatsD: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Line(statsd.Metric{Name: "panics_total", Type: statsd.Count, Value: "2"}), "panics_total:2|c"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestNew_InvalidAddress(t *testing.T) {
+	for _, addr := range []string{"", "localhost", "unix:"} {
+		if _, err := statsd.New(addr, statsd.Options{}); err == nil {
+			t.Errorf("Expected an error for %q", addr)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c, err := statsd.New(conn.LocalAddr().String(), statsd.Options{Prefix: "ipwatcher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough metrics to need several datagrams
+	var metrics []statsd.Metric
+	for i := range 100 {
+		metrics = append(metrics, statsd.Metric{Name: fmt.Sprintf("metric_%d", i), Type: statsd.Gauge, Value: "1"})
+	}
+	if err := c.Send(metrics); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	var lines []string
+	buf := make([]byte, 65536)
+	for len(lines) < len(metrics) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected %d lines, got %d: %v", len(metrics), len(lines), err)
+		}
+		if n > 1432 {
+			t.Errorf("Expected datagrams of 1432 bytes at most, got %d", n)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if lines[0] != "ipwatcher.metric_0:1|g" || lines[99] != "ipwatcher.metric_99:1|g" {
+		t.Errorf("Expected every metric in order, got %q ... %q", lines[0], lines[99])
+	}
+}
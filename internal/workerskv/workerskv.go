@@ -0,0 +1,76 @@
+// Package workerskv publishes the current public IPs to a Cloudflare Workers KV namespace,
+// so edge Workers can read the origin address without a DNS lookup.
+package workerskv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/kv"
+	"github.com/cloudflare/cloudflare-go/v6/option"
+)
+
+// DefaultKey is the key the IPs are written to unless configured otherwise
+const DefaultKey = "ipwatcher"
+
+// Value is the JSON document written to the key
+type Value struct {
+	IPv4    string    `json:"ipv4,omitempty"`
+	IPv6    string    `json:"ipv6,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Publisher writes the current IPs to one key of a Workers KV namespace
+type Publisher struct {
+	client      *cloudflare.Client
+	accountID   string
+	namespaceID string
+	key         string
+}
+
+// New creates a publisher writing to key in the namespace of the account, using apiToken.
+// An empty baseURL uses the public Cloudflare API, and an empty key DefaultKey.
+func New(apiToken, baseURL, accountID, namespaceID, key string) *Publisher {
+	return NewWithHTTPClient(apiToken, baseURL, accountID, namespaceID, key, nil)
+}
+
+// NewWithHTTPClient creates a publisher like New that sends its requests with httpClient;
+// a nil httpClient uses the default client
+func NewWithHTTPClient(apiToken, baseURL, accountID, namespaceID, key string, httpClient *http.Client) *Publisher {
+	opts := []option.RequestOption{option.WithAPIToken(apiToken)}
+	if httpClient != nil {
+		opts = append(opts, option.WithHTTPClient(httpClient))
+	}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	if key == "" {
+		key = DefaultKey
+	}
+	return &Publisher{
+		client:      cloudflare.NewClient(opts...),
+		accountID:   accountID,
+		namespaceID: namespaceID,
+		key:         key,
+	}
+}
+
+// PublishIP writes the IPs and the time they were detected; a family without an address is left out
+func (p *Publisher) PublishIP(ctx context.Context, ipv4, ipv6 string, at time.Time) error {
+	data, err := json.Marshal(Value{IPv4: ipv4, IPv6: ipv6, Updated: at.UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode KV value: %w", err)
+	}
+	_, err = p.client.KV.Namespaces.Values.Update(ctx, p.namespaceID, p.key, kv.NamespaceValueUpdateParams{
+		AccountID: cloudflare.F(p.accountID),
+		Value:     cloudflare.F(string(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write Workers KV key %s: %w", p.key, err)
+	}
+	return nil
+}
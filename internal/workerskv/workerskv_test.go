@@ -0,0 +1,76 @@
+package workerskv_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/workerskv"
+)
+
+func TestPublisher_PublishIP(t *testing.T) {
+	var path, auth string
+	var value workerskv.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Errorf("Expected a multipart request: %v", err)
+		}
+		form := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := form.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() == "value" {
+				data, _ := io.ReadAll(part)
+				if err := json.Unmarshal(data, &value); err != nil {
+					t.Errorf("Expected a JSON value, got %q: %v", data, err)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success": true, "errors": [], "messages": [], "result": {}}`))
+	}))
+	defer server.Close()
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	publisher := workerskv.New("test-token", server.URL, "account-1", "namespace-1", "")
+	if err := publisher.PublishIP(context.Background(), "198.51.100.1", "2001:db8::1", at); err != nil {
+		t.Fatalf("PublishIP returned error: %v", err)
+	}
+
+	if path != "/accounts/account-1/storage/kv/namespaces/namespace-1/values/ipwatcher" {
+		t.Errorf("Unexpected request path %s", path)
+	}
+	if auth != "Bearer test-token" {
+		t.Errorf("Expected the API token to be sent, got %q", auth)
+	}
+	want := workerskv.Value{IPv4: "198.51.100.1", IPv6: "2001:db8::1", Updated: at}
+	if value != want {
+		t.Errorf("Expected value %+v, got %+v", want, value)
+	}
+}
+
+func TestPublisher_PublishIPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}], "messages": [], "result": null}`))
+	}))
+	defer server.Close()
+
+	publisher := workerskv.New("test-token", server.URL, "account-1", "namespace-1", "origin")
+	if err := publisher.PublishIP(context.Background(), "198.51.100.1", "", time.Now()); err == nil {
+		t.Fatal("Expected an error when the API rejects the write")
+	}
+}
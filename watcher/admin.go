@@ -0,0 +1,211 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+)
+
+// errPaused is returned by a forced sync while the watcher is paused
+var errPaused = errors.New("the watcher is paused; resume it first")
+
+// Pause stops the IP checks and syncs of Run until Resume. It reports false when the
+// watcher was already paused.
+func (w *IPWatcher) Pause() bool {
+	if !w.pausedAt.CompareAndSwap(0, time.Now().UnixNano()) {
+		return false
+	}
+	slog.Info("Paused: IP checks and DNS syncs are skipped until resumed")
+	w.notifySystemdPause()
+	return true
+}
+
+// Resume restarts the IP checks and syncs stopped by Pause. It reports false when the
+// watcher was not paused.
+func (w *IPWatcher) Resume() bool {
+	if w.pausedAt.Swap(0) == 0 {
+		return false
+	}
+	slog.Info("Resumed: IP checks and DNS syncs are running again")
+	w.notifySystemdPause()
+	return true
+}
+
+// isPaused reports whether Pause stopped the IP checks and syncs
+func (w *IPWatcher) isPaused() bool {
+	return w.pausedAt.Load() != 0
+}
+
+// ForceSync asks Run to check the public IPs and verify every record now, without waiting for
+// the next tick, and returns the error of that sync
+func (w *IPWatcher) ForceSync(ctx context.Context) error {
+	if w.isPaused() {
+		return errPaused
+	}
+	reply := make(chan error, 1)
+	select {
+	case w.syncRequests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// syncNow checks the public IPs and verifies every record against the provider, like a
+// refresh followed by a full sync tick
+func (w *IPWatcher) syncNow(ctx context.Context) error {
+	slog.Info("Forced sync: checking IPs and verifying every DNS record")
+	if err := w.CheckAndUpdateIP(ctx); err != nil {
+		return err
+	}
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+	err := joinZoneErrors(w.ensureAllDomains(ctx, ipv4, ipv6, verifyPass))
+	w.publishIPs(ctx)
+	w.syncLocalDNS(ctx, true)
+	w.exportMetrics()
+	return err
+}
+
+// syncOnSignal forces a sync of the current watcher whenever one of syncSignals arrives,
+// until ctx is done
+func syncOnSignal(ctx context.Context, current *atomic.Pointer[IPWatcher]) {
+	if len(syncSignals) == 0 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syncSignals...)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			slog.Info("Received signal, syncing now", "signal", sig.String())
+			if err := current.Load().ForceSync(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to force a sync", "error", err)
+			}
+		}
+	}
+}
+
+// dumpOnSignal logs the state of the current watcher whenever one of dumpSignals arrives,
+// until ctx is done. It runs apart from syncOnSignal, so a dump still works while a sync hangs.
+func dumpOnSignal(ctx context.Context, current *atomic.Pointer[IPWatcher]) {
+	if len(dumpSignals) == 0 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, dumpSignals...)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			slog.Info("Received signal, dumping state", "signal", sig.String())
+			current.Load().logState()
+		}
+	}
+}
+
+// handleControl registers the admin commands of the control socket. reload loads the config
+// again and restarts the daemon with it.
+func (w *IPWatcher) handleControl(server *control.Server, reload func(context.Context) error) {
+	dump := func(ctx context.Context) (any, error) {
+		state, err := w.DebugState(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return redactedJSON(state)
+	}
+	server.Handle("dump", dump)
+	server.Handle("dump-state", dump)
+	server.Handle("status", func(ctx context.Context) (any, error) {
+		return redactedJSON(w.Status())
+	})
+	server.Handle("force-sync", func(ctx context.Context) (any, error) {
+		if err := w.ForceSync(ctx); err != nil {
+			return nil, err
+		}
+		return "Every record is in sync", nil
+	})
+	server.Handle("reload", func(ctx context.Context) (any, error) {
+		if err := reload(ctx); err != nil {
+			return nil, err
+		}
+		return "Config reloaded, restarting the watcher", nil
+	})
+	server.Handle("pause", func(ctx context.Context) (any, error) {
+		if !w.Pause() {
+			return "Already paused", nil
+		}
+		return "Paused", nil
+	})
+	server.Handle("resume", func(ctx context.Context) (any, error) {
+		if !w.Resume() {
+			return "Not paused", nil
+		}
+		return "Resumed", nil
+	})
+}
+
+// controlCommand returns a subcommand that sends command to the control socket of the running
+// daemon and prints its answer
+func controlCommand(name, command string) func(args []string) error {
+	return func(args []string) error {
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		socket := socketFlag(fs)
+		timeout := fs.Duration("timeout", 5*time.Minute, "How long to wait for the daemon to answer")
+		profile := profileFlag(fs)
+		if err := parseCommand(fs, args); err != nil {
+			return err
+		}
+		path, err := controlSocket(*socket, *profile)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		var answer string
+		if err := control.Call(ctx, path, command, &answer); err != nil {
+			return fmt.Errorf("%s failed: %w", name, err)
+		}
+		fmt.Println(answer)
+		return nil
+	}
+}
+
+// socketFlag defines the -socket flag of the commands that talk to the running daemon
+func socketFlag(fs *flag.FlagSet) *string {
+	return fs.String("socket", "", "Control socket path (defaults to control_socket from the config file)")
+}
+
+// controlSocket returns socket, or the control_socket of the config when it is empty
+func controlSocket(socket, profile string) (string, error) {
+	if socket != "" {
+		return socket, nil
+	}
+	cfg, err := loadCommandConfig(profile)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ControlSocket == "" {
+		return "", fmt.Errorf("control_socket is not configured; pass -socket or set it in the config file")
+	}
+	return cfg.ControlSocket, nil
+}
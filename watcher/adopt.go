@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// runAdopt implements `ipwatcher adopt`, which takes over the existing records of every configured
+// name once, so a config with adopt: false can manage them from then on
+func runAdopt(args []string) error {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	watcher, err := newCommandWatcher(ctx, *profile)
+	if err != nil {
+		return err
+	}
+	if watcher.config.ReadOnly {
+		return fmt.Errorf("read_only is set, so records cannot be adopted")
+	}
+	watcher.SetAdopt(true)
+
+	if err := watcher.FetchAndUpdateIPs(ctx); err != nil {
+		return fmt.Errorf("failed to adopt records: %w", err)
+	}
+	fmt.Println("Records adopted")
+	return nil
+}
+
+// SetAdopt overrides the adopt setting of every provider that supports it
+func (w *IPWatcher) SetAdopt(adopt bool) {
+	for _, provider := range w.providers {
+		if adopter, ok := provider.(dnsmanager.Adopter); ok {
+			adopter.SetAdopt(adopt)
+		}
+	}
+}
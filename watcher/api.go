@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/msyrus/ipwatcher/internal/history"
+)
+
+// ChangeHistory is the IP change history served at /history
+type ChangeHistory struct {
+	Transactions  []history.Transaction  `json:"transactions"`  // Oldest first
+	Disagreements []history.Disagreement `json:"disagreements"` // Oldest first
+}
+
+// APIResponse is the answer of the control endpoints of the HTTP API
+type APIResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Paused  bool   `json:"paused"` // Whether the watcher is paused after the request
+}
+
+// handleAPI registers /history, and with api set the endpoints that control the daemon like
+// the commands of the control socket do
+func (w *IPWatcher) handleAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /history", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, ChangeHistory{Transactions: w.History(), Disagreements: w.Disagreements()}, "history")
+	})
+	if w.config.API == nil {
+		return
+	}
+	mux.HandleFunc("POST /sync", w.apiHandler(func(r *http.Request) (string, error) {
+		if err := w.ForceSync(r.Context()); err != nil {
+			return "", err
+		}
+		return "Every record is in sync", nil
+	}))
+	mux.HandleFunc("POST /pause", w.apiHandler(func(r *http.Request) (string, error) {
+		if !w.Pause() {
+			return "Already paused", nil
+		}
+		return "Paused", nil
+	}))
+	mux.HandleFunc("POST /resume", w.apiHandler(func(r *http.Request) (string, error) {
+		if !w.Resume() {
+			return "Not paused", nil
+		}
+		return "Resumed", nil
+	}))
+}
+
+// apiHandler serves run to requests with the api token. A sync of a paused watcher answers
+// 409 Conflict and a failed one 500, with the error.
+func (w *IPWatcher) apiHandler(run func(r *http.Request) (string, error)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !authorized(rw, r, w.config.API.ResolveToken, "api") {
+			return
+		}
+		message, err := run(r)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errPaused) {
+				code = http.StatusConflict
+			}
+			writeJSONStatus(rw, code, APIResponse{Error: err.Error(), Paused: w.isPaused()}, "api response")
+			return
+		}
+		writeJSON(rw, APIResponse{Message: message, Paused: w.isPaused()}, "api response")
+	}
+}
@@ -0,0 +1,22 @@
+package watcher
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/netbind"
+)
+
+// ipFetchTimeout bounds every request to an IP source, like the fetcher's default client
+const ipFetchTimeout = 10 * time.Second
+
+// outboundClient returns an HTTP client bound to bind_interface and bind_address, for requests
+// to IP sources and providers; nil when neither is set, so the default clients are used
+func outboundClient(cfg *config.Config, timeout time.Duration) (*http.Client, error) {
+	transport, err := netbind.Transport(cfg.BindInterface, cfg.BindAddress)
+	if err != nil || transport == nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+)
+
+// ipChannel tracks the address of one configured channel
+type ipChannel struct {
+	name    string
+	family  string // ipv4 or ipv6
+	fetcher ipfetcher.Fetcher
+	current *atomic.Value
+}
+
+// fetch asks the channel's sources for its address
+func (c *ipChannel) fetch(ctx context.Context) (string, error) {
+	if c.family == "ipv6" {
+		return c.fetcher.GetIPv6(ctx)
+	}
+	return c.fetcher.GetIPv4(ctx)
+}
+
+// newSourceFetcher creates an IP fetcher for the given sources, resolving header secrets once.
+// family, when set, overrides the family of every source.
+func newSourceFetcher(sources []config.IPSource, family string, client *http.Client) (*ipfetcher.IPFetcher, error) {
+	var ipv4, ipv6 []ipfetcher.Source
+	for _, src := range sources {
+		header := make(http.Header)
+		for _, h := range src.Headers {
+			value, err := h.Resolve()
+			if err != nil {
+				return nil, fmt.Errorf("ip source %s: %w", sourceName(src), err)
+			}
+			header.Add(h.Name, value)
+		}
+
+		srcFamily := src.Family
+		if family != "" {
+			srcFamily = family
+		}
+		if srcFamily == "" {
+			srcFamily = "ipv4"
+		}
+		source, err := ipfetcher.NewSource(src.Type, ipfetcher.SourceConfig{Family: srcFamily, URL: src.URL, Header: header, Options: src.Options, Network: src.Network, Connect: src.Connect})
+		if err != nil {
+			return nil, fmt.Errorf("ip source %s: %w", sourceName(src), err)
+		}
+		if srcFamily == "ipv6" {
+			ipv6 = append(ipv6, source)
+		} else {
+			ipv4 = append(ipv4, source)
+		}
+	}
+	return ipfetcher.NewIPFetcherWithSources(client, ipv4, ipv6), nil
+}
+
+// sourceName identifies a configured source in errors
+func sourceName(src config.IPSource) string {
+	if src.URL != "" {
+		return src.URL
+	}
+	return src.Type
+}
+
+// checkSourceTypes reports configured sources whose type is not registered
+func checkSourceTypes(cfg *config.Config) error {
+	sources := slices.Clone(cfg.IPSources)
+	for _, ch := range cfg.Channels {
+		sources = append(sources, ch.Sources...)
+	}
+	for _, src := range sources {
+		if src.Type != "" && !slices.Contains(ipfetcher.Types(), src.Type) {
+			return fmt.Errorf("ip source %s: unknown source type %q (available: %s)", sourceName(src), src.Type, strings.Join(ipfetcher.Types(), ", "))
+		}
+	}
+	return nil
+}
+
+// newChannels creates the configured channels, each with its own fetcher
+func (w *IPWatcher) newChannels() error {
+	client, err := outboundClient(w.config, ipFetchTimeout)
+	if err != nil {
+		return err
+	}
+	for _, ch := range w.config.Channels {
+		fetcher, err := newSourceFetcher(ch.Sources, ch.Family, client)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+		policy := ch.Policy
+		if policy == "" {
+			policy = w.config.IPSourcePolicy
+		}
+		if policy != "" {
+			fetcher.SetPolicy(policy, w.recordDisagreement)
+		}
+		w.SetChannelFetcher(ch.Name, fetcher)
+	}
+	return nil
+}
+
+// SetChannelFetcher sets the fetcher that detects the address of a configured channel
+func (w *IPWatcher) SetChannelFetcher(name string, fetcher ipfetcher.Fetcher) {
+	ch, ok := w.config.Channel(name)
+	if !ok {
+		return
+	}
+	w.channels[name] = &ipChannel{name: name, family: ch.Family, fetcher: fetcher, current: &atomic.Value{}}
+}
+
+// refreshChannels fetches the address of every channel and reports whether any of them changed.
+// A channel whose sources fail keeps its last address.
+func (w *IPWatcher) refreshChannels(ctx context.Context) bool {
+	changed := false
+	for _, ch := range w.config.Channels {
+		c, ok := w.channels[ch.Name]
+		if !ok {
+			continue
+		}
+		ip, err := c.fetch(ctx)
+		if err != nil {
+			moduleLogger("ip").Error("Failed to fetch IP of channel", "channel", c.name, "error", err)
+			continue
+		}
+		if old, _ := c.current.Load().(string); ip != old {
+			moduleLogger("ip").Info("IP changed", "channel", c.name, "family", c.family, "old_ip", old, "ip", ip)
+			c.current.Store(ip)
+			w.publishIPChange(c.family, c.name, old, ip)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// channelIPs returns the addresses records on channel are published with: the given
+// default pair without a channel, otherwise the channel's address for its family only
+func (w *IPWatcher) channelIPs(channel, ipv4, ipv6 string) (string, string) {
+	if channel == "" {
+		return ipv4, ipv6
+	}
+	c, ok := w.channels[channel]
+	if !ok {
+		return "", ""
+	}
+	ip, _ := c.current.Load().(string)
+	if c.family == "ipv6" {
+		return "", ip
+	}
+	return ip, ""
+}
+
+// ChannelIPs returns the current address of every channel that has one
+func (w *IPWatcher) ChannelIPs() map[string]string {
+	ips := make(map[string]string)
+	for name, c := range w.channels {
+		if ip, _ := c.current.Load().(string); ip != "" {
+			ips[name] = ip
+		}
+	}
+	return ips
+}
+
+// recordsByChannel groups records by the channel they publish, keeping their order.
+// Records without a channel are under the empty name.
+func recordsByChannel(records []config.Record) ([]string, map[string][]config.Record) {
+	var channels []string
+	groups := make(map[string][]config.Record)
+	for _, r := range records {
+		if _, ok := groups[r.Channel]; !ok {
+			channels = append(channels, r.Channel)
+		}
+		groups[r.Channel] = append(groups[r.Channel], r)
+	}
+	return channels, groups
+}
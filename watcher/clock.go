@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/ntp"
+)
+
+const (
+	defaultNTPServer   = "pool.ntp.org"
+	defaultNTPInterval = time.Hour
+	defaultMaxSkew     = 2 * time.Second
+)
+
+// ClockStatus is the latest check of the system clock against NTP, served in /status
+type ClockStatus struct {
+	Server    string    `json:"server"`
+	CheckedAt time.Time `json:"checked_at"`
+	Offset    float64   `json:"offset_seconds"` // Server clock minus system clock
+	Skewed    bool      `json:"skewed"`         // Offset exceeds ntp.max_skew
+}
+
+// watchClock checks the system clock against ntp.server every ntp.interval until ctx is done
+func (w *IPWatcher) watchClock(ctx context.Context) {
+	interval := w.config.NTP.Interval
+	if interval == 0 {
+		interval = defaultNTPInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.CheckClock(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckClock measures the clock offset once and warns when it exceeds ntp.max_skew
+func (w *IPWatcher) CheckClock(ctx context.Context) {
+	server := w.config.NTP.Server
+	if server == "" {
+		server = defaultNTPServer
+	}
+	maxSkew := w.config.NTP.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = defaultMaxSkew
+	}
+
+	res, err := ntp.Query(ctx, server, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to check the system clock", "error", err)
+		}
+		return
+	}
+	w.clock.Store(&res)
+	if res.Offset.Abs() > maxSkew {
+		slog.Warn("System clock is off; change timestamps are corrected by it", "offset", res.Offset.Round(time.Millisecond), "server", server)
+	}
+}
+
+// ntpTime returns t corrected by the latest measured clock offset; zero when the clock was not checked
+func (w *IPWatcher) ntpTime(t time.Time) time.Time {
+	res := w.clock.Load()
+	if res == nil {
+		return time.Time{}
+	}
+	return t.Add(res.Offset)
+}
+
+// Clock returns the latest clock check, or nil when the clock was not checked
+func (w *IPWatcher) Clock() *ClockStatus {
+	res := w.clock.Load()
+	if res == nil {
+		return nil
+	}
+	maxSkew := defaultMaxSkew
+	if w.config.NTP != nil && w.config.NTP.MaxSkew > 0 {
+		maxSkew = w.config.NTP.MaxSkew
+	}
+	return &ClockStatus{
+		Server:    res.Server,
+		CheckedAt: res.Time,
+		Offset:    res.Offset.Seconds(),
+		Skewed:    res.Offset.Abs() > maxSkew,
+	}
+}
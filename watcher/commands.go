@@ -0,0 +1,156 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// command is a subcommand of ipwatcher
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// exitCode is returned by commands whose exit status tells more than success or failure.
+// err, when set, is logged before exiting.
+type exitCode struct {
+	code int
+	err  error
+}
+
+func (e exitCode) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e exitCode) Unwrap() error {
+	return e.err
+}
+
+// commands are the subcommands of ipwatcher, in the order the usage lists them
+var commands = []command{
+	{name: "run", summary: "Run the daemon; the default without a command", run: runDaemon},
+	{name: "once", summary: "Sync every record once and exit with 0 (no change), 1 (updated) or 2 (error)", run: runOnce},
+	{name: "validate", summary: "Check a config file, optionally against the live providers", run: runValidate},
+	{name: "plan", summary: "List the record changes a sync would make", run: runPlan},
+	{name: "apply", summary: "Make the record changes of a plan", run: runApply},
+	{name: "adopt", summary: "Take ownership of existing records", run: runAdopt},
+	{name: "import", summary: "Print the address records of a Cloudflare zone as config", run: runImport},
+	{name: "state", summary: "Export or import the state files", run: runState},
+	{name: "status", summary: "Print the IPs, zone syncs and next checks of the running daemon", run: runStatus},
+	{name: "health", summary: "Check the liveness or readiness of the running daemon; exits with 1 when it fails", run: runHealth},
+	{name: "sync", summary: "Make the running daemon check its IPs and verify every record now", run: controlCommand("sync", "force-sync")},
+	{name: "reload", summary: "Make the running daemon load its config again", run: controlCommand("reload", "reload")},
+	{name: "pause", summary: "Stop the IP checks and syncs of the running daemon", run: controlCommand("pause", "pause")},
+	{name: "resume", summary: "Restart the IP checks and syncs of a paused daemon", run: controlCommand("resume", "resume")},
+	{name: "service", summary: "Install or uninstall the daemon as a service of the system", run: runServiceCommand},
+	{name: "dump", summary: "Print the internal state of the daemon", run: runDump},
+	{name: "watch", summary: "Follow the events of the running daemon", run: runWatch},
+	{name: "version", summary: "Print the version", run: runVersion},
+}
+
+// globals holds the flags shared by every command. They can be given before the command, and
+// again after it to override them for that command.
+var globals struct {
+	config    string
+	logLevel  string
+	logFormat string
+	logOutput string
+	dryRun    bool
+	profile   string
+}
+
+// addGlobalFlags defines the flags every command accepts, defaulting to their current values
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&globals.config, "config", globals.config, "Config file, directory of config files or https URL (defaults to CONFIG_FILE, or config.yaml)")
+	fs.StringVar(&globals.logLevel, "log-level", globals.logLevel, "Least severe log lines to print: debug, info, warn or error, optionally followed by module=level overrides, e.g. info,dnsmanager=debug (defaults to log_level of the config, or info)")
+	fs.StringVar(&globals.logFormat, "log-format", globals.logFormat, "Format of the log lines: text or json")
+	fs.StringVar(&globals.logOutput, "log-output", globals.logOutput, "Where log lines go: stderr, stdout or a file they are appended to")
+}
+
+// parseCommand parses the flags of a command, including the ones every command accepts
+func parseCommand(fs *flag.FlagSet, args []string) error {
+	addGlobalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return setupLogging(globals.logLevel, globals.logFormat, globals.logOutput)
+}
+
+// outputFlag defines the -output flag, which selects what a command prints on standard output
+func outputFlag(fs *flag.FlagSet, format string) *string {
+	return fs.String("output", format, "Output format: text or json")
+}
+
+// checkOutput returns an error unless format is a value of -output
+func checkOutput(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("-output must be text or json, not %q", format)
+	}
+	return nil
+}
+
+// printJSON prints v as indented JSON on standard output with every secret replaced, for -output json
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, redact.String(string(data)))
+	return err
+}
+
+// findCommand returns the command called name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// usage writes how to call ipwatcher and the commands it has
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: ipwatcher [flags] [command] [command flags]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags:")
+	flag.CommandLine.SetOutput(out)
+	flag.PrintDefaults()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, `Run "ipwatcher <command> -h" for the flags of a command.`)
+}
+
+// runDaemon implements `ipwatcher run`, which runs the daemon until it is interrupted
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", globals.dryRun, "Print planned DNS changes instead of applying them")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("run takes no arguments, got %q", fs.Args())
+	}
+	run := func(ctx context.Context) error {
+		return Execute(ctx, globals.config, *profile, os.Getenv("CLOUDFLARE_API_TOKEN"), *dryRun)
+	}
+	if ok, err := runAsService(run); ok || err != nil {
+		return err
+	}
+	return run(context.Background())
+}
@@ -0,0 +1,94 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// OwnershipConflict is a record this instance is configured to manage but another instance
+// claims with its ownership TXT record
+type OwnershipConflict struct {
+	Zone     string `json:"zone"`
+	Provider string `json:"provider"`
+	dnsmanager.Conflict
+	Since time.Time `json:"since"` // When an update first found the conflict
+}
+
+// SetConflictAlert sets a function called with the ownership conflicts an update found that
+// were not reported before, e.g. to send a notification
+func (w *IPWatcher) SetConflictAlert(alert func([]OwnershipConflict)) {
+	w.conflictAlert = alert
+}
+
+func conflictKey(t zoneTarget, name, recordType string) string {
+	return t.key + "|" + name + "|" + recordType
+}
+
+// trackConflicts records the ownership conflicts err reports for the records of t and alerts
+// on new ones. Conflicts of t not reported again are resolved. Errors from before the records
+// could be compared leave the known conflicts as they are.
+func (w *IPWatcher) trackConflicts(t zoneTarget, err error) {
+	var conflictErr *dnsmanager.ConflictError
+	found := errors.As(err, &conflictErr)
+	if err != nil && !found && !dnsmanager.Refused(err) {
+		return
+	}
+
+	current := make(map[string]dnsmanager.Conflict)
+	if found {
+		for _, c := range conflictErr.Conflicts {
+			current[conflictKey(t, c.Name, c.Type)] = c
+		}
+	}
+
+	var added []OwnershipConflict
+	now := time.Now()
+	for _, r := range t.records {
+		key := conflictKey(t, r.FQDN(), r.Type.String())
+		c, ok := current[key]
+		if !ok {
+			w.conflicts.Delete(key)
+			continue
+		}
+		if _, known := w.conflicts.Load(key); known {
+			continue
+		}
+		conflict := OwnershipConflict{Zone: t.zone, Provider: t.provider, Conflict: c, Since: now}
+		w.conflicts.Store(key, conflict)
+		added = append(added, conflict)
+		moduleLogger("sync").Warn("Ownership conflict: the record is claimed by another instance, so this instance leaves it alone", "record", c.Name, "type", c.Type, "owner", c.Owner)
+	}
+	if len(added) > 0 && w.conflictAlert != nil {
+		w.conflictAlert(added)
+	}
+}
+
+// Conflicts returns the unresolved ownership conflicts, sorted by record
+func (w *IPWatcher) Conflicts() []OwnershipConflict {
+	var conflicts []OwnershipConflict
+	w.conflicts.Range(func(_, v any) bool {
+		conflicts = append(conflicts, v.(OwnershipConflict))
+		return true
+	})
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Name != conflicts[j].Name {
+			return conflicts[i].Name < conflicts[j].Name
+		}
+		return conflicts[i].Type < conflicts[j].Type
+	})
+	return conflicts
+}
+
+// ConflictMessage describes ownership conflicts in one line
+func ConflictMessage(conflicts []OwnershipConflict) string {
+	parts := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		parts[i] = fmt.Sprintf("%s %s (%s) is claimed by %s", c.Name, c.Type, c.Provider, c.Owner)
+	}
+	return "ownership conflict: " + strings.Join(parts, ", ")
+}
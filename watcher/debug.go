@@ -0,0 +1,276 @@
+package watcher
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+	"github.com/msyrus/ipwatcher/internal/jobs"
+)
+
+// defaultDebugInterval is the minimum time between two debug dumps unless debug.interval is set
+const defaultDebugInterval = 10 * time.Second
+
+// errDumpTooSoon is returned by DebugState while the previous dump is more recent than the interval
+var errDumpTooSoon = errors.New("debug dump requested too soon after the previous one")
+
+// FetchResult is the outcome of the latest fetch of the default address of one family
+type FetchResult struct {
+	Family       string    `json:"family"`
+	At           time.Time `json:"at"`
+	IP           string    `json:"ip,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	FailingSince time.Time `json:"failing_since,omitzero"` // First of the failed fetches in a row
+}
+
+// PublishedAddress is an address records publish, as tracked for create_after
+type PublishedAddress struct {
+	Content string    `json:"content"`
+	Since   time.Time `json:"since"`
+}
+
+// DebugState is the internal state of the daemon, dumped for bug reports with secrets redacted
+type DebugState struct {
+	Time      time.Time                   `json:"time"`
+	Version   string                      `json:"version"`
+	Config    map[string]any              `json:"config"`
+	Status    Status                      `json:"status"`
+	Fetches   []FetchResult               `json:"fetches"`
+	ZoneIDs   map[string]string           `json:"zone_ids"` // Cached zone IDs by provider and zone
+	Verified  map[string]string           `json:"verified"` // Content last confirmed per provider and record
+	Published map[string]PublishedAddress `json:"published"`
+	Jobs      []jobs.Job                  `json:"jobs,omitempty"`  // Pending DNS updates of job_queue_file
+	Files     map[string]json.RawMessage  `json:"files,omitempty"` // State files by the setting that names them
+}
+
+// fetchIP fetches the default address of family and keeps the outcome for debug dumps
+func (w *IPWatcher) fetchIP(ctx context.Context, family string) (string, error) {
+	var ip string
+	var err error
+	if family == "ipv6" {
+		ip, err = w.ipFetcher.GetIPv6(ctx)
+	} else {
+		ip, err = w.ipFetcher.GetIPv4(ctx)
+	}
+
+	result := FetchResult{Family: family, At: time.Now(), IP: ip}
+	if err != nil {
+		result.Error = err.Error()
+		result.FailingSince = result.At
+		if prev, ok := w.fetches.Load(family); ok && prev.(FetchResult).Error != "" {
+			result.FailingSince = prev.(FetchResult).FailingSince
+		}
+	}
+	w.fetches.Store(family, result)
+	return ip, err
+}
+
+// DebugState collects the internal state for a debug dump. Dumps are expensive for a daemon
+// that otherwise mostly sleeps, so one is refused while the previous one is more recent than
+// debug.interval.
+func (w *IPWatcher) DebugState(now time.Time) (*DebugState, error) {
+	interval := defaultDebugInterval
+	if w.config.Debug != nil && w.config.Debug.Interval > 0 {
+		interval = w.config.Debug.Interval
+	}
+	last := w.lastDump.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < interval {
+		return nil, errDumpTooSoon
+	}
+	if !w.lastDump.CompareAndSwap(last, now.UnixNano()) {
+		return nil, errDumpTooSoon
+	}
+
+	snapshot, err := w.config.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	state := &DebugState{
+		Time:      now,
+		Version:   version,
+		Config:    snapshot,
+		Status:    w.Status(),
+		ZoneIDs:   make(map[string]string),
+		Verified:  make(map[string]string),
+		Published: make(map[string]PublishedAddress),
+	}
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if v, ok := w.fetches.Load(family); ok {
+			state.Fetches = append(state.Fetches, v.(FetchResult))
+		}
+	}
+	w.zoneCache.Range(func(k, v any) bool {
+		state.ZoneIDs[fmt.Sprint(k)] = fmt.Sprint(v)
+		return true
+	})
+	w.verified.Range(func(k, v any) bool {
+		state.Verified[fmt.Sprint(k)] = fmt.Sprint(v)
+		return true
+	})
+	w.published.Range(func(k, v any) bool {
+		p := v.(publishedAddress)
+		state.Published[fmt.Sprint(k)] = PublishedAddress{Content: p.content, Since: p.since}
+		return true
+	})
+	if w.jobs != nil {
+		if state.Jobs, err = w.jobs.Pending(); err != nil {
+			return nil, fmt.Errorf("failed to read job file: %w", err)
+		}
+	}
+	archive, err := ExportState(w.config, now)
+	if err != nil {
+		return nil, err
+	}
+	state.Files = archive.Files
+	return state, nil
+}
+
+// serveDebugState serves /debug/state to requests with the debug token
+func (w *IPWatcher) serveDebugState(rw http.ResponseWriter, r *http.Request) {
+	if !authorized(rw, r, w.config.Debug.ResolveToken, "debug") {
+		return
+	}
+
+	state, err := w.DebugState(time.Now())
+	if errors.Is(err, errDumpTooSoon) {
+		interval := defaultDebugInterval
+		if w.config.Debug.Interval > 0 {
+			interval = w.config.Debug.Interval
+		}
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(interval.Seconds()))))
+		http.Error(rw, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		moduleLogger("http").Error("Failed to collect debug state", "error", err)
+		http.Error(rw, "failed to collect debug state", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(rw, state, "debug state")
+}
+
+// authorized reports whether r sends the bearer token returned by resolve, and answers it
+// when it does not; what names the token in errors
+func authorized(rw http.ResponseWriter, r *http.Request, resolve func() (string, error), what string) bool {
+	token, err := resolve()
+	if err != nil {
+		moduleLogger("http").Error("Failed to read token", "token", what, "error", err)
+		http.Error(rw, what+" token unavailable", http.StatusInternalServerError)
+		return false
+	}
+	sent, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="ipwatcher"`)
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// runDump implements `ipwatcher dump`, which prints the debug state of a running daemon
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	socket := socketFlag(fs)
+	out := fs.String("out", "", "Write the dump to this file instead of stdout")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+
+	path, err := controlSocket(*socket, *profile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var state json.RawMessage
+	if err := control.Call(ctx, path, "dump", &state); err != nil {
+		return fmt.Errorf("failed to dump daemon state: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0600)
+}
+
+// logState writes the IPs, cached zone IDs, latest sync of every zone and pending retries to
+// the log, one value per line between begin and end markers. It only reads caches, so it works
+// while a sync hangs.
+func (w *IPWatcher) logState() {
+	now := time.Now()
+	lines := []string{"State dump begin"}
+	add := func(format string, args ...any) {
+		lines = append(lines, "  "+fmt.Sprintf(format, args...))
+	}
+
+	status := w.Status()
+	add("ipv4: %s", valueOr(status.IPv4, "none"))
+	add("ipv6: %s", valueOr(status.IPv6, "none"))
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if v, ok := w.fetches.Load(family); ok {
+			f := v.(FetchResult)
+			add("fetch %s: %s at %s", family, valueOr(f.Error, "ok"), f.At.Format(time.RFC3339))
+		}
+	}
+	add("paused: %t", !status.PausedAt.IsZero())
+	add("next check: %s", relativeTime(status.NextCheck, now))
+	add("next sync: %s", relativeTime(status.NextSync, now))
+
+	var zoneIDs []string
+	w.zoneCache.Range(func(k, v any) bool {
+		zoneIDs = append(zoneIDs, fmt.Sprintf("zone id %s: %s", k, v))
+		return true
+	})
+	sort.Strings(zoneIDs)
+	for _, z := range zoneIDs {
+		add("%s", z)
+	}
+	for _, z := range status.Zones {
+		name := z.Zone + " (" + z.Provider + ")"
+		if z.Channel != "" {
+			name += " channel " + z.Channel
+		}
+		if z.OK {
+			add("zone %s: ok %s: %s", name, relativeTime(z.Time, now), z.Result)
+		} else {
+			add("zone %s: failed %s: %s", name, relativeTime(z.Time, now), z.Error)
+		}
+	}
+	for _, f := range status.RecordFailures {
+		add("failing record %s %s (%s): %d failures since %s: %s", f.Name, f.Type, f.Provider, f.Failures, f.Since.Format(time.RFC3339), f.LastError)
+	}
+	if w.jobs != nil {
+		pending, err := w.jobs.Pending()
+		if err != nil {
+			add("pending jobs: %v", err)
+		}
+		for _, j := range pending {
+			add("pending job %s (%s): %d attempts, last %s: %s", j.Zone, j.Provider, j.Attempts, j.LastAttempt.Format(time.RFC3339), valueOr(j.LastError, "no error"))
+		}
+	}
+	lines = append(lines, "State dump end")
+
+	for _, line := range lines {
+		slog.Info(line)
+	}
+}
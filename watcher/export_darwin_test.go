@@ -0,0 +1,7 @@
+package watcher
+
+// Unexported helpers of the launchd service used by the tests in watcher_test
+var (
+	LaunchdPlist = launchdPlist
+	PlistEscape  = plistEscape
+)
@@ -0,0 +1,7 @@
+package watcher
+
+// Unexported helpers of the systemd service used by the tests in watcher_test
+var (
+	SystemdUnitFile = systemdUnitFile
+	SystemdQuote    = systemdQuote
+)
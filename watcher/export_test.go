@@ -0,0 +1,27 @@
+package watcher
+
+import (
+	"flag"
+	"testing"
+)
+
+// Unexported helpers used by the tests in watcher_test
+var (
+	ParseServiceCommand = parseServiceCommand
+	ServiceArgs         = serviceArgs
+)
+
+// SetGlobalFlags sets the flags shared by every command to their defaults and then to args,
+// given like before a command, until the test ends
+func SetGlobalFlags(t testing.TB, args ...string) {
+	saved := globals
+	t.Cleanup(func() { globals = saved })
+	globals.config, globals.logLevel, globals.logFormat, globals.logOutput = "config.yaml", "", "text", "stderr"
+	globals.dryRun, globals.profile = false, ""
+
+	fs := flag.NewFlagSet("ipwatcher", flag.ContinueOnError)
+	addGlobalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// publishedAddress is an address records publish and when the watcher first published it
+type publishedAddress struct {
+	content string
+	since   time.Time
+}
+
+// holdNewRecords returns the records of t, with NoCreate set on those whose create_after grace
+// period has not passed yet: their address must have been published unchanged that long before a
+// missing record is created. Existing records are still updated right away.
+func (w *IPWatcher) holdNewRecords(t zoneTarget, ipv4, ipv6 string, now time.Time) []dnsmanager.DNSRecord {
+	var held []dnsmanager.DNSRecord
+	for i, r := range t.records {
+		grace := w.createAfter(t.zone, r)
+		content := expectedContent(r, ipv4, ipv6)
+		if grace == 0 || content == "" {
+			continue
+		}
+		if now.Sub(w.publishedSince(t.channel, r, content, now)) >= grace {
+			continue
+		}
+		if held == nil {
+			held = append([]dnsmanager.DNSRecord(nil), t.records...)
+		}
+		held[i].NoCreate = true
+	}
+	if held == nil {
+		return t.records
+	}
+	return held
+}
+
+// publishedSince returns when the watcher first published content for records of r's type on channel.
+// A new address restarts the clock, also when it returns to an earlier one.
+func (w *IPWatcher) publishedSince(channel string, r dnsmanager.DNSRecord, content string, now time.Time) time.Time {
+	key := channel + "|" + r.Type.String()
+	if v, ok := w.published.Load(key); ok && v.(publishedAddress).content == content {
+		return v.(publishedAddress).since
+	}
+	w.published.Store(key, publishedAddress{content: content, since: now})
+	return now
+}
+
+// createAfter returns the create_after grace period configured for r in zone, 0 when unset
+func (w *IPWatcher) createAfter(zone string, r dnsmanager.DNSRecord) time.Duration {
+	for _, domain := range w.config.Domains {
+		if domain.ZoneName != zone {
+			continue
+		}
+		for _, record := range domain.Records {
+			if record.Name == r.Name && dnsmanager.DNSRecordType(record.Type) == r.Type {
+				return record.CreateAfter
+			}
+		}
+	}
+	return 0
+}
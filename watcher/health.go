@@ -0,0 +1,213 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// minHealthMaxAge is the least health.max_age defaults to
+const minHealthMaxAge = 5 * time.Minute
+
+// Health is the answer of /healthz and /readyz
+type Health struct {
+	OK     bool          `json:"ok"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is one check of a health endpoint. A check that failed for less than
+// health.max_age still passes, with its error.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// add appends a check, failing the health when it failed
+func (h *Health) add(name string, ok bool, err string) {
+	h.Checks = append(h.Checks, HealthCheck{Name: name, OK: ok, Error: err})
+	h.OK = h.OK && ok
+}
+
+// healthMaxAge returns health.max_age, which defaults to three refresh intervals, and at least
+// minHealthMaxAge
+func (w *IPWatcher) healthMaxAge() time.Duration {
+	if w.config.Health != nil && w.config.Health.MaxAge > 0 {
+		return w.config.Health.MaxAge
+	}
+	return max(3*time.Duration(float64(time.Second)/w.config.RefreshRate), minHealthMaxAge)
+}
+
+// Liveness reports whether the IP checks run and succeed at now: every family that records
+// publish was fetched within health.max_age, and its fetches have not failed for longer. A
+// paused daemon is alive.
+func (w *IPWatcher) Liveness(now time.Time) Health {
+	h := Health{OK: true}
+	if w.isPaused() {
+		h.add("paused", true, "")
+		return h
+	}
+
+	maxAge := w.healthMaxAge()
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if !w.publishesFamily(family) {
+			continue
+		}
+		v, ok := w.fetches.Load(family)
+		if !ok {
+			h.add(family+" fetch", true, "not fetched yet")
+			continue
+		}
+		f := v.(FetchResult)
+		switch {
+		case now.Sub(f.At) > maxAge:
+			h.add(family+" fetch", false, fmt.Sprintf("last fetched %s ago", now.Sub(f.At).Round(time.Second)))
+		case f.Error != "":
+			h.add(family+" fetch", now.Sub(f.FailingSince) <= maxAge, fmt.Sprintf("failing for %s: %s", now.Sub(f.FailingSince).Round(time.Second), f.Error))
+		default:
+			h.add(family+" fetch", true, "")
+		}
+	}
+	return h
+}
+
+// Readiness reports whether the records are in sync at now: the daemon is alive, a refresh or
+// sync succeeded since the start, and no zone has failed to sync for longer than health.max_age
+func (w *IPWatcher) Readiness(now time.Time) Health {
+	h := w.Liveness(now)
+	if w.ready.Load() {
+		h.add("first sync", true, "")
+	} else {
+		h.add("first sync", false, "no refresh or sync succeeded yet")
+	}
+
+	maxAge := w.healthMaxAge()
+	for _, z := range w.ZoneSyncs() {
+		name := fmt.Sprintf("zone %s (%s)", z.Zone, z.Provider)
+		if z.Channel != "" {
+			name += " channel " + z.Channel
+		}
+		if z.OK {
+			h.add(name, true, "")
+		} else {
+			h.add(name, now.Sub(z.FailingSince) <= maxAge, fmt.Sprintf("failing for %s: %s", now.Sub(z.FailingSince).Round(time.Second), z.Error))
+		}
+	}
+	return h
+}
+
+// handleHealth registers /healthz and /readyz, which answer 503 Service Unavailable when a
+// check fails
+func (w *IPWatcher) handleHealth(mux *http.ServeMux) {
+	serve := func(check func(time.Time) Health, what string) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			h := check(time.Now())
+			code := http.StatusOK
+			if !h.OK {
+				code = http.StatusServiceUnavailable
+			}
+			writeJSONStatus(rw, code, h, what)
+		}
+	}
+	mux.HandleFunc("GET /healthz", serve(w.Liveness, "liveness"))
+	mux.HandleFunc("GET /readyz", serve(w.Readiness, "readiness"))
+}
+
+// HealthHandler returns the HTTP handler served on the health.listen addresses
+func (w *IPWatcher) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	w.handleHealth(mux)
+	return mux
+}
+
+// runHealth implements `ipwatcher health`, which checks /healthz, or /readyz with -ready, of the
+// running daemon and exits with 1 when it fails, for container health checks in images without
+// an HTTP client
+func runHealth(args []string) error {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	ready := fs.Bool("ready", false, "Check readiness instead of liveness")
+	url := fs.String("url", "", "Health URL of the daemon (defaults to the first health.listen, or http_listen, address)")
+	timeout := fs.Duration("timeout", 5*time.Second, "How long to wait for the daemon to answer")
+	output := outputFlag(fs, "text")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+
+	path := "/healthz"
+	if *ready {
+		path = "/readyz"
+	}
+	client := http.DefaultClient
+	if *url == "" {
+		cfg, err := loadCommandConfig(*profile)
+		if err != nil {
+			return err
+		}
+		addrs := cfg.HTTPListen
+		if cfg.Health != nil && len(cfg.Health.Listen) > 0 {
+			addrs = cfg.Health.Listen
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("neither health.listen nor http_listen is configured; pass -url or set one in the config file")
+		}
+		if client, *url, err = listenerClient(addrs[0], path); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	h, err := getHealth(ctx, client, *url)
+	if err != nil {
+		return exitCode{code: 1, err: fmt.Errorf("failed to check health: %w", err)}
+	}
+	if *output == "json" {
+		if err := printJSON(h); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range h.Checks {
+			state := "PASS"
+			if !c.OK {
+				state = "FAIL"
+			}
+			if c.Error != "" {
+				fmt.Printf("%s %s: %s\n", state, c.Name, c.Error)
+			} else {
+				fmt.Printf("%s %s\n", state, c.Name)
+			}
+		}
+	}
+	if !h.OK {
+		return exitCode{code: 1}
+	}
+	return nil
+}
+
+// getHealth fetches the answer of a health endpoint at url, which is a failing one with 503
+func getHealth(ctx context.Context, client *http.Client, url string) (Health, error) {
+	var h Health
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return h, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return h, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return h, fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return h, err
+	}
+	return h, nil
+}
@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+const (
+	defaultHeartbeatName     = "_ipwatcher-heartbeat"
+	defaultHeartbeatInterval = time.Hour
+)
+
+// heartbeatContent returns the content of the heartbeat TXT records at now. The timestamp
+// only advances once per interval, so the records are not rewritten on every sync.
+func (w *IPWatcher) heartbeatContent(now time.Time) string {
+	interval := w.config.Heartbeat.Interval
+	if interval == 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	last := w.lastHeartbeat.Load()
+	if last == 0 || now.Sub(time.Unix(0, last)) >= interval {
+		last = now.UnixNano()
+		w.lastHeartbeat.Store(last)
+	}
+	updated := time.Unix(0, last).UTC().Format(time.RFC3339)
+	return fmt.Sprintf(`"heritage=ipwatcher,updated=%s,version=%s"`, updated, version)
+}
+
+// heartbeatRecord returns the heartbeat TXT record of domain with the given content
+func (w *IPWatcher) heartbeatRecord(domain config.Domain, content string) dnsmanager.DNSRecord {
+	name := w.config.Heartbeat.Name
+	if name == "" {
+		name = defaultHeartbeatName
+	}
+	return dnsmanager.DNSRecord{
+		Root:   domain.ZoneName,
+		Name:   name,
+		Type:   dnsmanager.TXTRecord,
+		Target: content,
+	}
+}
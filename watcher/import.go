@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// runImport implements `ipwatcher import`, which prints the A and AAAA records of a Cloudflare
+// zone as a domains entry of the config, so an existing dynamic DNS setup can be copied over.
+// It needs no config file; the token comes from CLOUDFLARE_API_TOKEN.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	zone := fs.String("zone", "", "Zone to import, e.g. example.com")
+	zoneID := fs.String("zone-id", "", "ID of the zone; looked up from -zone when empty")
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if *zone == "" {
+		return fmt.Errorf("-zone is required")
+	}
+
+	token := os.Getenv("CLOUDFLARE_API_TOKEN")
+	if token == "" {
+		return fmt.Errorf("CLOUDFLARE_API_TOKEN environment variable is required")
+	}
+	provider, err := dnsmanager.NewCloudflareProviderWithBaseURL(token, os.Getenv("CLOUDFLARE_BASE_URL"))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	id := *zoneID
+	if id == "" {
+		if id, err = provider.GetZoneIDByName(ctx, *zone); err != nil {
+			return fmt.Errorf("failed to look up zone %s: %w", *zone, err)
+		}
+	}
+	records, err := provider.ListAddressRecords(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to import zone %s: %w", *zone, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("zone %s has no A or AAAA records", *zone)
+	}
+	writeImportedDomain(os.Stdout, *zone, records)
+	return nil
+}
+
+// writeImportedDomain writes records of zone as a domains entry in YAML. Names are relative to
+// the zone, and every record is commented with its current content. Round-robin records with
+// several addresses become one record, which publishes the current IP only.
+func writeImportedDomain(out io.Writer, zone string, records []dnsmanager.ExistingRecord) {
+	zone = strings.TrimSuffix(zone, ".")
+	fmt.Fprintln(out, "domains:")
+	fmt.Fprintf(out, "  - zone_name: %s\n", zone)
+	fmt.Fprintln(out, "    provider: cloudflare")
+	fmt.Fprintln(out, "    records:")
+
+	for i := 0; i < len(records); {
+		r := records[i]
+		contents := []string{r.Content}
+		for i++; i < len(records) && records[i].Name == r.Name && records[i].Type == r.Type; i++ {
+			contents = append(contents, records[i].Content)
+		}
+
+		fmt.Fprintf(out, "      - name: %s\n", strconv.Quote(config.RelativeName(r.Name, zone)))
+		fmt.Fprintf(out, "        type: %s # currently %s\n", r.Type, strings.Join(contents, ", "))
+		if r.Proxied {
+			fmt.Fprintln(out, "        proxied: true")
+		} else if r.TTL != 0 {
+			fmt.Fprintf(out, "        ttl: %d\n", r.TTL)
+		}
+	}
+}
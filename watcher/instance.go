@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/lockfile"
+)
+
+// lockInstance locks the lock file of cfg, loaded from configFile, so a second daemon or
+// `ipwatcher once` with the same config and profile fails instead of racing this one. When the
+// default lock file cannot be created, e.g. in a container without a writable temporary
+// directory, it runs without a lock and returns nil.
+func lockInstance(cfg *config.Config, configFile string) (*lockfile.Lock, error) {
+	path := instanceLockPath(cfg, configFile)
+	lock, err := lockfile.Acquire(path)
+	switch {
+	case errors.Is(err, lockfile.ErrLocked):
+		return nil, fmt.Errorf("another ipwatcher instance is running with this config (set lock_file to run both): %w", err)
+	case err != nil && cfg.LockFile == "":
+		slog.Warn("Running without an instance lock, set lock_file to a writable path", "error", err)
+		return nil, nil
+	}
+	return lock, err
+}
+
+// instanceLockPath returns lock_file, or a file in the temporary directory named after the
+// config file and profile
+func instanceLockPath(cfg *config.Config, configFile string) string {
+	if cfg.LockFile != "" {
+		return cfg.LockFile
+	}
+	if !config.IsRemote(configFile) {
+		if abs, err := filepath.Abs(configFile); err == nil {
+			configFile = abs
+		}
+	}
+	sum := sha256.Sum256([]byte(configFile + "\x00" + cfg.Profile))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("ipwatcher-%x.lock", sum[:8]))
+}
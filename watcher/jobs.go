@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/jobs"
+)
+
+// SetJobJournal sets the journal that keeps DNS updates until they succeed
+func (w *IPWatcher) SetJobJournal(j *jobs.Journal) {
+	w.jobs = j
+}
+
+// jobKey identifies the update of t's records, so a retry replaces the earlier job
+func jobKey(t zoneTarget) string {
+	var b strings.Builder
+	b.WriteString(t.key + "|" + t.zone)
+	for _, r := range t.records {
+		b.WriteString("|" + r.FQDN() + "/" + r.Type.String())
+	}
+	return b.String()
+}
+
+// beginJob journals the update of t before it is applied and returns its key
+func (w *IPWatcher) beginJob(t zoneTarget, ipv4, ipv6 string) string {
+	job := jobs.Job{
+		Key:      jobKey(t),
+		Zone:     t.zone,
+		Provider: t.provider,
+		IPv4:     ipv4,
+		IPv6:     ipv6,
+	}
+	for _, r := range t.records {
+		job.Records = append(job.Records, r.FQDN()+" "+r.Type.String())
+	}
+	if err := w.jobs.Begin(job, time.Now()); err != nil {
+		moduleLogger("sync").Error("Failed to journal DNS update", "zone", t.zone, "provider", t.provider, "error", err)
+	}
+	return job.Key
+}
+
+// finishJob removes the job with key from the journal, or keeps it with err for the next attempt
+func (w *IPWatcher) finishJob(key string, err error) {
+	if qErr := w.jobs.Finish(key, err); qErr != nil {
+		moduleLogger("sync").Error("Failed to update DNS job file", "error", qErr)
+	}
+}
+
+// reportInterruptedJobs logs the updates the previous run did not finish; the initial update retries them
+func (w *IPWatcher) reportInterruptedJobs() {
+	if w.jobs == nil {
+		return
+	}
+	pending, err := w.jobs.Pending()
+	if err != nil {
+		moduleLogger("sync").Error("Failed to read DNS job file", "error", err)
+		return
+	}
+	for _, job := range pending {
+		msg := "interrupted"
+		if job.LastError != "" {
+			msg = "last error: " + job.LastError
+		}
+		moduleLogger("sync").Info("Resuming DNS update", "zone", job.Zone, "provider", job.Provider,
+			"attempts", job.Attempts, "since", job.Enqueued, "status", msg)
+	}
+}
+
+// pruneJobs drops pending updates the initial update did not retry, such as those of
+// records removed from the config
+func (w *IPWatcher) pruneJobs(started time.Time) {
+	if w.jobs == nil {
+		return
+	}
+	dropped, err := w.jobs.Prune(started)
+	if err != nil {
+		moduleLogger("sync").Error("Failed to prune DNS job file", "error", err)
+	}
+	for _, job := range dropped {
+		moduleLogger("sync").Info("Dropping pending DNS update not retried by the initial update", "zone", job.Zone, "provider", job.Provider)
+	}
+}
+
+// pendingJobCount returns the number of pending DNS updates
+func (w *IPWatcher) pendingJobCount() int64 {
+	pending, err := w.jobs.Pending()
+	if err != nil {
+		moduleLogger("sync").Error("Failed to read DNS job file", "error", err)
+	}
+	return int64(len(pending))
+}
@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/workerskv"
+)
+
+// IPPublisher stores the current IPs outside of DNS, e.g. in a Workers KV namespace
+type IPPublisher interface {
+	PublishIP(ctx context.Context, ipv4, ipv6 string, at time.Time) error
+}
+
+// ipPublication tracks what was last stored by the IP publisher, so unchanged IPs are not rewritten
+type ipPublication struct {
+	publisher IPPublisher
+	mu        sync.Mutex
+	last      string // ipv4|ipv6 last stored successfully
+}
+
+// SetIPPublisher sets where the current IPs are published besides DNS
+func (w *IPWatcher) SetIPPublisher(p IPPublisher) {
+	w.ipPublisher = &ipPublication{publisher: p}
+}
+
+// newWorkersKVPublisher creates the publisher for the workers_kv settings, using apiToken
+// unless the section has its own token
+func newWorkersKVPublisher(cfg *config.Config, apiToken string) (*workerskv.Publisher, error) {
+	kv := cfg.WorkersKV
+	token, err := kv.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		token = apiToken
+	}
+	if token == "" {
+		return nil, fmt.Errorf("workers_kv requires api_token, api_token_file or the CLOUDFLARE_API_TOKEN environment variable")
+	}
+	httpClient, err := outboundClient(cfg, 0)
+	if err != nil {
+		return nil, err
+	}
+	return workerskv.NewWithHTTPClient(token, cfg.CloudflareBaseURL, kv.AccountID, kv.NamespaceID, kv.Key, httpClient), nil
+}
+
+// publishIPs stores the current IPs with the IP publisher when they changed since they were
+// last stored. Failures are logged and retried on the next call.
+func (w *IPWatcher) publishIPs(ctx context.Context) {
+	p := w.ipPublisher
+	if p == nil || w.config.ReadOnly || w.config.DryRun {
+		return
+	}
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+	if ipv4 == "" && ipv6 == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := ipv4 + "|" + ipv6
+	if current == p.last {
+		return
+	}
+	if err := p.publisher.PublishIP(ctx, ipv4, ipv6, time.Now()); err != nil {
+		slog.Error("Failed to publish current IPs", "error", err)
+		return
+	}
+	p.last = current
+	slog.Info("Published current IPs", "ipv4", ipv4, "ipv6", ipv6)
+}
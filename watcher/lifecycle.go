@@ -0,0 +1,175 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/notify"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+const (
+	defaultCrashLoopRestarts = 3
+	defaultCrashLoopWindow   = 10 * time.Minute
+	defaultQueueMaxAge       = 24 * time.Hour
+	queueRetryInterval       = time.Minute
+	defaultNotifyWorkers     = 2
+	defaultNotifyTimeout     = 10 * time.Second
+	notifyBacklog            = 64 // Notifications waiting for a free worker before new ones are dropped
+)
+
+// lifecycle sends notifications about the daemon itself, so operators learn when the
+// updater is the problem rather than DNS
+type lifecycle struct {
+	cfg       *config.Notifications
+	notifier  notify.Notifier
+	crashLoop *notify.CrashLoop
+	queue     *notify.Queue // Set when undelivered notifications are kept for retry
+	pool      *notify.Pool  // Delivers in the background, so a slow webhook never holds up the daemon
+	timeout   time.Duration
+	hostname  string
+}
+
+// newLifecycle creates the lifecycle notifier; it is a no-op when notifications are not configured
+func newLifecycle(cfg *config.Notifications) (*lifecycle, error) {
+	l := &lifecycle{cfg: cfg}
+	if cfg == nil || cfg.WebhookURL == "" {
+		return l, nil
+	}
+
+	header := make(http.Header)
+	for _, h := range cfg.Headers {
+		value, err := h.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("notifications: %w", err)
+		}
+		header.Add(h.Name, value)
+	}
+	l.timeout = cfg.Timeout
+	if l.timeout == 0 {
+		l.timeout = defaultNotifyTimeout
+	}
+	l.notifier = notify.NewWebhookWithClient(&http.Client{Timeout: l.timeout}, cfg.WebhookURL, header)
+	l.hostname, _ = os.Hostname()
+
+	if cfg.QueueFile != "" {
+		maxAge := cfg.QueueMaxAge
+		if maxAge == 0 {
+			maxAge = defaultQueueMaxAge
+		}
+		l.queue = notify.NewQueue(l.notifier, cfg.QueueFile, maxAge)
+		l.notifier = l.queue
+	}
+
+	workers := cfg.Workers
+	if workers == 0 {
+		workers = defaultNotifyWorkers
+	}
+	l.pool = notify.NewPool(l.notifier, workers, notifyBacklog, l.timeout, func(n notify.Notification, err error) {
+		slog.Error("Failed to send notification", "event", n.Event, "error", err)
+	})
+	l.notifier = l.pool
+
+	if cfg.StateFile != "" {
+		restarts := cfg.CrashLoopRestarts
+		if restarts == 0 {
+			restarts = defaultCrashLoopRestarts
+		}
+		window := cfg.CrashLoopWindow
+		if window == 0 {
+			window = defaultCrashLoopWindow
+		}
+		l.crashLoop = notify.NewCrashLoop(cfg.StateFile, restarts, window)
+	}
+	return l, nil
+}
+
+// started announces the start and reports a crash loop when the previous runs did not shut down cleanly
+func (l *lifecycle) started() {
+	if l.notifier == nil {
+		return
+	}
+
+	if l.crashLoop != nil {
+		restarts, err := l.crashLoop.Started(time.Now())
+		if err != nil {
+			slog.Error("Failed to track restarts", "error", err)
+		}
+		if restarts > 0 {
+			l.send(notify.EventCrashLoop, fmt.Sprintf("ipwatcher restarted %d times without shutting down cleanly", restarts))
+		}
+	}
+	l.send(notify.EventStart, "ipwatcher started")
+}
+
+// stopped announces a clean shutdown
+func (l *lifecycle) stopped() {
+	if l.notifier == nil {
+		return
+	}
+
+	if l.crashLoop != nil {
+		if err := l.crashLoop.Stopped(); err != nil {
+			slog.Error("Failed to track shutdown", "error", err)
+		}
+	}
+	l.send(notify.EventShutdown, "ipwatcher stopped")
+
+	// Give the remaining notifications one delivery timeout before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+	if err := l.pool.Close(ctx); err != nil {
+		slog.Warn("Notifications still undelivered at shutdown", "error", err)
+	}
+}
+
+// retry delivers queued notifications periodically until ctx is done, so they do not
+// wait for the next lifecycle event once the webhook recovers
+func (l *lifecycle) retry(ctx context.Context) {
+	if l.queue == nil {
+		return
+	}
+
+	ticker := time.NewTicker(queueRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, _ := l.queue.Pending(); n == 0 {
+				continue
+			}
+			flushCtx, cancel := context.WithTimeout(ctx, l.timeout)
+			err := l.queue.Flush(flushCtx)
+			cancel()
+			if err != nil {
+				slog.Error("Failed to deliver queued notifications", "error", err)
+			} else {
+				slog.Info("Delivered queued notifications")
+			}
+		}
+	}
+}
+
+func (l *lifecycle) send(event, msg string) {
+	if !l.cfg.Enabled(event) {
+		return
+	}
+	l.deliver(notify.Notification{Event: event, Message: msg})
+}
+
+// deliver stamps n with the time, host and version and hands it to the worker pool.
+// Delivery failures are logged by the pool.
+func (l *lifecycle) deliver(n notify.Notification) {
+	n.Time, n.Hostname, n.Version = time.Now(), l.hostname, version
+	n.Message = redact.String(n.Message)
+	if err := l.notifier.Notify(context.Background(), n); err != nil {
+		slog.Error("Failed to send notification", "event", n.Event, "error", err)
+	}
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/localdns"
+)
+
+// localDNSTimeout bounds one sync of the local DNS server
+const localDNSTimeout = 30 * time.Second
+
+// localDNSKey is the key local DNS requests are reported under in the provider status
+const localDNSKey = "local_dns"
+
+// localDNS tracks what was last sent to the local DNS server, so unchanged hosts are only
+// sent again by the sync ticker
+type localDNS struct {
+	server    localdns.Server
+	addresses func() (ipv4, ipv6 string, err error) // Internal addresses of the host
+	mu        sync.Mutex
+	sent      string // Hosts last sent, whether or not that succeeded
+	synced    string // Hosts last synced successfully
+}
+
+// SetLocalDNS sets the LAN DNS server the managed names are published to with the internal
+// addresses returned by addresses
+func (w *IPWatcher) SetLocalDNS(server localdns.Server, addresses func() (ipv4, ipv6 string, err error)) {
+	w.localDNS = &localDNS{server: server, addresses: addresses}
+}
+
+// newLocalDNSServer creates the server of the local_dns settings. Requests are not bound to
+// bind_interface, which usually faces the internet rather than the LAN.
+func newLocalDNSServer(l *config.LocalDNS) localdns.Server {
+	client := &http.Client{Timeout: localDNSTimeout}
+	switch l.Type {
+	case config.LocalDNSPiHole:
+		return localdns.NewPiHole(l.URL, l.ResolvePassword, client)
+	case config.LocalDNSAdGuard:
+		return localdns.NewAdGuard(l.URL, l.Username, l.ResolvePassword, client)
+	case config.LocalDNSDnsmasq:
+		return localdns.NewDnsmasq(l.File, l.ReloadCommand)
+	default:
+		return localdns.NewHostsFile(l.File, l.ReloadCommand)
+	}
+}
+
+// localAddresses returns the internal addresses of the local_dns settings: the fixed ones where
+// set, and those of the interface for the other families
+func localAddresses(l *config.LocalDNS) func() (string, string, error) {
+	return func() (string, string, error) {
+		if l.IPv4 != "" && l.IPv6 != "" {
+			return l.IPv4, l.IPv6, nil
+		}
+		ipv4, ipv6, err := localdns.InternalAddresses(l.Interface)
+		if err != nil && l.IPv4 == "" && l.IPv6 == "" {
+			return "", "", err
+		}
+		if l.IPv4 != "" {
+			ipv4 = l.IPv4
+		}
+		if l.IPv6 != "" {
+			ipv6 = l.IPv6
+		}
+		return ipv4, ipv6, nil
+	}
+}
+
+// localHosts returns the hosts to publish to the local DNS server: local_dns.names with both
+// addresses, or else the name of every A and AAAA record without a channel, with the address
+// of its family
+func (w *IPWatcher) localHosts(ipv4, ipv6 string) []localdns.Host {
+	if l := w.config.LocalDNS; l != nil && len(l.Names) > 0 {
+		hosts := make([]localdns.Host, len(l.Names))
+		for i, name := range l.Names {
+			hosts[i] = localdns.Host{Name: name, IPv4: ipv4, IPv6: ipv6}
+		}
+		return hosts
+	}
+
+	var hosts []localdns.Host
+	index := make(map[string]int)
+	for _, domain := range w.config.Domains {
+		_, groups := recordsByChannel(domain.Records)
+		for _, r := range toDNSRecords(domain, groups[""]) {
+			if r.Type != dnsmanager.ARecord && r.Type != dnsmanager.AAAARecord {
+				continue
+			}
+			name := strings.ToLower(r.FQDN())
+			i, ok := index[name]
+			if !ok {
+				i = len(hosts)
+				index[name] = i
+				hosts = append(hosts, localdns.Host{Name: name})
+			}
+			if r.Type == dnsmanager.ARecord {
+				hosts[i].IPv4 = ipv4
+			} else {
+				hosts[i].IPv6 = ipv6
+			}
+		}
+	}
+	return hosts
+}
+
+// syncLocalDNS publishes the managed names with the internal addresses to the local DNS server.
+// Unless force is set, nothing is sent while the hosts are the ones last sent, so a failure is
+// only retried by the next forced call.
+func (w *IPWatcher) syncLocalDNS(ctx context.Context, force bool) {
+	l := w.localDNS
+	if l == nil || w.config.ReadOnly || w.config.DryRun {
+		return
+	}
+	ipv4, ipv6, err := l.addresses()
+	if err != nil {
+		if force {
+			slog.Error("Failed to find the internal address for local DNS", "error", w.observe(localDNSKey, err))
+		}
+		return
+	}
+	hosts := w.localHosts(ipv4, ipv6)
+	current := fmt.Sprint(hosts)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !force && current == l.sent {
+		return
+	}
+	l.sent = current
+	ctx, cancel := context.WithTimeout(ctx, localDNSTimeout)
+	defer cancel()
+	if err := w.observe(localDNSKey, l.server.Sync(ctx, hosts)); err != nil {
+		slog.Error("Failed to update local DNS", "error", err)
+		return
+	}
+	if current != l.synced {
+		slog.Info("Updated local DNS", "names", len(hosts), "ipv4", ipv4, "ipv6", ipv6)
+	}
+	l.synced = current
+}
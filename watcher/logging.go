@@ -0,0 +1,202 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/logflood"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// logFormats are the values of -log-format
+var logFormats = []string{"text", "json"}
+
+// logLevel holds the least severe level logged by every module, set by -log-level or log_level
+var logLevel atomic.Pointer[config.LogLevel]
+
+func init() {
+	logLevel.Store(&config.LogLevel{Default: slog.LevelInfo})
+}
+
+// logRepeatPeriod is how long the repeats of a warning or error are counted before they are
+// logged as one line
+const logRepeatPeriod = 10 * time.Minute
+
+// logSink is where log lines go, selected by -log-output. A Windows service writes them to
+// the event log instead of standard error.
+var logSink = &logWriter{out: os.Stderr}
+
+// logWriter writes log lines to out, which can be replaced after the logger was created
+type logWriter struct {
+	out  io.Writer
+	file *os.File // Opened for -log-output; nil for standard error and output
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	return lw.out.Write(p)
+}
+
+// setOutput makes lw write to standard error, standard output or the end of the file at path
+func (lw *logWriter) setOutput(output string) error {
+	if lw.file != nil && lw.file.Name() == output {
+		return nil
+	}
+	var out io.Writer
+	var file *os.File
+	switch output {
+	case "", "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log output: %w", err)
+		}
+		out, file = f, f
+	}
+	if lw.file != nil {
+		lw.file.Close()
+	}
+	lw.out, lw.file = out, file
+	return nil
+}
+
+// setupLogging makes the default logger, which the log package writes through too, log the
+// lines of level and above in format to output, with every secret redacted. An empty level
+// leaves it to the log_level of the config, info until one is loaded.
+func setupLogging(level, format, output string) error {
+	parsed, err := config.ParseLogLevel(valueOr(level, "info"))
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(logFormats, format) {
+		return fmt.Errorf("log format must be one of %s, not %q", strings.Join(logFormats, ", "), format)
+	}
+	if err := logSink.setOutput(output); err != nil {
+		return err
+	}
+	logLevel.Store(parsed)
+	slog.SetDefault(slog.New(newLogHandler(redact.Writer(logSink), format)))
+	return nil
+}
+
+// useConfigLogLevel applies the log_level of cfg, or info without one, unless -log-level was given
+func useConfigLogLevel(cfg *config.Config) {
+	if globals.logLevel != "" {
+		return
+	}
+	level, err := config.ParseLogLevel(valueOr(cfg.LogLevel, "info"))
+	if err != nil {
+		return // Rejected when the config was validated
+	}
+	logLevel.Store(level)
+}
+
+// newLogHandler returns a handler writing the lines of logLevel and above in format to out, with
+// repeated warnings and errors collapsed
+func newLogHandler(out io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // Filtered by moduleHandler
+	var h slog.Handler = slog.NewTextHandler(out, opts)
+	if format == "json" {
+		h = slog.NewJSONHandler(out, opts)
+	}
+	return moduleHandler{Handler: logflood.New(h, logRepeatPeriod)}
+}
+
+// moduleLogger returns the default logger with the module attribute, which the level of the
+// module applies to
+func moduleLogger(module string) *slog.Logger {
+	return slog.Default().With("module", module)
+}
+
+// moduleHandler drops the records below the level of the module set on its logger with
+// moduleLogger, or below the default level on loggers without one
+type moduleHandler struct {
+	slog.Handler
+	module string
+}
+
+func (h moduleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Load().Level(h.module)
+}
+
+func (h moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, a := range attrs {
+		if a.Key == "module" {
+			module = a.Value.String()
+		}
+	}
+	return moduleHandler{Handler: h.Handler.WithAttrs(attrs), module: module}
+}
+
+func (h moduleHandler) WithGroup(name string) slog.Handler {
+	return moduleHandler{Handler: h.Handler.WithGroup(name), module: h.module}
+}
+
+// useLogger makes logger the default until the returned function restores the previous one
+func useLogger(logger *slog.Logger) func() {
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	return func() { slog.SetDefault(prev) }
+}
+
+// teeHandler hands every record to each of its handlers that logs its level
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slices.ContainsFunc(t, func(h slog.Handler) bool { return h.Enabled(ctx, level) })
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// lineLevel returns the level of a line written by the text or JSON handler. Both write the
+// level right after the time, before the message and attributes, so its first key is the level.
+func lineLevel(line string) slog.Level {
+	for _, key := range []string{"level=", `"level":"`} {
+		if _, rest, ok := strings.Cut(line, key); ok {
+			if end := strings.IndexAny(rest, "\" "); end >= 0 {
+				rest = rest[:end]
+			}
+			var level slog.Level
+			if level.UnmarshalText([]byte(rest)) == nil {
+				return level
+			}
+		}
+	}
+	return slog.LevelInfo
+}
@@ -0,0 +1,1366 @@
+// Package watcher is the ipwatcher daemon and its command line. The ipwatcher command only
+// calls Main; applications embedding the daemon run it with ExecuteWithEvents and subscribe
+// to its typed events.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/msyrus/ipwatcher/events"
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/control"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/history"
+	"github.com/msyrus/ipwatcher/internal/httpserver"
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+	"github.com/msyrus/ipwatcher/internal/jobs"
+	"github.com/msyrus/ipwatcher/internal/notify"
+	"github.com/msyrus/ipwatcher/internal/ntp"
+	"github.com/msyrus/ipwatcher/internal/redact"
+	"github.com/msyrus/ipwatcher/internal/schedule"
+	"github.com/msyrus/ipwatcher/internal/sdnotify"
+	"github.com/msyrus/ipwatcher/internal/statsd"
+)
+
+// IPWatcher manages the IP monitoring and DNS update process
+type IPWatcher struct {
+	config        *config.Config
+	ipFetcher     ipfetcher.Fetcher
+	providers     map[string]dnsmanager.DNSProvider
+	zoneCache     *sync.Map // zone name -> zone ID cache
+	currentIPv4   *atomic.Value
+	currentIPv6   *atomic.Value
+	channels      map[string]*ipChannel // channel name -> tracked address
+	resolver      Resolver              // answers live DNS queries for zones with verify: resolver
+	jobs          *jobs.Journal         // DNS updates not confirmed yet; nil unless job_queue_file is set
+	history       *history.History
+	verified      *sync.Map // provider key + record -> content last confirmed at the provider
+	published     *sync.Map // channel + record type -> publishedAddress, for create_after
+	drift         *sync.Map // provider key + zone -> []DriftedRecord found in read-only mode
+	conflicts     *sync.Map // provider key + record -> OwnershipConflict
+	recordErrors  *sync.Map // provider key + record -> RecordFailure
+	zoneSyncs     *sync.Map // provider key + zone + channel -> ZoneSync of the latest sync
+	fetches       *sync.Map // family -> FetchResult of the latest IP fetch
+	providerStats *sync.Map // provider key -> *providerStats
+	lastAudit     *atomic.Int64
+	lastHeartbeat *atomic.Int64               // time the heartbeat timestamp was last advanced
+	panics        *atomic.Int64               // panics recovered by guard
+	changes       *atomic.Int64               // record changes made, or planned in dry-run mode
+	lastDump      *atomic.Int64               // time of the latest debug dump
+	nextRefresh   *atomic.Int64               // time of the next IP check; 0 until Run schedules it
+	nextSync      *atomic.Int64               // time of the next full sync; 0 until Run schedules it
+	pausedAt      *atomic.Int64               // time Pause stopped the checks and syncs; 0 while running
+	syncRequests  chan chan error             // ForceSync requests, answered by Run with the error of the sync
+	ready         *atomic.Bool                // set once a refresh or sync succeeded, see notifySystemd
+	clock         *atomic.Pointer[ntp.Result] // latest clock check; nil until ntp checked it
+	events        *control.Broker
+	bus           *events.Bus    // typed events for embedders, see Events
+	ipPublisher   *ipPublication // nil unless workers_kv is set
+	localDNS      *localDNS      // LAN DNS server given the internal addresses; nil unless local_dns is set
+	propagation   *propagation   // public resolvers timed after IP changes; nil unless propagation is set
+	statsd        *statsd.Client // server the metrics are sent to; nil unless statsd is set
+	conflictAlert func([]OwnershipConflict)
+	refreshTicker *time.Ticker
+	syncTicker    *time.Ticker
+}
+
+// NewIPWatcher creates a new IP watcher instance
+func NewIPWatcher(ctx context.Context, cfg *config.Config, apiToken string) (*IPWatcher, error) {
+	fetcher, err := newIPFetcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := NewIPWatcherWithFetcher(ctx, cfg, apiToken, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.IPSourcePolicy != "" {
+		fetcher.SetPolicy(cfg.IPSourcePolicy, watcher.recordDisagreement)
+	}
+	if err := watcher.newChannels(); err != nil {
+		return nil, err
+	}
+	if cfg.JobQueueFile != "" {
+		watcher.SetJobJournal(jobs.NewJournal(cfg.JobQueueFile))
+	}
+	if cfg.HistoryFile != "" {
+		if err := watcher.loadHistory(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Propagation != nil {
+		for _, addr := range cfg.Propagation.Resolvers {
+			watcher.SetPropagationResolver(addr, publicResolver(addr))
+		}
+		client, err := outboundClient(cfg, probeTimeout)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range cfg.Propagation.Probes {
+			probe, err := NewProbeResolver(p, client)
+			if err != nil {
+				return nil, err
+			}
+			watcher.SetPropagationProbe(p.ProbeName(), probe)
+		}
+	}
+	if cfg.WorkersKV != nil {
+		publisher, err := newWorkersKVPublisher(cfg, apiToken)
+		if err != nil {
+			return nil, err
+		}
+		watcher.SetIPPublisher(publisher)
+	}
+	if cfg.LocalDNS != nil {
+		watcher.SetLocalDNS(newLocalDNSServer(cfg.LocalDNS), localAddresses(cfg.LocalDNS))
+	}
+	if cfg.StatsD != nil {
+		client, err := newStatsDClient(cfg.StatsD)
+		if err != nil {
+			return nil, err
+		}
+		watcher.SetStatsD(client)
+	}
+	return watcher, nil
+}
+
+// newIPFetcher creates an IP fetcher for the configured ip_sources
+func newIPFetcher(cfg *config.Config) (*ipfetcher.IPFetcher, error) {
+	client, err := outboundClient(cfg, ipFetchTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newSourceFetcher(cfg.IPSources, "", client)
+}
+
+// NewIPWatcherWithFetcher creates a new IP watcher instance with a custom IP fetcher
+func NewIPWatcherWithFetcher(ctx context.Context, cfg *config.Config, apiToken string, fetcher ipfetcher.Fetcher) (*IPWatcher, error) {
+	providers := make(map[string]dnsmanager.DNSProvider)
+	httpClient, err := outboundClient(cfg, 0)
+	if err != nil {
+		return nil, err
+	}
+	var recordCache *dnsmanager.StateCache
+	if cfg.RecordCacheFile != "" {
+		var err error
+		if recordCache, err = dnsmanager.NewStateCache(cfg.RecordCacheFile); err != nil {
+			return nil, err
+		}
+	}
+	newCloudflareProvider := func(token string) (*dnsmanager.CloudflareProvider, error) {
+		p, err := dnsmanager.NewCloudflareProviderWithHTTPClient(token, cfg.CloudflareBaseURL, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		p.SetRecordTags(cfg.CloudflareTags)
+		p.SetRetryPolicy(retryPolicy(cfg.CloudflareRetry))
+		p.SetCircuitBreaker(circuitBreaker(cfg.CloudflareCircuitBreaker))
+		p.SetBatchPolicy(batchPolicy(cfg.CloudflareBatch, dnsmanager.DefaultCloudflareBatch))
+		if recordCache != nil {
+			p.SetStateCache(recordCache)
+		}
+		return p, nil
+	}
+
+	// Initialize one Cloudflare provider per configured account
+	for _, account := range cfg.CloudflareAccounts {
+		token, err := account.Token()
+		if err != nil {
+			return nil, err
+		}
+		cfProvider, err := newCloudflareProvider(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloudflare provider for account %s: %w", account.Name, err)
+		}
+		providers[config.CloudflareAccountKey(account.Name)] = cfProvider
+	}
+
+	// Determine which providers are needed
+	cloudflareNeeded := false
+	route53Needed := false
+	execNeeded := false
+	for _, d := range cfg.Domains {
+		for _, providerType := range d.ProviderNames() {
+			switch providerType {
+			case "cloudflare":
+				key := d.ProviderKey(providerType)
+				if key == providerType {
+					cloudflareNeeded = true
+					continue
+				}
+				if d.Account != "" {
+					if _, ok := providers[key]; !ok {
+						return nil, fmt.Errorf("domain %s: unknown cloudflare account %s", d.ZoneName, d.Account)
+					}
+					continue
+				}
+
+				// Zone-scoped token gets its own client
+				token, err := d.CloudflareToken()
+				if err != nil {
+					return nil, err
+				}
+				cfProvider, err := newCloudflareProvider(token)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create Cloudflare provider for %s: %w", d.ZoneName, err)
+				}
+				providers[key] = cfProvider
+			case "route53":
+				route53Needed = true
+			case "exec":
+				execNeeded = true
+			}
+		}
+	}
+
+	// Initialize Cloudflare provider if needed
+	if cloudflareNeeded {
+		if apiToken == "" {
+			return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN environment variable is required when using the cloudflare provider")
+		}
+		cfProvider, err := newCloudflareProvider(apiToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloudflare provider: %w", err)
+		}
+		providers["cloudflare"] = cfProvider
+	}
+
+	// Initialize Route53 provider if needed
+	if route53Needed {
+		var r53Provider *dnsmanager.Route53Provider
+		var opts []dnsmanager.Route53Option
+		if httpClient != nil {
+			opts = append(opts, dnsmanager.Route53HTTPClient(httpClient))
+		}
+		if r := cfg.Route53; r != nil {
+			r53Provider, err = dnsmanager.NewRoute53ProviderWithWebIdentity(ctx, dnsmanager.WebIdentity{
+				RoleARN:       r.RoleARN,
+				TokenFile:     r.WebIdentityTokenFile,
+				GitHubActions: r.GitHubActionsOIDC,
+				SessionName:   r.SessionName,
+			}, opts...)
+		} else {
+			r53Provider, err = dnsmanager.NewRoute53Provider(ctx, opts...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Route53 provider: %w", err)
+		}
+		r53Provider.SetBatchPolicy(batchPolicy(cfg.Route53Batch, dnsmanager.DefaultRoute53Batch))
+		providers["route53"] = r53Provider
+	}
+
+	// Initialize exec provider if needed
+	if execNeeded {
+		if cfg.Exec == nil {
+			return nil, fmt.Errorf("exec configuration is required when using the exec provider")
+		}
+		execProvider, err := dnsmanager.NewExecProvider(cfg.Exec.Command, cfg.Exec.Args, cfg.Exec.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create exec provider: %w", err)
+		}
+		providers["exec"] = execProvider
+	}
+
+	// Print planned changes instead of applying them
+	if cfg.DryRun {
+		for _, provider := range providers {
+			if dryRunner, ok := provider.(dnsmanager.DryRunner); ok {
+				dryRunner.SetDryRun(os.Stdout)
+			}
+		}
+	}
+
+	// Leave unmanaged records alone unless adoption is allowed
+	if !cfg.AdoptRecords() {
+		for key, provider := range providers {
+			if adopter, ok := provider.(dnsmanager.Adopter); ok {
+				adopter.SetAdopt(false)
+			} else {
+				slog.Warn("Provider cannot tell unmanaged records apart; adopt is ignored for it", "provider", key)
+			}
+		}
+	}
+
+	// Guard records with ownership TXT records where the provider supports it
+	if cfg.OwnerID != "" {
+		for key, provider := range providers {
+			if tracker, ok := provider.(dnsmanager.OwnershipTracker); ok {
+				tracker.SetOwner(cfg.OwnerID)
+			} else {
+				slog.Warn("Provider does not support ownership records; owner_id is ignored for it", "provider", key)
+			}
+		}
+	}
+
+	return &IPWatcher{
+		config:        cfg,
+		ipFetcher:     fetcher,
+		providers:     providers,
+		zoneCache:     &sync.Map{},
+		currentIPv4:   &atomic.Value{},
+		currentIPv6:   &atomic.Value{},
+		channels:      make(map[string]*ipChannel),
+		resolver:      net.DefaultResolver,
+		history:       history.New(historySize),
+		events:        control.NewBroker(),
+		bus:           events.NewBus(),
+		verified:      &sync.Map{},
+		published:     &sync.Map{},
+		drift:         &sync.Map{},
+		conflicts:     &sync.Map{},
+		recordErrors:  &sync.Map{},
+		zoneSyncs:     &sync.Map{},
+		fetches:       &sync.Map{},
+		providerStats: &sync.Map{},
+		lastAudit:     &atomic.Int64{},
+		lastHeartbeat: &atomic.Int64{},
+		panics:        &atomic.Int64{},
+		changes:       &atomic.Int64{},
+		lastDump:      &atomic.Int64{},
+		nextRefresh:   &atomic.Int64{},
+		nextSync:      &atomic.Int64{},
+		pausedAt:      &atomic.Int64{},
+		syncRequests:  make(chan chan error),
+		ready:         &atomic.Bool{},
+		clock:         &atomic.Pointer[ntp.Result]{},
+	}, nil
+}
+
+// NewIPWatcherWithDeps creates a new IP watcher with fully injected dependencies for testing
+func NewIPWatcherWithDeps(cfg *config.Config, fetcher ipfetcher.Fetcher, providers map[string]dnsmanager.DNSProvider) *IPWatcher {
+	return &IPWatcher{
+		config:        cfg,
+		ipFetcher:     fetcher,
+		providers:     providers,
+		zoneCache:     &sync.Map{},
+		currentIPv4:   &atomic.Value{},
+		currentIPv6:   &atomic.Value{},
+		channels:      make(map[string]*ipChannel),
+		resolver:      net.DefaultResolver,
+		history:       history.New(historySize),
+		events:        control.NewBroker(),
+		bus:           events.NewBus(),
+		verified:      &sync.Map{},
+		published:     &sync.Map{},
+		drift:         &sync.Map{},
+		conflicts:     &sync.Map{},
+		recordErrors:  &sync.Map{},
+		zoneSyncs:     &sync.Map{},
+		fetches:       &sync.Map{},
+		providerStats: &sync.Map{},
+		lastAudit:     &atomic.Int64{},
+		lastHeartbeat: &atomic.Int64{},
+		panics:        &atomic.Int64{},
+		changes:       &atomic.Int64{},
+		lastDump:      &atomic.Int64{},
+		nextRefresh:   &atomic.Int64{},
+		nextSync:      &atomic.Int64{},
+		pausedAt:      &atomic.Int64{},
+		syncRequests:  make(chan chan error),
+		ready:         &atomic.Bool{},
+		clock:         &atomic.Pointer[ntp.Result]{},
+	}
+}
+
+// Run starts the IP watcher daemon
+func (w *IPWatcher) Run(ctx context.Context) error {
+	slog.Info("Starting IP Watcher daemon")
+	if w.config.ReadOnly {
+		slog.Info("Read-only mode: DNS records are checked but never changed")
+	}
+	if w.config.DryRun {
+		slog.Info("Dry-run mode: planned DNS changes are printed but never applied")
+	}
+
+	started := time.Now()
+	defer w.saveHistory()
+	w.reportInterruptedJobs()
+	if w.config.NTP != nil {
+		go w.watchClock(ctx)
+	}
+
+	// Initial IP fetch
+	err := w.FetchAndUpdateIPs(ctx)
+	if err != nil {
+		moduleLogger("ip").Warn("Initial IP fetch failed", "error", err)
+	}
+	w.notifySystemd(err)
+	w.publishIPs(ctx)
+	w.syncLocalDNS(ctx, true)
+	w.pruneJobs(started)
+	w.exportMetrics()
+
+	// Create tickers for refresh and sync
+	refreshInterval := time.Duration(float64(time.Second) / w.config.RefreshRate)
+	w.refreshTicker = time.NewTicker(scheduled(w.nextRefresh, w.jittered(refreshInterval)))
+	defer w.refreshTicker.Stop()
+	slog.Info("Refresh interval", "duration", refreshInterval, "rate_per_second", w.config.RefreshRate)
+	if w.config.IntervalJitter > 0 {
+		slog.Info("Interval jitter: part of every interval is left out", "max_fraction", w.config.IntervalJitter)
+	}
+
+	// A sync schedule fires at wall-clock times, so it is not reset when the IP changes
+	var syncC <-chan time.Time
+	var syncTimer *time.Timer
+	var sched *schedule.Schedule
+	if w.config.SyncSchedule != "" {
+		if sched, err = schedule.Parse(w.config.SyncSchedule); err != nil {
+			return fmt.Errorf("sync_schedule: %w", err)
+		}
+		next := sched.Next(time.Now())
+		syncTimer = time.NewTimer(scheduled(w.nextSync, time.Until(next)))
+		defer syncTimer.Stop()
+		syncC = syncTimer.C
+		slog.Info("Sync schedule", "schedule", w.config.SyncSchedule, "next", next)
+	} else {
+		syncInterval := time.Duration(float64(time.Minute) / w.config.SyncRate)
+		w.syncTicker = time.NewTicker(scheduled(w.nextSync, w.jittered(syncInterval)))
+		defer w.syncTicker.Stop()
+		syncC = w.syncTicker.C
+		slog.Info("Sync interval", "duration", syncInterval, "rate_per_minute", w.config.SyncRate)
+	}
+
+	// Keepalives are sent from the loop, so a refresh or sync that hangs lets the watchdog restart the daemon
+	var watchdogC <-chan time.Time
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		watchdog := time.NewTicker(interval / 2)
+		defer watchdog.Stop()
+		watchdogC = watchdog.C
+		slog.Info("systemd watchdog keepalives", "duration", interval/2)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down IP Watcher daemon")
+			if !errors.Is(context.Cause(ctx), errRestart) {
+				w.notifySystemdState(sdnotify.Stopping)
+				w.syncBeforeShutdown()
+			}
+			return ctx.Err()
+
+		case <-watchdogC:
+			w.notifySystemdState(sdnotify.Watchdog)
+
+		case reply := <-w.syncRequests:
+			err := w.guard("forced sync", func() error { return w.syncNow(ctx) })
+			if err != nil {
+				w.publishError("forced sync", err)
+			}
+			w.notifySystemd(err)
+			reply <- err
+
+		case <-w.refreshTicker.C:
+			if w.isPaused() {
+				break // The ticker keeps running, so checks continue once resumed
+			}
+			err := w.guard("IP refresh", func() error { return w.CheckAndUpdateIP(ctx) })
+			if err != nil {
+				w.publishError("IP refresh", err)
+				if !paused(err) {
+					slog.Error("Failed to check IP", "error", err)
+				}
+			}
+			w.notifySystemd(err)
+			w.syncLocalDNS(ctx, false) // Follows changes of the internal address
+			if w.config.IntervalJitter > 0 {
+				w.refreshTicker.Reset(scheduled(w.nextRefresh, w.jittered(refreshInterval)))
+			} else {
+				scheduled(w.nextRefresh, refreshInterval)
+			}
+
+		case <-syncC:
+			if !w.isPaused() {
+				err := w.guard("DNS sync", func() error { return w.VerifyDNSRecords(ctx) })
+				if err != nil {
+					w.publishError("DNS sync", err)
+					if !paused(err) {
+						slog.Error("Failed to verify DNS records", "error", err)
+					}
+				}
+				w.notifySystemd(err)
+				w.publishIPs(ctx)         // Retries a failed publish
+				w.syncLocalDNS(ctx, true) // Restores entries changed on the local DNS server
+				w.exportMetrics()
+			}
+			if syncTimer != nil {
+				syncTimer.Reset(scheduled(w.nextSync, time.Until(sched.Next(time.Now()))))
+			} else if w.config.IntervalJitter > 0 {
+				w.syncTicker.Reset(scheduled(w.nextSync, w.jittered(time.Duration(float64(time.Minute)/w.config.SyncRate))))
+			} else {
+				scheduled(w.nextSync, time.Duration(float64(time.Minute)/w.config.SyncRate))
+			}
+		}
+	}
+}
+
+// errRestart cancels a watcher that a watcher with a new config replaces. The replacement syncs
+// at startup, so the replaced one exits without a last sync.
+var errRestart = errors.New("watcher restarted")
+
+// defaultShutdownTimeout bounds the last sync before the daemon exits unless shutdown_timeout is set.
+// It stays below the 10 seconds docker stop waits before killing the container.
+const defaultShutdownTimeout = 5 * time.Second
+
+// syncBeforeShutdown pushes the records not confirmed for the current IPs yet, so an IP change
+// detected just before a shutdown is not lost until the next start. Records already confirmed
+// are skipped, so it makes no requests when everything is in sync.
+func (w *IPWatcher) syncBeforeShutdown() {
+	if w.config.ReadOnly || w.config.DryRun || w.isPaused() {
+		return
+	}
+	timeout := w.config.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+	if err := w.guard("shutdown sync", func() error {
+		return joinZoneErrors(w.ensureAllDomains(ctx, ipv4, ipv6, shutdownPass))
+	}); err != nil {
+		slog.Warn("Records may be stale until the next start", "error", err)
+	}
+}
+
+// scheduled stores in next when a ticker or timer started now with d fires, and returns d
+func scheduled(next *atomic.Int64, d time.Duration) time.Duration {
+	next.Store(time.Now().Add(d).UnixNano())
+	return d
+}
+
+// jittered returns interval less a random part of up to interval_jitter of it, so the ticks of
+// watchers started together drift apart instead of reaching the IP sources and DNS providers at
+// the same moment
+func (w *IPWatcher) jittered(interval time.Duration) time.Duration {
+	return interval - time.Duration(w.config.IntervalJitter*rand.Float64()*float64(interval))
+}
+
+// FetchAndUpdateIPs fetches current IPs and updates DNS if needed
+func (w *IPWatcher) FetchAndUpdateIPs(ctx context.Context) error {
+	// Fetch IPv4
+	ipv4, err := w.fetchIP(ctx, "ipv4")
+	if err != nil {
+		moduleLogger("ip").Error("Failed to fetch IP", "family", "ipv4", "error", err)
+	} else {
+		old, _ := w.currentIPv4.Swap(ipv4).(string)
+		moduleLogger("ip").Info("Current IP", "family", "ipv4", "ip", ipv4)
+		if old != ipv4 {
+			w.publishIPChange("ipv4", "", old, ipv4)
+		}
+	}
+
+	// Fetch IPv6
+	if w.config.SupportsIPv6 {
+		ipv6, err := w.fetchIP(ctx, "ipv6")
+		if err != nil {
+			moduleLogger("ip").Error("Failed to fetch IP", "family", "ipv6", "error", err)
+		} else {
+			old, _ := w.currentIPv6.Swap(ipv6).(string)
+			moduleLogger("ip").Info("Current IP", "family", "ipv6", "ip", ipv6)
+			if old != ipv6 {
+				w.publishIPChange("ipv6", "", old, ipv6)
+			}
+		}
+	}
+	w.refreshChannels(ctx)
+
+	// Update DNS records
+	return w.UpdateAllDNSRecords(ctx)
+}
+
+// CheckAndUpdateIP checks if IP has changed and updates DNS if needed
+func (w *IPWatcher) CheckAndUpdateIP(ctx context.Context) error {
+	oldIPv4, _ := w.currentIPv4.Load().(string)
+	oldIPv6, _ := w.currentIPv6.Load().(string)
+
+	// Fetch current IPs
+	newIPv4, err := w.fetchIP(ctx, "ipv4")
+	if err != nil {
+		moduleLogger("ip").Error("Failed to fetch IP", "family", "ipv4", "error", err)
+	}
+
+	newIPv6 := ""
+	if w.config.SupportsIPv6 {
+		newIPv6, err = w.fetchIP(ctx, "ipv6")
+		if err != nil {
+			// IPv6 might not be available, just log it
+			moduleLogger("ip").Error("Failed to fetch IP", "family", "ipv6", "error", err)
+		}
+	}
+
+	// Check if IPs have changed
+	ipv4Changed := newIPv4 != oldIPv4 && newIPv4 != ""
+	ipv6Changed := newIPv6 != oldIPv6 && newIPv6 != ""
+	channelsChanged := w.refreshChannels(ctx)
+
+	if ipv4Changed {
+		moduleLogger("ip").Info("IP changed", "family", "ipv4", "old_ip", oldIPv4, "ip", newIPv4)
+		w.currentIPv4.Store(newIPv4)
+		w.publishIPChange("ipv4", "", oldIPv4, newIPv4)
+	}
+	if ipv6Changed {
+		moduleLogger("ip").Info("IP changed", "family", "ipv6", "old_ip", oldIPv6, "ip", newIPv6)
+		w.currentIPv6.Store(newIPv6)
+		w.publishIPChange("ipv6", "", oldIPv6, newIPv6)
+	}
+	if ipv4Changed || ipv6Changed {
+		w.publishIPs(ctx)
+	}
+	if ipv4Changed || ipv6Changed || channelsChanged {
+		// Reset sync ticker if it's running (initialized in Run())
+		if w.syncTicker != nil {
+			w.syncTicker.Reset(scheduled(w.nextSync, w.jittered(time.Duration(float64(time.Minute)/w.config.SyncRate))))
+		}
+
+		return w.applyIPChange(ctx, oldIPv4, oldIPv6)
+	}
+
+	return nil
+}
+
+// GetZoneID retrieves the zone ID for a domain, using cache if available.
+// providerKey is the provider type, or a domain's provider key when it has dedicated credentials.
+func (w *IPWatcher) GetZoneID(ctx context.Context, zoneName, providerKey string) (string, error) {
+	return w.lookupZoneID(ctx, zoneName, providerKey, "")
+}
+
+// lookupZoneID is GetZoneID with an optional account scope for providers that support it
+func (w *IPWatcher) lookupZoneID(ctx context.Context, zoneName, providerKey, accountID string) (string, error) {
+	cacheKey := zoneCacheKey(providerKey, accountID, zoneName)
+	zoneID, exists := w.zoneCache.Load(cacheKey)
+
+	if exists {
+		return zoneID.(string), nil
+	}
+
+	provider, ok := w.providers[providerKey]
+	if !ok {
+		return "", fmt.Errorf("unsupported provider: %s", providerKey)
+	}
+
+	// Fetch zone ID from provider
+	var zID string
+	var err error
+	if resolver, ok := provider.(dnsmanager.AccountZoneResolver); ok && accountID != "" {
+		zID, err = resolver.GetZoneIDByNameInAccount(ctx, zoneName, accountID)
+	} else {
+		zID, err = provider.GetZoneIDByName(ctx, zoneName)
+	}
+	if err := w.observe(providerKey, err); err != nil {
+		return "", err
+	}
+
+	// Cache it
+	w.zoneCache.Store(cacheKey, zID)
+
+	return zID, nil
+}
+
+func zoneCacheKey(providerKey, accountID, zoneName string) string {
+	return providerKey + ":" + accountID + ":" + zoneName
+}
+
+// UpdateAllDNSRecords updates DNS records for all configured domains
+func (w *IPWatcher) UpdateAllDNSRecords(ctx context.Context) error {
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+
+	results := w.ensureAllDomains(ctx, ipv4, ipv6, updatePass)
+	return joinZoneErrors(results)
+}
+
+// VerifyDNSRecords verifies that all DNS records are up-to-date.
+// With audit_rate set, only records whose expected content changed since they were last
+// verified are checked, and every record is audited at the lower audit rate.
+func (w *IPWatcher) VerifyDNSRecords(ctx context.Context) error {
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+
+	pass := verifyPass
+	if w.auditDue(time.Now()) {
+		moduleLogger("sync").Info("Verifying DNS records")
+	} else {
+		pass = deltaVerifyPass
+		moduleLogger("sync").Info("Verifying changed DNS records")
+	}
+
+	results := w.ensureAllDomains(ctx, ipv4, ipv6, pass)
+	return joinZoneErrors(results)
+}
+
+// zoneTarget identifies one domain's records on one provider
+type zoneTarget struct {
+	zone      string
+	zoneID    string // Configured zone ID; looked up by name when empty
+	provider  string // Provider type, used for reporting
+	key       string // Provider instance key, see config.Domain.ProviderKey
+	accountID string // Optional account scope for the zone lookup
+	verify    string // Verify level of the domain, see config.Domain.Verify
+	channel   string // Channel the records publish; the default IPv4/IPv6 pair when empty
+	records   []dnsmanager.DNSRecord
+}
+
+// newZoneTarget returns the target for the given records of domain on one of its providers
+func (w *IPWatcher) newZoneTarget(domain config.Domain, providerType, channel string, records []dnsmanager.DNSRecord) zoneTarget {
+	target := zoneTarget{
+		zone:     domain.ZoneName,
+		zoneID:   domain.ZoneID,
+		provider: providerType,
+		key:      domain.ProviderKey(providerType),
+		channel:  channel,
+		verify:   domain.Verify,
+		records:  records,
+	}
+	if providerType == "cloudflare" {
+		target.accountID = w.config.CloudflareAccountID(domain)
+	}
+	return target
+}
+
+// zoneResult is the outcome of pushing one domain's records to one provider
+type zoneResult struct {
+	zoneTarget
+	err error
+}
+
+// ensureAllDomains pushes the given IPs to every provider of every configured domain.
+// Records are pushed in priority tiers, highest first, so critical records are updated
+// before the rest; a failing tier does not stop the following ones.
+// Providers of the same domain are updated concurrently and fail independently.
+// Records on a channel are pushed separately, with the channel's address instead of ipv4 and ipv6.
+func (w *IPWatcher) ensureAllDomains(ctx context.Context, ipv4, ipv6 string, pass syncPass) []zoneResult {
+	var results []zoneResult
+	for _, priority := range w.config.Priorities() {
+		for _, domain := range w.config.Domains {
+			var tier []config.Record
+			for _, record := range domain.Records {
+				if record.Priority == priority {
+					tier = append(tier, record)
+				}
+			}
+
+			channels, groups := recordsByChannel(tier)
+			for _, channel := range channels {
+				dnsRecords := toDNSRecords(domain, groups[channel])
+				results = append(results, w.ensureProviders(ctx, domain, channel, dnsRecords, ipv4, ipv6, pass)...)
+			}
+		}
+	}
+
+	// The heartbeat goes last, so it only advances once the records had their chance
+	if w.config.Heartbeat != nil && !w.config.ReadOnly {
+		content := w.heartbeatContent(time.Now())
+		for _, domain := range w.config.Domains {
+			results = append(results, w.ensureProviders(ctx, domain, "", []dnsmanager.DNSRecord{w.heartbeatRecord(domain, content)}, ipv4, ipv6, pass)...)
+		}
+	}
+
+	return results
+}
+
+// ensureProviders pushes records of domain to all of its providers concurrently
+func (w *IPWatcher) ensureProviders(ctx context.Context, domain config.Domain, channel string, dnsRecords []dnsmanager.DNSRecord, ipv4, ipv6 string, pass syncPass) []zoneResult {
+	providerTypes := domain.ProviderNames()
+	results := make([]zoneResult, len(providerTypes))
+
+	var wg sync.WaitGroup
+	for i, providerType := range providerTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target := w.newZoneTarget(domain, providerType, channel, dnsRecords)
+			results[i] = zoneResult{
+				zoneTarget: target,
+				err: w.guard(providerType+" provider for "+domain.ZoneName, func() error {
+					return w.ensureDomain(ctx, target, ipv4, ipv6, pass)
+				}),
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// retryPolicy applies the configured retry settings to the default policy
+func retryPolicy(r *config.Retry) dnsmanager.RetryPolicy {
+	policy := dnsmanager.DefaultRetryPolicy
+	if r == nil {
+		return policy
+	}
+	if r.Attempts > 0 {
+		policy.MaxRetries = r.Attempts - 1
+	}
+	if r.BaseDelay > 0 {
+		policy.BaseDelay = r.BaseDelay
+	}
+	if r.Jitter != nil {
+		policy.Jitter = *r.Jitter
+	}
+	return policy
+}
+
+// circuitBreaker applies the configured circuit breaker settings to the default policy
+func circuitBreaker(b *config.CircuitBreaker) dnsmanager.CircuitBreaker {
+	policy := dnsmanager.DefaultCircuitBreaker
+	if b == nil {
+		return policy
+	}
+	if b.Failures != nil {
+		policy.Failures = *b.Failures
+	}
+	if b.Cooldown > 0 {
+		policy.Cooldown = b.Cooldown
+	}
+	return policy
+}
+
+// batchPolicy applies the configured batch settings to the provider's default policy
+func batchPolicy(b *config.Batch, policy dnsmanager.BatchPolicy) dnsmanager.BatchPolicy {
+	if b == nil {
+		return policy
+	}
+	if b.MaxChanges > 0 {
+		policy.MaxChanges = b.MaxChanges
+	}
+	if b.Delay != nil {
+		policy.Delay = *b.Delay
+	}
+	return policy
+}
+
+// toDNSRecords converts config records of domain to DNS manager records
+func toDNSRecords(domain config.Domain, records []config.Record) []dnsmanager.DNSRecord {
+	var dnsRecords []dnsmanager.DNSRecord
+	for _, record := range records {
+		dnsRecords = append(dnsRecords, dnsmanager.DNSRecord{
+			Root:       domain.ZoneName,
+			Name:       record.Name,
+			Type:       dnsmanager.DNSRecordType(record.Type),
+			Proxied:    record.Proxied,
+			TTL:        record.TTL,
+			Target:     record.Target,
+			Strict:     domain.Verify == config.VerifyFull,
+			PurgeCache: record.PurgeCache,
+		})
+	}
+	return dnsRecords
+}
+
+// paused reports whether err only consists of requests skipped by providers that paused a
+// failing API; the provider logged the outage once when it paused
+func paused(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !paused(e) {
+				return false
+			}
+		}
+		return len(joined.Unwrap()) > 0
+	}
+	return errors.Is(err, dnsmanager.ErrUnavailable)
+}
+
+// joinZoneErrors joins the failures of all zone results into a single error
+func joinZoneErrors(results []zoneResult) error {
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ensureDomain pushes records of a single zone to a single provider
+func (w *IPWatcher) ensureDomain(ctx context.Context, t zoneTarget, ipv4, ipv6 string, pass syncPass) (err error) {
+	started := time.Now()
+	provider, ok := w.providers[t.key]
+	if !ok {
+		moduleLogger("sync").Error("Unsupported provider", "zone", t.zone, "provider", t.provider)
+		return nil
+	}
+
+	ipv4, ipv6 = w.channelIPs(t.channel, ipv4, ipv6)
+	if t.channel != "" && ipv4 == "" && ipv6 == "" {
+		moduleLogger("sync").Info("Skipping zone: channel has no address yet", "zone", t.zone, "provider", t.provider, "channel", t.channel)
+		return nil
+	}
+
+	t.records = w.holdNewRecords(t, ipv4, ipv6, time.Now())
+	if pass.deltaOnly {
+		t.records = w.staleRecords(t, ipv4, ipv6)
+		if len(t.records) == 0 {
+			return nil
+		}
+	}
+	if pass.resolve && t.verify == config.VerifyResolver {
+		t.records = w.unresolvedRecords(ctx, t, ipv4, ipv6)
+		if len(t.records) == 0 {
+			return nil
+		}
+	}
+
+	if w.jobs != nil && !w.config.ReadOnly && !w.config.DryRun {
+		key := w.beginJob(t, ipv4, ipv6)
+		defer func() { w.finishJob(key, err) }()
+	}
+
+	// Get zone ID, unless configured
+	zoneID := t.zoneID
+	if zoneID == "" {
+		zoneID, err = w.lookupZoneID(ctx, t.zone, t.key, t.accountID)
+	}
+	if err != nil {
+		if !paused(err) {
+			moduleLogger("sync").Error("Failed to get zone ID", "zone", t.zone, "provider", t.provider, "error", err)
+		}
+		w.trackZoneSync(t, dnsmanager.Result{}, err)
+		return fmt.Errorf("%s (%s): %w", t.zone, t.provider, err)
+	}
+
+	if w.config.ReadOnly {
+		return w.checkDomain(ctx, t, provider, zoneID, ipv4, ipv6)
+	}
+	if _, ok := provider.(dnsmanager.DryRunner); w.config.DryRun && !ok {
+		moduleLogger("sync").Info("Skipping zone: provider does not support dry runs", "zone", t.zone, "provider", t.provider)
+		return nil
+	}
+
+	// Use EnsureDNSRecords which will create or update only if needed,
+	// streaming per-record progress to watch clients where the provider supports it
+	ensure := provider.EnsureDNSRecords
+	if streamer, ok := provider.(dnsmanager.StreamingEnsurer); ok {
+		ensure = func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return streamer.EnsureDNSRecordsStream(ctx, zoneID, records, ipv4, ipv6, func(p dnsmanager.Progress) {
+				w.publishProgress(t, p)
+			})
+		}
+	}
+	if cacher, ok := provider.(dnsmanager.CachedEnsurer); ok && pass.cached {
+		ensure = func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return cacher.EnsureDNSRecordsCached(ctx, zoneID, records, ipv4, ipv6, func(p dnsmanager.Progress) {
+				w.publishProgress(t, p)
+			})
+		}
+	}
+	result, err := ensure(ctx, zoneID, t.records, ipv4, ipv6)
+	w.trackConflicts(t, err)
+	w.trackRecordFailures(t, result, err)
+	w.trackZoneSync(t, result, err)
+	if err := w.observe(t.key, err); err != nil {
+		if !paused(err) {
+			moduleLogger("sync").Error(pass.failMsg, "zone", t.zone, "provider", t.provider, "error", err)
+		}
+		if len(result.Errors) > 0 {
+			moduleLogger("sync").Info("DNS records partly synced", "zone", t.zone, "provider", t.provider, "result", result.String())
+			for _, e := range result.Errors {
+				moduleLogger("sync").Error("Failed to sync record", "zone", t.zone, "provider", t.provider, "record", e.Name, "type", e.Type, "error", e.Err)
+			}
+		}
+		w.publishUpdate(t.zone, t.provider, t.records, pass.failMsg, err)
+		w.forgetVerified(t)
+
+		// A cached zone ID may be stale, e.g. after the zone was re-created
+		if errors.Is(err, dnsmanager.ErrZoneNotFound) {
+			w.zoneCache.Delete(zoneCacheKey(t.key, t.accountID, t.zone))
+		}
+		return fmt.Errorf("%s (%s): %w", t.zone, t.provider, err)
+	}
+
+	w.changes.Add(int64(result.Changed()))
+
+	// Nothing was applied, so the records stay unverified and are planned again on the next sync
+	if w.config.DryRun {
+		moduleLogger("sync").Info("DNS records planned (dry run)", "zone", t.zone, "provider", t.provider)
+		return nil
+	}
+
+	moduleLogger("sync").Info("DNS records "+pass.okMsg, "zone", t.zone, "provider", t.provider, "result", result.String(), "duration", time.Since(started))
+	w.publishUpdate(t.zone, t.provider, t.records, "DNS records "+pass.okMsg+" ("+result.String()+")", nil)
+	w.markVerified(t, ipv4, ipv6)
+	return nil
+}
+
+// publishProgress emits a progress event for one record change of t
+func (w *IPWatcher) publishProgress(t zoneTarget, p dnsmanager.Progress) {
+	e := control.Event{
+		Kind:     control.KindProgress,
+		Zone:     t.zone,
+		Provider: t.provider,
+		Records:  []string{p.Change.Name},
+		Message:  redact.String(string(p.Stage) + " " + p.Change.String()),
+	}
+	if p.Err != nil {
+		e.Error = redact.String(p.Err.Error())
+	}
+	w.events.Publish(e)
+}
+
+// publishUpdate emits an update event for clients following the daemon
+func (w *IPWatcher) publishUpdate(zoneName, providerType string, records []dnsmanager.DNSRecord, msg string, err error) {
+	msg, err = redact.String(msg), redact.Error(err)
+	e := control.Event{
+		Kind:     control.KindUpdate,
+		Zone:     zoneName,
+		Provider: providerType,
+		Message:  msg,
+	}
+	for _, r := range records {
+		e.Records = append(e.Records, r.FQDN())
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	w.events.Publish(e)
+	w.bus.Publish(events.RecordChange{Time: time.Now(), Zone: zoneName, Provider: providerType, Records: e.Records, Message: msg, Err: err})
+}
+
+// publishIPChange emits a typed event for a changed address of family, on channel if set
+func (w *IPWatcher) publishIPChange(family, channel, oldIP, newIP string) {
+	w.bus.Publish(events.IPChange{Time: time.Now(), Family: family, Channel: channel, Old: oldIP, New: newIP})
+}
+
+// publishError emits a typed event for a refresh or sync that failed
+func (w *IPWatcher) publishError(where string, err error) {
+	w.bus.Publish(events.Error{Time: time.Now(), Where: where, Err: redact.Error(err)})
+}
+
+// Events returns the bus the watcher publishes typed IP change, record change and error events to
+func (w *IPWatcher) Events() *events.Bus {
+	return w.bus
+}
+
+// SetEvents sets the bus the watcher publishes its typed events to, instead of its own
+func (w *IPWatcher) SetEvents(bus *events.Bus) {
+	w.bus = bus
+}
+
+// profileFlag defines the -profile flag, which selects a config profile. It defaults to the
+// -profile given before the command, or else IPWATCHER_PROFILE.
+func profileFlag(fs *flag.FlagSet) *string {
+	return fs.String("profile", globals.profile, "Config profile to use instead of the one set in the config file")
+}
+
+// Execute is the main entry point for running the IP watcher daemon
+// It loads configuration, creates the watcher, and runs it until interrupted or ctx is done.
+// A config file given as an https URL is fetched again every config_refresh, and each
+// changed version replaces the running watcher once it passed the startup checks.
+func Execute(ctx context.Context, configFile, profile, apiToken string, dryRun bool) error {
+	return ExecuteWithEvents(ctx, events.NewBus(), configFile, profile, apiToken, dryRun)
+}
+
+// ExecuteWithEvents is Execute publishing the typed events of the watcher to bus, and those of
+// every watcher replacing it when the config is reloaded, so an embedding application can
+// subscribe to bus before the daemon starts.
+func ExecuteWithEvents(ctx context.Context, bus *events.Bus, configFile, profile, apiToken string, dryRun bool) error {
+	// Create signal handling context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// newWatcher applies the command line to a config and creates a watcher that passed the startup checks
+	newWatcher := func(ctx context.Context, cfg *config.Config) (*IPWatcher, error) {
+		useConfigLogLevel(cfg)
+		if cfg.Profile != "" {
+			slog.Info("Using config profile", "profile", cfg.Profile)
+		}
+		if dryRun {
+			cfg.DryRun = true
+		}
+		if cfg.CloudflareBaseURL == "" {
+			cfg.CloudflareBaseURL = os.Getenv("CLOUDFLARE_BASE_URL")
+		}
+
+		// Keep the secrets of this config out of logs, errors and status output
+		redact.Add(cfg.Secrets()...)
+
+		// Create IP watcher
+		watcher, err := NewIPWatcher(ctx, cfg, apiToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IP watcher: %w", err)
+		}
+		watcher.SetEvents(bus)
+
+		// Fail fast on invalid credentials or zones they cannot read
+		if err := watcher.Preflight(ctx); err != nil {
+			return nil, fmt.Errorf("startup checks failed: %w", err)
+		}
+		return watcher, nil
+	}
+
+	// Load configuration
+	var remote *config.Remote
+	var cfg *config.Config
+	var err error
+	if config.IsRemote(configFile) {
+		remote = config.NewRemote(configFile, nil)
+		cfg, err = fetchConfig(ctx, remote, profile)
+	} else {
+		cfg, err = config.LoadConfigProfile(configFile, profile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Held until the daemon exits; a reloaded config with another lock_file keeps this lock
+	lock, err := lockInstance(cfg, configFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	watcher, err := newWatcher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		slog.Info("Received shutdown signal")
+		cancel()
+	}()
+
+	// Signals act on the watcher that is running, which changes with every reload
+	var current atomic.Pointer[IPWatcher]
+	current.Store(watcher)
+	go syncOnSignal(ctx, &current)
+	go dumpOnSignal(ctx, &current)
+
+	lc, err := newLifecycle(cfg.Notifications)
+	if err != nil {
+		return err
+	}
+	lc.started()
+	go lc.retry(ctx)
+
+	// A reload requested on the control socket loads the config again and restarts the watcher
+	restarts := make(chan *IPWatcher)
+	reload := func(ctx context.Context) error {
+		var cfg *config.Config
+		var err error
+		if remote != nil {
+			cfg, err = fetchConfig(ctx, remote, profile)
+		} else {
+			cfg, err = config.LoadConfigProfile(configFile, profile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		next, err := newWatcher(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		select {
+		case restarts <- next:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var reloads <-chan *IPWatcher
+	if remote != nil {
+		reloads = watchRemoteConfig(ctx, remote, cfg.ConfigRefresh, func(ctx context.Context, data []byte) (*IPWatcher, error) {
+			cfg, err := config.Parse(data, profile)
+			if err != nil {
+				return nil, err
+			}
+			return newWatcher(ctx, cfg)
+		})
+	}
+
+	for {
+		runCtx, stop := context.WithCancelCause(ctx)
+		done := make(chan error, 1)
+		go func() { done <- serve(runCtx, watcher, lc, reload) }()
+
+		var next *IPWatcher
+		select {
+		case err = <-done:
+		case next = <-reloads:
+			slog.Info("Config changed, restarting the watcher")
+		case next = <-restarts:
+			slog.Info("Config reloaded, restarting the watcher")
+		}
+		if next != nil {
+			stop(errRestart)
+		} else {
+			stop(nil)
+		}
+		if next != nil {
+			if err = <-done; err == nil {
+				next.pausedAt.Store(watcher.pausedAt.Load()) // A paused daemon stays paused
+				watcher = next
+				current.Store(watcher)
+				continue
+			}
+		}
+		break
+	}
+	if err != nil {
+		return err
+	}
+
+	lc.stopped()
+	slog.Info("IP Watcher daemon stopped")
+	return nil
+}
+
+// serve runs watcher with its control socket and status endpoint until ctx is done, and
+// returns once they all stopped. reload is called by the reload command of the control socket.
+func serve(ctx context.Context, watcher *IPWatcher, lc *lifecycle, reload func(context.Context) error) error {
+	cfg := watcher.config
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Serve the control socket so `ipwatcher watch` can follow the daemon and admins can control it
+	if cfg.ControlSocket != "" {
+		server := control.NewServer(cfg.ControlSocket, watcher.events)
+		watcher.handleControl(server, reload)
+		if err := server.Listen(); err != nil {
+			return err
+		}
+		defer os.Remove(cfg.ControlSocket)
+		// Log lines are also published to `ipwatcher watch`, as text whatever the log format
+		watchLog := newLogHandler(redact.Writer(watcher.events), "text")
+		defer useLogger(slog.New(teeHandler{slog.Default().Handler(), watchLog}))()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := watcher.guard("control socket", func() error { return server.Serve(ctx) }); err != nil {
+				slog.Error("Control socket failed", "error", err)
+			}
+		}()
+		slog.Info("Control socket listening", "socket", cfg.ControlSocket)
+	}
+
+	// Serve the status endpoint on every configured address
+	if len(cfg.HTTPListen) > 0 {
+		server := httpserver.New(watcher.Handler(), cfg.HTTPListen)
+		if err := server.Listen(); err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := watcher.guard("HTTP server", func() error { return server.Serve(ctx) }); err != nil {
+				slog.Error("HTTP server failed", "error", err)
+			}
+		}()
+	}
+
+	// Serve the health endpoints alone where orchestrators probe them
+	if cfg.Health != nil && len(cfg.Health.Listen) > 0 {
+		server := httpserver.New(watcher.HealthHandler(), cfg.Health.Listen)
+		if err := server.Listen(); err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := watcher.guard("health server", func() error { return server.Serve(ctx) }); err != nil {
+				slog.Error("Health server failed", "error", err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lc.summaries(ctx, watcher)
+	}()
+	watcher.SetConflictAlert(func(conflicts []OwnershipConflict) {
+		lc.send(notify.EventConflict, ConflictMessage(conflicts))
+	})
+
+	// Tag every log line with the instance, so logs of several instances can be told apart
+	if cfg.OwnerID != "" {
+		defer useLogger(slog.Default().With("owner", cfg.OwnerID))()
+	}
+
+	// Run the watcher
+	if err := watcher.Run(ctx); err != nil && err != context.Canceled {
+		return fmt.Errorf("IP watcher error: %w", err)
+	}
+	return nil
+}
+
+// Main runs the ipwatcher command line with the arguments of the process and exits with its
+// status
+func Main() {
+	// Secrets are registered once the config is loaded; until then only the patterns apply
+	redact.Add(os.Getenv("CLOUDFLARE_API_TOKEN"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"))
+
+	globals.config = os.Getenv("CONFIG_FILE")
+	if globals.config == "" {
+		globals.config = "config.yaml"
+	}
+	globals.logFormat = "text"
+	globals.logOutput = "stderr"
+	globals.profile = os.Getenv("IPWATCHER_PROFILE")
+
+	showVersion := flag.Bool("version", false, "Print version and exit")
+	flag.BoolVar(&globals.dryRun, "dry-run", false, "Print planned DNS changes instead of applying them")
+	flag.StringVar(&globals.profile, "profile", globals.profile, "Config profile to use instead of the one set in the config file")
+	addGlobalFlags(flag.CommandLine)
+	flag.Usage = func() { usage(os.Stderr) }
+	flag.Parse()
+	if err := setupLogging(globals.logLevel, globals.logFormat, globals.logOutput); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	// Without a command, the daemon runs, like before there were commands
+	name, args := "run", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		flag.Usage()
+		os.Exit(2)
+	}
+	err := cmd.run(args)
+	var exit exitCode
+	if errors.As(err, &exit) {
+		if exit.err != nil {
+			slog.Error("Command failed", "command", name, "error", exit.err)
+		}
+		os.Exit(exit.code)
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", name, "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,2944 @@
+package watcher_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/msyrus/ipwatcher/events"
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/history"
+	"github.com/msyrus/ipwatcher/internal/jobs"
+	"github.com/msyrus/ipwatcher/internal/localdns"
+	"github.com/msyrus/ipwatcher/internal/statsd"
+	ipwatcher "github.com/msyrus/ipwatcher/watcher"
+)
+
+// MockIPFetcher implements ipfetcher.Fetcher for testing
+type MockIPFetcher struct {
+	GetIPv4Func func(ctx context.Context) (string, error)
+	GetIPv6Func func(ctx context.Context) (string, error)
+}
+
+func (m *MockIPFetcher) GetIPv4(ctx context.Context) (string, error) {
+	if m.GetIPv4Func != nil {
+		return m.GetIPv4Func(ctx)
+	}
+	return "192.168.1.1", nil
+}
+
+func (m *MockIPFetcher) GetIPv6(ctx context.Context) (string, error) {
+	if m.GetIPv6Func != nil {
+		return m.GetIPv6Func(ctx)
+	}
+	return "2001:db8::1", nil
+}
+
+// MockDNSProvider implements dnsmanager.DNSProvider for testing
+type MockDNSProvider struct {
+	GetZoneIDByNameFunc  func(ctx context.Context, zoneName string) (string, error)
+	EnsureDNSRecordsFunc func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error)
+}
+
+func (m *MockDNSProvider) GetZoneIDByName(ctx context.Context, zoneName string) (string, error) {
+	if m.GetZoneIDByNameFunc != nil {
+		return m.GetZoneIDByNameFunc(ctx, zoneName)
+	}
+	return "zone-123", nil
+}
+
+func (m *MockDNSProvider) EnsureDNSRecords(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+	if m.EnsureDNSRecordsFunc != nil {
+		return m.EnsureDNSRecordsFunc(ctx, zoneID, records, ipv4, ipv6)
+	}
+	return dnsmanager.Result{}, nil
+}
+
+// MockAccountDNSProvider additionally implements dnsmanager.AccountZoneResolver
+type MockAccountDNSProvider struct {
+	MockDNSProvider
+	GetZoneIDByNameInAccountFunc func(ctx context.Context, zoneName, accountID string) (string, error)
+}
+
+func (m *MockAccountDNSProvider) GetZoneIDByNameInAccount(ctx context.Context, zoneName, accountID string) (string, error) {
+	if m.GetZoneIDByNameInAccountFunc != nil {
+		return m.GetZoneIDByNameInAccountFunc(ctx, zoneName, accountID)
+	}
+	return "zone-" + accountID, nil
+}
+
+// MockDriftDNSProvider additionally implements dnsmanager.DriftChecker
+type MockDriftDNSProvider struct {
+	MockDNSProvider
+	CheckDNSRecordsFunc func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.DNSRecord, error)
+}
+
+func (m *MockDriftDNSProvider) CheckDNSRecords(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.DNSRecord, error) {
+	if m.CheckDNSRecordsFunc != nil {
+		return m.CheckDNSRecordsFunc(ctx, zoneID, records, ipv4, ipv6)
+	}
+	return nil, nil
+}
+
+// MockVerifyingDNSProvider additionally implements dnsmanager.CredentialVerifier
+type MockVerifyingDNSProvider struct {
+	MockDriftDNSProvider
+	VerifyCredentialsFunc func(ctx context.Context, accountID string) error
+}
+
+func (m *MockVerifyingDNSProvider) VerifyCredentials(ctx context.Context, accountID string) error {
+	if m.VerifyCredentialsFunc != nil {
+		return m.VerifyCredentialsFunc(ctx, accountID)
+	}
+	return nil
+}
+
+// MockPlanningDNSProvider additionally implements dnsmanager.Planner
+type MockPlanningDNSProvider struct {
+	MockDNSProvider
+	PlanDNSRecordsFunc func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.Change, error)
+}
+
+func (m *MockPlanningDNSProvider) PlanDNSRecords(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.Change, error) {
+	if m.PlanDNSRecordsFunc != nil {
+		return m.PlanDNSRecordsFunc(ctx, zoneID, records, ipv4, ipv6)
+	}
+	return nil, nil
+}
+
+// MockCachingDNSProvider additionally implements dnsmanager.CachedEnsurer
+type MockCachingDNSProvider struct {
+	MockDNSProvider
+	EnsureDNSRecordsCachedFunc func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error)
+}
+
+func (m *MockCachingDNSProvider) EnsureDNSRecordsCached(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string, progress func(dnsmanager.Progress)) (dnsmanager.Result, error) {
+	if m.EnsureDNSRecordsCachedFunc != nil {
+		return m.EnsureDNSRecordsCachedFunc(ctx, zoneID, records, ipv4, ipv6)
+	}
+	return dnsmanager.Result{}, nil
+}
+
+func TestNewIPWatcher_CloudflareProvider(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	// Should fail without API token
+	_, err := ipwatcher.NewIPWatcher(ctx, cfg, "")
+	if err == nil {
+		t.Error("Expected error when creating Cloudflare provider without API token")
+	}
+
+	// Should succeed with API token
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_Route53Provider(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "route53",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	// Route53 might fail if AWS credentials aren't configured - that's OK for this test
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "")
+	if err != nil {
+		t.Skipf("Skipping Route53 test - AWS credentials not configured: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_IPv6Support(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: true,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "AAAA", Proxied: false},
+				},
+			},
+		},
+	}
+
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_MultipleProviders(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_EmptyConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains:      []config.Domain{},
+	}
+
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher even with no domains")
+	}
+}
+
+func TestNewIPWatcher_MixedProviders(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: true,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+					{Name: "example.com", Type: "AAAA", Proxied: false},
+				},
+			},
+		},
+	}
+
+	// With API token for Cloudflare
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher with mixed providers: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_PerZoneToken(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				APIToken: "zone-token",
+				Records: []config.Record{
+					{Name: "@", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	// The zone-scoped token replaces the global one
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher with per-zone token: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+}
+
+func TestNewIPWatcher_CloudflareAccounts(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		CloudflareAccounts: []config.CloudflareAccount{
+			{Name: "client-a", APIToken: "token-a"},
+			{Name: "client-b", APIToken: "token-b"},
+		},
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "client-a.com",
+				Account:  "client-a",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+			{
+				Provider: "cloudflare",
+				ZoneName: "client-b.com",
+				Account:  "client-b",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	// Every zone is routed to an account, so no global token is needed
+	watcher, err := ipwatcher.NewIPWatcher(ctx, cfg, "")
+	if err != nil {
+		t.Fatalf("Failed to create IPWatcher with Cloudflare accounts: %v", err)
+	}
+
+	if watcher == nil {
+		t.Fatal("Expected non-nil watcher")
+	}
+
+	cfg.Domains[1].Account = "client-c"
+	if _, err := ipwatcher.NewIPWatcher(ctx, cfg, ""); err == nil {
+		t.Error("Expected error for domain referring to an unknown account")
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_RoutesZonesToAccounts(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "client-a.com", Account: "client-a", Records: []config.Record{{Name: "@", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "client-b.com", Account: "client-b", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	routed := make(map[string]string)
+	newAccount := func(name string) *MockDNSProvider {
+		return &MockDNSProvider{
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				routed[records[0].Root] = name
+				return dnsmanager.Result{}, nil
+			},
+		}
+	}
+
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{
+		config.CloudflareAccountKey("client-a"): newAccount("client-a"),
+		config.CloudflareAccountKey("client-b"): newAccount("client-b"),
+	})
+
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if routed["client-a.com"] != "client-a" || routed["client-b.com"] != "client-b" {
+		t.Errorf("Expected zones to be routed to their accounts, got %v", routed)
+	}
+}
+
+// Helper function to create a test watcher with mocks
+func createTestWatcher(cfg *config.Config, fetcher *MockIPFetcher, provider *MockDNSProvider) *ipwatcher.IPWatcher {
+	providers := make(map[string]dnsmanager.DNSProvider)
+	for _, d := range cfg.Domains {
+		providers[d.ProviderKey(d.Provider)] = provider
+	}
+	return ipwatcher.NewIPWatcherWithDeps(cfg, fetcher, providers)
+}
+
+func TestIPWatcher_GetZoneID(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			if zoneName == "example.com" {
+				return "zone-123", nil
+			}
+			return "", errors.New("zone not found")
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	// Test successful zone ID lookup
+	zoneID, err := watcher.GetZoneID(ctx, "example.com", "cloudflare")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if zoneID != "zone-123" {
+		t.Errorf("Expected zone-123, got %s", zoneID)
+	}
+
+	// Test caching - call again and it should use cache
+	zoneID2, err := watcher.GetZoneID(ctx, "example.com", "cloudflare")
+	if err != nil {
+		t.Errorf("Unexpected error on cached call: %v", err)
+	}
+	if zoneID2 != "zone-123" {
+		t.Errorf("Expected cached zone-123, got %s", zoneID2)
+	}
+
+	// Test unsupported provider
+	_, err = watcher.GetZoneID(ctx, "example.com", "invalid-provider")
+	if err == nil {
+		t.Error("Expected error for unsupported provider")
+	}
+
+	// Test zone not found
+	_, err = watcher.GetZoneID(ctx, "notfound.com", "cloudflare")
+	if err == nil {
+		t.Error("Expected error for zone not found")
+	}
+}
+
+func TestIPWatcher_FetchAndUpdateIPs(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			return "203.0.113.10", nil
+		},
+	}
+
+	ensureCalled := 0
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensureCalled++
+			if ipv4 != "203.0.113.10" {
+				t.Errorf("Expected IPv4 203.0.113.10, got %s", ipv4)
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	ctx := context.Background()
+
+	err := watcher.FetchAndUpdateIPs(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if ensureCalled != 1 {
+		t.Errorf("Expected EnsureDNSRecords to be called once, got %d", ensureCalled)
+	}
+}
+
+func TestIPWatcher_FetchAndUpdateIPs_WithIPv6(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: true,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+					{Name: "example.com", Type: "AAAA", Proxied: false},
+				},
+			},
+		},
+	}
+
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			return "203.0.113.10", nil
+		},
+		GetIPv6Func: func(ctx context.Context) (string, error) {
+			return "2001:db8::42", nil
+		},
+	}
+
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if ipv4 != "203.0.113.10" {
+				t.Errorf("Expected IPv4 203.0.113.10, got %s", ipv4)
+			}
+			if ipv6 != "2001:db8::42" {
+				t.Errorf("Expected IPv6 2001:db8::42, got %s", ipv6)
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	ctx := context.Background()
+
+	err := watcher.FetchAndUpdateIPs(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+					{Name: "www.example.com", Type: "A", Proxied: true},
+				},
+			},
+		},
+	}
+
+	ensureCalled := 0
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensureCalled++
+			if len(records) != 2 {
+				t.Errorf("Expected 2 records, got %d", len(records))
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	// First fetch IPs
+	_ = watcher.FetchAndUpdateIPs(ctx)
+
+	// Reset counter
+	ensureCalled = 0
+
+	// Now update DNS records
+	err := watcher.UpdateAllDNSRecords(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if ensureCalled != 1 {
+		t.Errorf("Expected EnsureDNSRecords to be called once, got %d", ensureCalled)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_ProviderError(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "", errors.New("zone lookup failed")
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	// First fetch IPs
+	_ = watcher.FetchAndUpdateIPs(ctx)
+
+	// Now try to update DNS records - should error
+	err := watcher.UpdateAllDNSRecords(ctx)
+	if err == nil {
+		t.Error("Expected error when zone lookup fails")
+	}
+}
+
+func TestIPWatcher_VerifyDNSRecords(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	verifyCalled := false
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			verifyCalled = true
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	// First fetch IPs
+	_ = watcher.FetchAndUpdateIPs(ctx)
+
+	// Reset flag
+	verifyCalled = false
+
+	// Now verify DNS records
+	err := watcher.VerifyDNSRecords(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if !verifyCalled {
+		t.Error("Expected EnsureDNSRecords to be called for verification")
+	}
+}
+
+func TestIPWatcher_CheckAndUpdateIP_NoChange(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			return "203.0.113.10", nil
+		},
+	}
+
+	ensureCalled := 0
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensureCalled++
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	ctx := context.Background()
+
+	// Initial fetch
+	_ = watcher.FetchAndUpdateIPs(ctx)
+	ensureCalled = 0 // Reset counter
+
+	// Check again - should not update because IP hasn't changed
+	err := watcher.CheckAndUpdateIP(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if ensureCalled != 0 {
+		t.Errorf("Expected no DNS updates when IP hasn't changed, but got %d calls", ensureCalled)
+	}
+}
+
+func TestIPWatcher_CheckAndUpdateIP_Changed(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "example.com", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	ipCallCount := 0
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			ipCallCount++
+			if ipCallCount == 1 {
+				return "203.0.113.10", nil
+			}
+			return "203.0.113.20", nil // Changed IP
+		},
+	}
+
+	ensureCalled := 0
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensureCalled++
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	ctx := context.Background()
+
+	// Initial fetch
+	_ = watcher.FetchAndUpdateIPs(ctx)
+	ensureCalled = 0 // Reset counter
+
+	// Check again - should update because IP has changed
+	err := watcher.CheckAndUpdateIP(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if ensureCalled != 1 {
+		t.Errorf("Expected DNS update when IP changed, got %d calls", ensureCalled)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_MultipleProviders(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: false,
+		Domains: []config.Domain{
+			{
+				Providers: []string{"cloudflare", "route53"},
+				ZoneName:  "example.com",
+				Records: []config.Record{
+					{Name: "@", Type: "A", Proxied: false},
+				},
+			},
+		},
+	}
+
+	cfCalled := false
+	cfProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			cfCalled = true
+			return dnsmanager.Result{}, nil
+		},
+	}
+	r53Provider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, errors.New("route53 unavailable")
+		},
+	}
+
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{
+		"cloudflare": cfProvider,
+		"route53":    r53Provider,
+	})
+
+	err := watcher.FetchAndUpdateIPs(context.Background())
+	if err == nil {
+		t.Fatal("Expected error from failing route53 provider")
+	}
+	if !strings.Contains(err.Error(), "route53") {
+		t.Errorf("Expected error to name the failing provider, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "cloudflare") {
+		t.Errorf("Expected cloudflare to succeed independently, got: %v", err)
+	}
+	if !cfCalled {
+		t.Error("Expected cloudflare provider to be updated despite route53 failure")
+	}
+}
+
+func TestIPWatcher_CheckAndUpdateIP_RollbackOnFailure(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:       0.1,
+		SyncRate:          1.0,
+		RollbackOnFailure: true,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+			{
+				Provider: "route53",
+				ZoneName: "example.net",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	ipCallCount := 0
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			ipCallCount++
+			if ipCallCount == 1 {
+				return "203.0.113.10", nil
+			}
+			return "203.0.113.20", nil
+		},
+	}
+
+	var cfPushed []string
+	cfProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			cfPushed = append(cfPushed, ipv4)
+			return dnsmanager.Result{}, nil
+		},
+	}
+	r53Calls := 0
+	r53Provider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			r53Calls++
+			if r53Calls > 1 {
+				return dnsmanager.Result{}, errors.New("route53 unavailable")
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, mockFetcher, map[string]dnsmanager.DNSProvider{
+		"cloudflare": cfProvider,
+		"route53":    r53Provider,
+	})
+	ctx := context.Background()
+
+	_ = watcher.FetchAndUpdateIPs(ctx)
+	cfPushed = nil
+
+	if err := watcher.CheckAndUpdateIP(ctx); err == nil {
+		t.Fatal("Expected error when a zone fails")
+	}
+
+	if len(cfPushed) != 2 || cfPushed[0] != "203.0.113.20" || cfPushed[1] != "203.0.113.10" {
+		t.Errorf("Expected cloudflare to be updated then rolled back, got %v", cfPushed)
+	}
+
+	txs := watcher.History()
+	if len(txs) != 1 {
+		t.Fatalf("Expected 1 transaction in history, got %d", len(txs))
+	}
+	if txs[0].Status != history.StatusRolledBack {
+		t.Errorf("Expected transaction status %s, got %s", history.StatusRolledBack, txs[0].Status)
+	}
+	if txs[0].OldIPv4 != "203.0.113.10" || txs[0].NewIPv4 != "203.0.113.20" {
+		t.Errorf("Unexpected transaction IPs: %+v", txs[0])
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_PriorityOrder(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "www", Type: "A"},
+					{Name: "mail", Type: "A", Priority: 10},
+				},
+			},
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.net",
+				Records: []config.Record{
+					{Name: "vpn", Type: "A", Priority: 10},
+				},
+			},
+		},
+	}
+
+	var order []string
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			for _, r := range records {
+				order = append(order, r.Name+"."+r.Root)
+			}
+			if records[0].Name == "mail" {
+				return dnsmanager.Result{}, errors.New("rate limited")
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+
+	err := watcher.FetchAndUpdateIPs(context.Background())
+	if err == nil {
+		t.Fatal("Expected error from failing high-priority record")
+	}
+
+	expected := []string{"mail.example.com", "vpn.example.net", "www.example.com"}
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected update order %v, got %v", expected, order)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_ScopesZoneLookupToAccount(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", AccountID: "account-b", Records: []config.Record{{Name: "@", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "example.net", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	zoneIDs := make(map[string]string)
+	provider := &MockAccountDNSProvider{
+		MockDNSProvider: MockDNSProvider{
+			GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+				return "zone-unscoped", nil
+			},
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				zoneIDs[records[0].Root] = zoneID
+				return dnsmanager.Result{}, nil
+			},
+		},
+	}
+
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{"cloudflare": provider})
+
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if zoneIDs["example.com"] != "zone-account-b" {
+		t.Errorf("Expected account-scoped zone lookup for example.com, got %s", zoneIDs["example.com"])
+	}
+	if zoneIDs["example.net"] != "zone-unscoped" {
+		t.Errorf("Expected unscoped zone lookup for example.net, got %s", zoneIDs["example.net"])
+	}
+}
+
+func TestIPWatcher_VerifyDNSRecords_DeltaOnly(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		AuditRate:   0.001, // Effectively never audit again during the test
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "@", Type: "A"},
+					{Name: "www", Type: "A"},
+				},
+			},
+		},
+	}
+
+	var verified [][]string
+	failWWW := false
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			var names []string
+			for _, r := range records {
+				names = append(names, r.FQDN())
+			}
+			verified = append(verified, names)
+			if failWWW {
+				return dnsmanager.Result{}, errors.New("transient failure")
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	// The first verification is a full audit
+	_ = watcher.FetchAndUpdateIPs(ctx)
+	verified = nil
+	if err := watcher.VerifyDNSRecords(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(verified) != 1 || len(verified[0]) != 2 {
+		t.Fatalf("Expected a full audit of 2 records, got %v", verified)
+	}
+
+	// Nothing changed since, so the delta pass reads nothing
+	verified = nil
+	if err := watcher.VerifyDNSRecords(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(verified) != 0 {
+		t.Fatalf("Expected no provider calls for unchanged records, got %v", verified)
+	}
+
+	// A failed update is re-verified on the next delta pass
+	failWWW = true
+	_ = watcher.UpdateAllDNSRecords(ctx)
+	failWWW = false
+	verified = nil
+	if err := watcher.VerifyDNSRecords(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(verified) != 1 || len(verified[0]) != 2 {
+		t.Fatalf("Expected records of the failed update to be verified again, got %v", verified)
+	}
+}
+
+// MockResolver answers A lookups from a fixed map and fails every other query
+type MockResolver struct {
+	answers map[string]string
+}
+
+func (m *MockResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if ip, ok := m.answers[host]; ok {
+		return []net.IP{net.ParseIP(ip)}, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (m *MockResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "", errors.New("no such host")
+}
+
+func (m *MockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, errors.New("no such host")
+}
+
+func TestIPWatcher_VerifyDNSRecords_Resolver(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Verify:   config.VerifyResolver,
+				Records: []config.Record{
+					{Name: "@", Type: "A"},
+					{Name: "www", Type: "A"},
+					{Name: "cdn", Type: "A", Proxied: true},
+					{Name: "vpn", Type: "A"},
+				},
+			},
+		},
+	}
+
+	var verified [][]string
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			var names []string
+			for _, r := range records {
+				names = append(names, r.FQDN())
+			}
+			verified = append(verified, names)
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	watcher.SetResolver(&MockResolver{answers: map[string]string{
+		"example.com":     "192.168.1.1",
+		"www.example.com": "192.168.1.1",
+		"cdn.example.com": "104.16.0.1",
+		"vpn.example.com": "192.168.1.2",
+	}})
+	ctx := context.Background()
+	_ = watcher.FetchAndUpdateIPs(ctx)
+
+	// Only the proxied record and the one answering with a stale address reach the provider
+	verified = nil
+	if err := watcher.VerifyDNSRecords(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "cdn.example.com,vpn.example.com"
+	if len(verified) != 1 || strings.Join(verified[0], ",") != want {
+		t.Fatalf("Expected %s to be verified at the provider, got %v", want, verified)
+	}
+
+	// Updates always go to the provider
+	verified = nil
+	if err := watcher.UpdateAllDNSRecords(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(verified) != 1 || len(verified[0]) != 4 {
+		t.Fatalf("Expected every record to be updated, got %v", verified)
+	}
+}
+
+// laggingResolver answers with the old address for its first lookups
+type laggingResolver struct {
+	MockResolver
+	mu      sync.Mutex
+	lookups int
+	lag     int
+	old     string
+}
+
+func (m *laggingResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lookups++
+	if m.lookups <= m.lag {
+		return []net.IP{net.ParseIP(m.old)}, nil
+	}
+	return m.MockResolver.LookupIP(ctx, network, host)
+}
+
+func TestIPWatcher_Propagation(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Propagation: &config.Propagation{Resolvers: []string{"1.1.1.1", "9.9.9.9"}, Interval: time.Millisecond, Timeout: time.Second},
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "vpn", Type: "A"},
+					{Name: "www", Type: "A", Proxied: true},
+				},
+			},
+		},
+	}
+
+	ip := "203.0.113.10"
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return ip, nil },
+	}
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) { return "zone-123", nil },
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	// The proxied www record answers with proxy addresses and must not hold up the measurement
+	watcher.SetPropagationResolver("1.1.1.1", &laggingResolver{
+		MockResolver: MockResolver{answers: map[string]string{"vpn.example.com": "203.0.113.20"}},
+		lag:          3,
+		old:          "203.0.113.10",
+	})
+	watcher.SetPropagationResolver("9.9.9.9", &MockResolver{answers: map[string]string{"vpn.example.com": "203.0.113.10"}})
+
+	ctx := context.Background()
+	if err := watcher.FetchAndUpdateIPs(ctx); err != nil {
+		t.Fatalf("FetchAndUpdateIPs failed: %v", err)
+	}
+	ip = "203.0.113.20"
+	if err := watcher.CheckAndUpdateIP(ctx); err != nil {
+		t.Fatalf("CheckAndUpdateIP failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statuses := watcher.Propagation()
+		if len(statuses) != 2 {
+			t.Fatalf("Expected 2 propagation statuses, got %+v", statuses)
+		}
+		fast, stuck := statuses[0], statuses[1]
+		if fast.Propagated && stuck.Timeouts == 1 {
+			if fast.Resolver != "1.1.1.1" || fast.Seconds <= 0 || stuck.Propagated {
+				t.Errorf("Unexpected propagation statuses %+v", statuses)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Propagation not measured in time: %+v", statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status ipwatcher.Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if len(status.Propagation) != 2 || status.Propagation[1].Timeouts != 1 {
+		t.Errorf("Expected propagation in the status, got %+v", status.Propagation)
+	}
+}
+
+func TestIPWatcher_PropagationProbes(t *testing.T) {
+	var apiKeys []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		apiKeys = append(apiKeys, r.Header.Get("X-Api-Key"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/dns-json")
+		switch q := r.URL.Query(); q.Get("name") + " " + q.Get("type") {
+		case "vpn.example.com A":
+			fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"vpn.example.com.","type":1,"TTL":60,"data":"203.0.113.20"}]}`)
+		case "vpn.example.com TXT":
+			fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"vpn.example.com.","type":16,"TTL":60,"data":"\"v=1\" \"site\""}]}`)
+		default:
+			fmt.Fprint(w, `{"Status":3}`)
+		}
+	}))
+	defer server.Close()
+
+	probe, err := ipwatcher.NewProbeResolver(config.Probe{
+		Name:    "fra",
+		URL:     server.URL + "/resolve",
+		Headers: []config.Header{{Name: "X-Api-Key", Value: "secret"}},
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("NewProbeResolver failed: %v", err)
+	}
+	ctx := context.Background()
+	if txts, err := probe.LookupTXT(ctx, "vpn.example.com"); err != nil || len(txts) != 1 || txts[0] != "v=1site" {
+		t.Errorf("Expected the joined TXT strings, got %v, %v", txts, err)
+	}
+	if _, err := probe.LookupIP(ctx, "ip6", "vpn.example.com"); err == nil {
+		t.Error("Expected an error for a name without AAAA records")
+	}
+
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Propagation: &config.Propagation{Resolvers: []string{"9.9.9.9"}, Quorum: 1, Interval: time.Millisecond, Timeout: time.Second},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "vpn", Type: "A"}}},
+		},
+	}
+	ip := "203.0.113.10"
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return ip, nil },
+	}
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) { return "zone-123", nil },
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	// The resolver never sees the change; the probe alone reaches the quorum of one
+	watcher.SetPropagationResolver("9.9.9.9", &MockResolver{answers: map[string]string{"vpn.example.com": "203.0.113.10"}})
+	watcher.SetPropagationProbe("fra", probe)
+
+	if err := watcher.FetchAndUpdateIPs(ctx); err != nil {
+		t.Fatalf("FetchAndUpdateIPs failed: %v", err)
+	}
+	if g := watcher.GlobalPropagation(); g != nil {
+		t.Errorf("Expected no global propagation before an IP change, got %+v", g)
+	}
+	ip = "203.0.113.20"
+	if err := watcher.CheckAndUpdateIP(ctx); err != nil {
+		t.Fatalf("CheckAndUpdateIP failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g := watcher.GlobalPropagation()
+		if g != nil && g.Propagated {
+			if g.Vantages != 2 || g.Confirmed != 1 || g.Quorum != 1 || g.Seconds <= 0 {
+				t.Errorf("Unexpected global propagation %+v", g)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Global propagation not reached in time: %+v", g)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	statuses := watcher.Propagation()
+	if len(statuses) != 2 || statuses[1].Resolver != "fra" || statuses[1].Vantage != "probe" || !statuses[1].Propagated {
+		t.Errorf("Expected the probe in the propagation statuses, got %+v", statuses)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range apiKeys {
+		if key != "secret" {
+			t.Errorf("Expected the probe header on every query, got %q", key)
+		}
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_ConfiguredZoneID(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				ZoneID:   "configured-zone",
+				Records:  []config.Record{{Name: "@", Type: "A"}},
+			},
+		},
+	}
+
+	var usedZoneID string
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			t.Error("Expected zone lookup to be skipped when zone_id is configured")
+			return "", errors.New("no zone read permission")
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			usedZoneID = zoneID
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usedZoneID != "configured-zone" {
+		t.Errorf("Expected configured zone ID, got %q", usedZoneID)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_ZoneNotFoundInvalidatesCache(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	lookups := 0
+	ensureErr := error(nil)
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			lookups++
+			return "zone-123", nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, ensureErr
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	_ = watcher.FetchAndUpdateIPs(ctx)
+	_ = watcher.UpdateAllDNSRecords(ctx)
+	if lookups != 1 {
+		t.Fatalf("Expected zone ID to be cached, got %d lookups", lookups)
+	}
+
+	ensureErr = fmt.Errorf("zone was deleted: %w", dnsmanager.ErrZoneNotFound)
+	err := watcher.UpdateAllDNSRecords(ctx)
+	if !errors.Is(err, dnsmanager.ErrZoneNotFound) {
+		t.Fatalf("Expected ErrZoneNotFound to be preserved, got %v", err)
+	}
+
+	ensureErr = nil
+	_ = watcher.UpdateAllDNSRecords(ctx)
+	if lookups != 2 {
+		t.Errorf("Expected zone ID to be looked up again after ErrZoneNotFound, got %d lookups", lookups)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_RecoversProviderPanic(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "bad.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "good.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	var updated []string
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return zoneName, nil
+		},
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if zoneID == "bad.com" {
+				var records map[string]string
+				records["@"] = ipv4 // nil map write panics
+			}
+			updated = append(updated, zoneID)
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	_ = watcher.FetchAndUpdateIPs(context.Background())
+	updated = nil
+
+	err := watcher.UpdateAllDNSRecords(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "panic in cloudflare provider for bad.com") {
+		t.Errorf("Expected recovered panic error, got %v", err)
+	}
+	if len(updated) != 1 || updated[0] != "good.com" {
+		t.Errorf("Expected good.com to still be updated, got %v", updated)
+	}
+	if got := watcher.Panics(); got != 2 {
+		t.Errorf("Expected 2 recovered panics, got %d", got)
+	}
+}
+
+func TestIPWatcher_StatusHandler(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			return "203.0.113.7", nil
+		},
+	}
+	watcher := createTestWatcher(cfg, mockFetcher, &MockDNSProvider{})
+	_ = watcher.FetchAndUpdateIPs(context.Background())
+
+	rec := httptest.NewRecorder()
+	watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var status ipwatcher.Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.IPv4 != "203.0.113.7" {
+		t.Errorf("Expected IPv4 203.0.113.7, got %s", status.IPv4)
+	}
+
+	rec = httptest.NewRecorder()
+	watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestIPWatcher_CheckClock(t *testing.T) {
+	// NTP server whose clock is a minute ahead
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		now := uint64(time.Now().Add(time.Minute).Unix()+2208988800) << 32
+		resp := make([]byte, 48)
+		resp[0], resp[1] = 0x1C, 2
+		copy(resp[24:32], buf[40:48])
+		binary.BigEndian.PutUint64(resp[32:], now)
+		binary.BigEndian.PutUint64(resp[40:], now)
+		conn.WriteTo(resp, addr)
+	}()
+
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		NTP:         &config.NTP{Server: conn.LocalAddr().String()},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	watcher.CheckClock(context.Background())
+
+	clock := watcher.Status().Clock
+	if clock == nil {
+		t.Fatal("Expected a clock check in status")
+	}
+	if !clock.Skewed || clock.Offset < 55 || clock.Offset > 65 {
+		t.Errorf("Expected a skewed clock about 60s behind, got %+v", clock)
+	}
+
+	watcher.CheckAndUpdateIP(context.Background())
+	txs := watcher.History()
+	if len(txs) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(txs))
+	}
+	if d := txs[0].NTPFinishedAt.Sub(txs[0].FinishedAt); d < 55*time.Second || d > 65*time.Second {
+		t.Errorf("Expected the NTP timestamp about 60s after the system one, got %v", d)
+	}
+}
+
+func TestIPWatcher_ProviderStatus(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			{Provider: "route53", ZoneName: "example.org", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{
+		"cloudflare": &MockDNSProvider{},
+		"route53": &MockDNSProvider{
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				return dnsmanager.Result{}, fmt.Errorf("access denied: %w", dnsmanager.ErrAuth)
+			},
+		},
+	})
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err == nil {
+		t.Fatal("Expected the route53 update to fail")
+	}
+
+	providers := watcher.Status().Providers
+	if len(providers) != 2 {
+		t.Fatalf("Expected status for 2 providers, got %+v", providers)
+	}
+	cf, r53 := providers[0], providers[1]
+	if cf.Provider != "cloudflare" || !cf.Healthy || cf.Requests != 2 || cf.Failures != 0 {
+		t.Errorf("Expected healthy cloudflare with 2 requests, got %+v", cf)
+	}
+	if r53.Provider != "route53" || r53.Healthy || r53.Failures != 1 || r53.ErrorKind != dnsmanager.ErrAuth.Error() {
+		t.Errorf("Expected unhealthy route53 with an authentication failure, got %+v", r53)
+	}
+	if r53.LastError == "" || r53.LastErrorAt.IsZero() {
+		t.Errorf("Expected route53 last error to be recorded, got %+v", r53)
+	}
+}
+
+func TestIPWatcher_DebugState(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Debug:       &config.Debug{Token: "debug-secret", Interval: time.Hour},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", APIToken: "zone-secret", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	mockFetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return "203.0.113.10", nil },
+	}
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) { return "zone-123", nil },
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, mockFetcher, mockProvider)
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("FetchAndUpdateIPs failed: %v", err)
+	}
+
+	dump := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		watcher.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := dump("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", rec.Code)
+	}
+	rec := dump("debug-secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "zone-secret") || strings.Contains(body, "debug-secret") {
+		t.Errorf("Expected secrets to be redacted, got %s", body)
+	}
+	var state ipwatcher.DebugState
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		t.Fatalf("Failed to decode debug state: %v", err)
+	}
+	if len(state.Fetches) != 1 || state.Fetches[0].IP != "203.0.113.10" {
+		t.Errorf("Expected the latest IPv4 fetch, got %+v", state.Fetches)
+	}
+	if len(state.ZoneIDs) != 1 || len(state.Verified) != 1 || state.Status.IPv4 != "203.0.113.10" {
+		t.Errorf("Expected caches and status in the dump, got %+v", state)
+	}
+
+	// A second dump within debug.interval is refused
+	if rec := dump("debug-secret"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestIPWatcher_API(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		API:         &config.API{Token: "api-secret"},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	call := func(method, path, token string) (*httptest.ResponseRecorder, ipwatcher.APIResponse) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		watcher.Handler().ServeHTTP(rec, req)
+		var answer ipwatcher.APIResponse
+		if rec.Code != http.StatusUnauthorized {
+			if err := json.NewDecoder(rec.Body).Decode(&answer); err != nil {
+				t.Fatalf("Failed to decode answer of %s %s: %v", method, path, err)
+			}
+		}
+		return rec, answer
+	}
+
+	if rec, _ := call(http.MethodPost, "/pause", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", rec.Code)
+	}
+	if rec, answer := call(http.MethodPost, "/pause", "api-secret"); rec.Code != http.StatusOK || answer.Message != "Paused" || !answer.Paused {
+		t.Errorf("Expected the watcher to be paused, got %d %+v", rec.Code, answer)
+	}
+	if rec, answer := call(http.MethodPost, "/pause", "api-secret"); rec.Code != http.StatusOK || answer.Message != "Already paused" {
+		t.Errorf("Expected a second pause to be a no-op, got %d %+v", rec.Code, answer)
+	}
+	if rec, answer := call(http.MethodPost, "/sync", "api-secret"); rec.Code != http.StatusConflict || answer.Error == "" {
+		t.Errorf("Expected 409 for a sync while paused, got %d %+v", rec.Code, answer)
+	}
+	if rec, answer := call(http.MethodPost, "/resume", "api-secret"); rec.Code != http.StatusOK || answer.Message != "Resumed" || answer.Paused {
+		t.Errorf("Expected the watcher to be resumed, got %d %+v", rec.Code, answer)
+	}
+
+	rec := httptest.NewRecorder()
+	watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history", nil))
+	var changes ipwatcher.ChangeHistory
+	if err := json.NewDecoder(rec.Body).Decode(&changes); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected the history, got %d: %v", rec.Code, err)
+	}
+	if changes.Transactions == nil || changes.Disagreements == nil {
+		t.Errorf("Expected empty lists rather than null, got %+v", changes)
+	}
+}
+
+func TestIPWatcher_APIDisabled(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	rec := httptest.NewRecorder()
+	watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pause", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without api, got %d", rec.Code)
+	}
+}
+
+func TestIPWatcher_OwnershipConflicts(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		OwnerID:     "home",
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}, {Name: "vpn", Type: "A"}}},
+		},
+	}
+	claimed := true
+	mockProvider := &MockDNSProvider{
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) { return "zone-123", nil },
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if claimed {
+				return dnsmanager.Result{}, &dnsmanager.ConflictError{Conflicts: []dnsmanager.Conflict{{Name: "www.example.com", Type: "A", Owner: "office"}}}
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	var alerts [][]ipwatcher.OwnershipConflict
+	watcher.SetConflictAlert(func(c []ipwatcher.OwnershipConflict) { alerts = append(alerts, c) })
+	ctx := context.Background()
+
+	// The conflict is alerted once, however many syncs find it
+	for i := 0; i < 2; i++ {
+		if err := watcher.UpdateAllDNSRecords(ctx); !errors.Is(err, dnsmanager.ErrNotOwner) {
+			t.Fatalf("Expected ErrNotOwner, got %v", err)
+		}
+	}
+	if len(alerts) != 1 || len(alerts[0]) != 1 || alerts[0][0].Owner != "office" || alerts[0][0].Zone != "example.com" {
+		t.Fatalf("Expected one alert for www.example.com, got %+v", alerts)
+	}
+	status := watcher.Status()
+	if status.Instance != "home" || len(status.Conflicts) != 1 {
+		t.Errorf("Expected instance home with one conflict, got %q and %+v", status.Instance, status.Conflicts)
+	}
+
+	// Once the other instance lets go, the conflict is resolved
+	claimed = false
+	if err := watcher.UpdateAllDNSRecords(ctx); err != nil {
+		t.Fatalf("UpdateAllDNSRecords failed: %v", err)
+	}
+	if conflicts := watcher.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Expected the conflict to be resolved, got %+v", conflicts)
+	}
+}
+
+func TestIPWatcher_RecordFailures(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}, {Name: "vpn", Type: "A"}}},
+		},
+	}
+	rejected := true
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if !rejected {
+				return dnsmanager.Result{Skipped: []string{"www.example.com A", "vpn.example.com A"}}, nil
+			}
+			err := fmt.Errorf("record rejected: %w", dnsmanager.ErrValidation)
+			return dnsmanager.Result{
+				Updated: []dnsmanager.Change{{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "A"}},
+				Errors:  []dnsmanager.RecordError{{Name: "vpn.example.com", Type: "A", Err: err}},
+			}, err
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := watcher.UpdateAllDNSRecords(ctx); err == nil {
+			t.Fatal("Expected the rejected record to fail the update")
+		}
+	}
+	failures := watcher.Status().RecordFailures
+	if len(failures) != 1 {
+		t.Fatalf("Expected only vpn.example.com to be failing, got %+v", failures)
+	}
+	f := failures[0]
+	if f.Name != "vpn.example.com" || f.Type != "A" || f.Provider != "cloudflare" || f.Zone != "example.com" {
+		t.Errorf("Unexpected failing record %+v", f)
+	}
+	if f.Failures != 3 || !strings.Contains(f.LastError, "record rejected") || f.LastErrorAt.IsZero() || f.Since.After(f.LastErrorAt) {
+		t.Errorf("Expected 3 failures with the latest error, got %+v", f)
+	}
+	if f.ErrorKind != dnsmanager.ErrValidation.Error() {
+		t.Errorf("Expected error kind %q, got %q", dnsmanager.ErrValidation, f.ErrorKind)
+	}
+
+	// The next successful update clears the record
+	rejected = false
+	if err := watcher.UpdateAllDNSRecords(ctx); err != nil {
+		t.Fatalf("UpdateAllDNSRecords failed: %v", err)
+	}
+	if failures := watcher.RecordFailures(); len(failures) != 0 {
+		t.Errorf("Expected no failing records, got %+v", failures)
+	}
+}
+
+func TestIPWatcher_StatusZones(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "example.org", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if zoneID == "zone-example.org" {
+				return dnsmanager.Result{}, errors.New("provider unavailable")
+			}
+			return dnsmanager.Result{Updated: []dnsmanager.Change{{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "A"}}}, nil
+		},
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-" + zoneName, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, mockProvider)
+
+	if err := watcher.UpdateAllDNSRecords(context.Background()); err == nil {
+		t.Fatal("Expected example.org to fail the update")
+	}
+	zones := watcher.Status().Zones
+	if len(zones) != 2 {
+		t.Fatalf("Expected the latest sync of both zones, got %+v", zones)
+	}
+	if z := zones[0]; z.Zone != "example.com" || !z.OK || !strings.Contains(z.Result, "updated 1") || z.Time.IsZero() {
+		t.Errorf("Expected example.com to be synced with 1 update, got %+v", z)
+	}
+	if z := zones[1]; z.Zone != "example.org" || z.OK || !strings.Contains(z.Error, "provider unavailable") {
+		t.Errorf("Expected example.org to have failed, got %+v", z)
+	}
+}
+
+func TestIPWatcher_HealthEndpoints(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Health:      &config.Health{MaxAge: time.Hour},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "example.org", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	failing := false
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if failing && zoneID == "zone-example.org" {
+				return dnsmanager.Result{}, errors.New("provider unavailable")
+			}
+			return dnsmanager.Result{}, nil
+		},
+		GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+			return "zone-" + zoneName, nil
+		},
+	})
+	get := func(path string) (int, ipwatcher.Health) {
+		rec := httptest.NewRecorder()
+		watcher.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var h ipwatcher.Health
+		if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		return rec.Code, h
+	}
+
+	// Alive before the first fetch, but not ready before the first sync
+	if code, h := get("/healthz"); code != http.StatusOK || !h.OK {
+		t.Errorf("Expected a starting daemon to be alive, got %d %+v", code, h)
+	}
+	if code, h := get("/readyz"); code != http.StatusServiceUnavailable || h.OK {
+		t.Errorf("Expected a daemon without a sync not to be ready, got %d %+v", code, h)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if code, h := get("/readyz"); code != http.StatusOK || !h.OK {
+		t.Errorf("Expected the daemon to be ready after the first sync, got %d %+v", code, h)
+	}
+
+	// A failing zone stays ready until it failed for longer than max_age
+	failing = true
+	watcher.UpdateAllDNSRecords(context.Background())
+	h := watcher.Readiness(time.Now())
+	if !h.OK || !slices.ContainsFunc(h.Checks, func(c ipwatcher.HealthCheck) bool {
+		return c.Name == "zone example.org (cloudflare)" && strings.Contains(c.Error, "provider unavailable")
+	}) {
+		t.Errorf("Expected a recent zone failure to be reported but ready, got %+v", h)
+	}
+	if h := watcher.Readiness(time.Now().Add(2 * time.Hour)); h.OK {
+		t.Errorf("Expected a zone failing for longer than max_age not to be ready, got %+v", h)
+	}
+
+	// Checks that stopped for longer than max_age fail the liveness
+	if h := watcher.Liveness(time.Now().Add(2 * time.Hour)); h.OK {
+		t.Errorf("Expected fetches older than max_age to fail the liveness, got %+v", h)
+	}
+}
+
+func TestIPWatcher_ReadOnly_ReportsDriftWithoutUpdating(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		ReadOnly:    true,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}, {Name: "www", Type: "A"}}},
+			{Provider: "exec", ZoneName: "example.net", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	provider := &MockDriftDNSProvider{
+		MockDNSProvider: MockDNSProvider{
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				t.Error("EnsureDNSRecords must not be called in read-only mode")
+				return dnsmanager.Result{}, nil
+			},
+		},
+		CheckDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.DNSRecord, error) {
+			var drifted []dnsmanager.DNSRecord
+			for _, r := range records {
+				if r.Name == "www" {
+					drifted = append(drifted, r)
+				}
+			}
+			return drifted, nil
+		},
+	}
+	execProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			t.Error("EnsureDNSRecords must not be called in read-only mode")
+			return dnsmanager.Result{}, nil
+		},
+	}
+
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{
+		"cloudflare": provider,
+		"exec":       execProvider,
+	})
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	drift := watcher.Drift()
+	if len(drift) != 1 || drift[0].Record != "www.example.com" || drift[0].Expected != "192.168.1.1" {
+		t.Fatalf("Expected www.example.com to be reported as drifted to 192.168.1.1, got %+v", drift)
+	}
+	if status := watcher.Status(); !status.ReadOnly || len(status.Drift) != 1 {
+		t.Errorf("Expected read-only status with one drifted record, got %+v", status)
+	}
+}
+
+func TestIPWatcher_Once(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	upToDate := false
+	mockProvider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if upToDate {
+				return dnsmanager.Result{Skipped: []string{"www.example.com A"}}, nil
+			}
+			return dnsmanager.Result{Updated: []dnsmanager.Change{{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "A"}}}, nil
+		},
+	}
+	fetcher := &MockIPFetcher{}
+	watcher := createTestWatcher(cfg, fetcher, mockProvider)
+	ctx := context.Background()
+
+	if changes, err := watcher.Once(ctx); err != nil || changes != 1 {
+		t.Errorf("Expected 1 change, got %d and error %v", changes, err)
+	}
+	upToDate = true
+	if changes, err := watcher.Once(ctx); err != nil || changes != 0 {
+		t.Errorf("Expected no changes, got %d and error %v", changes, err)
+	}
+
+	// Unlike the daemon, a failed fetch is an error, even though the last address is kept
+	fetcher.GetIPv4Func = func(ctx context.Context) (string, error) {
+		return "", errors.New("connection refused")
+	}
+	if _, err := watcher.Once(ctx); err == nil || !strings.Contains(err.Error(), "failed to fetch ipv4") {
+		t.Errorf("Expected the failed IPv4 fetch to be reported, got %v", err)
+	}
+}
+
+func TestIPWatcher_Preflight(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+			{Provider: "cloudflare", ZoneName: "example.org", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		verifyErr   error
+		zoneErr     error
+		recordsErr  error
+		expectError string
+	}{
+		{name: "all checks pass"},
+		{name: "invalid token", verifyErr: fmt.Errorf("API token is disabled: %w", dnsmanager.ErrAuth), expectError: "cloudflare credentials for example.com"},
+		{name: "zone not visible", zoneErr: fmt.Errorf("zone not found: %w", dnsmanager.ErrZoneNotFound), expectError: "zone example.org (cloudflare)"},
+		{name: "records not readable", recordsErr: fmt.Errorf("forbidden: %w", dnsmanager.ErrAuth), expectError: "records of example.com (cloudflare)"},
+		{name: "transient failure is only logged", verifyErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifyCalls := 0
+			provider := &MockVerifyingDNSProvider{
+				MockDriftDNSProvider: MockDriftDNSProvider{
+					MockDNSProvider: MockDNSProvider{
+						GetZoneIDByNameFunc: func(ctx context.Context, zoneName string) (string, error) {
+							if zoneName == "example.org" && tt.zoneErr != nil {
+								return "", tt.zoneErr
+							}
+							return "zone-" + zoneName, nil
+						},
+					},
+					CheckDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.DNSRecord, error) {
+						if zoneID == "zone-example.com" {
+							return nil, tt.recordsErr
+						}
+						return nil, nil
+					},
+				},
+				VerifyCredentialsFunc: func(ctx context.Context, accountID string) error {
+					verifyCalls++
+					return tt.verifyErr
+				},
+			}
+
+			watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{"cloudflare": provider})
+			err := watcher.Preflight(context.Background())
+			if verifyCalls != 1 {
+				t.Errorf("Expected shared credentials to be verified once, got %d", verifyCalls)
+			}
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestIPWatcher_DryRun_SkipsProvidersWithoutDryRun(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		DryRun:      true,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "@", Type: "A"}}},
+		},
+	}
+	provider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			t.Fatal("Dry run must not update a provider that cannot plan changes")
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, provider)
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestIPWatcher_PlanAndApply(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	current := "192.0.2.1"
+	var applied []string
+	provider := &MockPlanningDNSProvider{
+		MockDNSProvider: MockDNSProvider{
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				applied = append(applied, ipv4)
+				return dnsmanager.Result{}, nil
+			},
+		},
+		PlanDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.Change, error) {
+			if current == ipv4 {
+				return nil, nil
+			}
+			return []dnsmanager.Change{
+				{Action: dnsmanager.ChangeUpdate, Name: "www.example.com", Type: "A", OldContent: current, NewContent: ipv4},
+			}, nil
+		},
+	}
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{"cloudflare": provider})
+
+	plan, err := watcher.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected plan error: %v", err)
+	}
+	if len(plan.Zones) != 1 || plan.Zones[0].Zone != "example.com" || len(plan.Zones[0].Changes) != 1 {
+		t.Fatalf("Expected one change for example.com, got %+v", plan.Zones)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("Plan must not apply changes, got %v", applied)
+	}
+
+	// The zone changed behind the plan's back, so applying it must be refused
+	current = "192.0.2.2"
+	if err := watcher.Apply(context.Background(), plan); err == nil {
+		t.Fatal("Expected stale plan to be rejected")
+	}
+	if len(applied) != 0 {
+		t.Fatalf("Stale plan must not apply changes, got %v", applied)
+	}
+
+	current = "192.0.2.1"
+	if err := watcher.Apply(context.Background(), plan); err != nil {
+		t.Fatalf("Unexpected apply error: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != plan.IPv4 {
+		t.Errorf("Expected the plan to be applied with %s, got %v", plan.IPv4, applied)
+	}
+}
+
+func TestIPWatcher_PlanFamilies(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: true,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "AAAA"}}},
+		},
+	}
+	ipv4Fetches := 0
+	fetcher := &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) {
+			ipv4Fetches++
+			return "", errors.New("no IPv4 route")
+		},
+		GetIPv6Func: func(ctx context.Context) (string, error) { return "2001:db8::1", nil },
+	}
+	var planned []string
+	provider := &MockPlanningDNSProvider{
+		PlanDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) ([]dnsmanager.Change, error) {
+			planned = append(planned, ipv4+"|"+ipv6)
+			return nil, nil
+		},
+	}
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, fetcher, map[string]dnsmanager.DNSProvider{"cloudflare": provider})
+
+	// Without A records, IPv4 is not fetched
+	plan, err := watcher.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected plan error: %v", err)
+	}
+	if ipv4Fetches != 0 || plan.IPv4 != "" || plan.IPv6 != "2001:db8::1" {
+		t.Errorf("Expected only IPv6 to be fetched, got %d IPv4 fetches and plan %+v", ipv4Fetches, plan)
+	}
+
+	// A failed IPv4 fetch leaves the A records out instead of failing the plan
+	cfg.Domains[0].Records = append(cfg.Domains[0].Records, config.Record{Name: "www", Type: "A"})
+	if plan, err = watcher.Plan(context.Background()); err != nil {
+		t.Fatalf("Expected a failed IPv4 fetch not to fail the plan, got %v", err)
+	}
+	if ipv4Fetches != 1 || plan.IPv4 != "" {
+		t.Errorf("Expected IPv4 to be fetched once and left out, got %d fetches and plan %+v", ipv4Fetches, plan)
+	}
+	if want := []string{"|2001:db8::1", "|2001:db8::1"}; !slices.Equal(planned, want) {
+		t.Errorf("Expected the zone to be planned without IPv4, got %v", planned)
+	}
+}
+
+func TestIPWatcher_FetchAndUpdateIPs_Channels(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Channels: []config.Channel{
+			{Name: "lte-backup", Family: "ipv4", Sources: []config.IPSource{{URL: "https://echo.lte.example/ip"}}},
+		},
+		Domains: []config.Domain{
+			{
+				Provider: "cloudflare",
+				ZoneName: "example.com",
+				Records: []config.Record{
+					{Name: "www", Type: "A"},
+					{Name: "backup", Type: "A", Channel: "lte-backup"},
+				},
+			},
+		},
+	}
+
+	published := make(map[string]string)
+	provider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			for _, r := range records {
+				published[r.Name] = ipv4
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return "203.0.113.10", nil },
+	}, provider)
+	watcher.SetChannelFetcher("lte-backup", &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return "198.51.100.7", nil },
+	})
+
+	if err := watcher.FetchAndUpdateIPs(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if published["www"] != "203.0.113.10" {
+		t.Errorf("Expected www to publish the default IPv4, got %q", published["www"])
+	}
+	if published["backup"] != "198.51.100.7" {
+		t.Errorf("Expected backup to publish the channel address, got %q", published["backup"])
+	}
+	if got := watcher.Status().Channels["lte-backup"]; got != "198.51.100.7" {
+		t.Errorf("Expected status to report the channel address, got %q", got)
+	}
+}
+
+func TestIPWatcher_UpdateAllDNSRecords_Heartbeat(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Heartbeat:   &config.Heartbeat{Interval: time.Hour},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+
+	var heartbeats []string
+	provider := &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			for _, r := range records {
+				if r.Type == dnsmanager.TXTRecord {
+					heartbeats = append(heartbeats, r.FQDN()+" "+r.Target)
+				}
+			}
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, provider)
+
+	for i := 0; i < 2; i++ {
+		if err := watcher.UpdateAllDNSRecords(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(heartbeats) != 2 {
+		t.Fatalf("Expected a heartbeat on every update, got %v", heartbeats)
+	}
+	if !strings.HasPrefix(heartbeats[0], "_ipwatcher-heartbeat.example.com \"heritage=ipwatcher,updated=") {
+		t.Errorf("Unexpected heartbeat record %q", heartbeats[0])
+	}
+	if heartbeats[0] != heartbeats[1] {
+		t.Errorf("Expected the timestamp to hold within the interval, got %q and %q", heartbeats[0], heartbeats[1])
+	}
+}
+
+func TestIPWatcher_MetricsTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipwatcher.prom")
+	cfg := &config.Config{
+		RefreshRate:     0.1,
+		SyncRate:        1.0,
+		MetricsTextfile: path,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected metrics file to be written: %v", err)
+	}
+	for _, want := range []string{
+		`ipwatcher_current_ip_info{family="ipv4",address="192.168.1.1"} 1`,
+		`ipwatcher_provider_healthy{provider="cloudflare"} 1`,
+		`ipwatcher_provider_requests_total{provider="cloudflare"} 2`,
+		"# TYPE ipwatcher_panics_total counter",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "ipwatcher_record_failures") {
+		t.Errorf("Expected no record failures without failing records, got:\n%s", data)
+	}
+}
+
+func TestIPWatcher_StatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	client, err := statsd.New(conn.LocalAddr().String(), statsd.Options{Prefix: "ipwatcher", DogStatsD: true, Tags: []string{"env:test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.SetStatsD(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	var received string
+	buf := make([]byte, 65536)
+	for !strings.Contains(received, "ipwatcher.panics_total:") {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected every metric to be sent, got %v:\n%s", err, received)
+		}
+		received += string(buf[:n]) + "\n"
+	}
+	for _, want := range []string{
+		"ipwatcher.current_ip_info:1|g|#family:ipv4,address:192.168.1.1,env:test\n",
+		"ipwatcher.provider_healthy:1|g|#provider:cloudflare,env:test\n",
+		"ipwatcher.provider_requests_total:2|g|#provider:cloudflare,env:test\n",
+		"ipwatcher.panics_total:0|g|#env:test\n",
+	} {
+		if !strings.Contains(received, want) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", want, received)
+		}
+	}
+}
+
+func TestIPWatcher_MetricsTextfile_RecordFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipwatcher.prom")
+	cfg := &config.Config{
+		RefreshRate:     0.1,
+		SyncRate:        1.0,
+		MetricsTextfile: path,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			err := errors.New("content rejected")
+			return dnsmanager.Result{Errors: []dnsmanager.RecordError{{Name: "www.example.com", Type: "A", Err: err}}}, err
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected metrics file to be written: %v", err)
+	}
+	for _, want := range []string{
+		`ipwatcher_record_failures{provider="cloudflare",name="www.example.com",type="A"} 1`,
+		`ipwatcher_record_last_error_timestamp_seconds{provider="cloudflare",name="www.example.com",type="A"} `,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestIPWatcher_SyncBeforeShutdown(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	var ensures int
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensures++
+			if ensures == 1 {
+				return dnsmanager.Result{}, errors.New("rate limited")
+			}
+			return dnsmanager.Result{}, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// The failed first sync is retried once before exiting
+	if ensures != 2 {
+		t.Fatalf("Expected the records to be synced again before shutdown, got %d ensures", ensures)
+	}
+}
+
+func TestIPWatcher_SystemdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets are not supported: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+
+	// The socket only queues a few datagrams, so they are read while the watcher runs
+	received := make(chan []string)
+	go func() {
+		var states []string
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				received <- states
+				return
+			}
+			states = append(states, string(buf[:n]))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	states := <-received
+	if len(states) == 0 || states[0] != "STATUS=IPv4 192.168.1.1, IPv6 none\nREADY=1" {
+		t.Fatalf("Expected the first sync to report the IPs and readiness, got %q", states)
+	}
+	if !slices.Contains(states, "WATCHDOG=1") {
+		t.Errorf("Expected watchdog keepalives, got %q", states)
+	}
+	if states[len(states)-1] != "STOPPING=1" {
+		t.Errorf("Expected STOPPING=1 last, got %q", states)
+	}
+}
+
+func TestIPWatcher_JobJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal := jobs.NewJournal(filepath.Join(dir, "jobs.json"))
+	if err := journal.Begin(jobs.Job{Key: "cloudflare|removed.example", Zone: "removed.example"}, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	metricsPath := filepath.Join(dir, "ipwatcher.prom")
+	cfg := &config.Config{
+		RefreshRate:     0.1,
+		SyncRate:        1.0,
+		MetricsTextfile: metricsPath,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	failing := true
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			if failing {
+				return dnsmanager.Result{}, errors.New("rate limited")
+			}
+			return dnsmanager.Result{}, nil
+		},
+	})
+	watcher.SetJobJournal(journal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// The job of the removed zone is dropped, the failed update stays pending
+	pending, err := journal.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Zone != "example.com" || !strings.Contains(pending[0].LastError, "rate limited") {
+		t.Fatalf("Expected the failed update of example.com to be pending, got %+v, %v", pending, err)
+	}
+	data, _ := os.ReadFile(metricsPath)
+	if !strings.Contains(string(data), "ipwatcher_job_queue_depth 1") {
+		t.Errorf("Expected a journal depth of 1, got:\n%s", data)
+	}
+
+	failing = false
+	if err := watcher.VerifyDNSRecords(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pending, _ := journal.Pending(); len(pending) != 0 {
+		t.Errorf("Expected the journal to be empty after a successful retry, got %+v", pending)
+	}
+}
+
+func TestIPWatcher_CachedUpdates(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	var cached, listed int
+	provider := &MockCachingDNSProvider{
+		MockDNSProvider: MockDNSProvider{
+			EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+				listed++
+				return dnsmanager.Result{}, nil
+			},
+		},
+		EnsureDNSRecordsCachedFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			cached++
+			return dnsmanager.Result{}, nil
+		},
+	}
+	watcher := ipwatcher.NewIPWatcherWithDeps(cfg, &MockIPFetcher{}, map[string]dnsmanager.DNSProvider{"cloudflare": provider})
+
+	// An IP change is written from the cache
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cached != 1 || listed != 0 {
+		t.Fatalf("Expected the IP change to use the record cache, got %d cached and %d listed updates", cached, listed)
+	}
+
+	// A sync always reads the zone
+	if err := watcher.VerifyDNSRecords(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cached != 1 || listed != 1 {
+		t.Errorf("Expected the sync to list the zone, got %d cached and %d listed updates", cached, listed)
+	}
+}
+
+func TestIPWatcher_CreateAfter(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{
+				{Name: "www", Type: "A"},
+				{Name: "new", Type: "A", CreateAfter: 50 * time.Millisecond},
+			}},
+		},
+	}
+	held := make(map[string]bool)
+	ipv4 := "192.168.1.1"
+	watcher := createTestWatcher(cfg, &MockIPFetcher{
+		GetIPv4Func: func(ctx context.Context) (string, error) { return ipv4, nil },
+	}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			for _, r := range records {
+				held[r.Name] = r.NoCreate
+			}
+			return dnsmanager.Result{}, nil
+		},
+	})
+
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if held["www"] || !held["new"] {
+		t.Fatalf("Expected only the new record to be held back, got %v", held)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := watcher.VerifyDNSRecords(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if held["new"] {
+		t.Fatal("Expected the record to be created once its address was stable")
+	}
+
+	// A new address starts the grace period again
+	ipv4 = "192.168.1.2"
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !held["new"] {
+		t.Error("Expected the record to be held back after the address changed")
+	}
+}
+
+func TestIPWatcher_Events(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := events.NewBus()
+	watcher.SetEvents(bus)
+	if watcher.Events() != bus {
+		t.Fatal("Expected the watcher to publish to the bus it was given")
+	}
+	ch := bus.Subscribe(ctx)
+
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	change, ok := (<-ch).(events.IPChange)
+	if !ok || change.Family != "ipv4" || change.Old != "" || change.New != "192.168.1.1" {
+		t.Errorf("Expected the IPv4 change first, got %+v", change)
+	}
+	update, ok := (<-ch).(events.RecordChange)
+	if !ok || update.Zone != "example.com" || update.Err != nil || len(update.Records) != 1 || update.Records[0] != "www.example.com" {
+		t.Errorf("Expected the record change of www.example.com, got %+v", update)
+	}
+}
+
+type mockIPPublisher struct {
+	calls []string
+	err   error
+}
+
+func (m *mockIPPublisher) PublishIP(ctx context.Context, ipv4, ipv6 string, at time.Time) error {
+	m.calls = append(m.calls, ipv4+"|"+ipv6)
+	return m.err
+}
+
+func TestIPWatcher_PublishIPs(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate:  0.1,
+		SyncRate:     1.0,
+		SupportsIPv6: true,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	fetcher := &MockIPFetcher{}
+	watcher := createTestWatcher(cfg, fetcher, &MockDNSProvider{})
+	publisher := &mockIPPublisher{err: errors.New("KV unavailable")}
+	watcher.SetIPPublisher(publisher)
+
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The failed publish is retried once the publisher recovers, and unchanged IPs are stored only once
+	publisher.err = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 2 {
+		watcher.Run(ctx)
+	}
+	want := []string{"192.168.1.1|2001:db8::1", "192.168.1.1|2001:db8::1"}
+	if !slices.Equal(publisher.calls, want) {
+		t.Fatalf("Expected publishes %v, got %v", want, publisher.calls)
+	}
+
+	// A new address is published right away
+	fetcher.GetIPv4Func = func(ctx context.Context) (string, error) { return "198.51.100.7", nil }
+	if err := watcher.CheckAndUpdateIP(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last := publisher.calls[len(publisher.calls)-1]; last != "198.51.100.7|2001:db8::1" {
+		t.Errorf("Expected the new IPv4 to be published, got %s", last)
+	}
+}
+
+type mockLocalDNS struct {
+	calls [][]localdns.Host
+	err   error
+}
+
+func (m *mockLocalDNS) Sync(ctx context.Context, hosts []localdns.Host) error {
+	m.calls = append(m.calls, hosts)
+	return m.err
+}
+
+func TestIPWatcher_LocalDNS(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Channels:    []config.Channel{{Name: "office", Family: "ipv4"}},
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{
+				{Name: "@", Type: "A"},
+				{Name: "@", Type: "AAAA"},
+				{Name: "nas", Type: "A"},
+				{Name: "vpn", Type: "A", Channel: "office"},
+				{Name: "www", Type: "CNAME", Target: "example.com"},
+			}},
+		},
+		LocalDNS: &config.LocalDNS{Type: config.LocalDNSHosts},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{})
+	server := &mockLocalDNS{}
+	watcher.SetLocalDNS(server, func() (string, string, error) { return "192.168.1.10", "fd00::10", nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	watcher.Run(ctx)
+
+	// Records on a channel and CNAMEs are left out
+	want := []localdns.Host{
+		{Name: "example.com", IPv4: "192.168.1.10", IPv6: "fd00::10"},
+		{Name: "nas.example.com", IPv4: "192.168.1.10"},
+	}
+	if len(server.calls) != 1 || !slices.Equal(server.calls[0], want) {
+		t.Fatalf("Expected one sync of %v, got %v", want, server.calls)
+	}
+
+	// local_dns.names replaces the record names
+	cfg.LocalDNS.Names = []string{"home.lan"}
+	watcher.Run(ctx)
+	if last := server.calls[len(server.calls)-1]; !slices.Equal(last, []localdns.Host{{Name: "home.lan", IPv4: "192.168.1.10", IPv6: "fd00::10"}}) {
+		t.Errorf("Expected local_dns.names to be published, got %v", last)
+	}
+
+	// Nothing is changed in read-only mode
+	cfg.ReadOnly = true
+	calls := len(server.calls)
+	watcher.Run(ctx)
+	if len(server.calls) != calls {
+		t.Error("Expected no local DNS sync in read-only mode")
+	}
+}
+
+func TestSummarizer(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.1,
+		SyncRate:    1.0,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			return dnsmanager.Result{}, errors.New("rate limited")
+		},
+	})
+	started := time.Now().Add(-25 * time.Hour)
+	summarizer := ipwatcher.NewSummarizer(watcher, started)
+
+	if err := watcher.CheckAndUpdateIP(context.Background()); err == nil {
+		t.Fatal("Expected the failed update to be reported")
+	}
+
+	now := time.Now()
+	summary := summarizer.Next(now)
+	if !summary.Since.Equal(started) || summary.IPChanges != 1 || summary.IPv4 != "192.168.1.1" || summary.UptimeSeconds < 25*3600 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Provider != "cloudflare" || summary.Errors[0].Failures != 1 || !strings.Contains(summary.Errors[0].LastError, "rate limited") {
+		t.Errorf("Expected one cloudflare failure, got %+v", summary.Errors)
+	}
+
+	// A quiet period still reports, without the changes and errors of the previous one
+	quiet := summarizer.Next(now.Add(24 * time.Hour))
+	if !quiet.Since.Equal(now) || quiet.IPChanges != 0 || len(quiet.Errors) != 0 {
+		t.Errorf("Expected an empty period, got %+v", quiet)
+	}
+	if msg := ipwatcher.SummaryMessage(quiet); !strings.Contains(msg, "0 IP changes, IPv4 192.168.1.1, no errors") {
+		t.Errorf("Unexpected summary message %q", msg)
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	oldCfg := &config.Config{
+		HistoryFile:     filepath.Join(oldDir, "history.json"),
+		RecordCacheFile: filepath.Join(oldDir, "records.json"),
+		JobQueueFile:    filepath.Join(oldDir, "jobs.json"),
+	}
+	state := history.State{IPv4: "203.0.113.10", NextID: 1, Transactions: []history.Transaction{{ID: 1, NewIPv4: "203.0.113.10"}}}
+	if err := history.WriteFile(oldCfg.HistoryFile, state); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	records := `{"zone-123":{"www.example.com|A":{"id":"rec-1","content":"203.0.113.10"}}}`
+	if err := os.WriteFile(oldCfg.RecordCacheFile, []byte(records), 0600); err != nil {
+		t.Fatalf("Failed to write record cache: %v", err)
+	}
+
+	archive, err := ipwatcher.ExportState(oldCfg, time.Now())
+	if err != nil {
+		t.Fatalf("ExportState failed: %v", err)
+	}
+	// The job file does not exist yet, so it is not exported
+	if len(archive.Files) != 2 {
+		t.Fatalf("Expected 2 exported files, got %v", archive.Files)
+	}
+
+	newCfg := &config.Config{
+		HistoryFile: filepath.Join(newDir, "state", "history.json"),
+	}
+	skipped, err := ipwatcher.ImportState(newCfg, archive, false)
+	if err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0] != "record_cache_file" {
+		t.Errorf("Expected record_cache_file to be skipped, got %v", skipped)
+	}
+	imported, err := history.ReadFile(newCfg.HistoryFile)
+	if err != nil {
+		t.Fatalf("Failed to read imported history: %v", err)
+	}
+	if imported.IPv4 != "203.0.113.10" || len(imported.Transactions) != 1 {
+		t.Errorf("Unexpected imported history %+v", imported)
+	}
+
+	if _, err := ipwatcher.ImportState(newCfg, archive, false); err == nil {
+		t.Error("Expected an error when the history file already exists")
+	}
+	if _, err := ipwatcher.ImportState(newCfg, archive, true); err != nil {
+		t.Errorf("Expected -force to replace existing files, got %v", err)
+	}
+}
+
+func TestIPWatcher_PauseAndForceSync(t *testing.T) {
+	cfg := &config.Config{
+		RefreshRate: 0.001,
+		SyncRate:    0.001,
+		Domains: []config.Domain{
+			{Provider: "cloudflare", ZoneName: "example.com", Records: []config.Record{{Name: "www", Type: "A"}}},
+		},
+	}
+	var ensures atomic.Int64
+	watcher := createTestWatcher(cfg, &MockIPFetcher{}, &MockDNSProvider{
+		EnsureDNSRecordsFunc: func(ctx context.Context, zoneID string, records []dnsmanager.DNSRecord, ipv4, ipv6 string) (dnsmanager.Result, error) {
+			ensures.Add(1)
+			return dnsmanager.Result{}, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer syncCancel()
+	before := ensures.Load()
+	if err := watcher.ForceSync(syncCtx); err != nil {
+		t.Fatalf("ForceSync failed: %v", err)
+	}
+	if ensures.Load() == before {
+		t.Error("Expected a forced sync to verify the records")
+	}
+
+	if !watcher.Pause() || watcher.Pause() {
+		t.Error("Expected only the first Pause to pause the watcher")
+	}
+	if watcher.Status().PausedAt.IsZero() {
+		t.Error("Expected the status to report the pause")
+	}
+	if err := watcher.ForceSync(syncCtx); err == nil {
+		t.Error("Expected a forced sync of a paused watcher to fail")
+	}
+	if !watcher.Resume() || watcher.Resume() {
+		t.Error("Expected only the first Resume to resume the watcher")
+	}
+	if err := watcher.ForceSync(syncCtx); err != nil {
+		t.Errorf("Expected a forced sync after resuming, got %v", err)
+	}
+}
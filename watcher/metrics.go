@@ -0,0 +1,178 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/history"
+)
+
+// writeMetrics renders the daemon state in the Prometheus text exposition format
+func (w *IPWatcher) writeMetrics(out io.Writer) {
+	s := w.Status()
+
+	gauge(out, "ipwatcher_info", "Version of the running watcher", "version", s.Version, 1)
+	gauge(out, "ipwatcher_read_only", "Whether DNS records are only checked, never changed", "", "", boolValue(s.ReadOnly))
+
+	fmt.Fprintln(out, "# HELP ipwatcher_current_ip_info Public address currently published for each family")
+	fmt.Fprintln(out, "# TYPE ipwatcher_current_ip_info gauge")
+	if s.IPv4 != "" {
+		fmt.Fprintf(out, "ipwatcher_current_ip_info{family=\"ipv4\",address=%s} 1\n", quote(s.IPv4))
+	}
+	if s.IPv6 != "" {
+		fmt.Fprintf(out, "ipwatcher_current_ip_info{family=\"ipv6\",address=%s} 1\n", quote(s.IPv6))
+	}
+
+	if len(s.Channels) > 0 {
+		names := make([]string, 0, len(s.Channels))
+		for name := range s.Channels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(out, "# HELP ipwatcher_channel_ip_info Address currently detected for each channel")
+		fmt.Fprintln(out, "# TYPE ipwatcher_channel_ip_info gauge")
+		for _, name := range names {
+			fmt.Fprintf(out, "ipwatcher_channel_ip_info{channel=%s,address=%s} 1\n", quote(name), quote(s.Channels[name]))
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP ipwatcher_provider_healthy Whether the latest request to the provider succeeded")
+	fmt.Fprintln(out, "# TYPE ipwatcher_provider_healthy gauge")
+	for _, p := range s.Providers {
+		fmt.Fprintf(out, "ipwatcher_provider_healthy{provider=%s} %d\n", quote(p.Provider), boolValue(p.Healthy))
+	}
+	fmt.Fprintln(out, "# HELP ipwatcher_provider_requests_total Requests made to the provider")
+	fmt.Fprintln(out, "# TYPE ipwatcher_provider_requests_total counter")
+	for _, p := range s.Providers {
+		fmt.Fprintf(out, "ipwatcher_provider_requests_total{provider=%s} %d\n", quote(p.Provider), p.Requests)
+	}
+	fmt.Fprintln(out, "# HELP ipwatcher_provider_failures_total Requests to the provider that failed")
+	fmt.Fprintln(out, "# TYPE ipwatcher_provider_failures_total counter")
+	for _, p := range s.Providers {
+		fmt.Fprintf(out, "ipwatcher_provider_failures_total{provider=%s} %d\n", quote(p.Provider), p.Failures)
+	}
+	fmt.Fprintln(out, "# HELP ipwatcher_provider_last_success_timestamp_seconds Time of the latest successful request to the provider")
+	fmt.Fprintln(out, "# TYPE ipwatcher_provider_last_success_timestamp_seconds gauge")
+	for _, p := range s.Providers {
+		if !p.LastSuccess.IsZero() {
+			fmt.Fprintf(out, "ipwatcher_provider_last_success_timestamp_seconds{provider=%s} %d\n", quote(p.Provider), p.LastSuccess.Unix())
+		}
+	}
+
+	if len(s.RecordFailures) > 0 {
+		fmt.Fprintln(out, "# HELP ipwatcher_record_failures Consecutive failed updates of each record whose latest update failed")
+		fmt.Fprintln(out, "# TYPE ipwatcher_record_failures gauge")
+		for _, f := range s.RecordFailures {
+			fmt.Fprintf(out, "ipwatcher_record_failures{provider=%s,name=%s,type=%s} %d\n", quote(f.Provider), quote(f.Name), quote(f.Type), f.Failures)
+		}
+		fmt.Fprintln(out, "# HELP ipwatcher_record_last_error_timestamp_seconds Time of the latest failed update of each failing record")
+		fmt.Fprintln(out, "# TYPE ipwatcher_record_last_error_timestamp_seconds gauge")
+		for _, f := range s.RecordFailures {
+			fmt.Fprintf(out, "ipwatcher_record_last_error_timestamp_seconds{provider=%s,name=%s,type=%s} %d\n", quote(f.Provider), quote(f.Name), quote(f.Type), f.LastErrorAt.Unix())
+		}
+	}
+
+	if n := len(s.Transactions); n > 0 {
+		last := s.Transactions[n-1]
+		gauge(out, "ipwatcher_last_transaction_timestamp_seconds", "Time the latest IP change finished updating DNS", "", "", last.FinishedAt.Unix())
+		gauge(out, "ipwatcher_last_transaction_success", "Whether every zone of the latest IP change was updated", "", "", boolValue(last.Status == history.StatusApplied))
+	}
+	gauge(out, "ipwatcher_drifted_records", "Records found to differ from the current IPs in read-only mode", "", "", int64(len(s.Drift)))
+	gauge(out, "ipwatcher_ownership_conflicts", "Configured records another instance claims with its ownership record", "", "", int64(len(s.Conflicts)))
+	counter(out, "ipwatcher_source_disagreements_total", "IP source disagreements retained in history", int64(len(s.Disagreements)))
+	counter(out, "ipwatcher_panics_total", "Panics recovered since the watcher started", w.Panics())
+	if s.Clock != nil {
+		fmt.Fprintln(out, "# HELP ipwatcher_clock_offset_seconds Offset of the NTP server's clock from the system clock")
+		fmt.Fprintln(out, "# TYPE ipwatcher_clock_offset_seconds gauge")
+		fmt.Fprintf(out, "ipwatcher_clock_offset_seconds %g\n", s.Clock.Offset)
+	}
+	if len(s.Propagation) > 0 {
+		fmt.Fprintln(out, "# HELP ipwatcher_propagation_seconds Time the latest IP change took to resolve at each public resolver and probe")
+		fmt.Fprintln(out, "# TYPE ipwatcher_propagation_seconds gauge")
+		for _, p := range s.Propagation {
+			if p.Propagated {
+				fmt.Fprintf(out, "ipwatcher_propagation_seconds{resolver=%s} %g\n", quote(p.Resolver), p.Seconds)
+			}
+		}
+		fmt.Fprintln(out, "# HELP ipwatcher_propagation_timeouts_total IP changes a public resolver or probe did not show within the timeout")
+		fmt.Fprintln(out, "# TYPE ipwatcher_propagation_timeouts_total counter")
+		for _, p := range s.Propagation {
+			fmt.Fprintf(out, "ipwatcher_propagation_timeouts_total{resolver=%s} %d\n", quote(p.Resolver), p.Timeouts)
+		}
+	}
+	if g := s.GlobalPropagation; g != nil {
+		gauge(out, "ipwatcher_propagation_confirmed", "Vantage points that answer the values of the latest IP change", "", "", int64(g.Confirmed))
+		if g.Propagated {
+			fmt.Fprintln(out, "# HELP ipwatcher_propagation_global_seconds Time the latest IP change took to reach the propagation quorum")
+			fmt.Fprintln(out, "# TYPE ipwatcher_propagation_global_seconds gauge")
+			fmt.Fprintf(out, "ipwatcher_propagation_global_seconds %g\n", g.Seconds)
+		}
+	}
+	if w.jobs != nil {
+		gauge(out, "ipwatcher_job_queue_depth", "DNS updates pending until they succeed", "", "", w.pendingJobCount())
+	}
+}
+
+// gauge writes a single-sample gauge, with one label when label is set
+func gauge(out io.Writer, name, help, label, value string, v int64) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	if label != "" {
+		fmt.Fprintf(out, "%s{%s=%s} %d\n", name, label, quote(value), v)
+		return
+	}
+	fmt.Fprintf(out, "%s %d\n", name, v)
+}
+
+// counter writes a single-sample counter
+func counter(out io.Writer, name, help string, v int64) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// labelEscaper escapes label values as the text exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote formats a label value
+func quote(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+// exportMetrics writes the metrics to metrics_textfile for the node_exporter textfile collector,
+// and sends them to the StatsD server when one is set. The file is replaced atomically, so the
+// collector never reads a partial file.
+func (w *IPWatcher) exportMetrics() {
+	path := w.config.MetricsTextfile
+	if path == "" && w.statsd == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	w.writeMetrics(&buf)
+	if w.statsd != nil {
+		w.sendStatsD(buf.String())
+	}
+	if path == "" {
+		return
+	}
+
+	// The collector only reads *.prom files, so it ignores the temporary file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		slog.Error("Failed to write metrics", "path", path, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Error("Failed to write metrics", "path", path, "error", err)
+	}
+}
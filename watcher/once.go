@@ -0,0 +1,151 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// Exit codes of `ipwatcher once`
+const (
+	onceUnchanged = 0 // Every record was already up to date
+	onceUpdated   = 1 // Records were created, updated or deleted
+	onceFailed    = 2 // An IP could not be fetched or a zone failed
+)
+
+// Once fetches the IPs and ensures every record once, like the first sync of the daemon, and
+// returns how many record changes it made. A failed fetch of a family that records publish is
+// an error, unlike in the daemon, which keeps the last address and tries again on the next tick.
+func (w *IPWatcher) Once(ctx context.Context) (int64, error) {
+	defer w.saveHistory()
+	before := w.changes.Load()
+
+	err := w.FetchAndUpdateIPs(ctx)
+	var errs []error
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if v, ok := w.fetches.Load(family); ok && v.(FetchResult).Error != "" && w.publishesFamily(family) {
+			errs = append(errs, fmt.Errorf("failed to fetch %s: %s", family, v.(FetchResult).Error))
+		}
+	}
+	w.syncLocalDNS(ctx, true)
+	w.exportMetrics()
+	return w.changes.Load() - before, errors.Join(append(errs, err)...)
+}
+
+// publishesFamily reports whether a record without a channel publishes the addresses of family
+func (w *IPWatcher) publishesFamily(family string) bool {
+	recordType := dnsmanager.ARecord
+	if family == "ipv6" {
+		recordType = dnsmanager.AAAARecord
+	}
+	for _, domain := range w.config.Domains {
+		for _, r := range domain.Records {
+			if r.Channel == "" && dnsmanager.DNSRecordType(r.Type) == recordType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OnceReport is the output of `ipwatcher once -output json`
+type OnceReport struct {
+	ExitCode       int             `json:"exit_code"`
+	Changes        int64           `json:"changes"` // Record changes made, or planned with -dry-run
+	IPv4           string          `json:"ipv4,omitempty"`
+	IPv6           string          `json:"ipv6,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	RecordFailures []RecordFailure `json:"record_failures,omitempty"`
+}
+
+// runOnce implements `ipwatcher once`, which syncs every record once and exits with
+// onceUnchanged, onceUpdated or onceFailed, for cron jobs and systemd timers
+func runOnce(args []string) error {
+	fs := flag.NewFlagSet("once", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", globals.dryRun, "Print planned DNS changes instead of applying them; planned changes count as updates")
+	output := outputFlag(fs, "text")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report := once(ctx, *profile, *dryRun, *output == "json")
+	if *output == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case report.ExitCode == onceFailed:
+		return exitCode{code: onceFailed, err: errors.New(report.Error)}
+	case report.ExitCode == onceUnchanged:
+		slog.Info("Records are up to date")
+		return nil
+	}
+	slog.Info("Made record changes", "changes", report.Changes)
+	return exitCode{code: onceUpdated}
+}
+
+// once loads the config, creates a watcher and syncs once. With jsonOutput, the changes planned
+// by -dry-run are printed on standard error, to keep standard output for the report.
+func once(ctx context.Context, profile string, dryRun, jsonOutput bool) OnceReport {
+	var report OnceReport
+	fail := func(err error) OnceReport {
+		report.ExitCode, report.Error = onceFailed, err.Error()
+		return report
+	}
+
+	cfg, err := loadCommandConfig(profile)
+	if err != nil {
+		return fail(err)
+	}
+	if dryRun {
+		cfg.DryRun = true
+	}
+	if !dryRun {
+		lock, err := lockInstance(cfg, globals.config)
+		if err != nil {
+			return fail(err)
+		}
+		defer lock.Release()
+	}
+	watcher, err := newConfigWatcher(ctx, cfg)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create IP watcher: %w", err))
+	}
+	if dryRun && jsonOutput {
+		for _, provider := range watcher.providers {
+			if dryRunner, ok := provider.(dnsmanager.DryRunner); ok {
+				dryRunner.SetDryRun(os.Stderr)
+			}
+		}
+	}
+	if err := watcher.Preflight(ctx); err != nil {
+		return fail(fmt.Errorf("startup checks failed: %w", err))
+	}
+
+	report.Changes, err = watcher.Once(ctx)
+	report.IPv4, _ = watcher.currentIPv4.Load().(string)
+	report.IPv6, _ = watcher.currentIPv6.Load().(string)
+	report.RecordFailures = watcher.RecordFailures()
+	if err != nil {
+		return fail(err)
+	}
+	if report.Changes > 0 {
+		report.ExitCode = onceUpdated
+	}
+	return report
+}
@@ -0,0 +1,275 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// Plan is the output of `ipwatcher plan` and the input of `ipwatcher apply`
+type Plan struct {
+	CreatedAt time.Time         `json:"created_at"`
+	IPv4      string            `json:"ipv4,omitempty"`
+	IPv6      string            `json:"ipv6,omitempty"`
+	Channels  map[string]string `json:"channels,omitempty"` // Channel name -> address the plan was made for
+	Zones     []ZonePlan        `json:"zones"`              // Only zones with pending changes
+}
+
+// ZonePlan is the pending changes of one zone on one provider
+type ZonePlan struct {
+	Zone     string              `json:"zone"`
+	Provider string              `json:"provider"` // Provider key, see config.Domain.ProviderKey
+	Channel  string              `json:"channel,omitempty"`
+	Changes  []dnsmanager.Change `json:"changes"`
+}
+
+// planTargets returns one target per provider and channel of every configured domain, covering all of its records
+func (w *IPWatcher) planTargets() []zoneTarget {
+	var targets []zoneTarget
+	for _, domain := range w.config.Domains {
+		channels, groups := recordsByChannel(domain.Records)
+		for _, channel := range channels {
+			dnsRecords := toDNSRecords(domain, groups[channel])
+			for _, providerType := range domain.ProviderNames() {
+				targets = append(targets, w.newZoneTarget(domain, providerType, channel, dnsRecords))
+			}
+		}
+	}
+	return targets
+}
+
+// planKey identifies the target of a zone plan
+func planKey(provider, zone, channel string) string {
+	return provider + "|" + zone + "|" + channel
+}
+
+// planDomain returns the changes the provider of t would make for the given IPs
+func (w *IPWatcher) planDomain(ctx context.Context, t zoneTarget, ipv4, ipv6 string) ([]dnsmanager.Change, error) {
+	planner, ok := w.providers[t.key].(dnsmanager.Planner)
+	if !ok {
+		return nil, fmt.Errorf("provider cannot plan changes")
+	}
+
+	zoneID := t.zoneID
+	if zoneID == "" {
+		var err error
+		zoneID, err = w.lookupZoneID(ctx, t.zone, t.key, t.accountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ipv4, ipv6 = w.channelIPs(t.channel, ipv4, ipv6)
+	changes, err := planner.PlanDNSRecords(ctx, zoneID, t.records, ipv4, ipv6)
+	return changes, w.observe(t.key, err)
+}
+
+// Plan fetches the current IPs and returns the changes every zone needs, without applying them.
+// Only the families of the records are fetched, and the records of a family that failed to
+// fetch are left out. Zones that failed to plan are reported in the error; records owned by
+// another instance are left out of their zone's changes.
+func (w *IPWatcher) Plan(ctx context.Context) (*Plan, error) {
+	var ipv4, ipv6 string
+	var err error
+	if w.publishesFamily("ipv4") {
+		if ipv4, err = w.ipFetcher.GetIPv4(ctx); err != nil {
+			moduleLogger("ip").Warn("Failed to fetch IP, A records are left out of the plan", "family", "ipv4", "error", err)
+		}
+	}
+	if w.config.SupportsIPv6 && w.publishesFamily("ipv6") {
+		if ipv6, err = w.ipFetcher.GetIPv6(ctx); err != nil {
+			moduleLogger("ip").Warn("Failed to fetch IP, AAAA records are left out of the plan", "family", "ipv6", "error", err)
+		}
+	}
+
+	w.refreshChannels(ctx)
+
+	plan := &Plan{CreatedAt: time.Now().UTC(), IPv4: ipv4, IPv6: ipv6, Zones: []ZonePlan{}}
+	if channels := w.ChannelIPs(); len(channels) > 0 {
+		plan.Channels = channels
+	}
+	var errs []error
+	for _, t := range w.planTargets() {
+		changes, err := w.planDomain(ctx, t, ipv4, ipv6)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", t.zone, t.provider, err))
+		}
+		if len(changes) > 0 {
+			plan.Zones = append(plan.Zones, ZonePlan{Zone: t.zone, Provider: t.key, Channel: t.channel, Changes: changes})
+		}
+	}
+	return plan, errors.Join(errs...)
+}
+
+// Apply executes plan with the IPs it was made for. Every zone is planned again first and
+// nothing is applied when any of them no longer matches the plan. Channels are fetched
+// again, so a channel whose address moved since the plan makes it stale.
+func (w *IPWatcher) Apply(ctx context.Context, plan *Plan) error {
+	targets := make(map[string]zoneTarget)
+	for _, t := range w.planTargets() {
+		targets[planKey(t.key, t.zone, t.channel)] = t
+	}
+	w.refreshChannels(ctx)
+
+	var errs []error
+	for _, zp := range plan.Zones {
+		t, ok := targets[planKey(zp.Provider, zp.Zone, zp.Channel)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s (%s): zone is not configured", zp.Zone, zp.Provider))
+			continue
+		}
+		changes, err := w.planDomain(ctx, t, plan.IPv4, plan.IPv6)
+		if err != nil && !dnsmanager.Refused(err) {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", zp.Zone, zp.Provider, err))
+			continue
+		}
+		if !slices.Equal(changes, zp.Changes) {
+			errs = append(errs, fmt.Errorf("%s (%s): zone changed since the plan was made", zp.Zone, zp.Provider))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("plan is stale, run plan again: %w", errors.Join(errs...))
+	}
+
+	for _, zp := range plan.Zones {
+		t := targets[planKey(zp.Provider, zp.Zone, zp.Channel)]
+		if err := w.ensureDomain(ctx, t, plan.IPv4, plan.IPv6, updatePass); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newCommandWatcher creates a watcher for subcommands that talk to providers without running the daemon
+func newCommandWatcher(ctx context.Context, profile string) (*IPWatcher, error) {
+	cfg, err := loadCommandConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	return newConfigWatcher(ctx, cfg)
+}
+
+// newConfigWatcher creates a watcher for cfg like newCommandWatcher, for subcommands that load
+// the config themselves
+func newConfigWatcher(ctx context.Context, cfg *config.Config) (*IPWatcher, error) {
+	if cfg.CloudflareBaseURL == "" {
+		cfg.CloudflareBaseURL = os.Getenv("CLOUDFLARE_BASE_URL")
+	}
+	redact.Add(cfg.Secrets()...)
+	return NewIPWatcher(ctx, cfg, os.Getenv("CLOUDFLARE_API_TOKEN"))
+}
+
+// loadCommandConfig loads the config file a subcommand works on, set by -config
+func loadCommandConfig(profile string) (*config.Config, error) {
+	cfg, err := config.LoadConfigProfile(globals.config, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	useConfigLogLevel(cfg)
+	return cfg, nil
+}
+
+// runPlan implements `ipwatcher plan`, which prints the pending changes of every zone as JSON,
+// or as a readable diff with -output text
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	out := fs.String("out", "", "Write the plan to this file instead of standard output")
+	output := outputFlag(fs, "json")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	watcher, err := newCommandWatcher(ctx, *profile)
+	if err != nil {
+		return err
+	}
+	plan, planErr := watcher.Plan(ctx)
+	if plan == nil {
+		return planErr
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if *out == "" && *output == "json" {
+		fmt.Println(string(data))
+		return planErr
+	}
+
+	if *out != "" {
+		if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+	}
+	for _, zp := range plan.Zones {
+		writeZonePlan(os.Stdout, zp)
+	}
+	if *out != "" {
+		fmt.Printf("Plan for %d zones written to %s\n", len(plan.Zones), *out)
+	} else if len(plan.Zones) == 0 {
+		fmt.Println("Records are up to date")
+	}
+	return planErr
+}
+
+// runApply implements `ipwatcher apply <plan file>`, which executes a plan made by `ipwatcher plan`
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ipwatcher apply <plan file>")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if len(plan.Zones) == 0 {
+		fmt.Println("Plan has no changes")
+		return nil
+	}
+
+	ctx := context.Background()
+	watcher, err := newCommandWatcher(ctx, *profile)
+	if err != nil {
+		return err
+	}
+	for _, zp := range plan.Zones {
+		writeZonePlan(os.Stdout, zp)
+	}
+	if err := watcher.Apply(ctx, &plan); err != nil {
+		return err
+	}
+	fmt.Printf("Applied changes to %d zones\n", len(plan.Zones))
+	return nil
+}
+
+// writeZonePlan writes the changes of one zone to out as a readable diff
+func writeZonePlan(out io.Writer, zp ZonePlan) {
+	fmt.Fprintf(out, "%s (%s):\n", zp.Zone, zp.Provider)
+	for _, c := range zp.Changes {
+		fmt.Fprintf(out, "  %s\n", c)
+	}
+}
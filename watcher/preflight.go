@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// preflightCheck is the outcome of one check against a live provider
+type preflightCheck struct {
+	what string
+	err  error
+}
+
+// fatal reports whether the check failed in a way that retrying cannot fix
+func (c preflightCheck) fatal() bool {
+	return errors.Is(c.err, dnsmanager.ErrAuth) || errors.Is(c.err, dnsmanager.ErrZoneNotFound)
+}
+
+// Preflight checks credentials and zone access for every configured domain before the first
+// update, so an invalid token or a zone it cannot read stops the daemon at startup with a clear
+// message. Write access cannot be checked without changing a record. Failures that may be
+// transient, such as network errors, are only logged and left to the regular sync.
+func (w *IPWatcher) Preflight(ctx context.Context) error {
+	var errs []error
+	for _, c := range w.preflightChecks(ctx, false) {
+		switch {
+		case c.err == nil:
+		case c.fatal():
+			errs = append(errs, fmt.Errorf("%s: %w", c.what, c.err))
+		default:
+			slog.Warn("Startup check failed", "check", c.what, "error", c.err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	slog.Info("Startup checks passed")
+	return nil
+}
+
+// preflightChecks runs the startup checks of every configured domain and returns them in order,
+// passed or not. With names, it also checks that every record name belongs to its zone rather
+// than to a more specific zone delegated from it, which costs a zone lookup per name.
+func (w *IPWatcher) preflightChecks(ctx context.Context, names bool) []preflightCheck {
+	var checks []preflightCheck
+	check := func(what string, err error) bool {
+		checks = append(checks, preflightCheck{what: what, err: err})
+		return err == nil
+	}
+
+	verified := make(map[string]bool)
+	for _, domain := range w.config.Domains {
+		for _, providerType := range domain.ProviderNames() {
+			key := domain.ProviderKey(providerType)
+			provider, ok := w.providers[key]
+			if !ok {
+				continue
+			}
+			var accountID string
+			if providerType == "cloudflare" {
+				accountID = w.config.CloudflareAccountID(domain)
+			}
+
+			if verifier, ok := provider.(dnsmanager.CredentialVerifier); ok && !verified[key] {
+				verified[key] = true
+				check(providerType+" credentials for "+domain.ZoneName, w.observe(key, verifier.VerifyCredentials(ctx, accountID)))
+			}
+
+			// Zone:Read
+			zoneID := domain.ZoneID
+			if zoneID == "" {
+				var err error
+				zoneID, err = w.lookupZoneID(ctx, domain.ZoneName, key, accountID)
+				if !check(fmt.Sprintf("zone %s (%s)", domain.ZoneName, providerType), err) {
+					continue
+				}
+			}
+
+			// DNS:Read; without IPs no record is compared, so this only lists the zone's records.
+			// Write access cannot be checked without changing a record.
+			if checker, ok := provider.(dnsmanager.DriftChecker); ok {
+				_, err := checker.CheckDNSRecords(ctx, zoneID, nil, "", "")
+				check(fmt.Sprintf("records of %s (%s)", domain.ZoneName, providerType), w.observe(key, err))
+			}
+
+			// Exec commands accept any zone name, so they have no delegated zones to find
+			if names && providerType != "exec" {
+				for _, name := range recordNames(domain) {
+					check(fmt.Sprintf("record %s (%s)", name, providerType), w.checkRecordZone(ctx, name, domain.ZoneName, key, accountID))
+				}
+			}
+		}
+	}
+	return checks
+}
+
+// recordNames returns the distinct names of the records of domain, fully qualified
+func recordNames(domain config.Domain) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range toDNSRecords(domain, domain.Records) {
+		name := strings.ToLower(r.FQDN())
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// checkRecordZone returns an error when name is not inside zone, or when one of the names
+// between them is a zone of its own, which would hold the record instead: a record written to
+// the parent zone is hidden by the delegation.
+func (w *IPWatcher) checkRecordZone(ctx context.Context, name, zone, providerKey, accountID string) error {
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	if name != zone && !strings.HasSuffix(name, "."+zone) {
+		return fmt.Errorf("name is not inside zone %s", zone)
+	}
+	for parent := name; parent != zone; {
+		if _, err := w.lookupZoneID(ctx, parent, providerKey, accountID); err == nil {
+			return fmt.Errorf("name is inside zone %s, not %s", parent, zone)
+		} else if !errors.Is(err, dnsmanager.ErrZoneNotFound) {
+			return err
+		}
+		_, parent, _ = strings.Cut(parent, ".")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+)
+
+// probeTimeout bounds every query to an external probe
+const probeTimeout = 10 * time.Second
+
+// DNS JSON API record types and response codes
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+
+	dnsNXDomain = 3
+)
+
+// probeResolver answers queries through an external probe speaking the DNS JSON API
+// (application/dns-json), as served by public DoH resolvers such as https://dns.google/resolve
+// and https://cloudflare-dns.com/dns-query. A probe service on a server in another region
+// implements the same API to report what resolvers there answer.
+type probeResolver struct {
+	name   string
+	url    *url.URL
+	header http.Header
+	client *http.Client
+}
+
+// dnsJSONResponse is the part of a DNS JSON API answer the probes use
+type dnsJSONResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// NewProbeResolver creates the resolver of a configured probe, resolving header secrets once.
+// A nil client uses a default client with a timeout.
+func NewProbeResolver(p config.Probe, client *http.Client) (Resolver, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", p.ProbeName(), err)
+	}
+	header := make(http.Header)
+	header.Set("Accept", "application/dns-json")
+	for _, h := range p.Headers {
+		value, err := h.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("probe %s: %w", p.ProbeName(), err)
+		}
+		header.Add(h.Name, value)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: probeTimeout}
+	}
+	return &probeResolver{name: p.ProbeName(), url: u, header: header, client: client}, nil
+}
+
+// query returns the data of the answers of type qtype for name
+func (r *probeResolver) query(ctx context.Context, name, qtype string, want int) ([]string, error) {
+	u := *r.url
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("type", qtype)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.header.Clone()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("probe %s returned %s", r.name, resp.Status)
+	}
+
+	var answer dnsJSONResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("probe %s: invalid answer: %w", r.name, err)
+	}
+	if answer.Status == dnsNXDomain {
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: r.name, IsNotFound: true}
+	}
+	if answer.Status != 0 {
+		return nil, &net.DNSError{Err: fmt.Sprintf("response code %d", answer.Status), Name: name, Server: r.name}
+	}
+
+	var data []string
+	for _, a := range answer.Answer {
+		if a.Type == want {
+			data = append(data, a.Data)
+		}
+	}
+	if len(data) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: r.name, IsNotFound: true}
+	}
+	return data, nil
+}
+
+func (r *probeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	qtype, want := "A", dnsTypeA
+	if network == "ip6" {
+		qtype, want = "AAAA", dnsTypeAAAA
+	}
+	data, err := r.query(ctx, host, qtype, want)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(data))
+	for _, d := range data {
+		if ip := net.ParseIP(d); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+func (r *probeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	data, err := r.query(ctx, host, "CNAME", dnsTypeCNAME)
+	if err != nil {
+		return "", err
+	}
+	return data[0], nil
+}
+
+func (r *probeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	data, err := r.query(ctx, name, "TXT", dnsTypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	txts := make([]string, len(data))
+	for i, d := range data {
+		txts[i] = unquoteTXT(d)
+	}
+	return txts, nil
+}
+
+// unquoteTXT joins the character strings of TXT data in presentation format, e.g. "a" "b",
+// the way net.Resolver returns them; data that is not quoted is returned as is
+func unquoteTXT(data string) string {
+	if !strings.HasPrefix(data, `"`) {
+		return data
+	}
+	var b strings.Builder
+	rest := strings.TrimSpace(data)
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return data
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return data
+		}
+		b.WriteString(s)
+		rest = strings.TrimSpace(rest[len(quoted):])
+	}
+	return b.String()
+}
@@ -0,0 +1,260 @@
+package watcher
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// Defaults for the propagation settings
+const (
+	defaultPropagationTimeout  = 10 * time.Minute
+	defaultPropagationInterval = 10 * time.Second
+)
+
+// Kinds of propagation vantage points
+const (
+	vantageResolver = "resolver" // Public resolver queried over DNS
+	vantageProbe    = "probe"    // External probe queried over HTTPS
+)
+
+// PropagationStatus is the latest propagation measurement against one public resolver or probe
+type PropagationStatus struct {
+	Resolver   string    `json:"resolver"`
+	Vantage    string    `json:"vantage"`             // resolver or probe
+	StartedAt  time.Time `json:"started_at,omitzero"` // When the measured IP change was published
+	Seconds    float64   `json:"seconds,omitempty"`   // Time until every changed record resolved; unset until it did
+	Propagated bool      `json:"propagated"`
+	Timeouts   int64     `json:"timeouts"` // Changes not seen by the resolver within the timeout
+}
+
+// GlobalPropagation aggregates the latest measurements of all vantage points
+type GlobalPropagation struct {
+	StartedAt  time.Time `json:"started_at"`
+	Vantages   int       `json:"vantages"`
+	Confirmed  int       `json:"confirmed"` // Vantage points that answer the new values
+	Quorum     int       `json:"quorum"`
+	Propagated bool      `json:"propagated"`        // At least quorum vantage points confirmed
+	Seconds    float64   `json:"seconds,omitempty"` // Time until the quorum was reached
+}
+
+// propagation tracks the public resolvers and probes timed after IP changes
+type propagation struct {
+	mu        sync.Mutex
+	resolvers []*propagationResolver
+	cancel    context.CancelFunc // Stops the measurement of the previous change
+	confirmed int                // Vantage points that confirmed the current change
+}
+
+type propagationResolver struct {
+	resolver Resolver
+	mu       sync.Mutex
+	status   PropagationStatus
+}
+
+// propagationCheck is a changed record and the content a resolver should answer for it
+type propagationCheck struct {
+	record  dnsmanager.DNSRecord
+	content string
+}
+
+// publicResolver returns a resolver that sends every query to addr, a host or host:port
+func publicResolver(addr string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	var d net.Dialer
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// SetPropagationResolver adds a resolver queried after IP changes, reported under name
+func (w *IPWatcher) SetPropagationResolver(name string, r Resolver) {
+	w.addVantage(name, vantageResolver, r)
+}
+
+// SetPropagationProbe adds an external probe queried after IP changes, reported under name
+func (w *IPWatcher) SetPropagationProbe(name string, r Resolver) {
+	w.addVantage(name, vantageProbe, r)
+}
+
+func (w *IPWatcher) addVantage(name, vantage string, r Resolver) {
+	if w.propagation == nil {
+		w.propagation = &propagation{}
+	}
+	w.propagation.resolvers = append(w.propagation.resolvers, &propagationResolver{
+		resolver: r,
+		status:   PropagationStatus{Resolver: name, Vantage: vantage},
+	})
+}
+
+// quorum returns how many vantage points must confirm a change for global propagation
+func (w *IPWatcher) quorum() int {
+	n := len(w.propagation.resolvers)
+	if c := w.config.Propagation; c != nil && c.Quorum > 0 && c.Quorum < n {
+		return c.Quorum
+	}
+	return n
+}
+
+// startPropagation measures in the background how long the records updated by an IP change take
+// to resolve at every propagation resolver, stopping the measurement of an earlier change.
+// Proxied records answer with the proxy's addresses, so they are not checked.
+func (w *IPWatcher) startPropagation(ctx context.Context, results []zoneResult, ipv4, ipv6 string, published time.Time) {
+	p := w.propagation
+	if p == nil || w.config.ReadOnly || w.config.DryRun {
+		return
+	}
+
+	var checks []propagationCheck
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		v4, v6 := w.channelIPs(r.channel, ipv4, ipv6)
+		for _, record := range r.records {
+			content := expectedContent(record, v4, v6)
+			key := record.FQDN() + "|" + record.Type.String()
+			if content == "" || record.Proxied || record.NoCreate || seen[key] {
+				continue
+			}
+			seen[key] = true
+			checks = append(checks, propagationCheck{record: record, content: content})
+		}
+	}
+	if len(checks) == 0 {
+		return
+	}
+
+	timeout, interval := defaultPropagationTimeout, defaultPropagationInterval
+	if c := w.config.Propagation; c != nil {
+		if c.Timeout > 0 {
+			timeout = c.Timeout
+		}
+		if c.Interval > 0 {
+			interval = c.Interval
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.confirmed = 0
+	quorum := w.quorum()
+	for _, r := range p.resolvers {
+		go r.measure(ctx, checks, published, timeout, interval, func(elapsed time.Duration) {
+			p.confirm(ctx, quorum, elapsed)
+		})
+	}
+}
+
+// confirm counts a vantage point that answers the new values, and logs global propagation once
+// quorum of them did
+func (p *propagation) confirm(ctx context.Context, quorum int, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	p.confirmed++
+	if p.confirmed == quorum {
+		moduleLogger("sync").Info("Changed records propagated globally", "confirmed", quorum, "vantage_points", len(p.resolvers), "duration", elapsed.Round(time.Millisecond))
+	}
+}
+
+// measure queries the resolver until it answers every check with its content, which also
+// warms its cache, then records the time since published and reports it to confirmed
+func (r *propagationResolver) measure(ctx context.Context, checks []propagationCheck, published time.Time, timeout, interval time.Duration, confirmed func(time.Duration)) {
+	r.mu.Lock()
+	r.status.StartedAt, r.status.Seconds, r.status.Propagated = published, 0, false
+	name := r.status.Resolver
+	r.mu.Unlock()
+
+	pending := slices.Clone(checks)
+	deadline := published.Add(timeout)
+	for {
+		pending = slices.DeleteFunc(pending, func(c propagationCheck) bool {
+			return resolvesWith(ctx, r.resolver, c.record, c.content)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if len(pending) == 0 {
+			elapsed := time.Since(published)
+			r.mu.Lock()
+			r.status.Seconds, r.status.Propagated = elapsed.Seconds(), true
+			r.mu.Unlock()
+			moduleLogger("sync").Info("Changed records propagated", "resolver", name, "duration", elapsed.Round(time.Millisecond))
+			confirmed(elapsed)
+			return
+		}
+		if time.Now().Add(interval).After(deadline) {
+			r.mu.Lock()
+			r.status.Timeouts++
+			r.mu.Unlock()
+			moduleLogger("sync").Warn("Changed records did not propagate in time", "resolver", name, "duration", timeout, "stale_records", len(pending))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Propagation returns the latest propagation measurement of every propagation resolver
+func (w *IPWatcher) Propagation() []PropagationStatus {
+	if w.propagation == nil {
+		return nil
+	}
+	statuses := make([]PropagationStatus, 0, len(w.propagation.resolvers))
+	for _, r := range w.propagation.resolvers {
+		r.mu.Lock()
+		statuses = append(statuses, r.status)
+		r.mu.Unlock()
+	}
+	return statuses
+}
+
+// GlobalPropagation aggregates the latest measurement of every vantage point; nil before the
+// first IP change is measured
+func (w *IPWatcher) GlobalPropagation() *GlobalPropagation {
+	statuses := w.Propagation()
+	var started time.Time
+	for _, s := range statuses {
+		if s.StartedAt.After(started) {
+			started = s.StartedAt
+		}
+	}
+	if started.IsZero() {
+		return nil
+	}
+
+	g := &GlobalPropagation{StartedAt: started, Vantages: len(statuses), Quorum: w.quorum()}
+	var seconds []float64
+	for _, s := range statuses {
+		if s.Propagated && s.StartedAt.Equal(started) {
+			seconds = append(seconds, s.Seconds)
+		}
+	}
+	g.Confirmed = len(seconds)
+	if g.Confirmed >= g.Quorum {
+		slices.Sort(seconds)
+		g.Propagated, g.Seconds = true, seconds[g.Quorum-1]
+	}
+	return g
+}
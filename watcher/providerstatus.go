@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// ProviderStatus summarises the requests made to one configured provider
+type ProviderStatus struct {
+	Provider    string    `json:"provider"` // Provider key, e.g. route53, cloudflare@home or cloudflare:example.com
+	Healthy     bool      `json:"healthy"`  // False while the latest request failed
+	Requests    int64     `json:"requests"`
+	Failures    int64     `json:"failures"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+	ErrorKind   string    `json:"error_kind,omitempty"` // Kind of the last error, e.g. authentication failed
+}
+
+// providerStats accumulates the ProviderStatus of one provider
+type providerStats struct {
+	mu     sync.Mutex
+	status ProviderStatus
+}
+
+// observe records the outcome of a provider request and returns err unchanged
+func (w *IPWatcher) observe(key string, err error) error {
+	v, _ := w.providerStats.LoadOrStore(key, &providerStats{status: ProviderStatus{Provider: key}})
+	stats := v.(*providerStats)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.status.Requests++
+	if err == nil {
+		stats.status.LastSuccess = time.Now()
+		return nil
+	}
+	stats.status.Failures++
+	stats.status.LastError = redact.String(err.Error())
+	stats.status.LastErrorAt = time.Now()
+	stats.status.ErrorKind = ""
+	if kind := dnsmanager.ErrorKind(err); kind != nil {
+		stats.status.ErrorKind = kind.Error()
+	}
+	return err
+}
+
+// Providers returns the status of every configured provider, sorted by key
+func (w *IPWatcher) Providers() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(w.providers))
+	for key := range w.providers {
+		status := ProviderStatus{Provider: key}
+		if v, ok := w.providerStats.Load(key); ok {
+			stats := v.(*providerStats)
+			stats.mu.Lock()
+			status = stats.status
+			stats.mu.Unlock()
+		}
+		status.Healthy = status.LastErrorAt.IsZero() || status.LastSuccess.After(status.LastErrorAt)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	return statuses
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// DriftedRecord is a record that does not hold the expected IP, reported in read-only mode
+type DriftedRecord struct {
+	Zone     string `json:"zone"`
+	Provider string `json:"provider"`
+	Record   string `json:"record"`
+	Type     string `json:"type"`
+	Expected string `json:"expected"`
+}
+
+// checkDomain reports the records of t that differ from the expected IPs without changing them
+func (w *IPWatcher) checkDomain(ctx context.Context, t zoneTarget, provider dnsmanager.DNSProvider, zoneID, ipv4, ipv6 string) error {
+	checker, ok := provider.(dnsmanager.DriftChecker)
+	if !ok {
+		moduleLogger("sync").Info("Skipping zone: provider cannot check records in read-only mode", "zone", t.zone, "provider", t.provider)
+		return nil
+	}
+
+	drifted, err := checker.CheckDNSRecords(ctx, zoneID, t.records, ipv4, ipv6)
+	if err := w.observe(t.key, err); err != nil {
+		moduleLogger("sync").Error("Failed to check DNS records", "zone", t.zone, "provider", t.provider, "error", err)
+		w.publishUpdate(t.zone, t.provider, t.records, "Failed to check DNS records", err)
+		w.forgetVerified(t)
+		return fmt.Errorf("%s (%s): %w", t.zone, t.provider, err)
+	}
+
+	entries := make([]DriftedRecord, 0, len(drifted))
+	names := make([]string, 0, len(drifted))
+	for _, r := range drifted {
+		entries = append(entries, DriftedRecord{
+			Zone:     t.zone,
+			Provider: t.provider,
+			Record:   r.FQDN(),
+			Type:     r.Type.String(),
+			Expected: expectedContent(r, ipv4, ipv6),
+		})
+		names = append(names, r.FQDN()+" "+r.Type.String())
+	}
+	w.drift.Store(t.key+"|"+t.zone, entries)
+
+	w.markVerified(t, ipv4, ipv6)
+	if len(drifted) == 0 {
+		moduleLogger("sync").Info("DNS records are up-to-date", "zone", t.zone, "provider", t.provider)
+		w.publishUpdate(t.zone, t.provider, t.records, "DNS records are up-to-date", nil)
+		return nil
+	}
+
+	// Keep drifted records out of the verified set so every sync reports them again
+	w.forgetVerified(zoneTarget{key: t.key, records: drifted})
+	moduleLogger("sync").Warn("DNS records drifted, not updating in read-only mode", "zone", t.zone, "provider", t.provider, "records", strings.Join(names, ", "))
+	w.publishUpdate(t.zone, t.provider, drifted, "DNS records drifted (read-only)", nil)
+	return nil
+}
+
+// Drift returns the records found to differ from the expected IPs in read-only mode
+func (w *IPWatcher) Drift() []DriftedRecord {
+	drift := []DriftedRecord{}
+	w.drift.Range(func(_, value any) bool {
+		drift = append(drift, value.([]DriftedRecord)...)
+		return true
+	})
+	return drift
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"sort"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// RecordFailure is the latest error of a record whose updates keep failing, so one rejected
+// record stands out among the healthy records of its zone
+type RecordFailure struct {
+	Provider    string    `json:"provider"` // Provider key, as in ProviderStatus
+	Zone        string    `json:"zone"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	LastError   string    `json:"last_error"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	Failures    int64     `json:"failures"` // Consecutive failed updates
+	ErrorKind   string    `json:"error_kind,omitempty"`
+	Since       time.Time `json:"since"` // When the first of the consecutive failures happened
+}
+
+func recordFailureKey(t zoneTarget, name, recordType string) string {
+	return t.key + "|" + name + "|" + recordType
+}
+
+// trackRecordFailures records the per-record errors of an update of t. Records of t the update
+// did not fail are cleared. Errors from before the records were compared, such as a zone lookup
+// failing, leave the known failures as they are.
+func (w *IPWatcher) trackRecordFailures(t zoneTarget, result dnsmanager.Result, err error) {
+	if err != nil && len(result.Errors) == 0 {
+		return
+	}
+
+	failed := make(map[string]dnsmanager.RecordError)
+	for _, e := range result.Errors {
+		failed[recordFailureKey(t, e.Name, e.Type)] = e
+	}
+	now := time.Now()
+	for _, r := range t.records {
+		key := recordFailureKey(t, r.FQDN(), r.Type.String())
+		e, ok := failed[key]
+		if !ok {
+			w.recordErrors.Delete(key)
+			continue
+		}
+		f := RecordFailure{Provider: t.key, Zone: t.zone, Name: e.Name, Type: e.Type, Since: now}
+		if v, known := w.recordErrors.Load(key); known {
+			f = v.(RecordFailure)
+		}
+		f.LastError = redact.String(e.Err.Error())
+		f.LastErrorAt = now
+		f.Failures++
+		f.ErrorKind = ""
+		if kind := dnsmanager.ErrorKind(e.Err); kind != nil {
+			f.ErrorKind = kind.Error()
+		}
+		w.recordErrors.Store(key, f)
+	}
+}
+
+// RecordFailures returns the records whose latest update failed, sorted by provider and record
+func (w *IPWatcher) RecordFailures() []RecordFailure {
+	var failures []RecordFailure
+	w.recordErrors.Range(func(_, v any) bool {
+		failures = append(failures, v.(RecordFailure))
+		return true
+	})
+	sort.Slice(failures, func(i, j int) bool {
+		a, b := failures[i], failures[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+	return failures
+}
@@ -0,0 +1,36 @@
+package watcher
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// guard runs fn and turns a panic into an error so one bad provider response
+// cannot take the whole daemon down. The stack trace is logged, the panic is
+// counted and published to control socket subscribers.
+func (w *IPWatcher) guard(where string, fn func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		w.panics.Add(1)
+		err = fmt.Errorf("panic in %s: %v", where, r)
+		slog.Error("Recovered from a panic", "error", err, "stack", string(debug.Stack()))
+		w.events.Publish(control.Event{
+			Kind:    control.KindPanic,
+			Error:   redact.String(fmt.Sprint(r)),
+			Message: "Recovered from panic in " + where,
+		})
+	}()
+	return fn()
+}
+
+// Panics returns the number of panics recovered since the watcher started
+func (w *IPWatcher) Panics() int64 {
+	return w.panics.Load()
+}
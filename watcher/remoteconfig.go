@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+)
+
+const defaultConfigRefresh = 5 * time.Minute
+
+// fetchConfig downloads and parses the config file of remote
+func fetchConfig(ctx context.Context, remote *config.Remote, profile string) (*config.Config, error) {
+	data, _, err := remote.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return config.Parse(data, profile)
+}
+
+// watchRemoteConfig fetches the config file of remote every interval until ctx is done. Each
+// changed version is turned into a watcher by load and sent on the returned channel; versions
+// load rejects are logged and the running watcher is kept.
+func watchRemoteConfig(ctx context.Context, remote *config.Remote, interval time.Duration, load func(context.Context, []byte) (*IPWatcher, error)) <-chan *IPWatcher {
+	if interval <= 0 {
+		interval = defaultConfigRefresh
+	}
+	reloads := make(chan *IPWatcher)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			data, changed, err := remote.Fetch(ctx)
+			if err != nil {
+				slog.Error("Failed to fetch config file", "error", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			watcher, err := load(ctx, data)
+			if err != nil {
+				slog.Warn("Ignoring changed config file", "error", err)
+				continue
+			}
+			select {
+			case reloads <- watcher:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return reloads
+}
@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+)
+
+// serviceName is the name the daemon is installed under as a service
+const serviceName = "ipwatcher"
+
+// runServiceCommand implements `ipwatcher service`, which installs the daemon as a service of the
+// operating system, or removes it
+func runServiceCommand(args []string) error {
+	action, start, profile, err := parseServiceCommand(args)
+	if err != nil {
+		return err
+	}
+	if action == "uninstall" {
+		return uninstallService()
+	}
+
+	daemonArgs, err := serviceArgs(profile)
+	if err != nil {
+		return err
+	}
+	return installService(daemonArgs, start)
+}
+
+// parseServiceCommand parses the arguments of `ipwatcher service` into its action and, for
+// install, whether to start the service and the profile it runs with
+func parseServiceCommand(args []string) (string, bool, string, error) {
+	if len(args) == 0 {
+		return "", false, "", fmt.Errorf("service needs an action: install or uninstall")
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("service "+action, flag.ExitOnError)
+	start, profile := new(bool), new(string)
+	switch action {
+	case "install":
+		start = fs.Bool("start", true, "Start the service once it is installed")
+		profile = profileFlag(fs)
+	case "uninstall":
+	default:
+		return "", false, "", fmt.Errorf("unknown service action %q; use install or uninstall", action)
+	}
+	if err := parseCommand(fs, args); err != nil {
+		return "", false, "", err
+	}
+	return action, *start, *profile, nil
+}
+
+// serviceConfigDir returns the directory of the config file given to the install command, or
+// "" for a config URL. Services run in it, so relative paths of the config keep working.
+func serviceConfigDir() string {
+	if config.IsRemote(globals.config) {
+		return ""
+	}
+	abs, err := filepath.Abs(globals.config)
+	if err != nil {
+		return ""
+	}
+	if info, err := os.Stat(abs); err == nil && info.IsDir() {
+		return abs // A config directory
+	}
+	return filepath.Dir(abs)
+}
+
+// serviceArgs returns the arguments the service runs the daemon with: the config given to the
+// install command, made absolute as services do not start in the current directory, the
+// profile and the log settings
+func serviceArgs(profile string) ([]string, error) {
+	configFile := globals.config
+	if !config.IsRemote(configFile) {
+		abs, err := filepath.Abs(configFile)
+		if err != nil {
+			return nil, err
+		}
+		configFile = abs
+	}
+	args := []string{"-config", configFile}
+	if globals.logLevel != "" {
+		args = append(args, "-log-level", globals.logLevel)
+	}
+	if globals.logFormat != "text" {
+		args = append(args, "-log-format", globals.logFormat)
+	}
+	if output := globals.logOutput; output != "stderr" {
+		if output != "stdout" {
+			abs, err := filepath.Abs(output)
+			if err != nil {
+				return nil, err
+			}
+			output = abs
+		}
+		args = append(args, "-log-output", output)
+	}
+	if profile != "" {
+		args = append(args, "-profile", profile)
+	}
+	return append(args, "run"), nil
+}
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// launchdLabel is the label of the launchd job of the daemon
+const launchdLabel = "com.github.msyrus.ipwatcher"
+
+// launchdJob returns the path of the launchd plist of the daemon, its launchctl domain and its
+// log file: a daemon of the system as root, an agent of the user otherwise
+func launchdJob() (plist, domain, logFile string, err error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist"), "system", "/Library/Logs/ipwatcher.log", nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"),
+		"gui/" + strconv.Itoa(os.Getuid()),
+		filepath.Join(home, "Library", "Logs", "ipwatcher.log"), nil
+}
+
+// installService writes a launchd plist running this executable with args at load and again
+// after it fails, and loads it when start is set
+func installService(args []string, start bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	path, domain, logFile, err := launchdJob()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; run service uninstall first", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, launchdPlist(exe, args, logFile), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote job file", "path", path)
+
+	if !start {
+		slog.Info("Load the job with launchctl", "command", "launchctl bootstrap "+domain+" "+path)
+		return nil
+	}
+	if err := serviceManager("launchctl", "bootstrap", domain, path); err != nil {
+		return err
+	}
+	slog.Info("Loaded the job", "label", launchdLabel, "log", logFile)
+	return nil
+}
+
+// uninstallService unloads the launchd job of the daemon and removes its plist
+func uninstallService() error {
+	path, domain, _, err := launchdJob()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s is not installed: %s does not exist", serviceName, path)
+	}
+
+	if err := serviceManager("launchctl", "bootout", domain+"/"+launchdLabel); err != nil {
+		slog.Warn("Failed to unload the job", "label", launchdLabel, "error", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	slog.Info("Removed job file", "path", path)
+	return nil
+}
+
+// launchdPlist returns a plist running exe with args at load, in the directory of the config,
+// and again whenever it exits with an error, with its output appended to logFile
+func launchdPlist(exe string, args []string, logFile string) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", plistEscape(launchdLabel))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range append([]string{exe}, args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", plistEscape(arg))
+	}
+	b.WriteString("\t</array>\n")
+	if dir := serviceConfigDir(); dir != "" {
+		fmt.Fprintf(&b, "\t<key>WorkingDirectory</key>\n\t<string>%s</string>\n", plistEscape(dir))
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>10</integer>\n")
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", plistEscape(logFile))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", plistEscape(logFile))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// plistEscape escapes s for the text of a plist element
+func plistEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
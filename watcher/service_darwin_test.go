@@ -0,0 +1,109 @@
+package watcher_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	ipwatcher "github.com/msyrus/ipwatcher/watcher"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		exe        string
+		args       []string
+		want       []string
+		unwanted   []string
+	}{
+		{
+			name:       "plain paths",
+			configFile: "/usr/local/etc/ipwatcher/config.yaml",
+			exe:        "/usr/local/bin/ipwatcher",
+			args:       []string{"-config", "/usr/local/etc/ipwatcher/config.yaml", "run"},
+			want: []string{
+				"\t\t<string>/usr/local/bin/ipwatcher</string>",
+				"\t\t<string>/usr/local/etc/ipwatcher/config.yaml</string>",
+				"\t\t<string>run</string>",
+				"\t<key>WorkingDirectory</key>",
+				"\t<string>/usr/local/etc/ipwatcher</string>",
+				"\t<string>/tmp/ipwatcher.log</string>",
+			},
+		},
+		{
+			name:       "characters XML escapes",
+			configFile: "/Users/me/R&D <dns>/config.yaml",
+			exe:        "/Applications/IP Watcher/ipwatcher",
+			args:       []string{"-config", "/Users/me/R&D <dns>/config.yaml", "-profile", `"home's"`, "run"},
+			want: []string{
+				"\t\t<string>/Applications/IP Watcher/ipwatcher</string>",
+				"\t\t<string>/Users/me/R&amp;D &lt;dns&gt;/config.yaml</string>",
+				"\t\t<string>&#34;home&#39;s&#34;</string>",
+				"\t<string>/Users/me/R&amp;D &lt;dns&gt;</string>",
+			},
+		},
+		{
+			name:       "config URL",
+			configFile: "https://config.example.com/ipwatcher.yaml",
+			exe:        "/usr/local/bin/ipwatcher",
+			args:       []string{"-config", "https://config.example.com/ipwatcher.yaml", "run"},
+			want:       []string{"\t\t<string>https://config.example.com/ipwatcher.yaml</string>"},
+			unwanted:   []string{"WorkingDirectory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipwatcher.SetGlobalFlags(t, "-config", tt.configFile)
+			plist := ipwatcher.LaunchdPlist(tt.exe, tt.args, "/tmp/ipwatcher.log")
+			lines := strings.Split(string(plist), "\n")
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("Expected the line %s in the plist:\n%s", want, plist)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if bytes.Contains(plist, []byte(unwanted)) {
+					t.Errorf("Expected no %s in the plist:\n%s", unwanted, plist)
+				}
+			}
+
+			// The plist is well-formed XML whatever the paths contain
+			d := xml.NewDecoder(bytes.NewReader(plist))
+			for {
+				_, err := d.Token()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Expected a well-formed plist, got %v:\n%s", err, plist)
+				}
+			}
+		})
+	}
+}
+
+func TestPlistEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/usr/local/bin/ipwatcher", want: "/usr/local/bin/ipwatcher"},
+		{in: "/Applications/IP Watcher", want: "/Applications/IP Watcher"},
+		{in: "R&D", want: "R&amp;D"},
+		{in: "<dns>", want: "&lt;dns&gt;"},
+		{in: `"home"`, want: "&#34;home&#34;"},
+		{in: "home's", want: "home&#39;s"},
+	}
+
+	for _, tt := range tests {
+		if got := ipwatcher.PlistEscape(tt.in); got != tt.want {
+			t.Errorf("PlistEscape(%q): expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemdUnit returns the path of the systemd unit of the daemon and the systemctl flags that
+// manage it: a system unit as root, a user unit otherwise
+func systemdUnit() (string, []string, error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join("/etc/systemd/system", serviceName+".service"), nil, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "systemd", "user", serviceName+".service"), []string{"--user"}, nil
+}
+
+// installService writes a systemd unit running this executable with args, enables it, and
+// starts it when start is set
+func installService(args []string, start bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	path, scope, err := systemdUnit()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; run service uninstall first", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(systemdUnitFile(exe, args)), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Wrote unit file", "path", path)
+
+	if err := serviceManager("systemctl", append(scope, "daemon-reload")...); err != nil {
+		return err
+	}
+	enable := append(scope, "enable")
+	if start {
+		enable = append(enable, "--now")
+	}
+	if err := serviceManager("systemctl", append(enable, serviceName)...); err != nil {
+		return err
+	}
+	if start {
+		slog.Info("Enabled and started the service", "service", serviceName, "follow", "journalctl "+userFlag(scope)+"-u "+serviceName+" -f")
+	} else {
+		slog.Info("Enabled the service; it starts at the next boot", "service", serviceName, "start", "systemctl "+userFlag(scope)+"start "+serviceName)
+	}
+	return nil
+}
+
+// uninstallService stops and disables the systemd unit of the daemon and removes it
+func uninstallService() error {
+	path, scope, err := systemdUnit()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s is not installed: %s does not exist", serviceName, path)
+	}
+
+	if err := serviceManager("systemctl", append(scope, "disable", "--now", serviceName)...); err != nil {
+		slog.Warn("Failed to stop the service", "service", serviceName, "error", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := serviceManager("systemctl", append(scope, "daemon-reload")...); err != nil {
+		return err
+	}
+	slog.Info("Removed unit file", "path", path)
+	return nil
+}
+
+// userFlag returns the --user flag of scope followed by a space, for the hints printed after an install
+func userFlag(scope []string) string {
+	if len(scope) == 0 {
+		return ""
+	}
+	return "--user "
+}
+
+// systemdUnitFile returns a unit running exe with args as a Type=notify service with a
+// watchdog, like ipwatcher.service, reading tokens from the .env file next to the config
+func systemdUnitFile(exe string, args []string) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=ipwatcher dynamic DNS updater\n")
+	b.WriteString("Documentation=https://github.com/msyrus/ipwatcher\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	b.WriteString("NotifyAccess=main\n")
+	b.WriteString("TimeoutStartSec=5min\n")
+	b.WriteString("WatchdogSec=5min\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommandLine(append([]string{exe}, args...)))
+	if dir := serviceConfigDir(); dir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdEscape(dir))
+		fmt.Fprintf(&b, "EnvironmentFile=-%s\n", systemdEscape(filepath.Join(dir, ".env")))
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=10\n")
+	b.WriteString("UMask=0077\n")
+	b.WriteString("NoNewPrivileges=true\n\n")
+	b.WriteString("[Install]\n")
+	if os.Geteuid() == 0 {
+		b.WriteString("WantedBy=multi-user.target\n")
+	} else {
+		b.WriteString("WantedBy=default.target\n")
+	}
+	return b.String()
+}
+
+// systemdCommandLine quotes args for ExecStart
+func systemdCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// systemdQuote quotes s for ExecStart, escaping the specifiers and variables systemd expands
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(systemdEscape(s))
+	return `"` + s + `"`
+}
+
+// systemdEscape escapes the specifiers systemd expands in the path settings of a unit
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
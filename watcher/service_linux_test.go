@@ -0,0 +1,90 @@
+package watcher_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	ipwatcher "github.com/msyrus/ipwatcher/watcher"
+)
+
+func TestSystemdUnitFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		exe        string
+		args       []string
+		want       []string
+		unwanted   []string
+	}{
+		{
+			name:       "plain paths",
+			configFile: "/etc/ipwatcher/config.yaml",
+			exe:        "/usr/local/bin/ipwatcher",
+			args:       []string{"-config", "/etc/ipwatcher/config.yaml", "run"},
+			want: []string{
+				`ExecStart="/usr/local/bin/ipwatcher" "-config" "/etc/ipwatcher/config.yaml" "run"`,
+				"WorkingDirectory=/etc/ipwatcher",
+				"EnvironmentFile=-/etc/ipwatcher/.env",
+			},
+		},
+		{
+			name:       "spaces and characters systemd expands",
+			configFile: "/srv/dns configs/100%/config.yaml",
+			exe:        "/opt/ip watcher/ipwatcher",
+			args:       []string{"-config", "/srv/dns configs/100%/config.yaml", "-profile", `home "$USER" \ lab`, "run"},
+			want: []string{
+				`ExecStart="/opt/ip watcher/ipwatcher" "-config" "/srv/dns configs/100%%/config.yaml" "-profile" "home \"$$USER\" \\ lab" "run"`,
+				"WorkingDirectory=/srv/dns configs/100%%",
+				"EnvironmentFile=-/srv/dns configs/100%%/.env",
+			},
+		},
+		{
+			name:       "config URL",
+			configFile: "https://config.example.com/ipwatcher.yaml",
+			exe:        "/usr/local/bin/ipwatcher",
+			args:       []string{"-config", "https://config.example.com/ipwatcher.yaml", "run"},
+			want:       []string{`ExecStart="/usr/local/bin/ipwatcher" "-config" "https://config.example.com/ipwatcher.yaml" "run"`},
+			unwanted:   []string{"WorkingDirectory=", "EnvironmentFile="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipwatcher.SetGlobalFlags(t, "-config", tt.configFile)
+			unit := ipwatcher.SystemdUnitFile(tt.exe, tt.args)
+			lines := strings.Split(unit, "\n")
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("Expected the line %s in the unit:\n%s", want, unit)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(unit, unwanted) {
+					t.Errorf("Expected no %s in the unit:\n%s", unwanted, unit)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "run", want: `"run"`},
+		{in: "/opt/ip watcher", want: `"/opt/ip watcher"`},
+		{in: "100%", want: `"100%%"`},
+		{in: "$HOME", want: `"$$HOME"`},
+		{in: `say "hi"`, want: `"say \"hi\""`},
+		{in: `C:\dir`, want: `"C:\\dir"`},
+		{in: `%h/$X "a\b"`, want: `"%%h/$$X \"a\\b\""`},
+	}
+
+	for _, tt := range tests {
+		if got := ipwatcher.SystemdQuote(tt.in); got != tt.want {
+			t.Errorf("SystemdQuote(%q): expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
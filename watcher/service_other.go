@@ -0,0 +1,18 @@
+//go:build !windows && !linux && !darwin
+
+package watcher
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// installService reports that installing a service is not supported on this system
+func installService(args []string, start bool) error {
+	return fmt.Errorf("service install is not supported on %s", runtime.GOOS)
+}
+
+// uninstallService reports that removing a service is not supported on this system
+func uninstallService() error {
+	return fmt.Errorf("service uninstall is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,109 @@
+package watcher_test
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	ipwatcher "github.com/msyrus/ipwatcher/watcher"
+)
+
+func TestParseServiceCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantAction  string
+		wantStart   bool
+		wantProfile string
+		wantError   string
+	}{
+		{name: "install", args: []string{"install"}, wantAction: "install", wantStart: true},
+		{name: "install without starting", args: []string{"install", "-start=false", "-profile", "home"}, wantAction: "install", wantProfile: "home"},
+		{name: "uninstall", args: []string{"uninstall"}, wantAction: "uninstall"},
+		{name: "no action", wantError: "service needs an action"},
+		{name: "unknown action", args: []string{"restart"}, wantError: `unknown service action "restart"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipwatcher.SetGlobalFlags(t)
+			action, start, profile, err := ipwatcher.ParseServiceCommand(tt.args)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseServiceCommand failed: %v", err)
+			}
+			if action != tt.wantAction || start != tt.wantStart || profile != tt.wantProfile {
+				t.Errorf("Expected action %q, start %v and profile %q, got %q, %v and %q", tt.wantAction, tt.wantStart, tt.wantProfile, action, start, profile)
+			}
+		})
+	}
+}
+
+func TestServiceArgs(t *testing.T) {
+	config, err := filepath.Abs("config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile, err := filepath.Abs("ipwatcher.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   []string
+		profile string
+		want    []string
+	}{
+		{
+			name:  "relative config is made absolute",
+			flags: []string{"-config", "config.yaml"},
+			want:  []string{"-config", config, "run"},
+		},
+		{
+			name:    "absolute config with a profile",
+			flags:   []string{"-config", config},
+			profile: "home",
+			want:    []string{"-config", config, "-profile", "home", "run"},
+		},
+		{
+			name:  "https config is left unchanged",
+			flags: []string{"-config", "https://config.example.com/ipwatcher.yaml"},
+			want:  []string{"-config", "https://config.example.com/ipwatcher.yaml", "run"},
+		},
+		{
+			name:  "relative log output is made absolute",
+			flags: []string{"-config", config, "-log-format", "json", "-log-output", "ipwatcher.log"},
+			want:  []string{"-config", config, "-log-format", "json", "-log-output", logFile, "run"},
+		},
+		{
+			name:  "log level with module overrides",
+			flags: []string{"-config", config, "-log-level", "info,dnsmanager=debug"},
+			want:  []string{"-config", config, "-log-level", "info,dnsmanager=debug", "run"},
+		},
+		{
+			name:  "log output to stdout",
+			flags: []string{"-config", config, "-log-output", "stdout"},
+			want:  []string{"-config", config, "-log-output", "stdout", "run"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipwatcher.SetGlobalFlags(t, tt.flags...)
+			args, err := ipwatcher.ServiceArgs(tt.profile)
+			if err != nil {
+				t.Fatalf("ServiceArgs failed: %v", err)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// runAsService reports that the daemon does not run under a service manager that needs a
+// handler; systemd and launchd run it like any other process
+func runAsService(run func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
+
+// serviceManager runs a command of the service manager, returning its output in the error
+// when it fails
+func serviceManager(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %v failed: %w: %s", name, args, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
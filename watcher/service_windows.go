@@ -0,0 +1,180 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStopTimeout bounds how long uninstall waits for the running service to stop
+const serviceStopTimeout = 30 * time.Second
+
+// runAsService runs the daemon with run as a Windows service, logging to the event log, when the
+// service control manager started it. It reports false when started from a console.
+func runAsService(run func(ctx context.Context) error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	// The log stays open until the process exits, so the error main logs reaches it too. A
+	// -log-output of the service keeps its log lines where it says.
+	if elog, err := eventlog.Open(serviceName); err == nil && globals.logOutput == "stderr" {
+		logSink.out = eventLogWriter{log: elog}
+	}
+
+	service := &windowsService{run: run}
+	if err := svc.Run(serviceName, service); err != nil {
+		return true, err
+	}
+	return true, service.err
+}
+
+// windowsService answers the service control manager while the daemon runs
+type windowsService struct {
+	run func(ctx context.Context) error
+	err error // Returned by run
+}
+
+// Execute runs the daemon until it fails or the service is stopped, and reports its state to the
+// service control manager. A failure exits with a service-specific code, so the recovery
+// actions restart the service.
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.run(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case s.err = <-done:
+			if s.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				slog.Info("Received a stop request from the service control manager")
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// eventLogWriter writes log lines to the Windows event log, as errors, warnings or information
+// by the level of the line
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch level := lineLevel(msg); {
+	case level >= slog.LevelError:
+		err = w.log.Error(1, msg)
+	case level >= slog.LevelWarn:
+		err = w.log.Warning(1, msg)
+	default:
+		err = w.log.Info(1, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// installService installs the daemon as an automatic Windows service running this executable
+// with args, restarted when it fails, and registers its event log source
+func installService(args []string, start bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed; uninstall it first", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "ipwatcher",
+		Description: "Keeps DNS records in sync with the public IP addresses of this host",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	// Like Restart=on-failure of the systemd unit
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 10 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32(24*time.Hour/time.Second)); err != nil {
+		slog.Warn("Failed to set the recovery actions of the service", "service", serviceName, "error", err)
+	} else if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		slog.Warn("Failed to set the recovery actions of the service", "service", serviceName, "error", err)
+	}
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		slog.Warn("Failed to register the event log source", "source", serviceName, "error", err)
+	}
+	slog.Info("Installed service", "service", serviceName, "command", exe+" "+strings.Join(args, " "))
+
+	if !start {
+		return nil
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service %s: %w", serviceName, err)
+	}
+	slog.Info("Started service", "service", serviceName)
+	return nil
+}
+
+// uninstallService stops the Windows service of the daemon, removes it and its event log source
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if status, err := s.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(serviceStopTimeout)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+		slog.Info("Stopped service", "service", serviceName)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to remove service %s: %w", serviceName, err)
+	}
+	if err := eventlog.Remove(serviceName); err != nil {
+		slog.Warn("Failed to remove the event log source", "source", serviceName, "error", err)
+	}
+	slog.Info("Removed service", "service", serviceName)
+	return nil
+}
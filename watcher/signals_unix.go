@@ -0,0 +1,13 @@
+//go:build !windows
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	syncSignals = []os.Signal{syscall.SIGUSR1} // Force a sync of the running daemon
+	dumpSignals = []os.Signal{syscall.SIGUSR2} // Log the state of the running daemon
+)
@@ -0,0 +1,9 @@
+package watcher
+
+import "os"
+
+// Windows has no user signals; `ipwatcher sync` and `ipwatcher dump` do the same there
+var (
+	syncSignals []os.Signal
+	dumpSignals []os.Signal
+)
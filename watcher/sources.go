@@ -0,0 +1,6 @@
+package watcher
+
+// IP source types beyond the built-in echo endpoints register themselves when imported
+import (
+	_ "github.com/msyrus/ipwatcher/internal/ipfetcher/metadata"
+)
@@ -0,0 +1,217 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/history"
+)
+
+// StateArchive bundles the state files of a daemon, so it can move to another host without
+// losing its history or rechecking every record
+type StateArchive struct {
+	Version    string                     `json:"version"`
+	ExportedAt time.Time                  `json:"exported_at"`
+	Files      map[string]json.RawMessage `json:"files"` // Setting that names the file -> its content
+}
+
+// stateFiles returns the state files set in cfg, by the setting that names them.
+// notifications.state_file is left out, since it tracks the restarts of one host.
+func stateFiles(cfg *config.Config) map[string]string {
+	files := map[string]string{
+		"history_file":      cfg.HistoryFile,
+		"record_cache_file": cfg.RecordCacheFile,
+		"job_queue_file":    cfg.JobQueueFile,
+	}
+	if cfg.Notifications != nil {
+		files["notifications.queue_file"] = cfg.Notifications.QueueFile
+	}
+	for setting, path := range files {
+		if path == "" {
+			delete(files, setting)
+		}
+	}
+	return files
+}
+
+// ExportState reads the state files set in cfg; files that do not exist yet are left out
+func ExportState(cfg *config.Config, now time.Time) (*StateArchive, error) {
+	archive := &StateArchive{Version: version, ExportedAt: now, Files: make(map[string]json.RawMessage)}
+	for setting, path := range stateFiles(cfg) {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%s: %s is not valid JSON", setting, path)
+		}
+		archive.Files[setting] = data
+	}
+	return archive, nil
+}
+
+// ImportState writes the files of archive to the paths set in cfg and returns the settings
+// skipped because cfg leaves them empty. Existing files are only replaced with force; nothing
+// is written when one of them would be.
+func ImportState(cfg *config.Config, archive *StateArchive, force bool) ([]string, error) {
+	files := stateFiles(cfg)
+	var skipped []string
+	for setting := range archive.Files {
+		path, ok := files[setting]
+		if !ok {
+			skipped = append(skipped, setting)
+			continue
+		}
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, fmt.Errorf("%s: %s already exists; use -force to replace it", setting, path)
+		}
+	}
+	slices.Sort(skipped)
+
+	for setting, data := range archive.Files {
+		path, ok := files[setting]
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+	}
+	return skipped, nil
+}
+
+// loadHistory restores the history and the last published IPs from history_file
+func (w *IPWatcher) loadHistory() error {
+	state, err := history.ReadFile(w.config.HistoryFile)
+	if err != nil {
+		return err
+	}
+	w.history.Restore(state)
+	if state.IPv4 != "" {
+		w.currentIPv4.Store(state.IPv4)
+	}
+	if state.IPv6 != "" {
+		w.currentIPv6.Store(state.IPv6)
+	}
+	return nil
+}
+
+// saveHistory writes the history and the current IPs to history_file; failures are logged
+func (w *IPWatcher) saveHistory() {
+	if w.config.HistoryFile == "" {
+		return
+	}
+	state := w.history.State()
+	state.IPv4, _ = w.currentIPv4.Load().(string)
+	state.IPv6, _ = w.currentIPv6.Load().(string)
+	if err := history.WriteFile(w.config.HistoryFile, state); err != nil {
+		slog.Error("Failed to save history", "error", err)
+	}
+}
+
+// runState implements `ipwatcher state export` and `ipwatcher state import`, which move the
+// state files of a daemon to another host
+func runState(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ipwatcher state export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runStateExport(args[1:])
+	case "import":
+		return runStateImport(args[1:])
+	}
+	return fmt.Errorf("unknown state command %q; use export or import", args[0])
+}
+
+func runStateExport(args []string) error {
+	fs := flag.NewFlagSet("state export", flag.ExitOnError)
+	out := fs.String("out", "", "Write the state to this file instead of standard output")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadCommandConfig(*profile)
+	if err != nil {
+		return err
+	}
+	archive, err := ExportState(cfg, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to export state: %w", err)
+	}
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if *out == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	// The record cache and history hold nothing secret, but the notification queue may
+	if err := os.WriteFile(*out, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	fmt.Printf("State with %d files written to %s\n", len(archive.Files), *out)
+	return nil
+}
+
+func runStateImport(args []string) error {
+	fs := flag.NewFlagSet("state import", flag.ExitOnError)
+	force := fs.Bool("force", false, "Replace state files that already exist")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ipwatcher state import [-force] <file>, or - for standard input")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	var archive StateArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	cfg, err := loadCommandConfig(*profile)
+	if err != nil {
+		return err
+	}
+	skipped, err := ImportState(cfg, &archive, *force)
+	if err != nil {
+		return fmt.Errorf("failed to import state: %w", err)
+	}
+	for _, setting := range skipped {
+		fmt.Printf("Skipped %s: not set in this config\n", setting)
+	}
+	fmt.Printf("Imported %d state files\n", len(archive.Files)-len(skipped))
+	return nil
+}
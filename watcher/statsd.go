@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+	"github.com/msyrus/ipwatcher/internal/statsd"
+)
+
+// defaultStatsDPrefix is prepended to the metric names unless statsd.prefix is set
+const defaultStatsDPrefix = "ipwatcher"
+
+// SetStatsD sets the StatsD server the metrics are sent to on every cycle
+func (w *IPWatcher) SetStatsD(client *statsd.Client) {
+	w.statsd = client
+}
+
+// newStatsDClient creates the client of the statsd settings
+func newStatsDClient(s *config.StatsD) (*statsd.Client, error) {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = defaultStatsDPrefix
+	}
+	return statsd.New(s.Address, statsd.Options{Prefix: prefix, DogStatsD: s.DogStatsD, Tags: s.Tags})
+}
+
+// sendStatsD sends the metrics rendered by writeMetrics to the StatsD server. Counters are sent
+// as gauges of their totals, as Prometheus has them, so a restart or reload of the watcher
+// does not skew them. Failures are logged and the metrics are sent again on the next cycle.
+func (w *IPWatcher) sendStatsD(text string) {
+	if err := w.statsd.Send(statsDMetrics(text)); err != nil {
+		slog.Error("Failed to send metrics to StatsD", "error", err)
+	}
+}
+
+// statsDMetrics converts the samples of the text exposition format to StatsD gauges, dropping
+// the ipwatcher_ prefix of the names in favor of statsd.prefix and keeping the labels as tags
+func statsDMetrics(text string) []statsd.Metric {
+	var metrics []statsd.Metric
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, tags, value, ok := parseSample(line)
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, statsd.Metric{
+			Name:  strings.TrimPrefix(name, "ipwatcher_"),
+			Type:  statsd.Gauge,
+			Value: value,
+			Tags:  tags,
+		})
+	}
+	return metrics
+}
+
+// parseSample splits a sample line written by writeMetrics, name{label="value",...} value,
+// undoing the escaping of quote
+func parseSample(line string) (name string, tags []statsd.Tag, value string, ok bool) {
+	i := strings.IndexAny(line, "{ ")
+	if i <= 0 {
+		return "", nil, "", false
+	}
+	name, rest := line[:i], line[i:]
+	if rest[0] == '{' {
+		rest = rest[1:]
+		for !strings.HasPrefix(rest, "}") {
+			key, quoted, found := strings.Cut(rest, `="`)
+			if !found {
+				return "", nil, "", false
+			}
+			var v strings.Builder
+			j := 0
+			for ; j < len(quoted) && quoted[j] != '"'; j++ {
+				if quoted[j] == '\\' && j+1 < len(quoted) {
+					j++
+					if quoted[j] == 'n' {
+						v.WriteByte('\n')
+						continue
+					}
+				}
+				v.WriteByte(quoted[j])
+			}
+			if j == len(quoted) {
+				return "", nil, "", false
+			}
+			tags = append(tags, statsd.Tag{Key: key, Value: v.String()})
+			rest = strings.TrimPrefix(quoted[j+1:], ",")
+		}
+		rest = rest[1:]
+	}
+	value = strings.TrimSpace(rest)
+	return name, tags, value, value != ""
+}
@@ -0,0 +1,270 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+	"github.com/msyrus/ipwatcher/internal/history"
+	"github.com/msyrus/ipwatcher/internal/httpserver"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// Status is the daemon state served at /status
+type Status struct {
+	Version           string                 `json:"version"`
+	Instance          string                 `json:"instance,omitempty"` // owner_id of this instance
+	ReadOnly          bool                   `json:"read_only"`
+	PausedAt          time.Time              `json:"paused_at,omitzero"`
+	IPv4              string                 `json:"ipv4,omitempty"`
+	IPv6              string                 `json:"ipv6,omitempty"`
+	LastChange        time.Time              `json:"last_change,omitzero"` // Start of the latest IP change transaction
+	NextCheck         time.Time              `json:"next_check,omitzero"`  // Next check of the public IPs
+	NextSync          time.Time              `json:"next_sync,omitzero"`   // Next full sync of every record
+	Zones             []ZoneSync             `json:"zones,omitempty"`
+	Channels          map[string]string      `json:"channels,omitempty"` // Channel name -> current address
+	Transactions      []history.Transaction  `json:"transactions"`
+	Drift             []DriftedRecord        `json:"drift,omitempty"` // Only reported in read-only mode
+	Conflicts         []OwnershipConflict    `json:"conflicts,omitempty"`
+	Disagreements     []history.Disagreement `json:"disagreements,omitempty"`
+	Providers         []ProviderStatus       `json:"providers"`
+	RecordFailures    []RecordFailure        `json:"record_failures,omitempty"`
+	Clock             *ClockStatus           `json:"clock,omitempty"`       // Only reported with ntp set
+	Propagation       []PropagationStatus    `json:"propagation,omitempty"` // Only reported with propagation set
+	GlobalPropagation *GlobalPropagation     `json:"global_propagation,omitempty"`
+}
+
+// Status returns a snapshot of the current daemon state
+func (w *IPWatcher) Status() Status {
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+	transactions := w.History()
+	var lastChange time.Time
+	if len(transactions) > 0 {
+		lastChange = transactions[len(transactions)-1].StartedAt
+	}
+	return Status{
+		Version:           version,
+		Instance:          w.config.OwnerID,
+		ReadOnly:          w.config.ReadOnly,
+		PausedAt:          unixNanoTime(w.pausedAt.Load()),
+		IPv4:              ipv4,
+		IPv6:              ipv6,
+		LastChange:        lastChange,
+		NextCheck:         unixNanoTime(w.nextRefresh.Load()),
+		NextSync:          unixNanoTime(w.nextSync.Load()),
+		Zones:             w.ZoneSyncs(),
+		Channels:          w.ChannelIPs(),
+		Transactions:      transactions,
+		Drift:             w.Drift(),
+		Conflicts:         w.Conflicts(),
+		Disagreements:     w.Disagreements(),
+		Providers:         w.Providers(),
+		RecordFailures:    w.RecordFailures(),
+		Clock:             w.Clock(),
+		Propagation:       w.Propagation(),
+		GlobalPropagation: w.GlobalPropagation(),
+	}
+}
+
+// unixNanoTime returns the time of ns nanoseconds since the epoch, or the zero time for 0
+func unixNanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Handler returns the HTTP handler served on the http_listen addresses
+func (w *IPWatcher) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, w.Status(), "status")
+	})
+	w.handleHealth(mux)
+	w.handleAPI(mux)
+	if w.config.Debug != nil {
+		mux.HandleFunc("GET /debug/state", w.serveDebugState)
+	}
+	return mux
+}
+
+// redactedJSON encodes v as JSON with every secret replaced
+func redactedJSON(v any) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(redact.String(string(data))), nil
+}
+
+// writeJSON writes v as a JSON response with every secret replaced; what names it in the log
+func writeJSON(rw http.ResponseWriter, v any, what string) {
+	writeJSONStatus(rw, http.StatusOK, v, what)
+}
+
+// writeJSONStatus is writeJSON with the given status code
+func writeJSONStatus(rw http.ResponseWriter, code int, v any, what string) {
+	data, err := redactedJSON(v)
+	if err != nil {
+		moduleLogger("http").Error("Failed to encode response", "response", what, "error", err)
+		http.Error(rw, "failed to encode "+what, http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if _, err := rw.Write(append(data, '\n')); err != nil {
+		moduleLogger("http").Error("Failed to write response", "response", what, "error", err)
+	}
+}
+
+// runStatus implements `ipwatcher status`, which prints the state of the running daemon: its
+// IPs, when they last changed, the latest sync of every zone and when it checks next
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	socket := socketFlag(fs)
+	url := fs.String("url", "", "Status URL of the daemon, e.g. http://127.0.0.1:9180/status (defaults to the first http_listen address when no control socket is configured)")
+	output := outputFlag(fs, "text")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+
+	client := http.DefaultClient
+	if *socket == "" && *url == "" {
+		cfg, err := loadCommandConfig(*profile)
+		if err != nil {
+			return err
+		}
+		switch {
+		case cfg.ControlSocket != "":
+			*socket = cfg.ControlSocket
+		case len(cfg.HTTPListen) > 0:
+			if client, *url, err = statusClient(cfg.HTTPListen[0]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("neither control_socket nor http_listen is configured; pass -socket or -url or set one in the config file")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var status Status
+	if *socket != "" {
+		if err := control.Call(ctx, *socket, "status", &status); err != nil {
+			return fmt.Errorf("failed to get daemon status: %w", err)
+		}
+	} else if err := getStatus(ctx, client, *url, &status); err != nil {
+		return fmt.Errorf("failed to get daemon status: %w", err)
+	}
+
+	if *output == "json" {
+		return printJSON(status)
+	}
+	writeStatus(os.Stdout, status, time.Now())
+	return nil
+}
+
+// statusClient returns the client and URL that reach the status endpoint served on the
+// http_listen address addr. A wildcard address is reached on the loopback address.
+func statusClient(addr string) (*http.Client, string, error) {
+	return listenerClient(addr, "/status")
+}
+
+// listenerClient returns the client and URL that reach path on the listen address addr
+func listenerClient(addr, path string) (*http.Client, string, error) {
+	network, address, err := httpserver.ParseAddress(addr)
+	if err != nil {
+		return nil, "", err
+	}
+	if network == "unix" {
+		var d net.Dialer
+		transport := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", address)
+		}}
+		return &http.Client{Transport: transport}, "http://localhost" + path, nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, "", err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if network == "tcp6" {
+			host = "::1"
+		}
+	}
+	return http.DefaultClient, "http://" + net.JoinHostPort(host, port) + path, nil
+}
+
+// getStatus fetches the daemon status from its status endpoint at url
+func getStatus(ctx context.Context, client *http.Client, url string, status *Status) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(status)
+}
+
+// writeStatus writes the status as the daemon stood at now, one value per line
+func writeStatus(out io.Writer, s Status, now time.Time) {
+	fmt.Fprintf(out, "IPv4:        %s\n", valueOr(s.IPv4, "none"))
+	fmt.Fprintf(out, "IPv6:        %s\n", valueOr(s.IPv6, "none"))
+	fmt.Fprintf(out, "Last change: %s\n", relativeTime(s.LastChange, now))
+	fmt.Fprintf(out, "Next check:  %s\n", relativeTime(s.NextCheck, now))
+	fmt.Fprintf(out, "Next sync:   %s\n", relativeTime(s.NextSync, now))
+	if s.ReadOnly {
+		fmt.Fprintln(out, "Mode:        read-only")
+	}
+	if !s.PausedAt.IsZero() {
+		fmt.Fprintf(out, "Paused:      %s\n", relativeTime(s.PausedAt, now))
+	}
+	if len(s.Zones) == 0 {
+		fmt.Fprintln(out, "Zones:       none synced yet")
+		return
+	}
+	fmt.Fprintln(out, "Zones:")
+	for _, z := range s.Zones {
+		name := fmt.Sprintf("%s (%s)", z.Zone, z.Provider)
+		if z.Channel != "" {
+			name += " channel " + z.Channel
+		}
+		if z.OK {
+			fmt.Fprintf(out, "  %s: ok %s: %s\n", name, relativeTime(z.Time, now), z.Result)
+		} else {
+			fmt.Fprintf(out, "  %s: failed %s: %s\n", name, relativeTime(z.Time, now), z.Error)
+		}
+	}
+}
+
+// relativeTime formats t with how long before or after now it is
+func relativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := t.Sub(now).Round(time.Second)
+	if d < 0 {
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), -d)
+	}
+	return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), d)
+}
@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/notify"
+	"github.com/msyrus/ipwatcher/internal/schedule"
+)
+
+// Summarizer builds the periodic summary reports of a watcher, each covering the time since
+// the previous one
+type Summarizer struct {
+	w        *IPWatcher
+	started  time.Time
+	since    time.Time
+	failures map[string]int64 // Provider failures already counted by an earlier summary
+}
+
+// NewSummarizer creates a summarizer whose first period starts when the daemon started
+func NewSummarizer(w *IPWatcher, started time.Time) *Summarizer {
+	return &Summarizer{w: w, started: started, since: started, failures: make(map[string]int64)}
+}
+
+// Next returns the summary of the period ending at now and starts the next period.
+// IP changes are counted from the transaction history, which keeps the latest historySize.
+func (s *Summarizer) Next(now time.Time) notify.Summary {
+	status := s.w.Status()
+	summary := notify.Summary{
+		Since:         s.since,
+		UptimeSeconds: int64(now.Sub(s.started).Seconds()),
+		IPv4:          status.IPv4,
+		IPv6:          status.IPv6,
+		Channels:      status.Channels,
+	}
+	for _, tx := range status.Transactions {
+		if !tx.StartedAt.Before(s.since) {
+			summary.IPChanges++
+		}
+	}
+	for _, p := range status.Providers {
+		if failures := p.Failures - s.failures[p.Provider]; failures > 0 {
+			summary.Errors = append(summary.Errors, notify.ProviderErrors{Provider: p.Provider, Failures: failures, LastError: p.LastError})
+		}
+		s.failures[p.Provider] = p.Failures
+	}
+	s.since = now
+	return summary
+}
+
+// SummaryMessage describes a summary in one line, e.g.
+// "up 26h0m0s, 1 IP changes, IPv4 198.51.100.1, no errors"
+func SummaryMessage(s notify.Summary) string {
+	parts := []string{
+		fmt.Sprintf("up %s", (time.Duration(s.UptimeSeconds) * time.Second).String()),
+		fmt.Sprintf("%d IP changes", s.IPChanges),
+	}
+	if s.IPv4 != "" {
+		parts = append(parts, "IPv4 "+s.IPv4)
+	}
+	if s.IPv6 != "" {
+		parts = append(parts, "IPv6 "+s.IPv6)
+	}
+	if len(s.Errors) == 0 {
+		parts = append(parts, "no errors")
+	}
+	for _, e := range s.Errors {
+		parts = append(parts, fmt.Sprintf("%d failures at %s", e.Failures, e.Provider))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// summaries sends a summary report at every time of the notifications' summary_schedule until ctx is done
+func (l *lifecycle) summaries(ctx context.Context, w *IPWatcher) {
+	if l.notifier == nil || l.cfg.SummarySchedule == "" || !l.cfg.Enabled(notify.EventSummary) {
+		return
+	}
+	sched, err := schedule.Parse(l.cfg.SummarySchedule)
+	if err != nil {
+		slog.Warn("Summary reports disabled", "error", err)
+		return
+	}
+
+	s := NewSummarizer(w, time.Now())
+	timer := time.NewTimer(time.Until(sched.Next(time.Now())))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			summary := s.Next(time.Now())
+			l.deliver(notify.Notification{Event: notify.EventSummary, Message: "ipwatcher summary: " + SummaryMessage(summary), Summary: &summary})
+			timer.Reset(time.Until(sched.Next(time.Now())))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package watcher
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/msyrus/ipwatcher/internal/redact"
+	"github.com/msyrus/ipwatcher/internal/sdnotify"
+)
+
+// notifySystemd records that a refresh or sync succeeded, for /readyz, and reports its outcome
+// to systemd when it runs the daemon as a Type=notify service: the current IPs as the status
+// line, and READY=1 once one succeeded, so units ordered after the daemon start with the records
+// in sync
+func (w *IPWatcher) notifySystemd(err error) {
+	first := err == nil && !w.ready.Swap(true)
+	if !sdnotify.Enabled() {
+		return
+	}
+	states := []string{sdnotify.Status(w.systemdStatus(err))}
+	if first {
+		states = append(states, sdnotify.Ready)
+	}
+	w.notifySystemdState(states...)
+}
+
+// notifySystemdPause updates the status line when the daemon is paused or resumed
+func (w *IPWatcher) notifySystemdPause() {
+	if sdnotify.Enabled() {
+		w.notifySystemdState(sdnotify.Status(w.systemdStatus(nil)))
+	}
+}
+
+// notifySystemdState sends states to systemd, logging a failure
+func (w *IPWatcher) notifySystemdState(states ...string) {
+	if err := sdnotify.Notify(states...); err != nil {
+		slog.Error("Failed to notify systemd", "error", err)
+	}
+}
+
+// systemdStatus returns the status line shown by systemctl status after a refresh or sync that
+// returned err
+func (w *IPWatcher) systemdStatus(err error) string {
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+	status := fmt.Sprintf("IPv4 %s, IPv6 %s", valueOr(ipv4, "none"), valueOr(ipv6, "none"))
+	if w.isPaused() {
+		status = "Paused; " + status
+	}
+	if err != nil {
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		status += "; last sync failed: " + redact.String(msg)
+	}
+	return status
+}
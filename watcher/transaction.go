@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+	"github.com/msyrus/ipwatcher/internal/history"
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+)
+
+// historySize is the number of IP change transactions kept in memory
+const historySize = 100
+
+// applyIPChange pushes the current IPs to every configured zone as a single transaction.
+// When rollback_on_failure is enabled and some zones fail, zones that were already
+// updated are reverted to the previous IPs on a best-effort basis so that all
+// records keep pointing at the same address until the next sync retries.
+// Records on channels are not rolled back; their previous address is not kept.
+func (w *IPWatcher) applyIPChange(ctx context.Context, oldIPv4, oldIPv6 string) error {
+	ipv4, _ := w.currentIPv4.Load().(string)
+	ipv6, _ := w.currentIPv6.Load().(string)
+
+	tx := history.Transaction{
+		StartedAt: time.Now(),
+		OldIPv4:   oldIPv4,
+		NewIPv4:   ipv4,
+		OldIPv6:   oldIPv6,
+		NewIPv6:   ipv6,
+		Instance:  w.config.OwnerID,
+	}
+
+	results := w.ensureAllDomains(ctx, ipv4, ipv6, updatePass)
+	for _, r := range results {
+		zr := history.ZoneResult{Zone: r.zone, Provider: r.provider}
+		if r.err != nil {
+			zr.Error = r.err.Error()
+		}
+		tx.Zones = append(tx.Zones, zr)
+	}
+
+	if tx.Failed() && w.config.RollbackOnFailure && !w.config.ReadOnly && !w.config.DryRun {
+		for i, r := range results {
+			if r.err != nil || r.channel != "" {
+				continue
+			}
+			moduleLogger("sync").Info("Rolling back DNS records", "zone", r.zone, "provider", r.provider)
+			if err := w.ensureDomain(ctx, r.zoneTarget, oldIPv4, oldIPv6, rollbackPass); err != nil {
+				continue
+			}
+			tx.Zones[i].RolledBack = true
+		}
+	}
+
+	tx.Finish(time.Now())
+	tx.NTPFinishedAt = w.ntpTime(tx.FinishedAt)
+	tx = w.history.Record(tx)
+	moduleLogger("sync").Info("IP change transaction finished", "transaction", tx.ID, "status", tx.Status, "duration", tx.FinishedAt.Sub(tx.StartedAt))
+	w.saveHistory()
+	w.startPropagation(ctx, results, ipv4, ipv6, tx.FinishedAt)
+
+	return joinZoneErrors(results)
+}
+
+// History returns the recorded IP change transactions, oldest first
+func (w *IPWatcher) History() []history.Transaction {
+	return w.history.List()
+}
+
+// recordDisagreement logs IP sources that returned different addresses, keeps the
+// disagreement in history and alerts clients following the daemon
+func (w *IPWatcher) recordDisagreement(d ipfetcher.Disagreement) {
+	entry := history.Disagreement{
+		Time:   time.Now(),
+		Family: d.Family,
+		Policy: d.Policy,
+		Chosen: d.Chosen,
+	}
+	answers := make([]string, len(d.Answers))
+	for i, a := range d.Answers {
+		entry.Answers = append(entry.Answers, history.Answer{Source: a.Source, IP: a.IP})
+		answers[i] = a.Source + "=" + a.IP
+	}
+	w.history.RecordDisagreement(entry)
+
+	msg := "IP sources disagree on " + d.Family + ": " + strings.Join(answers, ", ")
+	if d.Chosen != "" {
+		msg += "; using " + d.Chosen
+	} else {
+		msg += "; keeping the current address"
+	}
+	moduleLogger("ip").Warn("IP sources disagree", "family", d.Family, "answers", strings.Join(answers, ", "), "ip", d.Chosen)
+	w.events.Publish(control.Event{Kind: control.KindDisagreement, Message: msg})
+}
+
+// Disagreements returns the recorded IP source disagreements, oldest first
+func (w *IPWatcher) Disagreements() []history.Disagreement {
+	return w.history.Disagreements()
+}
@@ -0,0 +1,274 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/msyrus/ipwatcher/internal/config"
+)
+
+// ValidateReport is the output of `ipwatcher validate -output json`
+type ValidateReport struct {
+	ConfigFile string            `json:"config_file"`
+	Valid      bool              `json:"valid"`
+	Error      string            `json:"error,omitempty"`
+	Problems   []ValidateProblem `json:"problems,omitempty"` // Why the config failed to load
+	Warnings   []ValidateWarning `json:"warnings,omitempty"` // With -lint
+	Checks     []ValidateCheck   `json:"checks,omitempty"`   // With -online
+	Plans      []ValidatePlan    `json:"plans,omitempty"`    // With -deep
+}
+
+// ValidateProblem is a validation problem of a config, located in its file where known
+type ValidateProblem struct {
+	Profile string `json:"profile,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"` // Config path of the value, e.g. domains[0].records[1].type
+	Message string `json:"message"`
+}
+
+// ValidateWarning is a lint warning of a config
+type ValidateWarning struct {
+	Profile string `json:"profile,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidateCheck is one check of a config against the live providers
+type ValidateCheck struct {
+	Profile string `json:"profile,omitempty"`
+	Check   string `json:"check"`
+	Passed  bool   `json:"passed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ValidatePlan is the changes a sync with a config would make
+type ValidatePlan struct {
+	Profile string     `json:"profile,omitempty"`
+	Zones   []ZonePlan `json:"zones"`
+	Error   string     `json:"error,omitempty"` // Zones that failed to plan
+}
+
+// validation is one run of `ipwatcher validate`. Text goes to out and errOut as it is found;
+// with -output json both are discarded and the report is printed at the end instead.
+type validation struct {
+	configFile string
+	out        io.Writer
+	errOut     io.Writer
+	report     ValidateReport
+}
+
+// runValidate implements `ipwatcher validate`, which checks a config file without starting the daemon
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	lint := fs.Bool("lint", false, "Also warn about settings that are valid but probably not intended")
+	online := fs.Bool("online", false, "Also check credentials and zone access with the live providers")
+	deep := fs.Bool("deep", false, "With --online, also list every record change a sync would make, without making it")
+	output := outputFlag(fs, "text")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+	if *deep && !*online {
+		return fmt.Errorf("--deep needs --online")
+	}
+
+	configFile := fs.Arg(0)
+	if configFile == "" {
+		configFile = globals.config
+	}
+
+	v := &validation{configFile: configFile, out: os.Stdout, errOut: os.Stderr}
+	if *output == "json" {
+		v.out, v.errOut = io.Discard, io.Discard
+	}
+	v.report.ConfigFile = configFile
+	err := v.run(context.Background(), *profile, *lint, *online, *deep)
+	if *output == "json" {
+		v.report.Valid = err == nil
+		if err != nil {
+			v.report.Error = err.Error()
+		}
+		if err := printJSON(v.report); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// run checks the config file with profile, or with every profile when it is empty
+func (v *validation) run(ctx context.Context, profile string, lint, online, deep bool) error {
+	cfg, err := config.LoadConfigProfile(v.configFile, profile)
+	if err != nil {
+		return v.invalidConfig("", err)
+	}
+	configs := []*config.Config{cfg}
+
+	// Without a selected profile, every profile is checked, so a broken one is found before it is deployed
+	if profile == "" {
+		for _, name := range cfg.ProfileNames() {
+			if name == cfg.Profile {
+				continue
+			}
+			profileCfg, err := config.LoadConfigProfile(v.configFile, name)
+			if err != nil {
+				return v.invalidConfig(name, err)
+			}
+			configs = append(configs, profileCfg)
+		}
+	}
+
+	for _, cfg := range configs {
+		if err := checkSourceTypes(cfg); err != nil {
+			v.report.Problems = append(v.report.Problems, ValidateProblem{Profile: cfg.Profile, Message: err.Error()})
+			return fmt.Errorf("%s: %w", v.configFile, err)
+		}
+	}
+
+	if lint {
+		var count int
+		for _, cfg := range configs {
+			for _, w := range cfg.Lint() {
+				v.report.Warnings = append(v.report.Warnings, ValidateWarning{Profile: cfg.Profile, Message: w})
+				if cfg.Profile != "" {
+					w = "profile " + cfg.Profile + ": " + w
+				}
+				fmt.Fprintf(v.out, "warning: %s\n", w)
+				count++
+			}
+		}
+		if count > 0 {
+			return fmt.Errorf("%s: %d lint warnings", v.configFile, count)
+		}
+	}
+
+	if online {
+		var failed int
+		for _, cfg := range configs {
+			if err := v.online(ctx, cfg, deep); err != nil {
+				if cfg.Profile != "" {
+					err = fmt.Errorf("profile %s: %w", cfg.Profile, err)
+				}
+				fmt.Fprintf(v.errOut, "error: %v\n", err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%s: online checks failed for %d of %d configs", v.configFile, failed, len(configs))
+		}
+	}
+
+	fmt.Fprintf(v.out, "%s is valid\n", v.configFile)
+	return nil
+}
+
+// online checks cfg against the live providers and prints a pass/fail line per check:
+// credentials, zone lookups, read access to the records, and that every record name belongs to
+// its zone. Any failed check fails it, including ones the daemon would retry at startup. With
+// deep, it also plans a full sync for the current IPs and prints every change it would make.
+// Nothing is changed: the watcher is read-only and only plans.
+func (v *validation) online(ctx context.Context, cfg *config.Config, deep bool) error {
+	cfg.ReadOnly = true
+	watcher, err := newConfigWatcher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	name := "config"
+	if cfg.Profile != "" {
+		name = "profile " + cfg.Profile
+	}
+	fmt.Fprintf(v.out, "%s:\n", name)
+	var failed int
+	checks := watcher.preflightChecks(ctx, true)
+	for _, c := range checks {
+		check := ValidateCheck{Profile: cfg.Profile, Check: c.what, Passed: c.err == nil}
+		if c.err != nil {
+			check.Error = c.err.Error()
+			fmt.Fprintf(v.out, "  FAIL %s: %v\n", c.what, c.err)
+			failed++
+		} else {
+			fmt.Fprintf(v.out, "  PASS %s\n", c.what)
+		}
+		v.report.Checks = append(v.report.Checks, check)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %s failed", failed, plural(len(checks), "check"))
+	}
+	if !deep {
+		return nil
+	}
+
+	plan, err := watcher.Plan(ctx)
+	if plan == nil {
+		return err
+	}
+	report := ValidatePlan{Profile: cfg.Profile, Zones: plan.Zones}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	v.report.Plans = append(v.report.Plans, report)
+
+	var changes int
+	for _, zp := range plan.Zones {
+		writeZonePlan(v.out, zp)
+		changes += len(zp.Changes)
+	}
+	if changes == 0 {
+		fmt.Fprintf(v.out, "%s: records are up to date\n", name)
+	} else {
+		fmt.Fprintf(v.out, "%s: a sync would make %s in %s\n", name, plural(changes, "change"), plural(len(plan.Zones), "zone"))
+	}
+	return err
+}
+
+// invalidConfig reports why the config file failed to load with profile. Validation problems
+// are printed one per line, already located in their files, and summed up in the returned error.
+func (v *validation) invalidConfig(profile string, err error) error {
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		v.report.Problems = append(v.report.Problems, ValidateProblem{Profile: profile, Message: err.Error()})
+		if profile != "" {
+			return fmt.Errorf("%s: profile %s: %w", v.configFile, profile, err)
+		}
+		return fmt.Errorf("%s: %w", v.configFile, err)
+	}
+
+	for _, p := range verr.Problems {
+		v.report.Problems = append(v.report.Problems, ValidateProblem{
+			Profile: profile,
+			File:    p.File,
+			Line:    p.Line,
+			Column:  p.Column,
+			Path:    p.Path,
+			Message: p.Err.Error(),
+		})
+		msg := p.Error()
+		if p.Line == 0 {
+			msg = v.configFile + ": " + msg
+		}
+		if profile != "" {
+			msg += " (profile " + profile + ")"
+		}
+		fmt.Fprintln(v.errOut, msg)
+	}
+	if len(verr.Problems) == 1 {
+		return fmt.Errorf("%s is invalid", v.configFile)
+	}
+	return fmt.Errorf("%s is invalid: %d problems", v.configFile, len(verr.Problems))
+}
+
+// plural returns n with noun, adding an s unless n is 1
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+)
+
+// syncPass describes how a round of DNS updates is reported and which records it covers
+type syncPass struct {
+	failMsg   string
+	okMsg     string
+	deltaOnly bool // Skip records already verified with the expected content
+	resolve   bool // Skip records whose live DNS answers match, in zones with verify: resolver
+	cached    bool // Write from the provider's record state cache instead of listing the zone
+}
+
+var (
+	updatePass      = syncPass{failMsg: "Failed to ensure DNS records", okMsg: "updated successfully", cached: true}
+	verifyPass      = syncPass{failMsg: "Failed to verify/update DNS records", okMsg: "are up-to-date", resolve: true}
+	deltaVerifyPass = syncPass{failMsg: "Failed to verify/update DNS records", okMsg: "are up-to-date", deltaOnly: true, resolve: true}
+	rollbackPass    = syncPass{failMsg: "Failed to roll back DNS records", okMsg: "rolled back"}
+	shutdownPass    = syncPass{failMsg: "Failed to sync DNS records before shutdown", okMsg: "synced before shutdown", deltaOnly: true, cached: true}
+)
+
+// auditDue reports whether the next verification must cover every record, and if so
+// records now as the time of the last full audit
+func (w *IPWatcher) auditDue(now time.Time) bool {
+	if w.config.AuditRate <= 0 {
+		return true
+	}
+
+	interval := time.Duration(float64(time.Hour) / w.config.AuditRate)
+	last := w.lastAudit.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < interval {
+		return false
+	}
+
+	w.lastAudit.Store(now.UnixNano())
+	return true
+}
+
+// expectedContent returns the content a record should have for the given IPs
+func expectedContent(r dnsmanager.DNSRecord, ipv4, ipv6 string) string {
+	switch r.Type {
+	case dnsmanager.ARecord:
+		return ipv4
+	case dnsmanager.AAAARecord:
+		return ipv6
+	case dnsmanager.CNAMERecord:
+		return strings.TrimSuffix(r.Target, ".")
+	case dnsmanager.TXTRecord:
+		return r.Target
+	}
+	return ""
+}
+
+func verifiedKey(t zoneTarget, r dnsmanager.DNSRecord) string {
+	return t.key + "|" + r.FQDN() + "|" + r.Type.String()
+}
+
+// staleRecords returns the records of t not yet verified with their expected content
+func (w *IPWatcher) staleRecords(t zoneTarget, ipv4, ipv6 string) []dnsmanager.DNSRecord {
+	var stale []dnsmanager.DNSRecord
+	for _, r := range t.records {
+		content := expectedContent(r, ipv4, ipv6)
+		if content == "" {
+			continue
+		}
+		if last, ok := w.verified.Load(verifiedKey(t, r)); ok && last.(string) == content {
+			continue
+		}
+		stale = append(stale, r)
+	}
+	return stale
+}
+
+// markVerified remembers that the records of t hold the expected content. Records held back by
+// create_after may not exist yet, so they are checked again by the next sync.
+func (w *IPWatcher) markVerified(t zoneTarget, ipv4, ipv6 string) {
+	for _, r := range t.records {
+		if r.NoCreate {
+			continue
+		}
+		if content := expectedContent(r, ipv4, ipv6); content != "" {
+			w.verified.Store(verifiedKey(t, r), content)
+		}
+	}
+}
+
+// forgetVerified drops the verified state of t so the next sync checks it again
+func (w *IPWatcher) forgetVerified(t zoneTarget) {
+	for _, r := range t.records {
+		w.verified.Delete(verifiedKey(t, r))
+	}
+}
+
+// Resolver answers the live DNS queries of zones with verify: resolver; *net.Resolver implements it
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// SetResolver sets the resolver used to verify zones with verify: resolver
+func (w *IPWatcher) SetResolver(r Resolver) {
+	w.resolver = r
+}
+
+// unresolvedRecords returns the records of t whose live DNS answers do not show the expected
+// content. Proxied records answer with the proxy's addresses, so they are always returned.
+func (w *IPWatcher) unresolvedRecords(ctx context.Context, t zoneTarget, ipv4, ipv6 string) []dnsmanager.DNSRecord {
+	var unresolved []dnsmanager.DNSRecord
+	for _, r := range t.records {
+		content := expectedContent(r, ipv4, ipv6)
+		if content == "" {
+			continue
+		}
+		if r.Proxied || !w.resolves(ctx, r, content) {
+			unresolved = append(unresolved, r)
+		}
+	}
+	return unresolved
+}
+
+// resolves reports whether the live answers for r show exactly content; lookup errors count as a mismatch
+func (w *IPWatcher) resolves(ctx context.Context, r dnsmanager.DNSRecord, content string) bool {
+	return resolvesWith(ctx, w.resolver, r, content)
+}
+
+// resolvesWith reports whether resolver answers r with exactly content
+func resolvesWith(ctx context.Context, resolver Resolver, r dnsmanager.DNSRecord, content string) bool {
+	switch r.Type {
+	case dnsmanager.ARecord, dnsmanager.AAAARecord:
+		network := "ip4"
+		if r.Type == dnsmanager.AAAARecord {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, r.FQDN())
+		return err == nil && len(ips) == 1 && ips[0].Equal(net.ParseIP(content))
+	case dnsmanager.CNAMERecord:
+		cname, err := resolver.LookupCNAME(ctx, r.FQDN())
+		return err == nil && strings.EqualFold(strings.TrimSuffix(cname, "."), content)
+	case dnsmanager.TXTRecord:
+		txts, err := resolver.LookupTXT(ctx, r.FQDN())
+		return err == nil && slices.Contains(txts, content)
+	}
+	return false
+}
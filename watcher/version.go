@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/ipfetcher"
+)
+
+// Build metadata, set at build time via
+// -ldflags "-X github.com/msyrus/ipwatcher/watcher.version=vX.Y.Z" and likewise commit and
+// buildDate, an RFC 3339 time.
+// commit and buildDate fall back to what the Go toolchain stamped from the checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+func init() {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				commit = s.Value
+			case s.Key == "vcs.time" && buildDate == "":
+				buildDate = s.Value
+			}
+		}
+	}
+
+	// Providers and IP sources see which release is calling them
+	dnsmanager.UserAgent = userAgent()
+	ipfetcher.UserAgent = userAgent()
+}
+
+// userAgent returns the User-Agent sent with requests to Cloudflare and the IP sources
+func userAgent() string {
+	return "ipwatcher/" + version + " (+https://github.com/msyrus/ipwatcher)"
+}
+
+// runVersion implements `ipwatcher version`, which prints the build metadata
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+
+	fmt.Printf("ipwatcher %s\n", version)
+	fmt.Printf("  commit:   %s\n", valueOr(commit, "unknown"))
+	fmt.Printf("  built:    %s\n", valueOr(buildDate, "unknown"))
+	fmt.Printf("  go:       %s\n", runtime.Version())
+	fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
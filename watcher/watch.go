@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/msyrus/ipwatcher/internal/control"
+)
+
+// runWatch implements `ipwatcher watch`, which follows the events of a running daemon
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	socket := socketFlag(fs)
+	zone := fs.String("zone", "", "Only show events for this zone")
+	record := fs.String("record", "", "Only show events for this fully qualified record name")
+	profile := profileFlag(fs)
+	if err := parseCommand(fs, args); err != nil {
+		return err
+	}
+
+	path, err := controlSocket(*socket, *profile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	filter := control.Filter{Zone: *zone, Record: *record}
+	return control.Watch(ctx, path, filter, func(e control.Event) error {
+		fmt.Println(formatEvent(e))
+		return nil
+	})
+}
+
+// formatEvent renders an event as a single human-readable line
+func formatEvent(e control.Event) string {
+	if e.Kind == control.KindLog {
+		return e.Message
+	}
+
+	line := fmt.Sprintf("%s %s %s (%s): %s", e.Time.Format("2006/01/02 15:04:05"), e.Kind, e.Zone, e.Provider, e.Message)
+	if e.Zone == "" {
+		line = fmt.Sprintf("%s %s: %s", e.Time.Format("2006/01/02 15:04:05"), e.Kind, e.Message)
+	}
+	if len(e.Records) > 0 {
+		line += " [" + strings.Join(e.Records, ", ") + "]"
+	}
+	if e.Error != "" {
+		line += ": " + e.Error
+	}
+	return line
+}
@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"sort"
+	"time"
+
+	"github.com/msyrus/ipwatcher/internal/dnsmanager"
+	"github.com/msyrus/ipwatcher/internal/redact"
+)
+
+// ZoneSync is the outcome of the latest sync of one zone on one provider
+type ZoneSync struct {
+	Zone         string    `json:"zone"`
+	Provider     string    `json:"provider"` // Provider key, as in ProviderStatus
+	Channel      string    `json:"channel,omitempty"`
+	Time         time.Time `json:"time"`
+	OK           bool      `json:"ok"`
+	Result       string    `json:"result,omitempty"` // Record counts, e.g. created 0, updated 1, skipped 2, failed 0
+	Error        string    `json:"error,omitempty"`
+	FailingSince time.Time `json:"failing_since,omitzero"` // First of the failed syncs in a row
+}
+
+// trackZoneSync records the outcome of a sync of t
+func (w *IPWatcher) trackZoneSync(t zoneTarget, result dnsmanager.Result, err error) {
+	key := t.key + "|" + t.zone + "|" + t.channel
+	s := ZoneSync{Zone: t.zone, Provider: t.key, Channel: t.channel, Time: time.Now(), OK: err == nil}
+	if err != nil {
+		s.Error = redact.String(err.Error())
+		s.FailingSince = s.Time
+		if prev, ok := w.zoneSyncs.Load(key); ok && !prev.(ZoneSync).OK {
+			s.FailingSince = prev.(ZoneSync).FailingSince
+		}
+	} else {
+		s.Result = result.String()
+	}
+	w.zoneSyncs.Store(key, s)
+}
+
+// ZoneSyncs returns the latest sync of every zone synced since the start, sorted by zone and provider
+func (w *IPWatcher) ZoneSyncs() []ZoneSync {
+	var syncs []ZoneSync
+	w.zoneSyncs.Range(func(_, v any) bool {
+		syncs = append(syncs, v.(ZoneSync))
+		return true
+	})
+	sort.Slice(syncs, func(i, j int) bool {
+		a, b := syncs[i], syncs[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Channel < b.Channel
+	})
+	return syncs
+}